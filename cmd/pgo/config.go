@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/edgeflare/pgo/pkg/config"
+	"github.com/edgeflare/pgo/pkg/pipeline"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the config file",
+	// the config is loaded by the subcommands, which report its errors
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the config file and print the effective config",
+	Long: `Validate the config file: peers, pipelines and their transformations, and the rest section including
+its auth settings. ${VAR} placeholders are replaced with environment variables, whose absence is an error.
+
+On success, the effective config is printed as YAML, with placeholders resolved. Otherwise every problem is
+printed with its line and field, and the command exits with status 1, e.g. to gate config changes in CI:
+
+  pgo config validate --config pgo.yaml --quiet`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, file, err := config.ValidateFile(cfgFile, pipeline.Connectors())
+		if err != nil {
+			return err
+		}
+		if file == "" {
+			return fmt.Errorf("no config file found; use --config or $HOME/.config/pgo.yaml")
+		}
+		if quiet, _ := cmd.Flags().GetBool("quiet"); quiet {
+			return nil
+		}
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(cfg)
+	},
+}
+
+func init() {
+	configValidateCmd.Flags().BoolP("quiet", "q", false, "print only errors")
+
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -16,6 +16,9 @@ var rootCmd = &cobra.Command{
 	Use:   "pgo",
 	Short: "PGO is a PostgreSQL CDC tool",
 	Long:  `PGO is a PostgreSQL Change Data Capture (CDC) tool that replicates data changes to various destinations.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initConfig()
+	},
 }
 
 func Execute() {
@@ -26,17 +29,18 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/pgo.yaml)")
+	rootCmd.PersistentFlags().String("postgres.conn_string", "", "PostgreSQL connection string")
 	rootCmd.PersistentFlags().String("postgres.logrepl_conn_string", "", "PostgreSQL logical replication connection string")
 	rootCmd.PersistentFlags().String("postgres.tables", "", "Comma-separated list of tables to replicate")
 
+	viper.BindPFlag("postgres.conn_string", rootCmd.PersistentFlags().Lookup("postgres.conn_string"))
 	viper.BindPFlag("postgres.logrepl_conn_string", rootCmd.PersistentFlags().Lookup("postgres.logrepl_conn_string"))
 	viper.BindPFlag("postgres.tables", rootCmd.PersistentFlags().Lookup("postgres.tables"))
 
 	// Add the pipeline subcommand
 	rootCmd.AddCommand(pipelineCmd)
+	rootCmd.AddCommand(cdcCmd)
 }
 
 func initConfig() {
@@ -1,41 +1,62 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
 
 	"github.com/edgeflare/pgo/pkg/pipeline/transform"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Peers     []Peer           `mapstructure:"peers"`
-	Pipelines []PipelineConfig `mapstructure:"pipelines"`
+	Peers     []Peer           `mapstructure:"peers" yaml:"peers,omitempty"`
+	Pipelines []PipelineConfig `mapstructure:"pipelines" yaml:"pipelines,omitempty"`
 }
 
 type Peer struct {
-	Name      string                 `mapstructure:"name"`
-	Connector string                 `mapstructure:"connector"`
-	Config    map[string]interface{} `mapstructure:"config"`
+	Name      string                 `mapstructure:"name" yaml:"name,omitempty"`
+	Connector string                 `mapstructure:"connector" yaml:"connector,omitempty"`
+	Config    map[string]interface{} `mapstructure:"config" yaml:"config,omitempty"`
 }
 
 type PipelineConfig struct {
-	Name            string                      `mapstructure:"name"`
-	Sources         []SourceConfig              `mapstructure:"sources"`
-	Sinks           []SinkConfig                `mapstructure:"sinks"`
-	Transformations []transform.TransformConfig `mapstructure:"transformations"`
+	Name            string                      `mapstructure:"name" yaml:"name,omitempty"`
+	Sources         []SourceConfig              `mapstructure:"sources" yaml:"sources,omitempty"`
+	Sinks           []SinkConfig                `mapstructure:"sinks" yaml:"sinks,omitempty"`
+	Transformations []transform.TransformConfig `mapstructure:"transformations" yaml:"transformations,omitempty"`
 }
 
 type SourceConfig struct {
-	Name            string                      `mapstructure:"name"`
-	Transformations []transform.TransformConfig `mapstructure:"transformations"`
+	Name            string                      `mapstructure:"name" yaml:"name,omitempty"`
+	Transformations []transform.TransformConfig `mapstructure:"transformations" yaml:"transformations,omitempty"`
 }
 
 type SinkConfig struct {
-	Name            string                      `mapstructure:"name"`
-	Transformations []transform.TransformConfig `mapstructure:"transformations"`
+	Name            string                      `mapstructure:"name" yaml:"name,omitempty"`
+	Transformations []transform.TransformConfig `mapstructure:"transformations" yaml:"transformations,omitempty"`
 }
 
+// LoadConfig loads cfgFile with Load, printing the path of the file used to stderr, keeping stdout for
+// the output of commands, e.g. the effective config of pgo config validate.
 func LoadConfig(cfgFile string) (*Config, error) {
+	cfg, file, err := Load(cfgFile)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		fmt.Fprintln(os.Stderr, "Using config file:", file)
+	}
+	return cfg, nil
+}
+
+// Load reads cfgFile, or pgo.yaml in $HOME/.config or the working directory if it's empty, replacing ${VAR}
+// placeholders with the values of environment variables. It returns the path of the file read, empty if
+// none was found. Placeholders of unset variables are replaced with empty strings, and returned as errors
+// along with the config.
+func Load(cfgFile string) (*Config, string, error) {
 	v := viper.New()
 	if cfgFile != "" {
 		v.SetConfigFile(cfgFile)
@@ -49,20 +70,56 @@ func LoadConfig(cfgFile string) (*Config, error) {
 	v.AutomaticEnv()
 	v.SetEnvPrefix("PGO")
 
+	var expandErr error
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("error reading config file: %w", err)
+			return nil, v.ConfigFileUsed(), fmt.Errorf("error reading config file: %w", err)
 		}
 	} else {
-		fmt.Println("Using config file:", v.ConfigFileUsed())
+		data, err := os.ReadFile(v.ConfigFileUsed())
+		if err != nil {
+			return nil, v.ConfigFileUsed(), fmt.Errorf("error reading config file: %w", err)
+		}
+		expanded, err := expandEnv(data)
+		if err != nil {
+			expandErr = err
+		}
+		if err := v.ReadConfig(bytes.NewReader(expanded)); err != nil {
+			return nil, v.ConfigFileUsed(), fmt.Errorf("error reading config file: %w", err)
+		}
 	}
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("unable to decode into config struct: %w", err)
+		return nil, v.ConfigFileUsed(), fmt.Errorf("unable to decode into config struct: %w", err)
 	}
 
-	return &cfg, nil
+	return &cfg, v.ConfigFileUsed(), expandErr
+}
+
+// placeholderPattern matches ${VAR} placeholders. $VAR isn't expanded, as it's used by values such as the
+// replacements of the replace transformation.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${VAR} placeholders of data with the values of environment variables. Placeholders
+// of unset variables are returned as ValidationErrors.
+func expandEnv(data []byte) ([]byte, error) {
+	var expanded bytes.Buffer
+	var errs []error
+	last := 0
+	for _, m := range placeholderPattern.FindAllSubmatchIndex(data, -1) {
+		name := string(data[m[2]:m[3]])
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			line := bytes.Count(data[:m[0]], []byte("\n")) + 1
+			errs = append(errs, &ValidationError{Line: line, Message: fmt.Sprintf("environment variable %s is not set", name)})
+		}
+		expanded.Write(data[last:m[0]])
+		expanded.WriteString(value)
+		last = m[1]
+	}
+	expanded.Write(data[last:])
+	return expanded.Bytes(), errors.Join(errs...)
 }
 
 // Helper functions to look up configurations
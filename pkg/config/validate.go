@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/edgeflare/pgo/pkg/pipeline/transform"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem with a field of a config file.
+type ValidationError struct {
+	// File is the path of the config file, empty if unknown
+	File string
+	// Line is the line of the field in the config file, 0 if unknown
+	Line int
+	// Field is the path of the field, e.g. pipelines[0].sinks[1].name, empty if the problem isn't one of a
+	// field
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	if e.File != "" {
+		sb.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "%d:", e.Line)
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(" ")
+	}
+	if e.Field != "" {
+		sb.WriteString(e.Field + ": ")
+	}
+	sb.WriteString(e.Message)
+	return sb.String()
+}
+
+// ValidateFile loads cfgFile with Load and validates it with Validate, returning the config and the path of
+// the file read. The ValidationErrors of the error returned have the file and, where known, the line of the
+// field.
+func ValidateFile(cfgFile string, connectors []string) (*Config, string, error) {
+	cfg, file, err := Load(cfgFile)
+	if cfg != nil {
+		err = errors.Join(err, cfg.Validate(connectors))
+	}
+	if file == "" {
+		return cfg, file, err
+	}
+
+	errs := flatten(err)
+	data, readErr := os.ReadFile(file)
+	if readErr != nil {
+		return cfg, file, err
+	}
+	lines := fieldLines(data)
+	for _, e := range errs {
+		var verr *ValidationError
+		if errors.As(e, &verr) {
+			verr.File = file
+			if verr.Line == 0 {
+				verr.Line = lines.find(verr.Field)
+			}
+		}
+	}
+	return cfg, file, errors.Join(errs...)
+}
+
+// flatten returns the errors joined in err, recursively.
+func flatten(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, flatten(e)...)
+		}
+		return errs
+	}
+	if err == nil {
+		return nil
+	}
+	return []error{err}
+}
+
+// Validate returns the problems of the config as ValidationErrors joined with errors.Join:
+//   - peers without a name or connector, with a duplicate name, or whose connector isn't one of connectors,
+//     unless connectors is nil
+//   - pipelines without a name, sources or sinks, with a duplicate name, or whose sources and sinks aren't
+//     peers
+//   - transformations of unknown types or with invalid configs
+func (c *Config) Validate(connectors []string) error {
+	var errs []error
+	add := func(field, format string, args ...any) {
+		errs = append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	peers := make(map[string]string)
+	for i, peer := range c.Peers {
+		field := fmt.Sprintf("peers[%d]", i)
+		switch other, dup := peers[peer.Name]; {
+		case peer.Name == "":
+			add(field+".name", "is required")
+		case dup:
+			add(field+".name", "duplicate peer %q, also %s", peer.Name, other)
+		default:
+			peers[peer.Name] = field
+		}
+		switch {
+		case peer.Connector == "":
+			add(field+".connector", "is required")
+		case connectors != nil && !slices.Contains(connectors, peer.Connector):
+			add(field+".connector", "unknown connector %q, expected one of %s", peer.Connector, strings.Join(connectors, ", "))
+		}
+	}
+
+	pipelines := make(map[string]string)
+	for i, pl := range c.Pipelines {
+		field := fmt.Sprintf("pipelines[%d]", i)
+		switch other, dup := pipelines[pl.Name]; {
+		case pl.Name == "":
+			add(field+".name", "is required")
+		case dup:
+			add(field+".name", "duplicate pipeline %q, also %s", pl.Name, other)
+		default:
+			pipelines[pl.Name] = field
+		}
+		if len(pl.Sources) == 0 {
+			add(field+".sources", "at least one source is required")
+		}
+		if len(pl.Sinks) == 0 {
+			add(field+".sinks", "at least one sink is required")
+		}
+		for j, source := range pl.Sources {
+			sourceField := fmt.Sprintf("%s.sources[%d]", field, j)
+			if _, ok := peers[source.Name]; !ok {
+				add(sourceField+".name", "peer %q is not defined", source.Name)
+			}
+			errs = append(errs, validateTransformations(sourceField, source.Transformations)...)
+		}
+		for j, sink := range pl.Sinks {
+			sinkField := fmt.Sprintf("%s.sinks[%d]", field, j)
+			if _, ok := peers[sink.Name]; !ok {
+				add(sinkField+".name", "peer %q is not defined", sink.Name)
+			}
+			errs = append(errs, validateTransformations(sinkField, sink.Transformations)...)
+		}
+		errs = append(errs, validateTransformations(field, pl.Transformations)...)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateTransformations returns the problems of the transformations of the config at field.
+func validateTransformations(field string, transformations []transform.TransformConfig) []error {
+	var errs []error
+	for i, t := range transformations {
+		tField := fmt.Sprintf("%s.transformations[%d]", field, i)
+		cfg, err := t.ToTransformConfig()
+		if err != nil {
+			errs = append(errs, &ValidationError{Field: tField + ".type", Message: err.Error()})
+			continue
+		}
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, &ValidationError{Field: tField + ".config", Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// lineIndex maps the lowercased paths of the fields of a YAML document, e.g. pipelines[0].sinks[1].name, to
+// their lines.
+type lineIndex map[string]int
+
+// fieldLines returns the lines of the fields of the YAML document data.
+func fieldLines(data []byte) lineIndex {
+	var doc yaml.Node
+	lines := make(lineIndex)
+	if err := yaml.Unmarshal(data, &doc); err == nil {
+		lines.add(&doc, "")
+	}
+	return lines
+}
+
+func (l lineIndex) add(node *yaml.Node, field string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			l.add(child, field)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := strings.ToLower(node.Content[i].Value)
+			if field != "" {
+				key = field + "." + key
+			}
+			l[key] = node.Content[i].Line
+			l.add(node.Content[i+1], key)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			key := fmt.Sprintf("%s[%d]", field, i)
+			l[key] = item.Line
+			l.add(item, key)
+		}
+	}
+}
+
+// find returns the line of field or, for fields missing from the document, of its nearest parent present, or
+// 0 if none is.
+func (l lineIndex) find(field string) int {
+	field = strings.ToLower(field)
+	for field != "" {
+		if line, ok := l[field]; ok {
+			return line
+		}
+		field = field[:max(strings.LastIndexAny(field, ".["), 0)]
+	}
+	return 0
+}
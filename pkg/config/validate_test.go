@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		Peers: []Peer{{Name: "pg", Connector: "postgres"}, {Name: "pg", Connector: "smtp"}},
+		Pipelines: []PipelineConfig{{
+			Name:    "p",
+			Sources: []SourceConfig{{Name: "pg"}},
+			Sinks:   []SinkConfig{{Name: "missing"}},
+		}},
+	}
+
+	var fields []string
+	for _, err := range flatten(cfg.Validate([]string{"debug", "postgres"})) {
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("error %v isn't a ValidationError", err)
+		}
+		fields = append(fields, verr.Field)
+	}
+	expected := []string{"peers[1].name", "peers[1].connector", "pipelines[0].sinks[0].name"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Validate() fields = %v, want %v", fields, expected)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("Validate() fields = %v, want %v", fields, expected)
+			break
+		}
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pgo.yaml")
+	data := `peers:
+- name: pg
+  connector: postgres
+  config:
+    connString: ${PGO_VALIDATE_TEST_CONN}
+pipelines:
+- name: p
+  sources:
+  - name: pg
+`
+	if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := ValidateFile(file, nil)
+	errs := flatten(err)
+	if len(errs) != 2 {
+		t.Fatalf("ValidateFile() = %v, want 2 errors", err)
+	}
+	if got := errs[0].Error(); got != file+":5: environment variable PGO_VALIDATE_TEST_CONN is not set" {
+		t.Errorf("ValidateFile() error = %q", got)
+	}
+	// missing fields are reported at their parent
+	if got := errs[1].Error(); got != file+":7: pipelines[0].sinks: at least one sink is required" {
+		t.Errorf("ValidateFile() error = %q", got)
+	}
+
+	t.Setenv("PGO_VALIDATE_TEST_CONN", "host=localhost")
+	cfg, _, err := ValidateFile(file, nil)
+	if len(flatten(err)) != 1 {
+		t.Errorf("ValidateFile() = %v, want 1 error", err)
+	}
+	if got := cfg.Peers[0].Config["connstring"]; got != "host=localhost" {
+		t.Errorf("connString = %v, want host=localhost", got)
+	}
+}
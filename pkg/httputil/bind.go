@@ -0,0 +1,351 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError describes an invalid field of a bound request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// BindError is returned by Bind for requests that can't be decoded or fail validation.
+type BindError struct {
+	Status  int // 400 Bad Request, or 415 Unsupported Media Type
+	Message string
+	Fields  []FieldError
+}
+
+func (e *BindError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return e.Message + ": " + strings.Join(msgs, "; ")
+}
+
+// BindErrorResponse is the JSON body of BindFailed responses. It extends ErrorResponse with field errors.
+type BindErrorResponse struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// Bind decodes the request into a T, a struct, and validates it. Fields are named by their json tag.
+// Query parameters are decoded first, then the body, JSON or form encoded, overriding them; a query tag
+// names a field's query parameter if it differs from its json name.
+//
+// Fields are validated with validate tags of comma separated rules:
+//   - required: the field must be non-zero
+//   - min=n, max=n: bounds of numbers, or of the length of strings, slices and maps
+//   - enum=a|b|c: the field's value must be one of the listed values
+//
+// Nested structs and slices of structs are validated too. Invalid requests yield a *BindError listing every
+// invalid field, which BindFailed sends as a response:
+//
+//	type createUser struct {
+//		Name  string `json:"name" validate:"required,max=64"`
+//		Role  string `json:"role" validate:"enum=admin|editor|viewer"`
+//		Limit int    `json:"limit" query:"limit" validate:"min=1,max=100"`
+//	}
+//
+//	user, err := httputil.Bind[createUser](r)
+//	if err != nil {
+//		httputil.BindFailed(w, err)
+//		return
+//	}
+//
+// It replaces BindOrError, which decodes JSON bodies only.
+func Bind[T any](r *http.Request) (T, error) {
+	var dst T
+	v := reflect.ValueOf(&dst).Elem()
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("httputil.Bind: %T is not a struct", dst))
+	}
+
+	var fields []FieldError
+	fields = append(fields, bindValues(v, r.URL.Query(), "query")...)
+
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "application/json", "":
+			if err := json.NewDecoder(r.Body).Decode(&dst); err != nil {
+				return dst, jsonBindError(err)
+			}
+		case "application/x-www-form-urlencoded", "multipart/form-data":
+			if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+				return dst, &BindError{Status: http.StatusBadRequest, Message: "invalid form body"}
+			}
+			fields = append(fields, bindValues(v, r.PostForm, "form")...)
+		default:
+			return dst, &BindError{Status: http.StatusUnsupportedMediaType, Message: "unsupported content type " + mediaType}
+		}
+	}
+
+	if len(fields) == 0 {
+		fields = validateStruct(v, "")
+	}
+	if len(fields) > 0 {
+		return dst, &BindError{Status: http.StatusBadRequest, Message: "invalid request", Fields: fields}
+	}
+	return dst, nil
+}
+
+// BindFailed sends the error of Bind as a JSON response, listing invalid fields.
+// Other errors are sent as 400 Bad Request.
+func BindFailed(w http.ResponseWriter, err error) {
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) {
+		bindErr = &BindError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	JSON(w, bindErr.Status, BindErrorResponse{Code: bindErr.Status, Message: bindErr.Message, Fields: bindErr.Fields})
+}
+
+func jsonBindError(err error) *BindError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &BindError{Status: http.StatusBadRequest, Message: "invalid request", Fields: []FieldError{
+			{Field: typeErr.Field, Message: "must be " + typeName(typeErr.Type)},
+		}}
+	}
+	return &BindError{Status: http.StatusBadRequest, Message: "invalid JSON body"}
+}
+
+// bindValues sets the fields of struct v named in values. tag is the struct tag naming a field's value
+// if it differs from its json name.
+func bindValues(v reflect.Value, values url.Values, tag string) []FieldError {
+	var errs []FieldError
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Tag.Get(tag)
+		if name == "" {
+			name = fieldName(sf)
+		}
+		vals, ok := values[name]
+		if !ok || name == "-" || len(vals) == 0 {
+			continue
+		}
+		if err := setFromStrings(v.Field(i), vals); err != nil {
+			errs = append(errs, FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func setFromStrings(f reflect.Value, vals []string) error {
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return setFromStrings(f.Elem(), vals)
+	}
+	if f.Kind() == reflect.Slice {
+		s := reflect.MakeSlice(f.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setFromString(s.Index(i), val); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+	return setFromString(f, vals[len(vals)-1])
+}
+
+func setFromString(f reflect.Value, s string) error {
+	if f.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("must be an RFC 3339 time")
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("can't be set from a parameter")
+	}
+	return nil
+}
+
+// validateStruct checks the validate tags of struct v's fields. prefix is v's path in the request.
+func validateStruct(v reflect.Value, prefix string) []FieldError {
+	var errs []FieldError
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := prefix + fieldName(sf)
+		f := v.Field(i)
+		if msg := validateField(f, sf.Tag.Get("validate")); msg != "" {
+			errs = append(errs, FieldError{Field: name, Message: msg})
+			continue
+		}
+
+		// nested structs
+		for f.Kind() == reflect.Pointer && !f.IsNil() {
+			f = f.Elem()
+		}
+		switch {
+		case f.Kind() == reflect.Struct && f.Type() != timeType:
+			errs = append(errs, validateStruct(f, name+".")...)
+		case f.Kind() == reflect.Slice:
+			for j := 0; j < f.Len(); j++ {
+				elem := f.Index(j)
+				for elem.Kind() == reflect.Pointer && !elem.IsNil() {
+					elem = elem.Elem()
+				}
+				if elem.Kind() == reflect.Struct && elem.Type() != timeType {
+					errs = append(errs, validateStruct(elem, fmt.Sprintf("%s[%d].", name, j))...)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateField returns why f violates rules, or "" if it doesn't.
+func validateField(f reflect.Value, rules string) string {
+	if rules == "" {
+		return ""
+	}
+	if slices.Contains(strings.Split(rules, ","), "required") && f.IsZero() {
+		return "is required"
+	}
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return "" // optional and absent
+		}
+		f = f.Elem()
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		key, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "min", "max":
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("httputil.Bind: invalid %s rule %q", key, rule))
+			}
+			n, unit, ok := measure(f)
+			if !ok {
+				continue
+			}
+			if key == "min" && n < bound {
+				if unit != "" {
+					return fmt.Sprintf("must have at least %s %s", arg, unit)
+				}
+				return "must be at least " + arg
+			}
+			if key == "max" && n > bound {
+				if unit != "" {
+					return fmt.Sprintf("must have at most %s %s", arg, unit)
+				}
+				return "must be at most " + arg
+			}
+		case "enum":
+			if f.IsZero() {
+				continue // use required to disallow empty values
+			}
+			allowed := strings.Split(arg, "|")
+			if !slices.Contains(allowed, fmt.Sprint(f.Interface())) {
+				return "must be one of " + strings.Join(allowed, ", ")
+			}
+		}
+	}
+	return ""
+}
+
+// measure returns the number a min or max rule bounds: the value of numbers, or the length of strings,
+// slices and maps, with the unit of the length.
+func measure(f reflect.Value) (n float64, unit string, ok bool) {
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(f.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(f.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return f.Float(), "", true
+	case reflect.String:
+		return float64(len([]rune(f.String()))), "characters", true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(f.Len()), "elements", true
+	}
+	return 0, "", false
+}
+
+// fieldName returns the name of a field in JSON.
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
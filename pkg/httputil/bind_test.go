@@ -0,0 +1,114 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bindItem struct {
+	SKU      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1"`
+}
+
+type bindOrder struct {
+	Customer string     `json:"customer" validate:"required,max=8"`
+	Status   string     `json:"status" validate:"enum=new|paid"`
+	Items    []bindItem `json:"items" validate:"min=1"`
+	Limit    int        `json:"limit" query:"page_size" validate:"min=1,max=100"`
+	Tags     []string   `json:"tags"`
+	Note     *string    `json:"note" validate:"max=4"`
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		contentType    string
+		body           string
+		expectedStatus int // 0 if valid
+		expectedFields []string
+	}{
+		{
+			name:   "valid JSON",
+			target: "/?page_size=10&tags=a&tags=b",
+			body:   `{"customer":"alice","status":"new","items":[{"sku":"x","quantity":2}]}`,
+		},
+		{
+			name:        "valid form",
+			target:      "/?page_size=10",
+			contentType: "application/x-www-form-urlencoded",
+			body:        url.Values{"customer": {"alice"}, "tags": {"a", "b"}}.Encode(),
+			// items are required at least once
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []string{"items"},
+		},
+		{
+			name:           "field errors",
+			target:         "/?page_size=1000",
+			body:           `{"customer":"","status":"shipped","items":[{"sku":"","quantity":0}],"note":"too long"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []string{"customer", "status", "items[0].sku", "items[0].quantity", "limit", "note"},
+		},
+		{
+			name:           "query type error",
+			target:         "/?page_size=ten",
+			body:           `{"customer":"alice"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []string{"page_size"},
+		},
+		{
+			name:           "JSON type error",
+			target:         "/?page_size=10",
+			body:           `{"customer":1}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []string{"customer"},
+		},
+		{
+			name:           "unsupported content type",
+			target:         "/",
+			contentType:    "text/csv",
+			body:           "a,b",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			order, err := Bind[bindOrder](req)
+			if tt.expectedStatus == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if order.Customer != "alice" || order.Limit != 10 || !reflect.DeepEqual(order.Tags, []string{"a", "b"}) {
+					t.Errorf("order = %+v", order)
+				}
+				return
+			}
+
+			rr := httptest.NewRecorder()
+			BindFailed(rr, err)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d: %v", rr.Code, tt.expectedStatus, err)
+			}
+			var body BindErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var fields []string
+			for _, f := range body.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.expectedFields) {
+				t.Errorf("fields = %v, want %v", body.Fields, tt.expectedFields)
+			}
+		})
+	}
+}
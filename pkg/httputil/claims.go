@@ -0,0 +1,162 @@
+package httputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/edgeflare/pgo/pkg/util"
+)
+
+// ClaimSetting maps a token claim to a Postgres setting, e.g. sub to request.jwt.sub, so RLS policies
+// can read current_setting('request.jwt.sub') instead of extracting the claim from the JSON of all claims.
+type ClaimSetting struct {
+	// Claim is the claim's path, e.g. "sub" or ".org.id". "." is the whole claims object.
+	Claim string
+	// Setting is a custom setting name, which must contain a dot, e.g. app.org_id.
+	Setting string
+	// Type is what the claim is coerced to: "text" (default), "int", "bool" or "json".
+	// Claims that can't be coerced fail the request rather than reaching policies in an unexpected format.
+	Type string
+}
+
+var (
+	claimSettingsMu sync.RWMutex
+	claimSettings   []ClaimSetting
+)
+
+// SetClaimSettings replaces how claims are set for RLS policies by ConnWithRole, RoleBatch and the PostgresTx
+// middleware. Without mappings, set here or in PGO_POSTGRES_CLAIM_SETTINGS as comma separated
+// claim=setting[:type] entries (e.g. "sub=request.jwt.sub,org_id=app.org_id:int"), all claims are set as JSON
+// in RequestClaimsSetting. With mappings, only the mapped claims are set; map "." to keep the JSON of all claims.
+func SetClaimSettings(mappings ...ClaimSetting) {
+	claimSettingsMu.Lock()
+	defer claimSettingsMu.Unlock()
+	claimSettings = mappings
+}
+
+// ParseClaimSettings parses claim=setting[:type] entries separated by commas.
+func ParseClaimSettings(s string) ([]ClaimSetting, error) {
+	var mappings []ClaimSetting
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		claim, setting, ok := strings.Cut(entry, "=")
+		if !ok || claim == "" || setting == "" {
+			return nil, fmt.Errorf("invalid claim setting %q, want claim=setting[:type]", entry)
+		}
+		m := ClaimSetting{Claim: claim, Setting: setting}
+		if setting, typ, ok := strings.Cut(setting, ":"); ok {
+			m.Setting, m.Type = setting, typ
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// currentClaimSettings returns the configured mappings, or the default of all claims in RequestClaimsSetting.
+func currentClaimSettings() ([]ClaimSetting, error) {
+	claimSettingsMu.RLock()
+	mappings := claimSettings
+	claimSettingsMu.RUnlock()
+	if mappings != nil {
+		return mappings, nil
+	}
+	if env := os.Getenv("PGO_POSTGRES_CLAIM_SETTINGS"); env != "" {
+		return ParseClaimSettings(env)
+	}
+	return []ClaimSetting{{Claim: ".", Setting: RequestClaimsSetting(), Type: "json"}}, nil
+}
+
+// ClaimSettingValues returns the settings and values to set for claims, as alternating setting and
+// value arguments for set_config. Missing claims are set to the empty string, like unset custom settings.
+func ClaimSettingValues(claims map[string]any) ([]string, error) {
+	mappings, err := currentClaimSettings()
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, 2*len(mappings))
+	for _, m := range mappings {
+		var v any = claims
+		if strings.Trim(m.Claim, ".") != "" {
+			if v, err = util.Jq(claims, m.Claim); err != nil {
+				v = nil
+			}
+		}
+		value, err := coerceClaim(v, m.Type)
+		if err != nil {
+			return nil, fmt.Errorf("claim %s: %w", m.Claim, err)
+		}
+		args = append(args, m.Setting, value)
+	}
+	return args, nil
+}
+
+// ClaimSettingsSQL returns a statement setting the claims' settings with set_config,
+// scoped to the transaction if local, and its arguments.
+func ClaimSettingsSQL(claims map[string]any, local bool) (string, []any, error) {
+	values, err := ClaimSettingValues(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	calls := make([]string, 0, len(values)/2)
+	args := make([]any, len(values))
+	for i := 0; i < len(values); i += 2 {
+		calls = append(calls, fmt.Sprintf("set_config($%d, $%d, %t)", i+1, i+2, local))
+		args[i], args[i+1] = values[i], values[i+1]
+	}
+	return "SELECT " + strings.Join(calls, ", "), args, nil
+}
+
+func coerceClaim(v any, typ string) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	switch typ {
+	case "", "text":
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64, bool, json.Number:
+			return fmt.Sprint(v), nil
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	case "int":
+		switch v := v.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return "", fmt.Errorf("%v is not an integer", v)
+			}
+			return strconv.FormatInt(int64(v), 10), nil
+		case string:
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				return "", fmt.Errorf("%q is not an integer", v)
+			}
+			return v, nil
+		}
+	case "bool":
+		switch v := v.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return "", fmt.Errorf("%q is not a boolean", v)
+			}
+			return strconv.FormatBool(b), nil
+		}
+	case "json":
+		b, err := json.Marshal(v)
+		return string(b), err
+	default:
+		return "", fmt.Errorf("unknown type %q", typ)
+	}
+	return "", fmt.Errorf("%v can't be coerced to %s", v, typ)
+}
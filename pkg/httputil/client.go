@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -26,6 +27,15 @@ type RequestConfig struct {
 	MaxRetries     int           // Default: 3
 	InitialBackoff time.Duration // Default: 100ms
 	MaxBackoff     time.Duration // Default: 10s
+	// Jitter randomizes each backoff by up to this fraction, so clients retrying at once spread out. Default: 0.5
+	Jitter float64
+	// RetryBudget caps the total time spent on a call, including attempts and waits between them.
+	// Retries that would exceed it aren't made. Default: MaxRetries * MaxBackoff
+	RetryBudget time.Duration
+	// HedgeDelay, if set, sends a second attempt of idempotent requests (GET, HEAD, OPTIONS, PUT, DELETE,
+	// or any method with an Idempotency-Key header) that have no response after HedgeDelay, and uses
+	// whichever response arrives first, cutting tail latency. Default: 0 (disabled)
+	HedgeDelay time.Duration
 
 	// Optional callback for handling responses before status code check
 	// Useful for custom error handling or response processing
@@ -50,6 +60,7 @@ func DefaultRequestConfig(method, url string) RequestConfig {
 		MaxRetries:     3,
 		InitialBackoff: 100 * time.Millisecond,
 		MaxBackoff:     10 * time.Second,
+		Jitter:         0.5,
 		Logger:         log.Default(),
 	}
 }
@@ -62,13 +73,13 @@ type Response struct {
 	Request    *http.Request // Original request for context
 }
 
-// Request performs an HTTP request with configurable retry logic
+// Request performs an HTTP request with configurable retry logic.
+// Failed attempts are retried with jittered exponential backoff, or after the delay of a Retry-After header
+// in 429 and 503 responses, until MaxRetries or RetryBudget is exhausted.
 func Request(ctx context.Context, config RequestConfig, payload interface{}) (*Response, error) {
-	var reqBody io.Reader
+	var payloadBytes []byte
 	if payload != nil {
-		var payloadBytes []byte
 		var err error
-
 		switch v := payload.(type) {
 		case []byte:
 			payloadBytes = v
@@ -80,26 +91,37 @@ func Request(ctx context.Context, config RequestConfig, payload interface{}) (*R
 				return nil, fmt.Errorf("failed to marshal payload: %w", err)
 			}
 		}
-		reqBody = bytes.NewReader(payloadBytes)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, config.Method, config.URL, reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	// each attempt needs its own request, as sending one consumes its body
+	newRequest := func(ctx context.Context) (*http.Request, error) {
+		var reqBody io.Reader
+		if payload != nil {
+			reqBody = bytes.NewReader(payloadBytes)
+		}
+		req, err := http.NewRequestWithContext(ctx, config.Method, config.URL, reqBody)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
 
-	// Set headers
-	for key, values := range config.Headers {
-		for _, value := range values {
-			req.Header.Add(key, value)
+		// Set headers
+		for key, values := range config.Headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
 		}
-	}
 
-	// Set default content-type for methods with body
-	if reqBody != nil && (config.Method == http.MethodPost || config.Method == http.MethodPut || config.Method == http.MethodPatch) {
-		if req.Header.Get("Content-Type") == "" {
-			req.Header.Set("Content-Type", "application/json")
+		// Set default content-type for methods with body
+		if reqBody != nil && (config.Method == http.MethodPost || config.Method == http.MethodPut || config.Method == http.MethodPatch) {
+			if req.Header.Get("Content-Type") == "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
 		}
+		return req, nil
+	}
+	// fail fast on invalid configurations rather than retrying them
+	if _, err := newRequest(ctx); err != nil {
+		return nil, err
 	}
 
 	client := &http.Client{
@@ -107,60 +129,44 @@ func Request(ctx context.Context, config RequestConfig, payload interface{}) (*R
 	}
 
 	var response *Response
-	var firstAttempt = true
-
-	operation := func() error {
-		if !firstAttempt && config.Logger != nil {
-			config.Logger.Printf("Retrying request to %s", config.URL)
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			firstAttempt = false
-			return fmt.Errorf("request failed: %w", err)
-		}
-		defer resp.Body.Close()
 
-		// Read response body
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response body: %w", err)
+	operation := func() (retryAfter time.Duration, err error) {
+		result := sendHedged(ctx, client, config, newRequest)
+		if result.err != nil {
+			return 0, result.err
 		}
+		resp := result.resp
 
 		response = &Response{
 			StatusCode: resp.StatusCode,
-			Body:       body,
+			Body:       result.body,
 			Headers:    resp.Header,
-			Request:    req,
+			Request:    result.req,
 		}
 
 		// Custom response handling if provided
 		if config.ResponseHandler != nil {
 			if err := config.ResponseHandler(resp); err != nil {
-				firstAttempt = false
-				return err
+				return 0, err
 			}
 		}
 
 		// Default status code check
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			firstAttempt = false
-			return fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, body)
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			}
+			return retryAfter, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, result.body)
 		}
 
-		return nil
+		return 0, nil
 	}
 
+	var err error
 	if config.RetryEnabled {
-		// Configure backoff
-		b := backoff.NewExponentialBackOff()
-		b.InitialInterval = config.InitialBackoff
-		b.MaxInterval = config.MaxBackoff
-		b.MaxElapsedTime = time.Duration(config.MaxRetries) * config.MaxBackoff
-
-		err = backoff.Retry(operation, backoff.WithContext(b, ctx))
+		err = retry(ctx, config, operation)
 	} else {
-		err = operation()
+		_, err = operation()
 	}
 
 	if err != nil {
@@ -172,3 +178,136 @@ func Request(ctx context.Context, config RequestConfig, payload interface{}) (*R
 
 	return response, nil
 }
+
+// retry calls operation until it succeeds or config's retries or budget are exhausted.
+func retry(ctx context.Context, config RequestConfig, operation func() (time.Duration, error)) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = config.InitialBackoff
+	b.MaxInterval = config.MaxBackoff
+	b.RandomizationFactor = config.Jitter
+	if b.RandomizationFactor == 0 {
+		b.RandomizationFactor = 0.5
+	}
+	b.MaxElapsedTime = 0 // bounded by the budget below
+	b.Reset()
+
+	budget := config.RetryBudget
+	if budget == 0 {
+		budget = time.Duration(config.MaxRetries) * config.MaxBackoff
+	}
+	start := time.Now()
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && config.Logger != nil {
+			config.Logger.Printf("Retrying request to %s", config.URL)
+		}
+		retryAfter, err := operation()
+		if err == nil {
+			return nil
+		}
+		if attempt >= config.MaxRetries {
+			return err
+		}
+
+		wait := b.NextBackOff()
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if time.Since(start)+wait > budget {
+			return fmt.Errorf("retry budget of %s exhausted: %w", budget, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+type attemptResult struct {
+	req  *http.Request
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// sendHedged sends a request, hedging it as configured by config.HedgeDelay.
+func sendHedged(ctx context.Context, client *http.Client, config RequestConfig, newRequest func(context.Context) (*http.Request, error)) attemptResult {
+	if config.HedgeDelay <= 0 || !isIdempotent(config) {
+		return send(ctx, client, newRequest)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // abandons the slower attempt
+	results := make(chan attemptResult, 2)
+	launch := func() { results <- send(ctx, client, newRequest) }
+
+	go launch()
+	launched, received := 1, 0
+	hedge := time.NewTimer(config.HedgeDelay)
+	defer hedge.Stop()
+	hedgeC := hedge.C
+	for {
+		select {
+		case <-hedgeC:
+			hedgeC = nil
+			launched++
+			go launch()
+		case result := <-results:
+			received++
+			// an attempt that failed before the hedge was sent is retried as usual
+			if result.err == nil || received == launched {
+				return result
+			}
+		}
+	}
+}
+
+func send(ctx context.Context, client *http.Client, newRequest func(context.Context) (*http.Request, error)) attemptResult {
+	req, err := newRequest(ctx)
+	if err != nil {
+		return attemptResult{err: err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return attemptResult{req: req, err: fmt.Errorf("request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return attemptResult{req: req, err: fmt.Errorf("failed to read response body: %w", err)}
+	}
+	return attemptResult{req: req, resp: resp, body: body}
+}
+
+func isIdempotent(config RequestConfig) bool {
+	switch config.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	for key := range config.Headers {
+		if http.CanonicalHeaderKey(key) == "Idempotency-Key" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package httputil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testRequestConfig(method, url string) RequestConfig {
+	config := DefaultRequestConfig(method, url)
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 10 * time.Millisecond
+	config.Logger = nil
+	return config
+}
+
+func TestRequestRetry(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"n":1}` {
+			t.Errorf("attempt %d body = %q", attempts.Load()+1, body)
+		}
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	resp, err := Request(context.Background(), testRequestConfig(http.MethodPost, srv.URL), map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "ok" || attempts.Load() != 3 {
+		t.Errorf("body = %q after %d attempts, want ok after 3", resp.Body, attempts.Load())
+	}
+}
+
+func TestRequestRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	config := testRequestConfig(http.MethodGet, srv.URL)
+	config.RetryBudget = 5 * time.Second
+	if _, err := Request(context.Background(), config, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want Retry-After of 1s honored", elapsed)
+	}
+
+	// a Retry-After beyond the budget ends the call
+	attempts.Store(0)
+	config.RetryBudget = 100 * time.Millisecond
+	resp, err := Request(context.Background(), config, nil)
+	if err == nil || resp.StatusCode != http.StatusTooManyRequests || attempts.Load() != 1 {
+		t.Errorf("status = %d, attempts = %d, err = %v, want budget exhausted after 1 attempt", resp.StatusCode, attempts.Load(), err)
+	}
+}
+
+func TestRequestHedging(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			// the first attempt stalls until it's abandoned
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("hedged"))
+	}))
+	defer srv.Close()
+
+	config := testRequestConfig(http.MethodGet, srv.URL)
+	config.HedgeDelay = 20 * time.Millisecond
+	resp, err := Request(context.Background(), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Body) != "hedged" {
+		t.Errorf("body = %q, want hedged", resp.Body)
+	}
+}
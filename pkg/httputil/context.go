@@ -16,6 +16,13 @@ const (
 	BasicAuthCtxKey ContextKey = "BasicAuth"
 	PgConnCtxKey    ContextKey = "PgConn"
 	PgRoleCtxKey    ContextKey = "PgRole"
+	PgTxCtxKey      ContextKey = "PgTx"
+	// PgRolePresetCtxKey is true if the connection in the context already has the request's role, as it
+	// comes from a pool of the role (see middleware.PostgresPools).
+	PgRolePresetCtxKey ContextKey = "PgRolePreset"
+	// PgRequestIDSettingCtxKey is the setting ConnWithRole and RoleBatch set to the request ID along with the
+	// role (see middleware.PostgresConfig.RequestIDSetting).
+	PgRequestIDSettingCtxKey ContextKey = "PgRequestIDSetting"
 )
 
 // OIDCUser extracts the OIDC user from the request context.
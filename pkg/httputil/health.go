@@ -0,0 +1,95 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck is a named check of a dependency, such as a database.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Timeout bounds the check. Default: 5s
+	Timeout time.Duration
+}
+
+// HealthStatus is the JSON response of Health.
+type HealthStatus struct {
+	Status string                      `json:"status"` // "ok" or "fail"
+	Checks map[string]HealthCheckState `json:"checks,omitempty"`
+}
+
+// HealthCheckState is the outcome of a HealthCheck.
+type HealthCheckState struct {
+	Status    string  `json:"status"` // "ok" or "fail"
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Health returns a handler that runs checks concurrently and responds with their outcomes and latencies as JSON,
+// with 200 OK if all pass or 503 Service Unavailable otherwise. Without checks it always responds 200 OK,
+// which suits liveness probes; readiness probes should check the dependencies requests need:
+//
+//	r.Handle("GET /healthz", httputil.Health())
+//	r.Handle("GET /readyz", httputil.Health(httputil.PingCheck("postgres", pool)))
+func Health(checks ...HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := HealthStatus{Status: "ok"}
+		if len(checks) > 0 {
+			status.Checks = make(map[string]HealthCheckState, len(checks))
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				state := runHealthCheck(r.Context(), check)
+				mu.Lock()
+				defer mu.Unlock()
+				status.Checks[check.Name] = state
+				if state.Status != "ok" {
+					status.Status = "fail"
+				}
+			}()
+		}
+		wg.Wait()
+
+		w.Header().Set("Cache-Control", "no-store")
+		code := http.StatusOK
+		if status.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		JSON(w, code, status)
+	})
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckState {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	state := HealthCheckState{Status: "ok", LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		state.Status, state.Error = "fail", err.Error()
+	}
+	return state
+}
+
+// Pinger is implemented by *pgxpool.Pool, *pgx.Conn and other clients that can check their connection.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PingCheck returns a HealthCheck pinging p, e.g. a Postgres pool.
+func PingCheck(name string, p Pinger) HealthCheck {
+	return HealthCheck{Name: name, Check: p.Ping}
+}
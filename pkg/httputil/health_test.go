@@ -0,0 +1,53 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	ok := HealthCheck{Name: "ok", Check: func(ctx context.Context) error { return nil }}
+	failing := HealthCheck{Name: "failing", Check: func(ctx context.Context) error { return errors.New("down") }}
+	slow := HealthCheck{Name: "slow", Timeout: 10 * time.Millisecond, Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	tests := []struct {
+		name           string
+		checks         []HealthCheck
+		expectedStatus int
+		expectedFailed []string
+	}{
+		{"liveness", nil, http.StatusOK, nil},
+		{"ready", []HealthCheck{ok}, http.StatusOK, nil},
+		{"not ready", []HealthCheck{ok, failing, slow}, http.StatusServiceUnavailable, []string{"failing", "slow"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			Health(tt.checks...).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+
+			var status HealthStatus
+			if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+			if len(status.Checks) != len(tt.checks) {
+				t.Errorf("checks = %v", status.Checks)
+			}
+			for _, name := range tt.expectedFailed {
+				if state := status.Checks[name]; state.Status != "fail" || state.Error == "" {
+					t.Errorf("check %s = %+v, want failed", name, state)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AuditConfig holds the configuration for an AuditLogger.
+type AuditConfig struct {
+	// Table stores the audit trail. It is created if it doesn't exist. Defaults to pgo_audit_log.
+	Table string
+	// LogBodies records request and response bodies, up to MaxBodySize bytes each.
+	LogBodies bool
+	// MaxBodySize defaults to 64 KiB. Longer bodies are truncated.
+	MaxBodySize int
+	// RedactFields lists JSON object keys, matched case-insensitively at any depth, whose values are replaced
+	// with "[REDACTED]" in recorded bodies. Bodies that aren't JSON, or are truncated, aren't recorded
+	// unless RedactFields is empty. Defaults to password, secret, token, access_token, refresh_token and client_secret.
+	RedactFields []string
+	// BatchSize is the number of entries written at once. Defaults to 100.
+	BatchSize int
+	// FlushInterval is how long entries wait at most before being written. Defaults to 1 second.
+	FlushInterval time.Duration
+	// Skip, if set, excludes requests from the audit trail, e.g. health checks.
+	Skip func(r *http.Request) bool
+}
+
+// AuditLogger writes an audit trail of requests to a Postgres table in batches with COPY.
+type AuditLogger struct {
+	pool    *pgxpool.Pool
+	cfg     AuditConfig
+	table   string
+	redact  map[string]bool
+	entries chan auditEntry
+	done    chan struct{}
+	close   sync.Once
+}
+
+type auditEntry struct {
+	at           time.Time
+	requestID    string
+	method       string
+	path         string
+	status       int
+	durationMs   float64
+	role         string
+	subject      string
+	remoteAddr   string
+	requestBody  *string
+	responseBody *string
+}
+
+var auditColumns = []string{
+	"at", "request_id", "method", "path", "status", "duration_ms",
+	"role", "subject", "remote_addr", "request_body", "response_body",
+}
+
+// NewAuditLogger returns an AuditLogger writing to cfg.Table, which is created if it doesn't exist.
+// Close it on shutdown to write pending entries.
+func NewAuditLogger(ctx context.Context, pool *pgxpool.Pool, cfg AuditConfig) (*AuditLogger, error) {
+	a := newAuditLogger(pool, cfg)
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+		at timestamptz NOT NULL,
+		request_id text,
+		method text NOT NULL,
+		path text NOT NULL,
+		status int NOT NULL,
+		duration_ms double precision NOT NULL,
+		role text,
+		subject text,
+		remote_addr text,
+		request_body text,
+		response_body text
+	)`, pgx.Identifier{a.cfg.Table}.Sanitize()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit table: %w", err)
+	}
+	go a.run()
+	return a, nil
+}
+
+func newAuditLogger(pool *pgxpool.Pool, cfg AuditConfig) *AuditLogger {
+	if cfg.Table == "" {
+		cfg.Table = "pgo_audit_log"
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 64 << 10
+	}
+	if cfg.RedactFields == nil {
+		cfg.RedactFields = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret"}
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	redact := make(map[string]bool, len(cfg.RedactFields))
+	for _, f := range cfg.RedactFields {
+		redact[strings.ToLower(f)] = true
+	}
+	return &AuditLogger{
+		pool:    pool,
+		cfg:     cfg,
+		table:   cfg.Table,
+		redact:  redact,
+		entries: make(chan auditEntry, cfg.BatchSize*10),
+		done:    make(chan struct{}),
+	}
+}
+
+// Close writes pending entries and stops the logger. Requests audited afterwards are dropped.
+func (a *AuditLogger) Close(ctx context.Context) error {
+	a.close.Do(func() { close(a.entries) })
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Audit is middleware that records each request's method, path (without query), status, duration, Postgres role,
+// token subject, client address and, if configured, redacted bodies with logger. Use it after the authentication
+// and Postgres middleware, so the role and subject are known. Entries are written asynchronously; if the database
+// falls behind, they're dropped and logged rather than delaying responses.
+func Audit(logger *AuditLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if logger.cfg.Skip != nil && logger.cfg.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			aw := &auditWriter{ResponseWriter: w, status: http.StatusOK}
+			var reqBody *limitedBuffer
+			if logger.cfg.LogBodies {
+				aw.body = &limitedBuffer{max: logger.cfg.MaxBodySize}
+				if r.Body != nil && r.Body != http.NoBody {
+					reqBody = &limitedBuffer{max: logger.cfg.MaxBodySize}
+					r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+				}
+			}
+			defer func() {
+				// record requests that panic too, as 500s, then let the panic propagate
+				if p := recover(); p != nil {
+					aw.status = http.StatusInternalServerError
+					logger.record(r, aw, reqBody, start)
+					panic(p)
+				}
+				logger.record(r, aw, reqBody, start)
+			}()
+			next.ServeHTTP(aw, r)
+		})
+	}
+}
+
+func (a *AuditLogger) record(r *http.Request, aw *auditWriter, reqBody *limitedBuffer, start time.Time) {
+	e := auditEntry{
+		at:         start,
+		method:     r.Method,
+		path:       r.URL.Path,
+		status:     aw.status,
+		durationMs: float64(time.Since(start).Microseconds()) / 1000,
+		remoteAddr: r.RemoteAddr,
+	}
+	e.requestID, _ = r.Context().Value(httputil.RequestIDCtxKey).(string)
+	e.role, _ = r.Context().Value(httputil.PgRoleCtxKey).(string)
+	if user, ok := httputil.OIDCUser(r); ok {
+		e.subject = user.Subject
+	} else if user, ok := httputil.BasicAuthUser(r); ok {
+		e.subject = user
+	}
+	if reqBody != nil && reqBody.Len() > 0 {
+		e.requestBody = a.redactBody(reqBody)
+	}
+	if aw.body != nil && aw.body.Len() > 0 {
+		e.responseBody = a.redactBody(aw.body)
+	}
+
+	defer func() {
+		// the logger was closed
+		if recover() != nil {
+			log.Printf("Dropped audit entry for %s %s: audit logger closed", e.method, e.path)
+		}
+	}()
+	select {
+	case a.entries <- e:
+	default:
+		log.Printf("Dropped audit entry for %s %s: audit buffer full", e.method, e.path)
+	}
+}
+
+// redactBody returns the body with RedactFields redacted, or nil if it can't be redacted.
+func (a *AuditLogger) redactBody(b *limitedBuffer) *string {
+	if len(a.redact) == 0 {
+		s := b.String()
+		return &s
+	}
+	if b.truncated {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(b.Bytes(), &v); err != nil {
+		return nil
+	}
+	redacted, err := json.Marshal(a.redactValue(v))
+	if err != nil {
+		return nil
+	}
+	s := string(redacted)
+	return &s
+}
+
+func (a *AuditLogger) redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if a.redact[strings.ToLower(k)] {
+				v[k] = "[REDACTED]"
+			} else {
+				v[k] = a.redactValue(val)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = a.redactValue(val)
+		}
+	}
+	return v
+}
+
+// run writes entries in batches until the logger is closed.
+func (a *AuditLogger) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]auditEntry, 0, a.cfg.BatchSize)
+	for {
+		select {
+		case e, ok := <-a.entries:
+			if !ok {
+				a.flush(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= a.cfg.BatchSize {
+				a.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (a *AuditLogger) flush(batch []auditEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := a.pool.CopyFrom(ctx, pgx.Identifier{a.table}, auditColumns, pgx.CopyFromSlice(len(batch), func(i int) ([]any, error) {
+		e := batch[i]
+		return []any{e.at, nullIfEmpty(e.requestID), e.method, e.path, e.status, e.durationMs,
+			nullIfEmpty(e.role), nullIfEmpty(e.subject), e.remoteAddr, e.requestBody, e.responseBody}, nil
+	}))
+	if err != nil {
+		log.Printf("Failed to write %d audit entries: %v", len(batch), err)
+	}
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// auditWriter records the status and, if body is set, the start of the response body.
+type auditWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        *limitedBuffer
+}
+
+func (aw *auditWriter) WriteHeader(code int) {
+	if !aw.wroteHeader {
+		aw.wroteHeader = true
+		aw.status = code
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *auditWriter) Write(b []byte) (int, error) {
+	aw.wroteHeader = true
+	if aw.body != nil {
+		aw.body.Write(b)
+	}
+	return aw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (aw *auditWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+)
+
+func TestAudit(t *testing.T) {
+	logger := newAuditLogger(nil, AuditConfig{LogBodies: true})
+	handler := Audit(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := httputil.BindOrError(r, w, &body); err != nil {
+			return
+		}
+		httputil.JSON(w, http.StatusCreated, map[string]any{"id": 1, "tokens": []any{map[string]any{"Token": "t0ps3cret"}}})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/users?api_key=k", strings.NewReader(`{"name":"alice","password":"hunter2"}`))
+	req = req.WithContext(context.WithValue(req.Context(), httputil.PgRoleCtxKey, "editor"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	e := <-logger.entries
+	if e.method != http.MethodPost || e.path != "/users" || e.status != http.StatusCreated || e.role != "editor" {
+		t.Errorf("entry = %+v", e)
+	}
+	if e.requestBody == nil || *e.requestBody != `{"name":"alice","password":"[REDACTED]"}` {
+		t.Errorf("request body = %v", e.requestBody)
+	}
+	if e.responseBody == nil || strings.Contains(*e.responseBody, "t0ps3cret") {
+		t.Errorf("response body = %v", e.responseBody)
+	}
+	if rr.Code != http.StatusCreated {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusCreated)
+	}
+}
+
+func TestAuditThroughRouter(t *testing.T) {
+	logger := newAuditLogger(nil, AuditConfig{})
+	router := httputil.NewRouter()
+	router.Use(Audit(logger))
+	router.Handle("POST /items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	router.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/items", nil))
+
+	if n := len(logger.entries); n != 1 {
+		t.Fatalf("got %d audit entries, want 1", n)
+	}
+	if e := <-logger.entries; e.path != "/items" || e.status != http.StatusCreated {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestAuditUnredactableBody(t *testing.T) {
+	logger := newAuditLogger(nil, AuditConfig{LogBodies: true, MaxBodySize: 8})
+	handler := Audit(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body) // truncated, so it can't be redacted
+		w.Write([]byte("plain text"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"password":"hunter2"}`)))
+
+	e := <-logger.entries
+	if e.requestBody != nil || e.responseBody != nil {
+		t.Errorf("bodies = %v, %v, want none recorded", e.requestBody, e.responseBody)
+	}
+}
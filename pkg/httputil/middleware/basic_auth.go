@@ -2,16 +2,99 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // BasicAuthConfig holds the username-password pairs for basic authentication.
 type BasicAuthConfig struct {
 	Credentials map[string]string
+	// Verifier, if set, checks credentials instead of Credentials, e.g. PgLoginVerifier or PgCredentialsVerifier.
+	// The role it returns is set as the request's Postgres role, as PgOIDCAuthz does for OIDC users.
+	Verifier BasicAuthVerifier
+}
+
+// BasicAuthVerifier checks a username and password and returns the Postgres role of the user.
+// It returns ErrInvalidCredentials if they don't match.
+type BasicAuthVerifier func(ctx context.Context, username, password string) (role string, err error)
+
+// ErrInvalidCredentials is returned by a BasicAuthVerifier for a wrong username or password.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// PgLoginVerifier verifies credentials by logging in to Postgres as the user, with connString's other
+// parameters, e.g. "host=db dbname=app sslmode=require". Users are Postgres login roles, authenticated by
+// the server (usually with SCRAM), and map to themselves. Successful logins are remembered for a minute
+// to spare the server an authentication per request.
+func PgLoginVerifier(connString string) (BasicAuthVerifier, error) {
+	base, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	verified := make(map[[32]byte]time.Time)
+
+	return func(ctx context.Context, username, password string) (string, error) {
+		key := sha256.Sum256([]byte(username + "\x00" + password))
+		mu.Lock()
+		expiry, ok := verified[key]
+		mu.Unlock()
+		if ok && time.Now().Before(expiry) {
+			return username, nil
+		}
+
+		cfg := base.Copy()
+		cfg.User, cfg.Password = username, password
+		conn, err := pgconn.ConnectConfig(ctx, cfg)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			// invalid_password, invalid_authorization_specification
+			if errors.As(err, &pgErr) && (pgErr.Code == "28P01" || pgErr.Code == "28000") {
+				return "", ErrInvalidCredentials
+			}
+			return "", err
+		}
+		conn.Close(ctx)
+
+		mu.Lock()
+		now := time.Now()
+		for k, exp := range verified {
+			if now.After(exp) {
+				delete(verified, k)
+			}
+		}
+		verified[key] = now.Add(time.Minute)
+		mu.Unlock()
+		return username, nil
+	}, nil
+}
+
+// PgCredentialsVerifier verifies credentials against table, which has username, password_hash and role
+// columns. Password hashes are checked with pgcrypto's crypt(), so they are created with e.g.
+// crypt('secret', gen_salt('bf')) and the pgcrypto extension must be installed.
+func PgCredentialsVerifier(pool *pgxpool.Pool, table string) BasicAuthVerifier {
+	query := fmt.Sprintf(`SELECT role FROM %s WHERE username = $1 AND password_hash = crypt($2, password_hash)`,
+		pgx.Identifier{table}.Sanitize())
+
+	return func(ctx context.Context, username, password string) (string, error) {
+		var role string
+		err := pool.QueryRow(ctx, query, username, password).Scan(&role)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrInvalidCredentials
+		}
+		return role, err
+	}
 }
 
 // NewBasicAuthCreds creates a new instance of BasicAuthConfig with multiple username/password pairs.
@@ -55,6 +138,24 @@ func VerifyBasicAuth(config *BasicAuthConfig) func(http.Handler) http.Handler {
 
 			username, password := creds[0], creds[1]
 
+			if config.Verifier != nil {
+				role, err := config.Verifier(r.Context(), username, password)
+				if errors.Is(err, ErrInvalidCredentials) {
+					w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+					http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					log.Printf("Failed to verify basic auth credentials: %v", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				ctx := context.WithValue(r.Context(), httputil.BasicAuthCtxKey, username)
+				ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, role)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// Verify the credentials
 			if validPassword, ok := config.Credentials[username]; !ok || validPassword != password {
 				w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
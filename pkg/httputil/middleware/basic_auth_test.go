@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"context"
 	"encoding/base64"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -93,3 +95,65 @@ func TestVerifyBasicAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyBasicAuthVerifier(t *testing.T) {
+	config := &BasicAuthConfig{Verifier: func(ctx context.Context, username, password string) (string, error) {
+		switch {
+		case username == "down":
+			return "", errors.New("connection refused")
+		case password != "secret":
+			return "", ErrInvalidCredentials
+		}
+		return username + "_role", nil
+	}}
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		expectedStatus int
+		expectedRole   string
+	}{
+		{"valid credentials", "alice", "secret", http.StatusOK, "alice_role"},
+		{"invalid credentials", "alice", "wrong", http.StatusUnauthorized, ""},
+		{"verifier error", "down", "secret", http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role string
+			handler := VerifyBasicAuth(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				role, _ = r.Context().Value(httputil.PgRoleCtxKey).(string)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.SetBasicAuth(tt.username, tt.password)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+			if role != tt.expectedRole {
+				t.Errorf("role = %q, want %q", role, tt.expectedRole)
+			}
+		})
+	}
+}
+
+func TestVerifyBasicAuthVerifierWithPgBasicAuthz(t *testing.T) {
+	config := &BasicAuthConfig{Verifier: func(ctx context.Context, username, password string) (string, error) {
+		return "editor", nil
+	}}
+	var role string
+	handler := VerifyBasicAuth(config)(Authorize(PgBasicAuthz())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, _ = r.Context().Value(httputil.PgRoleCtxKey).(string)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("alice", "secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || role != "editor" {
+		t.Errorf("status %d, role %q, want 200 and the verifier's role editor", rr.Code, role)
+	}
+}
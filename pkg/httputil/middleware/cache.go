@@ -1,61 +1,114 @@
 package middleware
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
 
-// Cache is a simple in-memory cache with expiration
+// Cache is a simple in-memory cache with expiration.
+// If it's bounded, the least recently used item is evicted to make room for new ones.
 type Cache struct {
 	sync.RWMutex
-	items map[string]cacheItem
+	items      map[string]*list.Element
+	lru        *list.List // of *cacheItem, most recently used first
+	maxEntries int
 }
 
 // cacheItem holds cached data along with its expiration
 type cacheItem struct {
+	key        string
 	value      interface{}
 	expiration time.Time
 }
 
-// NewCache creates a new Cache
-func NewCache() *Cache {
-	return &Cache{
-		items: make(map[string]cacheItem),
+// NewCache creates a new Cache holding at most maxEntries items, if given and positive; otherwise it's unbounded.
+func NewCache(maxEntries ...int) *Cache {
+	c := &Cache{
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
 	}
+	if len(maxEntries) > 0 && maxEntries[0] > 0 {
+		c.maxEntries = maxEntries[0]
+	}
+	return c
 }
 
 // Set adds an item to the cache with a specified expiration duration
 func (c *Cache) Set(key string, value interface{}, duration time.Duration) {
 	c.Lock()
 	defer c.Unlock()
-	c.items[key] = cacheItem{
-		value:      value,
-		expiration: time.Now().Add(duration),
+	item := &cacheItem{key: key, value: value, expiration: time.Now().Add(duration)}
+	if e, ok := c.items[key]; ok {
+		e.Value = item
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.lru.PushFront(item)
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
 	}
 }
 
 // Get retrieves an item from the cache
 func (c *Cache) Get(key string) (interface{}, bool) {
-	c.RLock()
-	defer c.RUnlock()
-	item, found := c.items[key]
+	c.Lock()
+	defer c.Unlock()
+	e, found := c.items[key]
 	if !found {
 		return nil, false
 	}
+	item := e.Value.(*cacheItem)
 	if time.Now().After(item.expiration) {
-		delete(c.items, key)
+		c.remove(e)
 		return nil, false
 	}
+	c.lru.MoveToFront(e)
 	return item.value, true
 }
 
+// Delete removes an item from the cache
+func (c *Cache) Delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+}
+
+// DeleteFunc removes the items for which match returns true
+func (c *Cache) DeleteFunc(match func(key string, value interface{}) bool) {
+	c.Lock()
+	defer c.Unlock()
+	for _, e := range c.items {
+		item := e.Value.(*cacheItem)
+		if match(item.key, item.value) {
+			c.remove(e)
+		}
+	}
+}
+
+// Len returns the number of items in the cache, including expired ones not yet removed
+func (c *Cache) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.lru.Len()
+}
+
 // CleanupExpired removes expired items from the cache
 func (c *Cache) CleanupExpired() {
 	c.Lock()
 	defer c.Unlock()
-	for key, item := range c.items {
-		if time.Now().After(item.expiration) {
-			delete(c.items, key)
+	now := time.Now()
+	for _, e := range c.items {
+		if now.After(e.Value.(*cacheItem).expiration) {
+			c.remove(e)
 		}
 	}
 }
+
+// remove deletes e. The caller must hold the lock.
+func (c *Cache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.items, e.Value.(*cacheItem).key)
+}
@@ -70,6 +70,31 @@ func TestCache_CleanupExpired(t *testing.T) {
 	}
 }
 
+func TestCache_LRUEviction(t *testing.T) {
+	cache := NewCache(2)
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Get("a") // b is now the least recently used
+	cache.Set("c", 3, time.Minute)
+
+	if _, found := cache.Get("b"); found {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, found := cache.Get(key); !found {
+			t.Errorf("Expected to find %s", key)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+
+	cache.DeleteFunc(func(key string, _ interface{}) bool { return key == "a" })
+	if _, found := cache.Get("a"); found {
+		t.Error("Expected a to be deleted")
+	}
+}
+
 func TestCache_Concurrency(t *testing.T) {
 	cache := NewCache()
 	var wg sync.WaitGroup
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+)
+
+// CircuitBreakerConfig holds the configuration for the CircuitBreaker middleware.
+type CircuitBreakerConfig struct {
+	// Threshold is the number of consecutive failed requests that opens the breaker. Defaults to 5.
+	Threshold int
+	// Cooldown is how long the breaker stays open before letting probe requests through. Defaults to 30 seconds.
+	Cooldown time.Duration
+	// Probes is the number of concurrent requests let through while half-open. Defaults to 1.
+	Probes int
+	// IsFailure reports whether a response status counts as a failure. Defaults to 5xx statuses,
+	// which the Postgres middleware responds with when it can't acquire a connection.
+	IsFailure func(status int) bool
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker tracks consecutive failures. It is closed while requests succeed, open after Threshold
+// consecutive failures, and half-open once Cooldown has passed, when a successful probe closes it again
+// and a failed one reopens it.
+type circuitBreaker struct {
+	cfg CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  int
+}
+
+// CircuitBreaker is middleware that stops sending requests to a failing backend, usually Postgres during
+// an outage. Once the breaker opens, requests get 503 Service Unavailable with Retry-After immediately
+// instead of queueing for connections, and only a few probe requests go through after the cooldown
+// to find out whether the backend has recovered. Place it before the Postgres middleware.
+func CircuitBreaker(cfg CircuitBreakerConfig) func(http.Handler) http.Handler {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 5
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(status int) bool { return status >= http.StatusInternalServerError }
+	}
+	b := &circuitBreaker{cfg: cfg}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			probe, retryAfter, ok := b.allow(time.Now())
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(retryAfter))))
+				httputil.Error(w, http.StatusServiceUnavailable, "service unavailable")
+				return
+			}
+
+			rec := NewResponseRecorder(w)
+			completed := false
+			defer func() {
+				// a panicking handler counts as a failure
+				b.done(probe, completed && !cfg.IsFailure(rec.StatusCode), time.Now())
+			}()
+			next.ServeHTTP(rec, r)
+			completed = true
+		})
+	}
+}
+
+// allow reports whether a request may proceed, and whether it is a probe. If not, retryAfter is the
+// time left until probes are let through.
+func (b *circuitBreaker) allow(now time.Time) (probe bool, retryAfter time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if wait := b.cfg.Cooldown - now.Sub(b.openedAt); wait > 0 {
+			return false, wait, false
+		}
+		b.state = breakerHalfOpen
+	}
+	if b.state == breakerHalfOpen {
+		if b.probing >= b.cfg.Probes {
+			return false, time.Second, false
+		}
+		b.probing++
+		return true, 0, true
+	}
+	return false, 0, true
+}
+
+// done records the outcome of an allowed request.
+func (b *circuitBreaker) done(probe, success bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing--
+		if success {
+			b.state = breakerClosed
+			b.failures = 0
+		} else {
+			b.state = breakerOpen
+			b.openedAt = now
+		}
+		return
+	}
+	if b.state != breakerClosed {
+		// a request let through before the breaker opened
+		return
+	}
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.cfg.Threshold {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	failing := true
+	calls := 0
+	handler := CircuitBreaker(CircuitBreakerConfig{Threshold: 2, Cooldown: 50 * time.Millisecond})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if failing {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	serve()
+	serve()
+	rr := serve()
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("open: got %d with Retry-After %q, want 503 with 1", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if calls != 2 {
+		t.Errorf("open breaker let requests through: %d calls, want 2", calls)
+	}
+
+	// a failed probe reopens the breaker
+	time.Sleep(60 * time.Millisecond)
+	if rr := serve(); rr.Code != http.StatusInternalServerError {
+		t.Errorf("probe: status = %d, want 500", rr.Code)
+	}
+	if rr := serve(); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("reopened: status = %d, want 503", rr.Code)
+	}
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	failing = false
+	for i := 0; i < 3; i++ {
+		if rr := serve(); rr.Code != http.StatusOK {
+			t.Errorf("closed: status = %d, want 200", rr.Code)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	b := &circuitBreaker{cfg: CircuitBreakerConfig{Threshold: 1, Cooldown: time.Second, Probes: 1}}
+	now := time.Now()
+	b.done(false, false, now)
+
+	if _, wait, ok := b.allow(now.Add(100 * time.Millisecond)); ok || wait != 900*time.Millisecond {
+		t.Errorf("open: ok = %v, wait = %v", ok, wait)
+	}
+	later := now.Add(2 * time.Second)
+	if probe, _, ok := b.allow(later); !ok || !probe {
+		t.Fatal("half-open breaker didn't let a probe through")
+	}
+	if _, _, ok := b.allow(later); ok {
+		t.Error("half-open breaker let a second concurrent probe through")
+	}
+	b.done(true, true, later)
+	if probe, _, ok := b.allow(later); !ok || probe {
+		t.Error("breaker didn't close after a successful probe")
+	}
+}
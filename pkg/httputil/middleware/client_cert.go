@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+// ClientCertConfig holds the configuration for the ClientCertAuth middleware.
+type ClientCertConfig struct {
+	// Roles maps certificate identities to Postgres roles. An identity is a URI SAN
+	// (e.g. a SPIFFE ID), DNS SAN, email SAN or the subject common name, tried in that order.
+	Roles map[string]string `json:"roles"`
+	// DefaultRole, if set, is the role of verified certificates matching none of Roles.
+	DefaultRole string `json:"default_role"`
+}
+
+// ClientCertAuth is middleware authenticating requests by the client certificate verified during the
+// TLS handshake (see httputil.WithClientCerts), for service-to-service access without tokens.
+// The certificate's identity is mapped to a Postgres role, which is set in the request context for the
+// Postgres middleware. The certificate's names are also stored as claims the way VerifyOIDCToken does,
+// with the common name as subject, so OIDCUser works as well.
+// It responds with 401 Unauthorized without a verified certificate and 403 Forbidden for unmapped ones.
+func ClientCertAuth(cfg ClientCertConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				http.Error(w, "Client certificate required", http.StatusUnauthorized)
+				return
+			}
+			cert := r.TLS.VerifiedChains[0][0]
+
+			role, ok := clientCertRole(cert, cfg)
+			if !ok {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), httputil.OIDCUserCtxKey, clientCertClaims(cert, role))
+			ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// clientCertIdentities returns the identities of cert in the order they're matched against roles.
+func clientCertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	return ids
+}
+
+func clientCertRole(cert *x509.Certificate, cfg ClientCertConfig) (string, bool) {
+	for _, id := range clientCertIdentities(cert) {
+		if role, ok := cfg.Roles[id]; ok {
+			return role, true
+		}
+	}
+	return cfg.DefaultRole, cfg.DefaultRole != ""
+}
+
+func clientCertClaims(cert *x509.Certificate, role string) *oidc.IntrospectionResponse {
+	uris := make([]string, len(cert.URIs))
+	for i, u := range cert.URIs {
+		uris[i] = u.String()
+	}
+	user := &oidc.IntrospectionResponse{Active: true, Subject: cert.Subject.CommonName}
+	user.Claims = map[string]any{
+		"cn":        cert.Subject.CommonName,
+		"dns_names": cert.DNSNames,
+		"uris":      uris,
+		"emails":    cert.EmailAddresses,
+		"serial":    cert.SerialNumber.String(),
+		"role":      role,
+	}
+	return user
+}
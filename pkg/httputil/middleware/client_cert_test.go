@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+)
+
+func TestClientCertAuth(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	cfg := ClientCertConfig{Roles: map[string]string{
+		"spiffe://example.org/billing": "billing",
+		"reports.internal":             "reporter",
+		"ops":                          "admin",
+	}}
+
+	tests := []struct {
+		name           string
+		cert           *x509.Certificate
+		expectedStatus int
+		expectedRole   string
+	}{
+		{"no certificate", nil, http.StatusUnauthorized, ""},
+		{"URI SAN", &x509.Certificate{URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "ops"}}, http.StatusOK, "billing"},
+		{"DNS SAN", &x509.Certificate{DNSNames: []string{"reports.internal"}}, http.StatusOK, "reporter"},
+		{"common name", &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}, http.StatusOK, "admin"},
+		{"unmapped", &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role string
+			handler := ClientCertAuth(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				role, _ = r.Context().Value(httputil.PgRoleCtxKey).(string)
+				if user, ok := httputil.OIDCUser(r); !ok || user.Claims["role"] != role {
+					t.Errorf("claims = %v, want role %s", user, role)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cert != nil {
+				tt.cert.SerialNumber = big.NewInt(1)
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert}}}
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus || role != tt.expectedRole {
+				t.Errorf("got %d with role %q, want %d with %q", rr.Code, role, tt.expectedStatus, tt.expectedRole)
+			}
+		})
+	}
+}
@@ -2,15 +2,29 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // CORSOptions defines configuration for CORS.
 type CORSOptions struct {
+	// AllowedOrigins lists the allowed origins. "*" allows any origin; an origin may have a wildcard
+	// subdomain, e.g. "https://*.example.com". The origin of a request is echoed back when it's allowed,
+	// with Vary: Origin, so caches keep responses for different origins apart.
 	AllowedOrigins   []string
 	AllowedMethods   []string
 	AllowedHeaders   []string
+	ExposedHeaders   []string
 	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses, sent as Access-Control-Max-Age.
+	MaxAge time.Duration
+	// AllowPrivateNetwork answers Private Network Access preflights, letting public sites call
+	// servers on private networks, e.g. a pgo instance on localhost.
+	AllowPrivateNetwork bool
+	// Overrides replaces the options for requests whose path starts with a key, e.g. "/admin/".
+	// The longest matching prefix applies. Overrides of overrides are ignored.
+	Overrides map[string]*CORSOptions
 }
 
 // defaultCORSOptions returns the default CORS options.
@@ -26,6 +40,9 @@ func defaultCORSOptions() *CORSOptions {
 // CORSWithOptions creates a CORS middleware with the provided configuration.
 // If options is nil, it will use the default CORS settings.
 // If options is an empty struct (CORSOptions{}), it will create a middleware with no CORS headers.
+//
+// Preflight requests are answered before they reach routes, so use Overrides rather than
+// group middleware to configure CORS differently for some routes.
 func CORSWithOptions(options *CORSOptions) func(http.Handler) http.Handler {
 	if options == nil {
 		options = defaultCORSOptions()
@@ -33,26 +50,107 @@ func CORSWithOptions(options *CORSOptions) func(http.Handler) http.Handler {
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if len(options.AllowedOrigins) > 0 {
-				w.Header().Set("Access-Control-Allow-Origin", strings.Join(options.AllowedOrigins, ","))
-			}
-			if len(options.AllowedMethods) > 0 {
-				w.Header().Set("Access-Control-Allow-Methods", strings.Join(options.AllowedMethods, ","))
-			}
-			if len(options.AllowedHeaders) > 0 {
-				w.Header().Set("Access-Control-Allow-Headers", strings.Join(options.AllowedHeaders, ","))
+			opts := options.forPath(r.URL.Path)
+			h := w.Header()
+
+			allowed := true
+			if origin := r.Header.Get("Origin"); origin != "" {
+				allowOrigin := opts.allowOrigin(origin)
+				allowed = allowOrigin != ""
+				if allowed {
+					h.Set("Access-Control-Allow-Origin", allowOrigin)
+				}
+				if allowOrigin != "*" && len(opts.AllowedOrigins) > 0 {
+					addVary(h, "Origin")
+				}
+			} else if len(opts.AllowedOrigins) > 0 {
+				h.Set("Access-Control-Allow-Origin", strings.Join(opts.AllowedOrigins, ","))
 			}
-			if options.AllowCredentials {
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+			if allowed {
+				if len(opts.AllowedMethods) > 0 {
+					h.Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ","))
+				}
+				if len(opts.AllowedHeaders) > 0 {
+					h.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ","))
+				}
+				if opts.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
 			}
 
 			// Handle preflight request
 			if r.Method == http.MethodOptions {
+				if allowed {
+					if opts.MaxAge > 0 {
+						h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+					}
+					if opts.AllowPrivateNetwork && r.Header.Get("Access-Control-Request-Private-Network") == "true" {
+						h.Set("Access-Control-Allow-Private-Network", "true")
+					}
+				}
+				if len(opts.AllowedOrigins) > 0 {
+					addVary(h, "Access-Control-Request-Method", "Access-Control-Request-Headers")
+				}
 				w.WriteHeader(http.StatusNoContent)
 				return
 			}
 
+			if allowed && len(opts.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(opts.ExposedHeaders, ","))
+			}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// forPath returns the options of the longest override prefix matching path, or o.
+func (o *CORSOptions) forPath(path string) *CORSOptions {
+	opts, longest := o, -1
+	for prefix, override := range o.Overrides {
+		if override != nil && strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			opts, longest = override, len(prefix)
+		}
+	}
+	return opts
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" if it isn't allowed.
+func (o *CORSOptions) allowOrigin(origin string) string {
+	for _, allowed := range o.AllowedOrigins {
+		switch {
+		case allowed == "*":
+			// browsers reject credentialed responses allowing any origin
+			if o.AllowCredentials {
+				return origin
+			}
+			return "*"
+		case strings.EqualFold(allowed, origin):
+			return origin
+		case strings.Contains(allowed, "://*."):
+			scheme, domain, _ := strings.Cut(allowed, "://*")
+			if strings.HasPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://") &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(domain)) {
+				return origin
+			}
+		}
+	}
+	return ""
+}
+
+// addVary adds values to the Vary header unless they're present already, e.g. added by nested middleware.
+func addVary(h http.Header, values ...string) {
+	existing := strings.Join(h.Values("Vary"), ",")
+	for _, v := range values {
+		found := false
+		for _, e := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(e), v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			h.Add("Vary", v)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestCORSWithOptions(t *testing.T) {
@@ -88,3 +89,77 @@ func TestCORSWithOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCORSOrigins(t *testing.T) {
+	options := &CORSOptions{
+		AllowedOrigins:      []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowedMethods:      []string{"GET"},
+		ExposedHeaders:      []string{"X-Request-Id"},
+		MaxAge:              10 * time.Minute,
+		AllowPrivateNetwork: true,
+		Overrides: map[string]*CORSOptions{
+			"/public/": {AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+		},
+	}
+	handler := CORSWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		headers         map[string]string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:   "allowed origin",
+			method: http.MethodGet, path: "/api", origin: "https://app.example.com",
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "X-Request-Id",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:   "wildcard subdomain",
+			method: http.MethodGet, path: "/api", origin: "https://pr-1.preview.example.com",
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": "https://pr-1.preview.example.com"},
+		},
+		{
+			name:   "disallowed origin",
+			method: http.MethodGet, path: "/api", origin: "https://evil.com",
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": "", "Vary": "Origin"},
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions, path: "/api", origin: "https://app.example.com",
+			headers: map[string]string{"Access-Control-Request-Private-Network": "true"},
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":          "https://app.example.com",
+				"Access-Control-Max-Age":               "600",
+				"Access-Control-Allow-Private-Network": "true",
+			},
+		},
+		{
+			name:   "override",
+			method: http.MethodOptions, path: "/public/logo.png", origin: "https://evil.com",
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Max-Age": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			for header, expectedValue := range tt.expectedHeaders {
+				if value := rr.Header().Get(header); value != expectedValue {
+					t.Errorf("header %s: expected %q, got %q", header, expectedValue, value)
+				}
+			}
+		})
+	}
+}
@@ -2,19 +2,44 @@ package middleware
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"io/fs"
 	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"log"
 )
 
+// StaticConfig holds the configuration for StaticWithConfig.
+type StaticConfig struct {
+	// Directory is the directory to serve, on the host or in FS.
+	Directory string
+	// FS, if set, is the file system Directory is in, e.g. an embed.FS. Otherwise Directory is on the host.
+	FS fs.FS
+	// SPAFallback serves index.html for paths not mapped to a file, for single page apps with client side routing.
+	SPAFallback bool
+	// CacheControl is the Cache-Control header of files, e.g. "public, max-age=31536000, immutable"
+	// for fingerprinted assets. Empty by default.
+	CacheControl string
+	// IndexCacheControl is the Cache-Control header of index.html files, which usually reference
+	// fingerprinted assets and should be revalidated. Defaults to "no-cache".
+	IndexCacheControl string
+	// Precompressed serves a file's .br or .gz sibling, e.g. app.js.br for app.js, with the matching
+	// Content-Encoding when it exists and the client accepts the encoding.
+	Precompressed bool
+}
+
 // Static returns an http.Handler that serves static files.
-// If the embeddedFS arg is not nil, it uses serveEmbedded; else, serveLocal
+// If the embeddedFS arg is not nil, it serves directory from it; else, from the host machine/container.
 //
 // Example usage:
 //
@@ -24,104 +49,155 @@ import (
 // This will serve files from the "dist" directory of the embedded file system and use "index.html"
 // as a fallback for routes not directly mapped to a file.
 func Static(directory string, spaFallback bool, embeddedFS *embed.FS) http.Handler {
+	cfg := StaticConfig{Directory: directory, SPAFallback: spaFallback}
 	if embeddedFS != nil {
-		return serveEmbedded(*embeddedFS, directory, spaFallback)
+		cfg.FS = *embeddedFS
 	}
-	return serveLocal(directory, spaFallback)
+	return StaticWithConfig(cfg)
 }
 
-func serveEmbedded(embeddedFS embed.FS, baseDir string, spaFallback bool) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		filePath := filepath.Join(baseDir, r.URL.Path)
-		if !isValidFilePath(filePath) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
+// StaticWithConfig returns an http.Handler that serves static files as configured by cfg.
+// Responses carry ETag and Last-Modified headers (file system permitting), so clients can revalidate
+// cached files, and Range requests are supported for large files.
+func StaticWithConfig(cfg StaticConfig) http.Handler {
+	if cfg.IndexCacheControl == "" {
+		cfg.IndexCacheControl = "no-cache"
+	}
 
-		fileData, fileInfo, err := readFileFromFS(embeddedFS, filePath)
-		if err != nil && spaFallback {
-			filePath = filepath.Join(baseDir, "index.html")
-			fileData, fileInfo, err = readFileFromFS(embeddedFS, filePath)
+	var fsys fs.FS
+	if cfg.FS != nil {
+		sub, err := fs.Sub(cfg.FS, path.Clean(filepath.ToSlash(cfg.Directory)))
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", cfg.Directory, err)
 		}
-
+		fsys = sub
+	} else {
+		absDir, err := filepath.Abs(cfg.Directory)
 		if err != nil {
-			http.NotFound(w, r)
-			return
+			log.Fatalf("Failed to resolve absolute path for %s: %v", cfg.Directory, err)
 		}
+		fsys = os.DirFS(absDir)
+	}
 
-		setContentType(w, filePath)
-		http.ServeContent(w, r, filePath, fileInfo.ModTime(), bytes.NewReader(fileData))
-	})
+	s := &staticServer{fsys: fsys, cfg: cfg}
+	return http.HandlerFunc(s.serveHTTP)
 }
 
-// serveLocal returns an http.Handler that serves static files from the given directory in the host machine/container
-func serveLocal(directory string, spaFallback bool) http.Handler {
-	absDir, err := filepath.Abs(directory)
-	if err != nil {
-		log.Fatalf("Failed to resolve absolute path for %s: %v", directory, err)
-	}
+type staticServer struct {
+	fsys fs.FS
+	cfg  StaticConfig
+	// etags caches content hashes of files without modification times, such as embedded ones
+	etags sync.Map
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := strings.TrimPrefix(r.URL.Path, "/")
-		cleanPath := filepath.Clean(path)
+func (s *staticServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// cleaning a rooted path removes any .. elements
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
 
-		requestedPath := filepath.Join(absDir, cleanPath)
-		if !isSubPath(absDir, requestedPath) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+	info, err := fs.Stat(s.fsys, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(s.fsys, name)
+		if err != nil && !s.cfg.SPAFallback {
+			http.Error(w, "Directory listing not allowed", http.StatusForbidden)
 			return
 		}
+	}
+	if err != nil && s.cfg.SPAFallback {
+		name = "index.html"
+		info, err = fs.Stat(s.fsys, name)
+	}
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
 
-		fileInfo, err := os.Stat(requestedPath)
-		if err != nil && spaFallback {
-			indexPath := filepath.Join(absDir, "index.html")
-			requestedPath = indexPath
-			fileInfo, err = os.Stat(indexPath)
-		}
+	setContentType(w, name)
+	if path.Base(name) == "index.html" {
+		w.Header().Set("Cache-Control", s.cfg.IndexCacheControl)
+	} else if s.cfg.CacheControl != "" {
+		w.Header().Set("Cache-Control", s.cfg.CacheControl)
+	}
 
-		if err != nil {
-			http.NotFound(w, r)
-			return
+	servedName, encoding := name, ""
+	if s.cfg.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		for _, enc := range []struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+			if !acceptsEncoding(r, enc.name) {
+				continue
+			}
+			if encInfo, err := fs.Stat(s.fsys, name+enc.ext); err == nil && !encInfo.IsDir() {
+				servedName, encoding, info = name+enc.ext, enc.name, encInfo
+				break
+			}
 		}
+	}
 
-		if fileInfo.IsDir() && !spaFallback {
-			http.Error(w, "Directory listing not allowed", http.StatusForbidden)
+	f, err := s.fsys.Open(servedName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-
-		setContentType(w, requestedPath)
-		http.ServeFile(w, r, requestedPath)
-	})
-}
-
-// isValidFilePath checks if the file path is valid and does not contain any directory traversal attempts.
-func isValidFilePath(filePath string) bool {
-	cleaned := filepath.Clean(filePath)
-	if !strings.HasPrefix(cleaned, ".") {
-		return true
-	} else {
-		return false
+		content = bytes.NewReader(data)
 	}
-}
 
-// readFileFromFS reads a file from the embedded filesystem and returns its data and FileInfo.
-func readFileFromFS(embeddedFS embed.FS, filePath string) ([]byte, fs.FileInfo, error) {
-	fileData, err := fs.ReadFile(embeddedFS, filePath)
+	etag, err := s.etag(servedName, info, content)
 	if err != nil {
-		return nil, nil, err
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
 	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
 
-	fileInfo, err := fs.Stat(embeddedFS, filePath)
-	if err != nil {
-		return nil, nil, err
+// etag returns a weak ETag from the size and modification time of a file, or a strong one from
+// its content if it has no modification time.
+func (s *staticServer) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	}
+	if etag, ok := s.etags.Load(name); ok {
+		return etag.(string), nil
 	}
 
-	return fileData, fileInfo, nil
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(name, etag)
+	return etag, nil
 }
 
-// isSubPath checks if a path is a subdirectory of the base directory.
-func isSubPath(baseDir, path string) bool {
-	rel, err := filepath.Rel(baseDir, path)
-	return err == nil && !strings.HasPrefix(rel, "..")
+// acceptsEncoding reports whether the request's Accept-Encoding header allows encoding.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		// q=0 means not acceptable
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
 }
 
 // setContentType sets the Content-Type header based on the file extension.
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticWithConfig(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dist/index.html":    {Data: []byte("<html>app</html>")},
+		"dist/app.js":        {Data: []byte("console.log('app')")},
+		"dist/app.js.br":     {Data: []byte("brotli")},
+		"dist/docs/guide.md": {Data: []byte("# guide")},
+	}
+	handler := StaticWithConfig(StaticConfig{
+		Directory:     "dist",
+		FS:            fsys,
+		SPAFallback:   true,
+		CacheControl:  "public, max-age=31536000, immutable",
+		Precompressed: true,
+	})
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("/app.js", nil)
+	if rr.Body.String() != "console.log('app')" || rr.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("app.js: got %q with Cache-Control %q", rr.Body.String(), rr.Header().Get("Cache-Control"))
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("ETag = %q, want a strong content hash", etag)
+	}
+
+	if rr := serve("/app.js", map[string]string{"If-None-Match": etag}); rr.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status = %d, want 304", rr.Code)
+	}
+
+	rr = serve("/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	if rr.Body.String() != "brotli" || rr.Header().Get("Content-Encoding") != "br" ||
+		!strings.HasPrefix(rr.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("precompressed: got %q, headers %v", rr.Body.String(), rr.Header())
+	}
+	if rr := serve("/app.js", map[string]string{"Accept-Encoding": "br;q=0"}); rr.Header().Get("Content-Encoding") != "" {
+		t.Error("served brotli to a client refusing it")
+	}
+
+	rr = serve("/app.js", map[string]string{"Range": "bytes=0-6"})
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "console" {
+		t.Errorf("range: got %d %q", rr.Code, rr.Body.String())
+	}
+
+	for _, path := range []string{"/", "/users/1", "/../secret"} {
+		rr = serve(path, nil)
+		if rr.Body.String() != "<html>app</html>" || rr.Header().Get("Cache-Control") != "no-cache" {
+			t.Errorf("%s: got %q with Cache-Control %q, want index.html", path, rr.Body.String(), rr.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestStaticLocal(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0o755)
+	handler := Static(dir, false, nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/a.txt", nil))
+	if rr.Body.String() != "hello" || !strings.HasPrefix(rr.Header().Get("ETag"), `W/"`) || rr.Header().Get("Last-Modified") == "" {
+		t.Errorf("got %q, headers %v", rr.Body.String(), rr.Header())
+	}
+
+	for path, want := range map[string]int{"/missing": http.StatusNotFound, "/sub": http.StatusForbidden} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != want {
+			t.Errorf("%s: status = %d, want %d", path, rr.Code, want)
+		}
+	}
+}
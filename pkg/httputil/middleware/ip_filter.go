@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+)
+
+// IPFilterConfig holds the configuration for the IPFilter middleware.
+// Ranges are CIDRs such as "10.0.0.0/8" or single addresses such as "192.0.2.1" or "::1".
+type IPFilterConfig struct {
+	// Allow lists the ranges clients must be in, if any. Empty allows all clients not denied.
+	Allow []string
+	// Deny lists the ranges of rejected clients. It takes precedence over Allow.
+	Deny []string
+	// TrustedProxies lists the ranges of reverse proxies, e.g. load balancers, whose X-Forwarded-For headers
+	// are trusted. The client is the rightmost X-Forwarded-For address not in TrustedProxies, as addresses to its
+	// left are set by the client itself. Without trusted proxies, the client is the connection's remote address.
+	TrustedProxies []string
+}
+
+// IPFilter is middleware that responds with 403 Forbidden to clients whose IP address is denied or not allowed
+// by cfg. Use it before the Postgres middleware, so rejected requests do no database work, e.g. to restrict admin
+// endpoints to an internal network. It panics if a range is invalid.
+func IPFilter(cfg IPFilterConfig) func(http.Handler) http.Handler {
+	allow, deny, trusted := mustParsePrefixes(cfg.Allow), mustParsePrefixes(cfg.Deny), mustParsePrefixes(cfg.TrustedProxies)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip, ok := clientIP(r, trusted)
+			if !ok || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+				httputil.Error(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the address of the client, skipping trusted proxies in X-Forwarded-For.
+func clientIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	ip, ok := parseIP(r.RemoteAddr)
+	if !ok || !containsIP(trusted, ip) {
+		return ip, ok
+	}
+
+	// X-Forwarded-For may be sent as several headers; later ones were appended by later proxies
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseIP(strings.TrimSpace(hops[i]))
+		if !ok {
+			// a malformed entry can't be attributed, so the client is unknown
+			return netip.Addr{}, false
+		}
+		ip = hop
+		if !containsIP(trusted, ip) {
+			break
+		}
+	}
+	return ip, true
+}
+
+// parseIP parses an address with or without a port.
+func parseIP(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+func containsIP(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParsePrefixes(ranges []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, s := range ranges {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				panic(fmt.Sprintf("invalid IP range %q: %v", s, err))
+			}
+			ip = ip.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			panic(fmt.Sprintf("invalid IP range %q: %v", s, err))
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	cfg := IPFilterConfig{
+		Allow:          []string{"10.0.0.0/8", "2001:db8::/32"},
+		Deny:           []string{"10.0.0.66"},
+		TrustedProxies: []string{"192.0.2.0/24"},
+	}
+	handler := IPFilter(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		expectedStatus int
+	}{
+		{"allowed", "10.1.2.3:1234", nil, http.StatusOK},
+		{"allowed IPv6", "[2001:db8::1]:1234", nil, http.StatusOK},
+		{"not allowed", "203.0.113.5:1234", nil, http.StatusForbidden},
+		{"denied", "10.0.0.66:1234", nil, http.StatusForbidden},
+		{"untrusted proxy's header ignored", "203.0.113.5:1234", []string{"10.1.2.3"}, http.StatusForbidden},
+		{"via trusted proxy", "192.0.2.1:1234", []string{"10.1.2.3"}, http.StatusOK},
+		{"via trusted proxies", "192.0.2.1:1234", []string{"10.1.2.3, 192.0.2.2"}, http.StatusOK},
+		{"spoofed by client", "192.0.2.1:1234", []string{"10.1.2.3, 203.0.113.5"}, http.StatusForbidden},
+		{"several headers", "192.0.2.1:1234", []string{"203.0.113.5", "10.1.2.3"}, http.StatusOK},
+		{"malformed header", "192.0.2.1:1234", []string{"10.1.2.3, bogus"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, h := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", h)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestIPFilterInvalidRange(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid range")
+		}
+	}()
+	IPFilter(IPFilterConfig{Allow: []string{"10.0.0.0/33"}})
+}
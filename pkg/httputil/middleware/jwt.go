@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+	"golang.org/x/sync/singleflight"
+)
+
+// JWTConfig holds the configuration for VerifyJWT. One of JWKSURL, PublicKeys or Secret must be set.
+type JWTConfig struct {
+	// JWKSURL is fetched for RS256/ES256 verification keys, which are selected by the token's kid header.
+	JWKSURL string `json:"jwks_url"`
+	// PublicKeys are PEM encoded RSA or ECDSA public keys or certificates.
+	PublicKeys []string `json:"public_keys"`
+	// Secret is the shared secret of HS256 tokens, at least 32 bytes long.
+	Secret string `json:"secret"`
+	// Issuer, if set, must match the token's iss claim.
+	Issuer string `json:"issuer"`
+	// Audience, if set, must contain one of the token's aud values.
+	Audience []string `json:"audience"`
+	// ClockSkew is the tolerance for exp, nbf and iat checks. Defaults to one minute.
+	ClockSkew time.Duration `json:"clock_skew"`
+	// JWKSRefreshInterval is how long fetched keys are cached. Defaults to one hour.
+	// Keys are also refetched when a token names an unknown kid, at most once a minute. Failed fetches are
+	// retried after jwksRetryInterval at the earliest, verifying tokens with the keys fetched last meanwhile.
+	JWKSRefreshInterval time.Duration `json:"jwks_refresh_interval"`
+}
+
+var jwtAlgorithms = []jose.SignatureAlgorithm{jose.HS256, jose.RS256, jose.ES256}
+
+const (
+	// jwksRetryInterval is the least time between a failed JWKS fetch and the next.
+	jwksRetryInterval = 10 * time.Second
+	// jwksFetchTimeout limits JWKS fetches, which requests waiting for the keys share.
+	jwksFetchTimeout = 10 * time.Second
+)
+
+// VerifyJWT is middleware that verifies JWTs in Authorization headers against static keys or a JWKS URL,
+// for identity providers or internal services without OIDC discovery or introspection.
+// The token's claims are stored in the request context the same way VerifyOIDCToken does,
+// so OIDCUser and PgJWTAuthz work with either middleware.
+// By default, it sends a 401 Unauthorized response if the token is missing or invalid.
+// If send401Unauthorized is false, it allows requests with other authorization schemes to continue,
+// as well as requests with invalid tokens if the anonymous role (see httputil.AnonRole) is set.
+func VerifyJWT(cfg JWTConfig, send401Unauthorized ...bool) func(http.Handler) http.Handler {
+	send401 := true // Default behavior: Send 401 on failure
+	if len(send401Unauthorized) > 0 {
+		send401 = send401Unauthorized[0]
+	}
+
+	keys, err := newJWTKeySet(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT keys: %v", err)
+	}
+	skew := cfg.ClockSkew
+	if skew == 0 {
+		skew = time.Minute
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+				if !send401 {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if authHeader == "" {
+					http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+				} else {
+					http.Error(w, "Invalid token format", http.StatusUnauthorized)
+				}
+				return
+			}
+
+			user, err := verifyJWT(r.Context(), keys, cfg, skew, authHeader[len("bearer "):])
+			if err != nil {
+				if !send401 && httputil.AnonRole() != "" {
+					// treat the request as anonymous, as if it had no token
+					next.ServeHTTP(w, r)
+					return
+				}
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), httputil.OIDCUserCtxKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// verifyJWT checks the token's signature and registered claims and returns its claims as an introspection response.
+func verifyJWT(ctx context.Context, keys *jwtKeySet, cfg JWTConfig, skew time.Duration, token string) (*oidc.IntrospectionResponse, error) {
+	tok, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+	if len(tok.Headers) != 1 {
+		return nil, fmt.Errorf("unexpected number of signatures")
+	}
+	header := tok.Headers[0]
+
+	candidates, err := keys.lookup(ctx, header.KeyID, jose.SignatureAlgorithm(header.Algorithm))
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.Claims
+	var raw json.RawMessage
+	verified := false
+	for _, key := range candidates {
+		if err := tok.Claims(key, &claims, &raw); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	expected := jwt.Expected{Issuer: cfg.Issuer, AnyAudience: jwt.Audience(cfg.Audience)}
+	if err := claims.ValidateWithLeeway(expected, skew); err != nil {
+		return nil, err
+	}
+	if claims.Expiry == nil {
+		// tokens that never expire can't be revoked
+		return nil, fmt.Errorf("token has no exp claim")
+	}
+
+	user := new(oidc.IntrospectionResponse)
+	if err := json.Unmarshal(raw, user); err != nil {
+		return nil, err
+	}
+	user.Active = true
+	return user, nil
+}
+
+// jwtKeySet resolves verification keys for JWTs.
+type jwtKeySet struct {
+	static  []jose.JSONWebKey // PEM keys and the HS256 secret
+	jwksURL string
+	refresh time.Duration
+
+	fetches singleflight.Group // of the JWKS, shared by the requests needing it
+
+	mu          sync.Mutex
+	remote      jose.JSONWebKeySet
+	fetchedAt   time.Time // of the last successful fetch
+	attemptedAt time.Time // of the last fetch, successful or not
+	fetchErr    error     // of the last fetch
+}
+
+func newJWTKeySet(cfg JWTConfig) (*jwtKeySet, error) {
+	ks := &jwtKeySet{jwksURL: cfg.JWKSURL, refresh: cfg.JWKSRefreshInterval}
+	if ks.refresh == 0 {
+		ks.refresh = time.Hour
+	}
+	if cfg.Secret != "" {
+		if len(cfg.Secret) < 32 {
+			return nil, fmt.Errorf("HS256 secret must be at least 32 bytes")
+		}
+		ks.static = append(ks.static, jose.JSONWebKey{Key: []byte(cfg.Secret), Algorithm: string(jose.HS256)})
+	}
+	for _, p := range cfg.PublicKeys {
+		key, err := parsePEMPublicKey(p)
+		if err != nil {
+			return nil, err
+		}
+		ks.static = append(ks.static, jose.JSONWebKey{Key: key})
+	}
+	if len(ks.static) == 0 && ks.jwksURL == "" {
+		return nil, fmt.Errorf("one of jwks_url, public_keys or secret is required")
+	}
+	return ks, nil
+}
+
+// lookup returns the keys a token signed with alg and kid may verify against.
+func (ks *jwtKeySet) lookup(ctx context.Context, kid string, alg jose.SignatureAlgorithm) ([]interface{}, error) {
+	var keys []interface{}
+	for _, k := range ks.static {
+		// never verify an asymmetric algorithm with the shared secret, or the other way round
+		if _, symmetric := k.Key.([]byte); symmetric == (alg == jose.HS256) {
+			keys = append(keys, k.Key)
+		}
+	}
+	if ks.jwksURL == "" || alg == jose.HS256 {
+		return keys, nil
+	}
+
+	ks.mu.Lock()
+	refetch := ks.needsFetch(kid)
+	ks.mu.Unlock()
+	if refetch {
+		// fetched without holding ks.mu, so requests with cached keys aren't held up meanwhile
+		fetched := ks.fetches.DoChan("jwks", func() (interface{}, error) {
+			ks.refetch(kid)
+			return nil, nil
+		})
+		select {
+		case <-fetched:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.fetchedAt.IsZero() {
+		return nil, ks.fetchErr
+	}
+	remote := ks.remote.Keys
+	if kid != "" {
+		remote = ks.remote.Key(kid)
+	}
+	for _, k := range remote {
+		if k.Use == "" || k.Use == "sig" {
+			keys = append(keys, k.Key)
+		}
+	}
+	return keys, nil
+}
+
+// needsFetch reports whether the JWKS must be fetched for a token with kid: the keys are stale, or don't
+// include kid and weren't fetched in the last minute. Failed fetches aren't retried for jwksRetryInterval.
+// The caller must hold ks.mu.
+func (ks *jwtKeySet) needsFetch(kid string) bool {
+	if ks.fetchErr != nil && time.Since(ks.attemptedAt) < jwksRetryInterval {
+		return false
+	}
+	stale := time.Since(ks.fetchedAt) > ks.refresh
+	unknown := kid != "" && len(ks.remote.Key(kid)) == 0 && time.Since(ks.fetchedAt) > time.Minute
+	return stale || unknown
+}
+
+// refetch fetches the JWKS if it's still needed for a token with kid, recording the attempt.
+func (ks *jwtKeySet) refetch(kid string) {
+	ks.mu.Lock()
+	refetch := ks.needsFetch(kid)
+	ks.mu.Unlock()
+	if !refetch {
+		return // fetched by another request meanwhile
+	}
+
+	// not the request's context, as other requests wait for the fetch too
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	set, err := ks.fetch(ctx)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.attemptedAt, ks.fetchErr = time.Now(), err
+	if err != nil {
+		if !ks.fetchedAt.IsZero() {
+			log.Printf("Failed to refresh JWKS, using cached keys: %v", err)
+		}
+		return
+	}
+	ks.remote, ks.fetchedAt = set, ks.attemptedAt
+}
+
+// fetch downloads the JWKS.
+func (ks *jwtKeySet) fetch(ctx context.Context) (jose.JSONWebKeySet, error) {
+	var set jose.JSONWebKeySet
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.jwksURL, nil)
+	if err != nil {
+		return set, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return set, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return set, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return set, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	return set, nil
+}
+
+// parsePEMPublicKey parses a PEM encoded public key or certificate.
+func parsePEMPublicKey(s string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM public key")
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const jwtTestSecret = "0123456789abcdef0123456789abcdef"
+
+func signJWT(t *testing.T, alg jose.SignatureAlgorithm, key interface{}, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if kid != "" {
+		opts = opts.WithHeader("kid", kid)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &ecKey.PublicKey, KeyID: "ec1", Algorithm: "ES256", Use: "sig"}}})
+	}))
+	defer jwks.Close()
+
+	now := time.Now().Unix()
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": "https://issuer.test", "aud": "pgo", "sub": "alice", "exp": now + 60, "role": "editor"}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	cfg := JWTConfig{
+		Secret:     jwtTestSecret,
+		PublicKeys: []string{rsaPEM},
+		JWKSURL:    jwks.URL,
+		Issuer:     "https://issuer.test",
+		Audience:   []string{"pgo"},
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"HS256", signJWT(t, jose.HS256, []byte(jwtTestSecret), "", claims(nil)), http.StatusOK},
+		{"RS256 PEM key", signJWT(t, jose.RS256, rsaKey, "", claims(nil)), http.StatusOK},
+		{"ES256 JWKS key", signJWT(t, jose.ES256, ecKey, "ec1", claims(nil)), http.StatusOK},
+		{"wrong secret", signJWT(t, jose.HS256, []byte(jwtTestSecret+"x"), "", claims(nil)), http.StatusUnauthorized},
+		{"wrong issuer", signJWT(t, jose.HS256, []byte(jwtTestSecret), "", claims(map[string]interface{}{"iss": "https://evil.test"})), http.StatusUnauthorized},
+		{"wrong audience", signJWT(t, jose.HS256, []byte(jwtTestSecret), "", claims(map[string]interface{}{"aud": "other"})), http.StatusUnauthorized},
+		{"expired", signJWT(t, jose.HS256, []byte(jwtTestSecret), "", claims(map[string]interface{}{"exp": now - 120})), http.StatusUnauthorized},
+		{"without exp", signJWT(t, jose.HS256, []byte(jwtTestSecret), "", claims(map[string]interface{}{"exp": nil})), http.StatusUnauthorized},
+		{"expired within clock skew", signJWT(t, jose.HS256, []byte(jwtTestSecret), "", claims(map[string]interface{}{"exp": now - 10})), http.StatusOK},
+		{"malformed", "not-a-jwt", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role interface{}
+			handler := VerifyJWT(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, _ := httputil.OIDCUser(r)
+				role = user.Claims["role"]
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.expectedStatus, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && role != "editor" {
+				t.Errorf("role claim = %v, want editor", role)
+			}
+		})
+	}
+}
+
+func TestPgJWTAuthz(t *testing.T) {
+	token := signJWT(t, jose.HS256, []byte(jwtTestSecret), "", map[string]interface{}{"role": "editor", "exp": time.Now().Unix() + 60})
+
+	var authz AuthzResponse
+	handler := VerifyJWT(JWTConfig{Secret: jwtTestSecret})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authz, _ = PgJWTAuthz("role")(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !authz.Allowed || authz.Role != "editor" {
+		t.Errorf("got %+v, want editor allowed", authz)
+	}
+}
+
+func TestVerifyJWTAnon(t *testing.T) {
+	t.Setenv("PGO_POSTGRES_ANON_ROLE", "anon")
+	token := signJWT(t, jose.HS256, []byte(jwtTestSecret+"x"), "", map[string]interface{}{"role": "editor"})
+
+	var hasUser bool
+	handler := VerifyJWT(JWTConfig{Secret: jwtTestSecret}, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, hasUser = httputil.OIDCUser(r)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || hasUser {
+		t.Errorf("status = %d, user = %v, want anonymous request passed through", rr.Code, hasUser)
+	}
+}
+
+func TestVerifyJWTRateLimitsFailedFetches(t *testing.T) {
+	var fetches atomic.Int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer jwks.Close()
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	token := signJWT(t, jose.ES256, ecKey, "ec1", map[string]interface{}{"exp": time.Now().Unix() + 60})
+	handler := VerifyJWT(JWTConfig{JWKSURL: jwks.URL})(http.NotFoundHandler())
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnauthorized)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
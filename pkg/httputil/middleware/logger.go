@@ -2,19 +2,23 @@ package middleware
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/edgeflare/pgo/pkg/httputil"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // ResponseRecorder is a wrapper for http.ResponseWriter to capture status codes and durations.
 type ResponseRecorder struct {
 	http.ResponseWriter
 	StatusCode int
+	Size       int // bytes written
 	start      time.Time
 }
 
@@ -32,7 +36,9 @@ func (rr *ResponseRecorder) WriteHeader(statusCode int) {
 }
 
 func (rr *ResponseRecorder) Write(b []byte) (int, error) {
-	return rr.ResponseWriter.Write(b)
+	n, err := rr.ResponseWriter.Write(b)
+	rr.Size += n
+	return n, err
 }
 
 // Retrieve log metadata from context
@@ -46,7 +52,20 @@ func GetLogEntryMetadata(ctx context.Context) map[string]interface{} {
 // LoggerOptions defines configuration for the logger middleware.
 type LoggerOptions struct {
 	Logger *zap.Logger
-	Format func(reqID string, rec *ResponseRecorder, r *http.Request, latency time.Duration) []zap.Field
+	// Handler, if set, receives the request logs instead of Logger, so any log/slog backend can be used.
+	Handler slog.Handler
+	Format  func(reqID string, rec *ResponseRecorder, r *http.Request, latency time.Duration) []zap.Field
+	// Sampling, if set, limits the logs of successful requests per route, for high-QPS routes.
+	// Responses with 5xx statuses are always logged.
+	Sampling *LogSampling
+}
+
+// LogSampling logs the first First requests to each route per Tick, then every Thereafter-th request,
+// if Thereafter is positive, like zap's sampler.
+type LogSampling struct {
+	Tick       time.Duration // Default: 1s
+	First      int
+	Thereafter int
 }
 
 var defaultLogger *zap.Logger
@@ -60,10 +79,21 @@ func init() {
 	defer defaultLogger.Sync()
 }
 
+// LoggerWithOptions is middleware that logs each response with its request ID, status, latency and Postgres role,
+// and the trace ID when the Tracing middleware is used. The request ID, role, trace ID and route set by middleware
+// running after it, such as Postgres, are included too.
 func LoggerWithOptions(options *LoggerOptions) func(http.Handler) http.Handler {
 	if options == nil {
 		options = &LoggerOptions{Logger: defaultLogger}
 	}
+	if options.Logger == nil && options.Handler == nil {
+		options.Logger = defaultLogger
+	}
+	// handlers may retrieve the logger from the request context
+	ctxLogger := options.Logger
+	if ctxLogger == nil {
+		ctxLogger = zap.NewNop()
+	}
 
 	if options.Format == nil {
 		options.Format = func(reqID string, rec *ResponseRecorder, r *http.Request, latency time.Duration) []zap.Field {
@@ -80,36 +110,143 @@ func LoggerWithOptions(options *LoggerOptions) func(http.Handler) http.Handler {
 		}
 	}
 
+	var sampler *logSampler
+	if options.Sampling != nil {
+		sampler = newLogSampler(*options.Sampling)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			if _, ok := r.Context().Value(httputil.LogEntryCtxKey).(*zap.Logger); !ok {
-				reqID, ok := r.Context().Value(httputil.RequestIDCtxKey).(string)
-				if !ok {
-					reqID = uuid.Nil.String()
-				}
-
+				fields := &logFields{}
 				rec := NewResponseRecorder(w)
 				// try to minimize the data passed via context
-				ctx := context.WithValue(r.Context(), httputil.LogEntryCtxKey, options.Logger)
+				ctx := context.WithValue(r.Context(), httputil.LogEntryCtxKey, ctxLogger)
+				ctx = context.WithValue(ctx, logFieldsCtxKey, fields)
 				r = r.WithContext(ctx)
 
 				next.ServeHTTP(rec, r)
 
 				latency := time.Since(start)
+				fields.mu.Lock()
+				defer fields.mu.Unlock()
 
+				if sampler != nil && rec.StatusCode < http.StatusInternalServerError {
+					if !sampler.sample(r.Method+" "+r.Pattern, start) {
+						return
+					}
+				}
+
+				reqID, ok := r.Context().Value(httputil.RequestIDCtxKey).(string)
+				if !ok {
+					reqID = fields.requestID
+				}
+				if reqID == "" {
+					reqID = uuid.Nil.String()
+				}
 				pgRole, ok := r.Context().Value(httputil.PgRoleCtxKey).(string)
 				if !ok {
-					fmt.Println("TODO: FIX PG_ROLE in logger: ", pgRole)
+					pgRole = fields.role
+				}
+				if pgRole == "" {
 					pgRole = "unknown"
 				}
+				traceID := fields.traceID
+				if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+					traceID = sc.TraceID().String()
+				}
 
-				fields := options.Format(reqID, rec, r, latency)
-				fields = append(fields, zap.String("pg_role", pgRole))
-				options.Logger.Info("response", fields...)
+				zapFields := options.Format(reqID, rec, r, latency)
+				zapFields = append(zapFields, zap.String("pg_role", pgRole))
+				if traceID != "" {
+					zapFields = append(zapFields, zap.String("trace_id", traceID))
+				}
+				if options.Handler != nil {
+					logToHandler(r.Context(), options.Handler, zapFields)
+					return
+				}
+				options.Logger.Info("response", zapFields...)
 			} else {
 				next.ServeHTTP(w, r)
 			}
 		})
 	}
 }
+
+// logToHandler logs a response with zap fields to an slog.Handler.
+func logToHandler(ctx context.Context, handler slog.Handler, fields []zap.Field) {
+	if !handler.Enabled(ctx, slog.LevelInfo) {
+		return
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "response", 0)
+	for _, f := range fields {
+		if v, ok := enc.Fields[f.Key]; ok {
+			record.AddAttrs(slog.Any(f.Key, v))
+		}
+	}
+	handler.Handle(ctx, record)
+}
+
+// logFields collects request log fields from middleware running after the logger, whose context changes
+// the logger can't see.
+type logFields struct {
+	mu        sync.Mutex
+	requestID string
+	role      string
+	traceID   string
+}
+
+const logFieldsCtxKey httputil.ContextKey = "LogFields"
+
+// annotateLog updates the request log fields in ctx, if the request is logged.
+func annotateLog(ctx context.Context, update func(f *logFields)) {
+	if f, ok := ctx.Value(logFieldsCtxKey).(*logFields); ok {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		update(f)
+	}
+}
+
+// logSampler counts requests per key and tick.
+type logSampler struct {
+	cfg    LogSampling
+	mu     sync.Mutex
+	counts map[string]*logSampleCount
+}
+
+type logSampleCount struct {
+	tick time.Time
+	n    int
+}
+
+func newLogSampler(cfg LogSampling) *logSampler {
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Second
+	}
+	return &logSampler{cfg: cfg, counts: map[string]*logSampleCount{}}
+}
+
+// sample reports whether the request to key at now is logged.
+func (s *logSampler) sample(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tick := now.Truncate(s.cfg.Tick)
+	c, ok := s.counts[key]
+	if !ok {
+		c = &logSampleCount{}
+		s.counts[key] = c
+	}
+	if !c.tick.Equal(tick) {
+		c.tick, c.n = tick, 0
+	}
+	c.n++
+	if c.n <= s.cfg.First {
+		return true
+	}
+	return s.cfg.Thereafter > 0 && (c.n-s.cfg.First)%s.cfg.Thereafter == 0
+}
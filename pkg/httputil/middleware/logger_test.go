@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -131,3 +134,46 @@ func TestLoggerWithRequestID(t *testing.T) {
 	assert.Equal(t, "response", logs.All()[0].Message)
 	assert.Equal(t, reqID, logs.All()[0].ContextMap()["req_id"])
 }
+
+func TestLoggerWithSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	middleware := LoggerWithOptions(&LoggerOptions{Handler: slog.NewJSONHandler(&buf, nil)})
+
+	// the role is set by inner middleware, in a context the logger doesn't see
+	handler := middleware(RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizeRole(r.Context(), []AuthzFunc{func(ctx context.Context) (AuthzResponse, error) {
+			return AuthzResponse{Role: "editor", Allowed: true}, nil
+		}})
+		w.WriteHeader(http.StatusCreated)
+	})))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "http://example.com/foo", nil))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "response", entry["msg"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, "editor", entry["pg_role"])
+	assert.NotEqual(t, uuid.Nil.String(), entry["req_id"])
+}
+
+func TestLoggerSampling(t *testing.T) {
+	logger, logs := newTestLogger()
+	middleware := LoggerWithOptions(&LoggerOptions{
+		Logger:   logger,
+		Sampling: &LogSampling{Tick: time.Hour, First: 2, Thereafter: 3},
+	})
+	status := http.StatusOK
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	for i := 0; i < 8; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo", nil))
+	}
+	// the first 2, then the 5th and 8th
+	assert.Equal(t, 4, logs.Len())
+
+	status = http.StatusInternalServerError
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/foo", nil))
+	assert.Equal(t, 5, logs.Len(), "errors are always logged")
+}
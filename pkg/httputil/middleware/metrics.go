@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/metrics"
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpMetricsOnce     sync.Once
+	httpRequestsTotal   *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	httpResponseSize    *prometheus.HistogramVec
+	httpInFlight        prometheus.Gauge
+)
+
+func registerHTTPMetrics() {
+	labels := []string{"method", "route", "status"}
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace, Subsystem: "http", Name: "requests_total",
+		Help: "Number of HTTP requests handled.",
+	}, labels)
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace, Subsystem: "http", Name: "request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+	httpResponseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace, Subsystem: "http", Name: "response_size_bytes",
+		Help:    "Size of HTTP response bodies.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+	}, labels)
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace, Subsystem: "http", Name: "requests_in_flight",
+		Help: "Number of HTTP requests being handled.",
+	})
+	metrics.MustRegister(httpRequestsTotal, httpRequestDuration, httpResponseSize, httpInFlight)
+}
+
+// Metrics is middleware recording Prometheus metrics of HTTP requests in metrics.Registry: request count,
+// duration and response size labeled by method, route pattern and status, and the number of requests in flight.
+// Routes are labeled by the ServeMux pattern that matched (e.g. "GET /users/{id}") rather than the raw path,
+// keeping label cardinality bounded; requests matching no route are labeled "unmatched".
+func Metrics() func(http.Handler) http.Handler {
+	httpMetricsOnce.Do(registerHTTPMetrics)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
+
+			start := time.Now()
+			rec := NewResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			// ServeMux sets the pattern on the request it routes, which is r when Metrics wraps the mux directly;
+			// httputil.Router sets it before its middleware runs
+			pattern := r.Pattern
+			if pattern == "" {
+				pattern = "unmatched"
+			}
+			labels := prometheus.Labels{"method": r.Method, "route": pattern, "status": strconv.Itoa(rec.StatusCode)}
+			httpRequestsTotal.With(labels).Inc()
+			httpRequestDuration.With(labels).Observe(time.Since(start).Seconds())
+			httpResponseSize.With(labels).Observe(float64(rec.Size))
+		})
+	}
+}
+
+// QueryEndpoint is middleware attributing the queries handlers run with the request's context to the
+// request's route pattern, e.g. "GET /users/{id}", in pgx.QueryStats, showing which endpoints run slow queries.
+// The pattern is only known once a route matched, so apply it around routes, as httputil.Router does with
+// its middleware, rather than around a ServeMux only.
+func QueryEndpoint() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Pattern != "" {
+				r = r.WithContext(pg.WithQueryEndpoint(r.Context(), r.Pattern))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
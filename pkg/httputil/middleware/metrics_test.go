@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	router := httputil.NewRouter()
+	router.Use(Metrics())
+	router.Handle("GET /items/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("item"))
+	}))
+	handler := router.Handler()
+	for _, path := range []string{"/items/1", "/items/2", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "GET /items/{id}", "200")); got != 2 {
+		t.Errorf("requests for GET /items/{id} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "unmatched", "404")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(httpInFlight); got != 0 {
+		t.Errorf("in flight = %v, want 0", got)
+	}
+}
+
+func TestQueryEndpoint(t *testing.T) {
+	stats := pg.NewQueryStats(pg.QueryStatsOptions{})
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}", QueryEndpoint()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// what pgx calls for a query run with the request's context
+		ctx := stats.TraceQueryStart(r.Context(), nil, pgx.TraceQueryStartData{SQL: "SELECT * FROM items WHERE id = $1"})
+		stats.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	})))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/1", nil))
+
+	snapshot := stats.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Endpoint != "GET /items/{id}" {
+		t.Errorf("expected the query attributed to GET /items/{id}, got %+v", snapshot)
+	}
+}
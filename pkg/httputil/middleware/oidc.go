@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
@@ -35,7 +38,8 @@ var (
 // VerifyOIDCToken is middleware that verifies OIDC tokens in Authorization headers.
 // By default, it sends a 401 Unauthorized response if the token is missing or invalid.
 // If send401Unauthorized is false, it allows requests with other authorization schemes
-// (e.g., Basic Auth) to continue without interference.
+// (e.g., Basic Auth) to continue without interference, as well as requests with invalid tokens
+// if the anonymous role (see httputil.AnonRole) is set, which the Postgres middleware then uses.
 func VerifyOIDCToken(oidcCfg OIDCProviderConfig, send401Unauthorized ...bool) func(http.Handler) http.Handler {
 	send401 := true // Default behavior: Send 401 on failure
 	if len(send401Unauthorized) > 0 {
@@ -49,44 +53,167 @@ func VerifyOIDCToken(oidcCfg OIDCProviderConfig, send401Unauthorized ...bool) fu
 			}
 		})
 
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				if send401 {
-					http.Error(w, "Authorization header missing", http.StatusUnauthorized)
-					return
-				} else {
-					// No Authorization header and send401Unauthorized is false,
-					// so let other middleware/handlers handle it
-					next.ServeHTTP(w, r)
-					return
-				}
+		return oidcMiddleware(next, send401, func(ctx context.Context, token string) (*oidc.IntrospectionResponse, error) {
+			return rs.Introspect[*oidc.IntrospectionResponse](ctx, oidcProvider.provider, token)
+		})
+	}
+}
+
+// VerifyOIDCTokens is like VerifyOIDCToken but trusts several issuers, e.g. Keycloak and Auth0.
+// The issuer is selected by the iss claim of JWT access tokens; opaque tokens are introspected
+// by each issuer in turn until one reports them active. Providers are created on first use and cached per issuer.
+func VerifyOIDCTokens(oidcCfgs []OIDCProviderConfig, send401Unauthorized ...bool) func(http.Handler) http.Handler {
+	send401 := true // Default behavior: Send 401 on failure
+	if len(send401Unauthorized) > 0 {
+		send401 = send401Unauthorized[0]
+	}
+
+	providers := newOIDCProviders(oidcCfgs)
+	return func(next http.Handler) http.Handler {
+		return oidcMiddleware(next, send401, providers.introspect)
+	}
+}
+
+// oidcMiddleware authenticates bearer tokens with introspect and stores the result under httputil.OIDCUserCtxKey.
+// Results are cached as configured by SetTokenCache.
+func oidcMiddleware(next http.Handler, send401 bool, introspect func(ctx context.Context, token string) (*oidc.IntrospectionResponse, error)) http.Handler {
+	introspect = cachedIntrospect(introspect)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			if send401 {
+				http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+				return
+			} else {
+				// No Authorization header and send401Unauthorized is false,
+				// so let other middleware/handlers handle it
+				next.ServeHTTP(w, r)
+				return
 			}
+		}
 
-			// Check for "Bearer" token (case-insensitive)
-			if !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
-				if send401 {
-					http.Error(w, "Invalid token format", http.StatusUnauthorized)
-					return
-				} else {
-					// Other authorization scheme present and send401Unauthorized is false
-					next.ServeHTTP(w, r)
-					return
-				}
+		// Check for "Bearer" token (case-insensitive)
+		if !strings.HasPrefix(strings.ToLower(authHeader), "bearer ") {
+			if send401 {
+				http.Error(w, "Invalid token format", http.StatusUnauthorized)
+				return
+			} else {
+				// Other authorization scheme present and send401Unauthorized is false
+				next.ServeHTTP(w, r)
+				return
 			}
+		}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			user, err := rs.Introspect[*oidc.IntrospectionResponse](r.Context(), oidcProvider.provider, tokenString)
-			if err != nil || user == nil {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+		user, err := introspect(r.Context(), tokenString)
+		if err != nil || user == nil {
+			if !send401 && httputil.AnonRole() != "" {
+				// treat the request as anonymous, as if it had no token
+				next.ServeHTTP(w, r)
 				return
 			}
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
 
-			ctx := context.WithValue(r.Context(), httputil.OIDCUserCtxKey, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+		ctx := context.WithValue(r.Context(), httputil.OIDCUserCtxKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// oidcProviders lazily creates and caches one provider per trusted issuer.
+type oidcProviders struct {
+	issuers   []string // in configuration order
+	configs   map[string]OIDCProviderConfig
+	mu        sync.Mutex
+	providers map[string]*OIDCProvider
+}
+
+func newOIDCProviders(cfgs []OIDCProviderConfig) *oidcProviders {
+	if len(cfgs) == 0 {
+		panic("missing required OIDC configuration")
 	}
+	p := &oidcProviders{configs: map[string]OIDCProviderConfig{}, providers: map[string]*OIDCProvider{}}
+	for _, cfg := range cfgs {
+		if cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.Issuer == "" {
+			panic("missing required OIDC configuration")
+		}
+		issuer := normalizeIssuer(cfg.Issuer)
+		p.issuers = append(p.issuers, issuer)
+		p.configs[issuer] = cfg
+	}
+	return p
+}
+
+// introspect verifies token with the provider of its issuer, or with each provider if the token isn't a JWT.
+func (p *oidcProviders) introspect(ctx context.Context, token string) (*oidc.IntrospectionResponse, error) {
+	if issuer := tokenIssuer(token); issuer != "" {
+		provider, err := p.get(normalizeIssuer(issuer))
+		if err != nil {
+			return nil, err
+		}
+		user, err := rs.Introspect[*oidc.IntrospectionResponse](ctx, provider.provider, token)
+		if err == nil && user != nil && !user.Active {
+			return nil, fmt.Errorf("token not active")
+		}
+		return user, err
+	}
+
+	for _, issuer := range p.issuers {
+		provider, err := p.get(issuer)
+		if err != nil {
+			log.Printf("Skipping OIDC issuer %s: %v", issuer, err)
+			continue
+		}
+		user, err := rs.Introspect[*oidc.IntrospectionResponse](ctx, provider.provider, token)
+		if err == nil && user != nil && user.Active {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("token not active at any trusted issuer")
+}
+
+// get returns the provider of a trusted issuer, creating it on first use.
+func (p *oidcProviders) get(issuer string) (*OIDCProvider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if provider, ok := p.providers[issuer]; ok {
+		return provider, nil
+	}
+	cfg, ok := p.configs[issuer]
+	if !ok {
+		return nil, fmt.Errorf("untrusted issuer %s", issuer)
+	}
+	provider, err := newOIDCProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.providers[issuer] = provider
+	return provider, nil
+}
+
+// tokenIssuer returns the unverified iss claim of a JWT, or "" for other tokens.
+func tokenIssuer(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+func normalizeIssuer(issuer string) string {
+	return strings.TrimSuffix(issuer, "/")
 }
 
 func InitOIDCProvider(cfg OIDCProviderConfig) *OIDCProvider {
@@ -94,14 +221,22 @@ func InitOIDCProvider(cfg OIDCProviderConfig) *OIDCProvider {
 		panic("missing required OIDC configuration")
 	}
 
-	provider, err := rs.NewResourceServerClientCredentials(context.Background(), cfg.Issuer, cfg.ClientID, cfg.ClientSecret)
+	provider, err := newOIDCProvider(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create OIDC provider: %v", err)
 	}
+	return provider
+}
+
+func newOIDCProvider(cfg OIDCProviderConfig) (*OIDCProvider, error) {
+	provider, err := rs.NewResourceServerClientCredentials(context.Background(), cfg.Issuer, cfg.ClientID, cfg.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
 
 	return &OIDCProvider{
 		config:   cfg,
 		provider: provider,
 		cache:    NewCache(),
-	}
+	}, nil
 }
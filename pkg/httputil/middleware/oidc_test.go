@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/edgeflare/pgo/pkg/httputil"
 	"github.com/edgeflare/pgo/pkg/util"
 )
 
@@ -130,3 +135,75 @@ func TestExtractRoleFromClaims(t *testing.T) {
 		})
 	}
 }
+
+// fakeIssuer serves OIDC discovery and an introspection endpoint that accepts tokens in active.
+func fakeIssuer(t *testing.T, active map[string]bool) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 srv.URL,
+				"introspection_endpoint": srv.URL + "/introspect",
+				"token_endpoint":         srv.URL + "/token",
+			})
+		case "/introspect":
+			r.ParseForm()
+			token := r.PostForm.Get("token")
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": active[token], "iss": srv.URL, "sub": token})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func unsignedJWT(iss string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	payload, _ := json.Marshal(map[string]string{"iss": iss})
+	return enc([]byte(`{"alg":"none"}`)) + "." + enc(payload) + ".sig"
+}
+
+func TestVerifyOIDCTokens(t *testing.T) {
+	activeA, activeB := map[string]bool{"opaque-a": true}, map[string]bool{"opaque-b": true}
+	a, b := fakeIssuer(t, activeA), fakeIssuer(t, activeB)
+	// JWTs are introspected only by the issuer they name
+	jwtA, jwtB := unsignedJWT(a.URL+"/"), unsignedJWT(b.URL)
+	activeA[jwtA], activeA[jwtB] = true, true
+
+	mw := VerifyOIDCTokens([]OIDCProviderConfig{
+		{Issuer: a.URL, ClientID: "pgo", ClientSecret: "secret"},
+		{Issuer: b.URL, ClientID: "pgo", ClientSecret: "secret"},
+	})
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{"opaque token of first issuer", "opaque-a", http.StatusOK},
+		{"opaque token of second issuer", "opaque-b", http.StatusOK},
+		{"unknown opaque token", "opaque-c", http.StatusUnauthorized},
+		{"JWT of untrusted issuer", unsignedJWT("https://evil.test"), http.StatusUnauthorized},
+		{"JWT of first issuer", jwtA, http.StatusOK},
+		{"JWT inactive at its issuer", jwtB, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := httputil.OIDCUser(r); !ok {
+					t.Error("OIDC user missing from context")
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package middleware
 
 import (
 	"context"
-	"os"
 
 	"github.com/edgeflare/pgo/pkg/httputil"
 	"github.com/edgeflare/pgo/pkg/util"
@@ -26,6 +25,16 @@ func PgOIDCAuthz(oidcCfg OIDCProviderConfig, pgRoleClaimKey string) AuthzFunc {
 		}
 	})
 
+	return pgClaimAuthz(pgRoleClaimKey)
+}
+
+// PgJWTAuthz is like PgOIDCAuthz for tokens verified by VerifyJWT, which needs no OIDC provider.
+func PgJWTAuthz(pgRoleClaimKey string) AuthzFunc {
+	return pgClaimAuthz(pgRoleClaimKey)
+}
+
+// pgClaimAuthz reads the pg role from the pgRoleClaimKey claim of the request's verified token.
+func pgClaimAuthz(pgRoleClaimKey string) AuthzFunc {
 	return func(ctx context.Context) (AuthzResponse, error) {
 		user, ok := ctx.Value(httputil.OIDCUserCtxKey).(*oidc.IntrospectionResponse)
 		if !ok {
@@ -42,14 +51,17 @@ func PgOIDCAuthz(oidcCfg OIDCProviderConfig, pgRoleClaimKey string) AuthzFunc {
 	}
 }
 
-// WithBasicAuthz returns an authorization function for Basic Auth
+// WithBasicAuthz returns an authorization function for Basic Auth. Requests run as the role the
+// BasicAuthConfig.Verifier returned, if any, or else as the role named like the user.
 func PgBasicAuthz() AuthzFunc {
 	return func(ctx context.Context) (AuthzResponse, error) {
 		user, ok := ctx.Value(httputil.BasicAuthCtxKey).(string)
 		if !ok {
 			return AuthzResponse{Allowed: false}, nil
 		}
-		ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, user)
+		if role, ok := ctx.Value(httputil.PgRoleCtxKey).(string); ok && role != "" {
+			return AuthzResponse{Role: role, Allowed: true}, nil
+		}
 		return AuthzResponse{Role: user, Allowed: true}, nil
 	}
 }
@@ -57,7 +69,7 @@ func PgBasicAuthz() AuthzFunc {
 // WithAnonAuthz returns an authorization function for anonymous users
 func PgAnonAuthz() AuthzFunc {
 	return func(ctx context.Context) (AuthzResponse, error) {
-		pgrole := os.Getenv("PGO_POSTGRES_ANON_ROLE")
+		pgrole := httputil.AnonRole()
 		if pgrole == "" {
 			return AuthzResponse{Allowed: false}, nil
 		}
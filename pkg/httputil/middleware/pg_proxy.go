@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	pgoutil "github.com/edgeflare/pgo/pkg/httputil"
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/edgeflare/pgo/pkg/pgx/notify"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgProxyConfig holds the configuration for NewPgProxy.
+type PgProxyConfig struct {
+	// Table holds the routes. It is created if it doesn't exist. Defaults to pgo_proxy_routes.
+	Table string
+	// Transport sends requests upstream. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// ProxyRoute is a row of the route table. A request matches a route if its host matches Host,
+// or Host is empty, and its path is Prefix or below it. Host-specific routes take precedence,
+// then longer prefixes.
+type ProxyRoute struct {
+	ID     int64
+	Host   string
+	Prefix string
+	// Target is the upstream URL. Its path is prepended to the request path.
+	Target string
+	// Rewrite, if not nil, replaces Prefix in the request path, e.g. "" strips it.
+	Rewrite *string
+}
+
+// PgProxy is a reverse proxy whose routes are kept in a Postgres table, making the router a data-driven
+// API gateway. Routes are cached in memory and reloaded whenever the table changes, through a trigger
+// notifying the proxy with NOTIFY.
+type PgProxy struct {
+	pool      *pgxpool.Pool
+	table     string
+	channel   string
+	transport http.RoundTripper
+	listener  *notify.Listener
+
+	mu     sync.RWMutex
+	routes []proxyRoute
+}
+
+type proxyRoute struct {
+	ProxyRoute
+	proxy *httputil.ReverseProxy
+}
+
+// NewPgProxy creates the route table if needed, loads the routes and listens for changes until ctx is done
+// or Close is called.
+func NewPgProxy(ctx context.Context, pool *pgxpool.Pool, cfg PgProxyConfig) (*PgProxy, error) {
+	if cfg.Table == "" {
+		cfg.Table = "pgo_proxy_routes"
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = http.DefaultTransport
+	}
+	p := &PgProxy{pool: pool, table: pgx.Identifier{cfg.Table}.Sanitize(), channel: cfg.Table, transport: cfg.Transport}
+
+	if err := p.createTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := p.reload(ctx); err != nil {
+		return nil, err
+	}
+
+	// routes are also reloaded after reconnecting, as notifications may have been missed meanwhile
+	p.listener = notify.NewListener(pool, notify.Config{OnConnect: p.reload})
+	p.listener.Handle(p.channel, func(ctx context.Context, _ *pgconn.Notification) error {
+		return p.reload(ctx)
+	})
+	p.listener.Start(ctx)
+	return p, nil
+}
+
+func (p *PgProxy) createTable(ctx context.Context) error {
+	fn := pgx.Identifier{p.channel + "_notify"}.Sanitize()
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %[1]s (
+				id bigserial PRIMARY KEY,
+				host text NOT NULL DEFAULT '',
+				prefix text NOT NULL,
+				target text NOT NULL,
+				rewrite text
+			);
+			CREATE OR REPLACE FUNCTION %[2]s() RETURNS trigger LANGUAGE plpgsql AS $$
+			BEGIN
+				PERFORM pg_notify(%[3]s, '');
+				RETURN NULL;
+			END $$;
+			DROP TRIGGER IF EXISTS notify ON %[1]s;
+			CREATE TRIGGER notify AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON %[1]s
+				FOR EACH STATEMENT EXECUTE FUNCTION %[2]s();`,
+			p.table, fn, pg.QuoteLiteral(p.channel)))
+		if err != nil {
+			return fmt.Errorf("failed to create proxy route table: %w", err)
+		}
+		return nil
+	})
+}
+
+// reload replaces the cached routes with the table's.
+func (p *PgProxy) reload(ctx context.Context) error {
+	rows, err := p.pool.Query(ctx, fmt.Sprintf(`SELECT id, host, prefix, target, rewrite FROM %s`, p.table))
+	if err != nil {
+		return fmt.Errorf("failed to load proxy routes: %w", err)
+	}
+	routes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ProxyRoute, error) {
+		var r ProxyRoute
+		err := row.Scan(&r.ID, &r.Host, &r.Prefix, &r.Target, &r.Rewrite)
+		return r, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load proxy routes: %w", err)
+	}
+	p.SetRoutes(routes)
+	return nil
+}
+
+// Close stops listening for changes to the route table.
+func (p *PgProxy) Close() {
+	if p.listener != nil {
+		p.listener.Close()
+	}
+}
+
+// SetRoutes replaces the cached routes. Routes with invalid targets are skipped.
+// Changes to the table overwrite them.
+func (p *PgProxy) SetRoutes(routes []ProxyRoute) {
+	compiled := make([]proxyRoute, 0, len(routes))
+	for _, route := range routes {
+		target, err := url.Parse(route.Target)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			log.Printf("Skipping proxy route %d with invalid target %q", route.ID, route.Target)
+			continue
+		}
+		route.Prefix = "/" + strings.Trim(route.Prefix, "/")
+		compiled = append(compiled, proxyRoute{ProxyRoute: route, proxy: p.reverseProxy(route, target)})
+	}
+	sort.SliceStable(compiled, func(i, j int) bool {
+		if (compiled[i].Host != "") != (compiled[j].Host != "") {
+			return compiled[i].Host != ""
+		}
+		return len(compiled[i].Prefix) > len(compiled[j].Prefix)
+	})
+
+	p.mu.Lock()
+	p.routes = compiled
+	p.mu.Unlock()
+}
+
+func (p *PgProxy) reverseProxy(route ProxyRoute, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: p.transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.Rewrite != nil {
+				rest := strings.TrimPrefix(pr.In.URL.Path, route.Prefix)
+				if route.Prefix == "/" {
+					rest = pr.In.URL.Path
+				}
+				pr.Out.URL.Path = strings.TrimSuffix(*route.Rewrite, "/") + rest
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(target)
+			pr.SetXForwarded()
+		},
+	}
+}
+
+// match returns the route for a request to host and path.
+func (p *PgProxy) match(host, path string) (proxyRoute, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, route := range p.routes {
+		if route.Host != "" && !strings.EqualFold(route.Host, host) {
+			continue
+		}
+		if route.Prefix == "/" || path == route.Prefix || strings.HasPrefix(path, route.Prefix+"/") {
+			return route, true
+		}
+	}
+	return proxyRoute{}, false
+}
+
+// ServeHTTP proxies the request to the upstream of its route, or responds with 404 Not Found.
+func (p *PgProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, ok := p.match(r.Host, r.URL.Path)
+	if !ok {
+		pgoutil.Error(w, http.StatusNotFound, "no route")
+		return
+	}
+	route.proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPgProxyRouting(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + " " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	strip, v2 := "", "/v2"
+	p := &PgProxy{transport: http.DefaultTransport}
+	p.SetRoutes([]ProxyRoute{
+		{ID: 1, Prefix: "/api", Target: upstream.URL + "/base"},
+		{ID: 2, Prefix: "/api/users", Target: upstream.URL, Rewrite: &v2},
+		{ID: 3, Host: "admin.example.com", Prefix: "/", Target: upstream.URL, Rewrite: &strip},
+		{ID: 4, Prefix: "/broken", Target: "not a url"},
+	})
+
+	tests := []struct {
+		host, path     string
+		expectedStatus int
+		expectedPath   string
+	}{
+		{"example.com", "/api/orders", http.StatusOK, "/base/api/orders"},
+		{"example.com", "/api/users/1", http.StatusOK, "/v2/1"},
+		{"example.com", "/apix", http.StatusNotFound, ""},
+		{"admin.example.com:8080", "/api/users", http.StatusOK, "/api/users"},
+		{"example.com", "/broken", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("%s%s: status = %d, want %d", tt.host, tt.path, rr.Code, tt.expectedStatus)
+			continue
+		}
+		want := upstream.Listener.Addr().String() + " " + tt.expectedPath
+		if tt.expectedStatus == http.StatusOK && rr.Body.String() != want {
+			t.Errorf("%s%s: upstream got %q, want %q", tt.host, tt.path, rr.Body.String(), want)
+		}
+	}
+}
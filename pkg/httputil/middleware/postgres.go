@@ -2,9 +2,11 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
 
 	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,36 +15,74 @@ import (
 // )
 
 // Postgres middleware attaches a connection from pool to the request context if the http request user is authorized.
+// Requests no authorizer allows get the anonymous role (see httputil.AnonRole) with empty claims, if it's set,
+// so public endpoints work without a token; otherwise they're rejected with 401 Unauthorized.
+// The connection is released once the handler returns. Roles and claims set on it by ConnWithRole persist until
+// then, so the pool should reset connections on release (see pgx.ResetSessionOnRelease).
 func Postgres(pool *pgxpool.Pool, authorizers ...AuthzFunc) func(http.Handler) http.Handler {
+	return PostgresPools(func(string) (*pgxpool.Pool, bool, error) { return pool, false, nil }, authorizers...)
+}
+
+// PoolFunc returns the pool to acquire connections of a role's requests from, and whether its connections
+// already have the role, e.g. pgx.PoolManager.ForRole of a pool.
+type PoolFunc func(role string) (pool *pgxpool.Pool, preset bool, err error)
+
+// PostgresPools middleware is like Postgres, but acquires connections from the pool pools returns for the
+// request's role, so requests of roles with pools of their own (see pgx.Pool.RolePools) skip SET ROLE in
+// ConnWithRole and RoleBatch, which only set the claims:
+//
+//	r.Use(middleware.PostgresPools(func(role string) (*pgxpool.Pool, bool, error) {
+//		return manager.ForRole("main", role)
+//	}, authorizers...))
+func PostgresPools(pools PoolFunc, authorizers ...AuthzFunc) func(http.Handler) http.Handler {
+	return PostgresWithConfig(PostgresConfig{Pools: pools}, authorizers...)
+}
+
+// PostgresConfig holds the configuration for PostgresWithConfig.
+type PostgresConfig struct {
+	// Pools returns the pool to acquire connections of a role's requests from, see PostgresPools.
+	Pools PoolFunc
+	// RequestIDSetting, if set, is the setting httputil.ConnWithRole and httputil.RoleBatch set to the request
+	// ID (see RequestID) along with the role, in the same round trip, so queries can be correlated with HTTP
+	// requests. Use "application_name" to see request IDs in pg_stat_activity and log_line_prefix's %a, or a
+	// custom setting such as "pgo.request_id" to read them with current_setting('pgo.request_id', true) in
+	// functions and triggers.
+	RequestIDSetting string
+}
+
+// PostgresWithConfig middleware is like PostgresPools, configured by cfg.
+func PostgresWithConfig(cfg PostgresConfig, authorizers ...AuthzFunc) func(http.Handler) http.Handler {
+	pools := cfg.Pools
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
+			ctx, err := authorizeRole(r.Context(), authorizers)
+			if err != nil {
+				http.Error(w, "Authorization error", http.StatusInternalServerError)
+				return
+			}
 
-			for _, authorize := range authorizers {
-				authzResponse, err := authorize(ctx)
+			if pgRole, ok := ctx.Value(httputil.PgRoleCtxKey).(string); ok {
+				pool, preset, err := pools(pgRole)
 				if err != nil {
-					http.Error(w, "Authorization error", http.StatusInternalServerError)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
-				if authzResponse.Allowed {
-					ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, authzResponse.Role)
-					break
-				}
-			}
-
-			if pgRole, ok := ctx.Value(httputil.PgRoleCtxKey).(string); ok {
-				// Acquire a connection from the default pool
 				conn, err := pool.Acquire(r.Context())
 				if err != nil {
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 					return
 				}
-				// caller should
-				// defer conn.Release()
+				// callers may release the connection early; releasing again is a no-op
+				defer conn.Release()
+
+				if cfg.RequestIDSetting != "" {
+					ctx = context.WithValue(ctx, httputil.PgRequestIDSettingCtxKey, cfg.RequestIDSetting)
+				}
 
 				// set the connection in the context
 				ctx = context.WithValue(ctx, httputil.PgConnCtxKey, conn)
 				ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, pgRole)
+				ctx = context.WithValue(ctx, httputil.PgRolePresetCtxKey, preset)
 				r = r.WithContext(ctx)
 				next.ServeHTTP(w, r)
 			} else {
@@ -52,6 +92,180 @@ func Postgres(pool *pgxpool.Pool, authorizers ...AuthzFunc) func(http.Handler) h
 	}
 }
 
+// PostgresReplicas middleware is like PostgresPools, but acquires the connections of GET and HEAD requests from
+// the pool reads returns, e.g. one of pgx.PoolManager.Reader, so read replicas serve them, and the connections
+// of other requests from the pool writes returns:
+//
+//	r.Use(middleware.PostgresReplicas(func(string) (*pgxpool.Pool, bool, error) {
+//		pool, err := manager.Get("main")
+//		return pool, false, err
+//	}, func(string) (*pgxpool.Pool, bool, error) {
+//		pool, err := manager.Reader("main")
+//		return pool, false, err
+//	}, authorizers...))
+func PostgresReplicas(writes, reads PoolFunc, authorizers ...AuthzFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		write := PostgresPools(writes, authorizers...)(next)
+		read := PostgresPools(reads, authorizers...)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				read.ServeHTTP(w, r)
+				return
+			}
+			write.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PostgresTx middleware runs each authorized request in a transaction, stored in the request context
+// for handlers to retrieve with httputil.Tx. The transaction's role is set with SET LOCAL ROLE to the
+// authorized Postgres role, and the OIDC user's claims, if any, are set for RLS policies as ConnWithRole does.
+//
+// The transaction commits when the handler responds with a 2xx status, before the status is sent, so clients
+// never see success for a transaction that failed to commit; it then responds with 500 instead. Other statuses
+// and panics roll the transaction back. Handlers must therefore finish their queries before writing the response.
+func PostgresTx(pool *pgxpool.Pool, authorizers ...AuthzFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := authorizeRole(r.Context(), authorizers)
+			if err != nil {
+				http.Error(w, "Authorization error", http.StatusInternalServerError)
+				return
+			}
+			pgRole, ok := ctx.Value(httputil.PgRoleCtxKey).(string)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			tx, err := pool.Begin(r.Context())
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			tw := &txWriter{ResponseWriter: w, tx: tx, ctx: r.Context()}
+			defer func() {
+				// rolls back unless committed; a no-op afterwards
+				tx.Rollback(context.Background())
+			}()
+
+			if err := setLocalRoleAndClaims(r.Context(), tx, r, pgRole); err != nil {
+				log.Printf("Failed to set role and claims: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			ctx = context.WithValue(ctx, httputil.PgTxCtxKey, tx)
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			if !tw.wroteHeader {
+				// the handler wrote nothing, which the server sends as 200 OK
+				tw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// Authorize middleware stores the Postgres role of authorized requests in the request context, as Postgres
+// does, without acquiring a connection, for handlers serving role-dependent data from memory, e.g.
+// schema.Cache.RoleHandler. Requests without a role, the anonymous one included, are rejected with 401 Unauthorized.
+func Authorize(authorizers ...AuthzFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := authorizeRole(r.Context(), authorizers)
+			if err != nil {
+				http.Error(w, "Authorization error", http.StatusInternalServerError)
+				return
+			}
+			if _, ok := ctx.Value(httputil.PgRoleCtxKey).(string); !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authorizeRole stores the role of the first authorizer that allows the request in ctx,
+// falling back to the anonymous role, if any, when the request has no role yet.
+func authorizeRole(ctx context.Context, authorizers []AuthzFunc) (context.Context, error) {
+	for _, authorize := range authorizers {
+		authzResponse, err := authorize(ctx)
+		if err != nil {
+			return ctx, err
+		}
+		if authzResponse.Allowed {
+			ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, authzResponse.Role)
+			break
+		}
+	}
+	role, ok := ctx.Value(httputil.PgRoleCtxKey).(string)
+	if !ok {
+		if role = httputil.AnonRole(); role != "" {
+			ctx = context.WithValue(ctx, httputil.PgRoleCtxKey, role)
+		}
+	}
+	annotateLog(ctx, func(f *logFields) { f.role = role })
+	return ctx, nil
+}
+
+func setLocalRoleAndClaims(ctx context.Context, tx pgx.Tx, r *http.Request, role string) error {
+	if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+pgx.Identifier{role}.Sanitize()); err != nil {
+		return err
+	}
+	// requests without a token, e.g. anonymous ones, get empty claims
+	claims := map[string]any{}
+	if user, ok := httputil.OIDCUser(r); ok {
+		claims = user.Claims
+	}
+	claimsSQL, args, err := httputil.ClaimSettingsSQL(claims, true)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, claimsSQL, args...)
+	return err
+}
+
+// txWriter commits its transaction before a 2xx response is written.
+type txWriter struct {
+	http.ResponseWriter
+	tx          pgx.Tx
+	ctx         context.Context
+	wroteHeader bool
+	failed      bool // the commit failed, so the handler's response is replaced
+}
+
+func (tw *txWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	if code >= 200 && code < 300 {
+		if err := tw.tx.Commit(tw.ctx); err != nil {
+			log.Printf("Failed to commit request transaction: %v", err)
+			tw.failed = true
+			tw.ResponseWriter.Header().Del("Content-Length")
+			httputil.Error(tw.ResponseWriter, http.StatusInternalServerError, "failed to commit transaction")
+			return
+		}
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *txWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.failed {
+		return len(b), nil
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (tw *txWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
 // // PostgresConfig holds configuration for the Postgres connection pool
 // type PgConfig struct {
 // 	// ConnString is the libpq connection string
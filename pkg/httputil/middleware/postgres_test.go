@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type fakeTx struct {
+	pgx.Tx
+	commitErr error
+	committed bool
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = tx.commitErr == nil
+	return tx.commitErr
+}
+
+func TestTxWriter(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		commitErr       error
+		expectedStatus  int
+		expectedCommit  bool
+		expectedHandler bool // the handler's body is sent
+	}{
+		{"2xx commits", http.StatusCreated, nil, http.StatusCreated, true, true},
+		{"4xx rolls back", http.StatusBadRequest, nil, http.StatusBadRequest, false, true},
+		{"failed commit", http.StatusOK, errors.New("serialization failure"), http.StatusInternalServerError, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &fakeTx{commitErr: tt.commitErr}
+			rr := httptest.NewRecorder()
+			tw := &txWriter{ResponseWriter: rr, tx: tx, ctx: context.Background()}
+			tw.WriteHeader(tt.status)
+			tw.Write([]byte("handler body"))
+
+			if rr.Code != tt.expectedStatus || tx.committed != tt.expectedCommit {
+				t.Errorf("status = %d, committed = %v, want %d, %v", rr.Code, tx.committed, tt.expectedStatus, tt.expectedCommit)
+			}
+			if sent := rr.Body.String() == "handler body"; sent != tt.expectedHandler {
+				t.Errorf("body = %q", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthorizeRoleAnon(t *testing.T) {
+	allow := func(role string) AuthzFunc {
+		return func(ctx context.Context) (AuthzResponse, error) {
+			return AuthzResponse{Role: role, Allowed: role != ""}, nil
+		}
+	}
+	tests := []struct {
+		name         string
+		anonRole     string
+		authorizers  []AuthzFunc
+		expectedRole string // empty if unauthorized
+	}{
+		{"authorized", "anon", []AuthzFunc{allow(""), allow("editor")}, "editor"},
+		{"anon fallback", "anon", []AuthzFunc{allow("")}, "anon"},
+		{"anon disabled", "", []AuthzFunc{allow("")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PGO_POSTGRES_ANON_ROLE", tt.anonRole)
+			ctx, err := authorizeRole(context.Background(), tt.authorizers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			role, _ := ctx.Value(httputil.PgRoleCtxKey).(string)
+			if role != tt.expectedRole {
+				t.Errorf("role = %q, want %q", role, tt.expectedRole)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Setenv("PGO_POSTGRES_ANON_ROLE", "")
+	authz := func(role string, err error) AuthzFunc {
+		return func(ctx context.Context) (AuthzResponse, error) {
+			return AuthzResponse{Role: role, Allowed: role != ""}, err
+		}
+	}
+	tests := []struct {
+		name           string
+		authorizer     AuthzFunc
+		expectedStatus int
+	}{
+		{"authorized", authz("editor", nil), http.StatusOK},
+		{"unauthorized", authz("", nil), http.StatusUnauthorized},
+		{"error", authz("", errors.New("token expired")), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role string
+			handler := Authorize(tt.authorizer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				role, _ = r.Context().Value(httputil.PgRoleCtxKey).(string)
+			}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.expectedStatus)
+			}
+			if tt.expectedStatus == http.StatusOK && role != "editor" {
+				t.Errorf("role = %q, want editor", role)
+			}
+		})
+	}
+}
+
+func TestPostgresReplicas(t *testing.T) {
+	t.Setenv("PGO_POSTGRES_ANON_ROLE", "anon")
+	var got []string
+	pools := func(name string) PoolFunc {
+		return func(string) (*pgxpool.Pool, bool, error) {
+			got = append(got, name)
+			return nil, false, errors.New("no pool")
+		}
+	}
+	handler := PostgresReplicas(pools("primary"), pools("replica"))(http.NotFoundHandler())
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPatch} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/", nil))
+	}
+	if want := []string{"replica", "replica", "primary", "primary"}; !slices.Equal(got, want) {
+		t.Errorf("got pools %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RateLimitConfig holds the configuration for the RateLimit middleware.
+type RateLimitConfig struct {
+	// Limit is the number of requests allowed per Window for each key. It is also the burst size.
+	Limit int
+	// Window is the period over which Limit requests are allowed; tokens refill evenly across it.
+	Window time.Duration
+	// Key derives the rate limit key of a request. Defaults to RateLimitByIP.
+	// Requests for which Key returns "" are keyed by client IP.
+	Key func(r *http.Request) string
+	// Store keeps the token buckets. Defaults to an in-memory store, which is per instance;
+	// use a shared store such as PgRateLimitStore when running several instances.
+	Store RateLimitStore
+}
+
+// RateLimitStore keeps token buckets.
+type RateLimitStore interface {
+	// Take takes a token from key's bucket, which holds up to burst tokens and refills at rate tokens per second.
+	Take(ctx context.Context, key string, rate float64, burst int) (RateLimitResult, error)
+}
+
+// RateLimitResult is the outcome of taking a token.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int           // whole tokens left in the bucket
+	Reset     time.Duration // time until the bucket is full again
+}
+
+// RateLimitByIP keys requests by client IP address.
+func RateLimitByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RateLimitBySubject keys requests by the subject of the verified OIDC or JWT token.
+func RateLimitBySubject(r *http.Request) string {
+	if user, ok := httputil.OIDCUser(r); ok && user.Subject != "" {
+		return "sub:" + user.Subject
+	}
+	return ""
+}
+
+// RateLimitByRole keys requests by the Postgres role set by the Postgres middleware,
+// so it must run after that middleware.
+func RateLimitByRole(r *http.Request) string {
+	if role, ok := r.Context().Value(httputil.PgRoleCtxKey).(string); ok && role != "" {
+		return "role:" + role
+	}
+	return ""
+}
+
+// RateLimit is token bucket rate limiting middleware. It sets the RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers and responds with 429 Too Many Requests and Retry-After when a key's bucket is empty.
+// If the store fails, requests are let through.
+func RateLimit(cfg RateLimitConfig) func(http.Handler) http.Handler {
+	if cfg.Limit <= 0 || cfg.Window <= 0 {
+		panic("rate limit requires a positive Limit and Window")
+	}
+	if cfg.Key == nil {
+		cfg.Key = RateLimitByIP
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryRateLimitStore()
+	}
+	rate := float64(cfg.Limit) / cfg.Window.Seconds()
+	limit := strconv.Itoa(cfg.Limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := cfg.Key(r)
+			if key == "" {
+				key = RateLimitByIP(r)
+			}
+
+			result, err := cfg.Store.Take(r.Context(), key, rate, cfg.Limit)
+			if err != nil {
+				log.Printf("Rate limit store failed, allowing request: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", limit)
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if !result.Allowed {
+				// the next token arrives after 1/rate seconds at the latest
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Duration(float64(time.Second)/rate))))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// bucketResult computes the result of taking a token from a bucket now holding tokens.
+func bucketResult(allowed bool, tokens, rate float64, burst int) RateLimitResult {
+	return RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(burst) - tokens) / rate * float64(time.Second)),
+	}
+}
+
+// MemoryRateLimitStore keeps token buckets in memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	full      time.Time // when the bucket is full again, after which it can be forgotten
+}
+
+// NewMemoryRateLimitStore returns an in-memory RateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, rate float64, burst int) (RateLimitResult, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// full buckets behave like missing ones, so drop them now and then to bound memory
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := bucketResult(allowed, b.tokens, rate, burst)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// PgRateLimitStore keeps token buckets in a Postgres table, sharing limits across instances.
+type PgRateLimitStore struct {
+	pool  *pgxpool.Pool
+	table string
+}
+
+// NewPgRateLimitStore returns a RateLimitStore backed by table, which is created if it doesn't exist.
+// Each Take is a single upsert, so concurrent instances never over-admit.
+func NewPgRateLimitStore(ctx context.Context, pool *pgxpool.Pool, table string) (*PgRateLimitStore, error) {
+	if table == "" {
+		table = "pgo_rate_limits"
+	}
+	table = pgx.Identifier{table}.Sanitize()
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE UNLOGGED TABLE IF NOT EXISTS %s (
+		key text PRIMARY KEY,
+		tokens double precision NOT NULL,
+		allowed boolean NOT NULL,
+		updated_at timestamptz NOT NULL
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limit table: %w", err)
+	}
+	return &PgRateLimitStore{pool: pool, table: table}, nil
+}
+
+// Take implements RateLimitStore.
+func (s *PgRateLimitStore) Take(ctx context.Context, key string, rate float64, burst int) (RateLimitResult, error) {
+	const refill = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM clock_timestamp() - b.updated_at)::float8 * $3::float8)`
+	query := fmt.Sprintf(`INSERT INTO %[1]s AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, true, clock_timestamp())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN %[2]s >= 1 THEN %[2]s - 1 ELSE %[2]s END,
+			allowed = %[2]s >= 1,
+			updated_at = clock_timestamp()
+		RETURNING tokens, allowed`, s.table, refill)
+
+	var tokens float64
+	var allowed bool
+	if err := s.pool.QueryRow(ctx, query, key, float64(burst), rate).Scan(&tokens, &allowed); err != nil {
+		return RateLimitResult{}, err
+	}
+	return bucketResult(allowed, tokens, rate, burst), nil
+}
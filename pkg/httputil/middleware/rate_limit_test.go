@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+)
+
+func TestRateLimit(t *testing.T) {
+	handler := RateLimit(RateLimitConfig{Limit: 2, Window: time.Minute, Key: RateLimitByRole})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(role, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if role != "" {
+			req = req.WithContext(context.WithValue(req.Context(), httputil.PgRoleCtxKey, role))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		rr := request("alice", "10.0.0.1:1234")
+		if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != wantRemaining {
+			t.Fatalf("request %d: status %d, remaining %q", i, rr.Code, rr.Header().Get("RateLimit-Remaining"))
+		}
+		if rr.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("RateLimit-Limit = %q, want 2", rr.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	rr := request("alice", "10.0.0.2:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("Retry-After = %q, want 30", rr.Header().Get("Retry-After"))
+	}
+	if reset := rr.Header().Get("RateLimit-Reset"); reset != "60" {
+		t.Errorf("RateLimit-Reset = %q, want 60", reset)
+	}
+
+	// other roles and requests without a role (keyed by IP) have their own buckets
+	if rr := request("bob", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("bob: status = %d, want 200", rr.Code)
+	}
+	if rr := request("", "10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("anonymous: status = %d, want 200", rr.Code)
+	}
+}
+
+func TestRateLimitThroughRouter(t *testing.T) {
+	router := httputil.NewRouter()
+	router.Use(RateLimit(RateLimitConfig{Limit: 2, Window: time.Minute}))
+	router.Handle("GET /items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler := router.Handler()
+
+	// each routed request takes one token
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items", nil))
+		if rr.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, rr.Code, want)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreRefill(t *testing.T) {
+	s := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	// 100 tokens per second with a burst of 1
+	if res, _ := s.Take(ctx, "k", 100, 1); !res.Allowed {
+		t.Fatal("first take denied")
+	}
+	if res, _ := s.Take(ctx, "k", 100, 1); res.Allowed {
+		t.Fatal("second take allowed before refill")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if res, _ := s.Take(ctx, "k", 100, 1); !res.Allowed {
+		t.Fatal("take denied after refill")
+	}
+}
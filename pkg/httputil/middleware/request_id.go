@@ -24,6 +24,7 @@ func RequestID(next http.Handler) http.Handler {
 		// currently used by the logger middleware, but it can read from the request header set by this middleware
 		ctx = context.WithValue(ctx, httputil.RequestIDCtxKey, reqID)
 		w.Header().Set(RequestIDHeader, reqID)
+		annotateLog(ctx, func(f *logFields) { f.requestID = reqID })
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
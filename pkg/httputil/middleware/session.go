@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SessionConfig holds the configuration for a SessionStore.
+type SessionConfig struct {
+	// Table stores the sessions. It is created if it doesn't exist. Defaults to pgo_sessions.
+	Table string
+	// CookieName defaults to pgo_session.
+	CookieName string
+	// MaxAge is how long a session lasts without requests. Each request extends it. Defaults to 24 hours.
+	MaxAge time.Duration
+	// Path and Domain scope the cookie. Path defaults to /.
+	Path   string
+	Domain string
+	// Insecure allows sending the cookie over plain HTTP, e.g. during local development.
+	Insecure bool
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+// SessionStore keeps sessions in a Postgres table.
+type SessionStore struct {
+	pool  *pgxpool.Pool
+	cfg   SessionConfig
+	table string
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewSessionStore returns a SessionStore backed by cfg.Table, which is created if it doesn't exist.
+func NewSessionStore(ctx context.Context, pool *pgxpool.Pool, cfg SessionConfig) (*SessionStore, error) {
+	if cfg.Table == "" {
+		cfg.Table = "pgo_sessions"
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "pgo_session"
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 24 * time.Hour
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.SameSite == 0 {
+		cfg.SameSite = http.SameSiteLaxMode
+	}
+
+	table := pgx.Identifier{cfg.Table}.Sanitize()
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id text PRIMARY KEY,
+		data jsonb NOT NULL DEFAULT '{}',
+		expires_at timestamptz NOT NULL
+	)`, table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session table: %w", err)
+	}
+	return &SessionStore{pool: pool, cfg: cfg, table: table, lastSweep: time.Now()}, nil
+}
+
+// Session holds the values of a client's session. Values round-trip through JSON,
+// so numbers read back from a stored session are float64.
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	values    map[string]any
+	expiresAt time.Time
+	stored    bool   // the session exists in the store
+	dirty     bool   // values changed or the ID was renewed
+	destroyed bool   // the session is to be deleted
+	replaced  string // ID to delete after Renew
+}
+
+// Get returns the value stored under key.
+func (s *Session) Get(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// Set stores a value under key. It must be called before the handler writes the response,
+// so a new session's cookie can be sent with it.
+func (s *Session) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.dirty = true
+}
+
+// Delete removes the value stored under key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.dirty = true
+}
+
+// Renew gives the session a new ID, keeping its values. Call it when a user signs in to prevent session fixation.
+func (s *Session) Renew() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stored && s.replaced == "" {
+		s.replaced = s.id
+	}
+	s.id = newSessionID()
+	s.stored = false
+	s.dirty = true
+}
+
+// Destroy deletes the session and expires its cookie, e.g. when a user signs out.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = map[string]any{}
+	s.destroyed = true
+}
+
+// GetSession returns the session the Sessions middleware attached to the request.
+func GetSession(r *http.Request) (*Session, bool) {
+	s, ok := r.Context().Value(sessionCtxKey).(*Session)
+	return s, ok
+}
+
+// Sessions is middleware that attaches the client's session, identified by a cookie, to the request context.
+// Handlers read and write it with GetSession. Sessions are saved after the handler returns; a new session
+// is only stored once a value is set, and each request extends a session's expiry by MaxAge.
+func Sessions(store *SessionStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sess, err := store.load(r)
+			if err != nil {
+				log.Printf("Failed to load session: %v", err)
+				httputil.Error(w, http.StatusInternalServerError, "failed to load session")
+				return
+			}
+
+			sw := &sessionWriter{ResponseWriter: w, store: store, sess: sess}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionCtxKey, sess)))
+			if !sw.wroteHeader {
+				// the server writes the header once the handler returns
+				store.setCookie(w, sess)
+			}
+
+			if err := store.save(r.Context(), sess); err != nil {
+				log.Printf("Failed to save session: %v", err)
+			}
+			store.sweep()
+		})
+	}
+}
+
+// load returns the session named by the request's cookie, or a new one.
+func (st *SessionStore) load(r *http.Request) (*Session, error) {
+	sess := &Session{values: map[string]any{}}
+	if c, err := r.Cookie(st.cfg.CookieName); err == nil && c.Value != "" {
+		var data []byte
+		err := st.pool.QueryRow(r.Context(), fmt.Sprintf(`SELECT data, expires_at FROM %s WHERE id = $1 AND expires_at > now()`, st.table),
+			c.Value).Scan(&data, &sess.expiresAt)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &sess.values); err != nil {
+				return nil, err
+			}
+			sess.id, sess.stored = c.Value, true
+			return sess, nil
+		case !errors.Is(err, pgx.ErrNoRows):
+			return nil, err
+		}
+	}
+	sess.id = newSessionID()
+	return sess, nil
+}
+
+// save stores, extends or deletes the session.
+func (st *SessionStore) save(ctx context.Context, sess *Session) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.replaced != "" || (sess.destroyed && sess.stored) {
+		id := sess.replaced
+		if sess.destroyed {
+			id = sess.id
+		}
+		if _, err := st.pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = ANY($1)`, st.table), []string{id, sess.replaced}); err != nil {
+			return err
+		}
+	}
+	if sess.destroyed || (!sess.stored && !sess.dirty) {
+		return nil
+	}
+	// unchanged sessions are extended at most once a minute to save writes
+	if !sess.dirty && time.Until(sess.expiresAt) > st.cfg.MaxAge-time.Minute {
+		return nil
+	}
+
+	data, err := json.Marshal(sess.values)
+	if err != nil {
+		return err
+	}
+	_, err = st.pool.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (id, data, expires_at) VALUES ($1, $2, now() + $3 * interval '1 second')
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, expires_at = EXCLUDED.expires_at`, st.table),
+		sess.id, data, st.cfg.MaxAge.Seconds())
+	return err
+}
+
+// setCookie sets the session cookie, or expires it if the session is destroyed.
+// New sessions without values get no cookie.
+func (st *SessionStore) setCookie(w http.ResponseWriter, sess *Session) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	c := &http.Cookie{
+		Name:     st.cfg.CookieName,
+		Value:    sess.id,
+		Path:     st.cfg.Path,
+		Domain:   st.cfg.Domain,
+		MaxAge:   int(st.cfg.MaxAge.Seconds()),
+		Secure:   !st.cfg.Insecure,
+		HttpOnly: true,
+		SameSite: st.cfg.SameSite,
+	}
+	switch {
+	case sess.destroyed:
+		if !sess.stored && sess.replaced == "" {
+			return
+		}
+		c.Value, c.MaxAge = "", -1
+	case !sess.stored && !sess.dirty:
+		return
+	}
+	http.SetCookie(w, c)
+}
+
+// sweep deletes expired sessions at most once an hour.
+func (st *SessionStore) sweep() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if time.Since(st.lastSweep) < time.Hour {
+		return
+	}
+	st.lastSweep = time.Now()
+	go func() {
+		if _, err := st.pool.Exec(context.Background(), fmt.Sprintf(`DELETE FROM %s WHERE expires_at < now()`, st.table)); err != nil {
+			log.Printf("Failed to delete expired sessions: %v", err)
+		}
+	}()
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sessionWriter sets the session cookie before the response header is written.
+type sessionWriter struct {
+	http.ResponseWriter
+	store       *SessionStore
+	sess        *Session
+	wroteHeader bool
+}
+
+func (sw *sessionWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		sw.store.setCookie(sw.ResponseWriter, sw.sess)
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+const sessionCtxKey httputil.ContextKey = "Session"
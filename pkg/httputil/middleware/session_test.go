@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionCookie(t *testing.T) {
+	store := &SessionStore{cfg: SessionConfig{CookieName: "sid", MaxAge: time.Hour, Path: "/"}}
+	cookie := func(sess *Session) *http.Cookie {
+		rr := httptest.NewRecorder()
+		store.setCookie(rr, sess)
+		cookies := rr.Result().Cookies()
+		if len(cookies) == 0 {
+			return nil
+		}
+		return cookies[0]
+	}
+
+	sess := &Session{id: newSessionID(), values: map[string]any{}}
+	if c := cookie(sess); c != nil {
+		t.Errorf("new empty session got a cookie: %v", c)
+	}
+
+	sess.Set("user", "alice")
+	c := cookie(sess)
+	if c == nil || c.Value != sess.id || c.MaxAge != 3600 || !c.Secure || !c.HttpOnly {
+		t.Fatalf("got cookie %v, want a secure one for %s", c, sess.id)
+	}
+	if v, ok := sess.Get("user"); !ok || v != "alice" {
+		t.Errorf("Get(user) = %v, %v", v, ok)
+	}
+
+	sess.stored, sess.dirty = true, false
+	old := sess.id
+	sess.Renew()
+	if sess.id == old || sess.replaced != old {
+		t.Errorf("Renew kept ID %s or lost the old one", sess.id)
+	}
+	if v, _ := sess.Get("user"); v != "alice" {
+		t.Error("Renew dropped the session's values")
+	}
+
+	sess.Destroy()
+	if c := cookie(sess); c == nil || c.MaxAge != -1 {
+		t.Errorf("destroyed session cookie = %v, want expired", c)
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+// TokenCacheConfig configures caching of tokens verified by VerifyOIDCToken and VerifyOIDCTokens.
+type TokenCacheConfig struct {
+	// MaxAge is how long a verified token is trusted without asking its issuer again, capped at the token's expiry.
+	// Zero disables caching. Revoked tokens stay valid for up to MaxAge unless they're purged with RevokeToken.
+	MaxAge time.Duration
+	// MaxEntries bounds the number of cached tokens, evicting the least recently used ones. Defaults to 10000.
+	MaxEntries int
+	// IsRevoked, if set, is called for cached tokens, e.g. to check a deny list. Tokens it reports revoked are
+	// purged and verified with their issuer again.
+	IsRevoked func(ctx context.Context, user *oidc.IntrospectionResponse) bool
+}
+
+var tokenCache struct {
+	sync.RWMutex
+	cfg   TokenCacheConfig
+	cache *Cache
+}
+
+// SetTokenCache configures caching of verified tokens, which saves a round trip to the identity provider
+// per request. It discards tokens cached so far. JWTs verified by VerifyJWT aren't cached, as they're verified
+// locally against keys cached for JWTConfig.JWKSRefreshInterval.
+func SetTokenCache(cfg TokenCacheConfig) {
+	if cfg.MaxEntries == 0 {
+		cfg.MaxEntries = 10000
+	}
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+	tokenCache.cfg = cfg
+	tokenCache.cache = nil
+	if cfg.MaxAge > 0 {
+		tokenCache.cache = NewCache(cfg.MaxEntries)
+	}
+}
+
+// RevokeToken purges token from the cache, so it's verified with its issuer on its next use.
+func RevokeToken(token string) {
+	if cache := currentTokenCache(); cache != nil {
+		cache.Delete(tokenCacheKey(token))
+	}
+}
+
+// RevokeSubject purges the cached tokens of the user with the sub claim subject, e.g. on logout.
+func RevokeSubject(subject string) {
+	if cache := currentTokenCache(); cache != nil {
+		cache.DeleteFunc(func(_ string, value interface{}) bool {
+			return value.(*oidc.IntrospectionResponse).Subject == subject
+		})
+	}
+}
+
+// TokenRevocationHandler returns a handler that purges cached tokens, for identity provider webhooks or
+// back-channel logout. It accepts POST requests with a form (or query) parameter token, like RFC 7009
+// revocation requests, or sub to purge all of a user's tokens. It must be protected by other middleware,
+// since anyone able to call it can force tokens to be verified again.
+func TokenRevocationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			httputil.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		token, subject := r.FormValue("token"), r.FormValue("sub")
+		if token == "" && subject == "" {
+			httputil.Error(w, http.StatusBadRequest, "token or sub is required")
+			return
+		}
+		if token != "" {
+			RevokeToken(token)
+		}
+		if subject != "" {
+			RevokeSubject(subject)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// cachedIntrospect wraps introspect with the token cache, if enabled.
+func cachedIntrospect(introspect func(ctx context.Context, token string) (*oidc.IntrospectionResponse, error)) func(ctx context.Context, token string) (*oidc.IntrospectionResponse, error) {
+	return func(ctx context.Context, token string) (*oidc.IntrospectionResponse, error) {
+		tokenCache.RLock()
+		cfg, cache := tokenCache.cfg, tokenCache.cache
+		tokenCache.RUnlock()
+		if cache == nil {
+			return introspect(ctx, token)
+		}
+
+		key := tokenCacheKey(token)
+		if v, ok := cache.Get(key); ok {
+			user := v.(*oidc.IntrospectionResponse)
+			if cfg.IsRevoked == nil || !cfg.IsRevoked(ctx, user) {
+				return user, nil
+			}
+			cache.Delete(key)
+		}
+
+		user, err := introspect(ctx, token)
+		if err != nil || user == nil || !user.Active {
+			return user, err
+		}
+		maxAge := cfg.MaxAge
+		if user.Expiration != 0 {
+			if ttl := time.Until(user.Expiration.AsTime()); ttl < maxAge {
+				maxAge = ttl
+			}
+		}
+		if maxAge > 0 {
+			cache.Set(key, user, maxAge)
+		}
+		return user, nil
+	}
+}
+
+func currentTokenCache() *Cache {
+	tokenCache.RLock()
+	defer tokenCache.RUnlock()
+	return tokenCache.cache
+}
+
+// tokenCacheKey hashes token, so the cache doesn't hold usable tokens.
+func tokenCacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+func TestCachedIntrospect(t *testing.T) {
+	var calls int
+	var revoked bool
+	introspect := cachedIntrospect(func(ctx context.Context, token string) (*oidc.IntrospectionResponse, error) {
+		calls++
+		return &oidc.IntrospectionResponse{Active: true, Subject: "alice"}, nil
+	})
+	SetTokenCache(TokenCacheConfig{
+		MaxAge:    time.Minute,
+		IsRevoked: func(ctx context.Context, user *oidc.IntrospectionResponse) bool { return revoked },
+	})
+	t.Cleanup(func() { SetTokenCache(TokenCacheConfig{}) })
+
+	verify := func(wantCalls int) {
+		t.Helper()
+		if _, err := introspect(context.Background(), "token"); err != nil {
+			t.Fatal(err)
+		}
+		if calls != wantCalls {
+			t.Fatalf("introspected %d times, want %d", calls, wantCalls)
+		}
+	}
+
+	verify(1)
+	verify(1) // cached
+
+	RevokeToken("token")
+	verify(2)
+
+	revoked = true
+	verify(3)
+	revoked = false
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/revoke", strings.NewReader(url.Values{"sub": {"alice"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	TokenRevocationHandler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("revocation status = %d", rr.Code)
+	}
+	verify(4)
+
+	SetTokenCache(TokenCacheConfig{})
+	verify(5)
+	verify(6) // caching disabled
+}
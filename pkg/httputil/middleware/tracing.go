@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/edgeflare/pgo/pkg/httputil/middleware"
+
+// traceContext extracts and injects W3C traceparent and tracestate headers, regardless of the global propagator.
+var traceContext = propagation.TraceContext{}
+
+// Tracing is middleware that starts an OpenTelemetry server span per request, continuing the trace of an
+// incoming W3C traceparent header. The span is named by the route pattern that matched, e.g. "GET /users/{id}",
+// and marked as failed on 5xx responses. Spans are created with tp, or the global TracerProvider if tp is nil.
+//
+// The span is in the request context, so database queries run with it become child spans when the pool is
+// configured with pgx.TraceQueries.
+func Tracing(tp trace.TracerProvider) func(http.Handler) http.Handler {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(tracerName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := traceContext.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			))
+			defer span.End()
+			annotateLog(ctx, func(f *logFields) { f.traceID = span.SpanContext().TraceID().String() })
+			r = r.WithContext(ctx)
+
+			rec := NewResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			if r.Pattern != "" {
+				span.SetName(r.Pattern)
+				span.SetAttributes(attribute.String("http.route", r.Pattern))
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", rec.StatusCode))
+			if rec.StatusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.StatusCode))
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PgErrorResponse is the JSON body ErrorFromPg sends for Postgres errors.
+type PgErrorResponse struct {
+	Code     int    `json:"code"` // HTTP status
+	Message  string `json:"message"`
+	SQLState string `json:"sqlstate"`
+	Detail   string `json:"detail,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// pgErrorStatuses maps SQLSTATE codes, or their two character classes, to HTTP statuses like PostgREST does.
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+var pgErrorStatuses = map[string]int{
+	"08": http.StatusServiceUnavailable, // connection exception
+	"09": http.StatusInternalServerError,
+	"0L": http.StatusForbidden, // invalid grantor
+	"0P": http.StatusForbidden, // invalid role specification
+	"22": http.StatusBadRequest, // data exception
+	"23": http.StatusBadRequest, // integrity constraint violation
+	"25": http.StatusInternalServerError,
+	"28": http.StatusForbidden, // invalid authorization specification
+	"2D": http.StatusInternalServerError,
+	"38": http.StatusInternalServerError,
+	"39": http.StatusInternalServerError,
+	"3B": http.StatusInternalServerError,
+	"40": http.StatusInternalServerError, // transaction rollback
+	"42": http.StatusBadRequest,          // syntax error or access rule violation
+	"53": http.StatusServiceUnavailable,  // insufficient resources
+	"54": http.StatusInternalServerError,
+	"55": http.StatusInternalServerError,
+	"57": http.StatusInternalServerError,
+	"58": http.StatusInternalServerError,
+	"F0": http.StatusInternalServerError,
+	"HV": http.StatusInternalServerError,
+	"P0": http.StatusInternalServerError,
+	"XX": http.StatusInternalServerError,
+
+	"23503": http.StatusConflict,            // foreign_key_violation
+	"23505": http.StatusConflict,            // unique_violation
+	"25006": http.StatusMethodNotAllowed,    // read_only_sql_transaction
+	"42501": http.StatusForbidden,           // insufficient_privilege
+	"42883": http.StatusNotFound,            // undefined_function
+	"42P01": http.StatusNotFound,            // undefined_table
+	"42P17": http.StatusInternalServerError, // infinite_recursion
+	"57014": http.StatusGatewayTimeout,      // query_canceled, e.g. by statement_timeout
+	"P0001": http.StatusBadRequest,          // raise_exception
+}
+
+var pgErrorStatusesMu sync.RWMutex
+
+// SetPgErrorStatus maps a SQLSTATE code, e.g. "23514", or a two character class, e.g. "22", to an HTTP status
+// for ErrorFromPg and PgErrorStatus, overriding the default mapping. Codes take precedence over classes.
+func SetPgErrorStatus(sqlState string, status int) {
+	pgErrorStatusesMu.Lock()
+	defer pgErrorStatusesMu.Unlock()
+	pgErrorStatuses[sqlState] = status
+}
+
+// PgErrorStatus returns the HTTP status of err: the mapped status of Postgres errors (see SetPgErrorStatus),
+// 404 for pgx.ErrNoRows, 504 for timeouts and 500 otherwise. Errors raised with a SQLSTATE of the form PTnnn,
+// e.g. RAISE SQLSTATE 'PT402', have status nnn, as in PostgREST.
+func PgErrorStatus(err error) int {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr != nil:
+		return pgStatus(pgErr.Code)
+	case errors.Is(err, pgx.ErrNoRows):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func pgStatus(code string) int {
+	if strings.HasPrefix(code, "PT") {
+		if status, err := strconv.Atoi(code[2:]); err == nil && status >= 100 && status <= 599 {
+			return status
+		}
+	}
+	pgErrorStatusesMu.RLock()
+	defer pgErrorStatusesMu.RUnlock()
+	if status, ok := pgErrorStatuses[code]; ok {
+		return status
+	}
+	if len(code) >= 2 {
+		if status, ok := pgErrorStatuses[code[:2]]; ok {
+			return status
+		}
+	}
+	return http.StatusBadRequest
+}
+
+// ErrorFromPg sends a JSON error response for err with the status of PgErrorStatus. Postgres errors are
+// described by their message, SQLSTATE, detail and hint (see PgErrorResponse); other errors by their status text
+// only, so internal details aren't exposed, and are logged if they're unexpected.
+func ErrorFromPg(w http.ResponseWriter, err error) {
+	status := PgErrorStatus(err)
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr == nil {
+		if status == http.StatusInternalServerError {
+			log.Printf("Database error: %v", err)
+		}
+		Error(w, status, http.StatusText(status))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(PgErrorResponse{
+		Code:     status,
+		Message:  pgErr.Message,
+		SQLState: pgErr.Code,
+		Detail:   pgErr.Detail,
+		Hint:     pgErr.Hint,
+	})
+}
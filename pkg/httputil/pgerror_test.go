@@ -0,0 +1,66 @@
+package httputil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestPgErrorStatus(t *testing.T) {
+	tests := []struct {
+		err            error
+		expectedStatus int
+	}{
+		{&pgconn.PgError{Code: "23505"}, http.StatusConflict},
+		{&pgconn.PgError{Code: "23514"}, http.StatusBadRequest}, // class 23
+		{&pgconn.PgError{Code: "42P01"}, http.StatusNotFound},
+		{&pgconn.PgError{Code: "42601"}, http.StatusBadRequest}, // class 42
+		{&pgconn.PgError{Code: "08006"}, http.StatusServiceUnavailable},
+		{&pgconn.PgError{Code: "PT402"}, http.StatusPaymentRequired},
+		{&pgconn.PgError{Code: "ZZ000"}, http.StatusBadRequest},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23503"}), http.StatusConflict},
+		{pgx.ErrNoRows, http.StatusNotFound},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if status := PgErrorStatus(tt.err); status != tt.expectedStatus {
+			t.Errorf("PgErrorStatus(%v) = %d, want %d", tt.err, status, tt.expectedStatus)
+		}
+	}
+}
+
+func TestErrorFromPg(t *testing.T) {
+	SetPgErrorStatus("23514", http.StatusUnprocessableEntity)
+	t.Cleanup(func() {
+		pgErrorStatusesMu.Lock()
+		delete(pgErrorStatuses, "23514")
+		pgErrorStatusesMu.Unlock()
+	})
+
+	rr := httptest.NewRecorder()
+	ErrorFromPg(rr, &pgconn.PgError{Code: "23514", Message: "check constraint violated", Hint: "fix it"})
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	var body PgErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.SQLState != "23514" || body.Message != "check constraint violated" || body.Hint != "fix it" {
+		t.Errorf("body = %+v", body)
+	}
+
+	rr = httptest.NewRecorder()
+	ErrorFromPg(rr, errors.New("dial tcp: secret-host:5432"))
+	if rr.Code != http.StatusInternalServerError || json.Unmarshal(rr.Body.Bytes(), &body) != nil || body.Message != "Internal Server Error" {
+		t.Errorf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
@@ -2,12 +2,11 @@ package httputil
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
-	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/zitadel/oidc/v3/pkg/oidc"
@@ -16,10 +15,14 @@ import (
 // Conn retrieves the OIDC user and a pgxpool.Conn from the request context.
 // It returns an error if the user or connection is not found in the context.
 // Currently it only supports OIDC users. But the authZ middleware chain works, and error occurs here.
+// Requests authorized as the anonymous role (see AnonRole) get a user without claims.
 func Conn(r *http.Request) (*oidc.IntrospectionResponse, *pgxpool.Conn, *pgconn.PgError) {
 	// TODO: Add support for Basic Auth
 	// basicAuthUser := r.Context().Value(pgo.BasicAuthCtxKey).(string)
 	user, ok := OIDCUser(r)
+	if !ok && isAnon(r) {
+		user, ok = anonUser(), true
+	}
 	if !ok || !user.Active {
 		return nil, nil, &pgconn.PgError{
 			Code:    "28000", // SQLSTATE for invalid authorization specification
@@ -38,8 +41,43 @@ func Conn(r *http.Request) (*oidc.IntrospectionResponse, *pgxpool.Conn, *pgconn.
 	return user, conn, nil
 }
 
+// Tx retrieves the transaction started by the PostgresTx middleware from the request context.
+func Tx(r *http.Request) (pgx.Tx, bool) {
+	tx, ok := r.Context().Value(PgTxCtxKey).(pgx.Tx)
+	return tx, ok && tx != nil
+}
+
+// RequestClaimsSetting returns the setting JWT claims are stored in for RLS policies, which is
+// PGO_POSTGRES_OIDC_REQUEST_JWT_CLAIMS or "request.jwt.claims" for PostgREST compatibility.
+func RequestClaimsSetting() string {
+	if setting, ok := os.LookupEnv("PGO_POSTGRES_OIDC_REQUEST_JWT_CLAIMS"); ok {
+		return setting
+	}
+	return "request.jwt.claims"
+}
+
+// AnonRole returns PGO_POSTGRES_ANON_ROLE, the Postgres role of unauthenticated requests, like PostgREST's db-anon-role.
+// Anonymous access is disabled if it's empty.
+func AnonRole() string {
+	return os.Getenv("PGO_POSTGRES_ANON_ROLE")
+}
+
+// isAnon reports whether the request was authorized as the anonymous role without a token.
+func isAnon(r *http.Request) bool {
+	role, ok := r.Context().Value(PgRoleCtxKey).(string)
+	anon := AnonRole()
+	return ok && anon != "" && role == anon
+}
+
+// anonUser is the user of anonymous requests, which has empty claims.
+func anonUser() *oidc.IntrospectionResponse {
+	return &oidc.IntrospectionResponse{Active: true, Claims: map[string]any{}}
+}
+
 // ConnWithRole retrieves the OIDC user, a pgxpool.Conn, and checks for a role
-// from the request context. It's designed for use with Row Level Security (RLS)
+// from the request context. The role and claims are set for the connection's session, so they must be reset
+// when it's released, as pools created by pgx.PoolManager or configured with pgx.ResetSessionOnRelease do;
+// RoleBatch and the PostgresTx middleware scope them to a transaction instead. It's designed for use with Row Level Security (RLS)
 // enabled on a table. JWT claims are set using environment variable
 // PGO_POSTGRES_OIDC_REQUEST_JWT_CLAIMS, defaulting to "request.jwt.claims" for PostgREST compatibility.
 // See https://docs.postgrest.org/en/v12/references/transactions.html#request-headers-cookies-and-jwt-claims for more.
@@ -67,24 +105,20 @@ func ConnWithRole(r *http.Request) (*oidc.IntrospectionResponse, *pgxpool.Conn,
 		}
 	}
 
-	claimsJSON, err := json.Marshal(user.Claims)
+	if rolePreset(r) {
+		role = ""
+	}
+	batch, err := roleBatch(role, user, false)
 	if err != nil {
+		conn.Release()
 		return nil, nil, &pgconn.PgError{
 			Code:    "28000",
-			Message: fmt.Sprintf("Failed to marshal claims: %v", err),
+			Message: fmt.Sprintf("Failed to set claims: %v", err),
 		}
 	}
-	escapedClaimsJSON := strings.ReplaceAll(string(claimsJSON), "'", "''")
+	queueRequestID(r, batch, false)
 
-	setRoleQuery := fmt.Sprintf("SET ROLE %s;", role)
-	reqClaims, ok := os.LookupEnv("PGO_POSTGRES_OIDC_REQUEST_JWT_CLAIMS")
-	if !ok {
-		reqClaims = "request.jwt.claims"
-	}
-	setReqClaimsQuery := fmt.Sprintf("SET %s TO '%s';", reqClaims, escapedClaimsJSON)
-	combinedQuery := setRoleQuery + setReqClaimsQuery
-
-	_, execErr := conn.Exec(context.Background(), combinedQuery)
+	execErr := conn.SendBatch(context.Background(), batch).Close()
 	if execErr != nil {
 		conn.Release()
 		if pgErr, ok := execErr.(*pgconn.PgError); ok {
@@ -98,3 +132,110 @@ func ConnWithRole(r *http.Request) (*oidc.IntrospectionResponse, *pgxpool.Conn,
 
 	return user, conn, nil
 }
+
+// RoleBatch is like ConnWithRole, but instead of setting the role and claims in a round trip of its own,
+// it returns a batch that sets them, for the handler to queue its queries behind and send in one round trip:
+//
+//	user, conn, batch, pgErr := httputil.RoleBatch(r)
+//	if pgErr != nil { ... }
+//	defer conn.Release()
+//	batch.Queue("SELECT balance FROM wallets").QueryRow(func(row pgx.Row) error {
+//		return row.Scan(&balance)
+//	})
+//	err := conn.SendBatch(r.Context(), batch).Close()
+func RoleBatch(r *http.Request) (*oidc.IntrospectionResponse, *pgxpool.Conn, *pgx.Batch, *pgconn.PgError) {
+	user, conn, pgErr := Conn(r)
+	if pgErr != nil {
+		return nil, nil, nil, pgErr
+	}
+
+	role, ok := r.Context().Value(PgRoleCtxKey).(string)
+	if !ok {
+		conn.Release()
+		return nil, nil, nil, &pgconn.PgError{
+			Code:    "28000",
+			Message: "Role not found in context",
+		}
+	}
+
+	if rolePreset(r) {
+		role = ""
+	}
+	batch, err := roleBatch(role, user, true)
+	if err != nil {
+		conn.Release()
+		return nil, nil, nil, &pgconn.PgError{
+			Code:    "28000",
+			Message: fmt.Sprintf("Failed to set claims: %v", err),
+		}
+	}
+	queueRequestID(r, batch, true)
+	return user, conn, batch, nil
+}
+
+// QueryWithRole runs sql on the request's connection as the request's role, with the user's claims set,
+// in a single round trip, calling scan with its rows. The connection is released before it returns.
+func QueryWithRole(r *http.Request, scan func(pgx.Rows) error, sql string, args ...any) error {
+	_, conn, batch, pgErr := RoleBatch(r)
+	if pgErr != nil {
+		return pgErr
+	}
+	defer conn.Release()
+
+	batch.Queue(sql, args...).Query(scan)
+	return conn.SendBatch(r.Context(), batch).Close()
+}
+
+// ExecWithRole is like QueryWithRole for statements returning no rows.
+func ExecWithRole(r *http.Request, sql string, args ...any) (pgconn.CommandTag, error) {
+	_, conn, batch, pgErr := RoleBatch(r)
+	if pgErr != nil {
+		return pgconn.CommandTag{}, pgErr
+	}
+	defer conn.Release()
+
+	var tag pgconn.CommandTag
+	batch.Queue(sql, args...).Exec(func(ct pgconn.CommandTag) error {
+		tag = ct
+		return nil
+	})
+	return tag, conn.SendBatch(r.Context(), batch).Close()
+}
+
+// rolePreset reports whether the request's connection already has the request's role.
+func rolePreset(r *http.Request) bool {
+	preset, _ := r.Context().Value(PgRolePresetCtxKey).(bool)
+	return preset
+}
+
+// roleBatch returns a batch setting role, unless it's empty, and the user's claims (see SetClaimSettings). If local, they are set
+// with SET LOCAL and end with the batch's transaction, which is its own unless sent in one, rather than
+// persisting on the connection.
+func roleBatch(role string, user *oidc.IntrospectionResponse, local bool) (*pgx.Batch, error) {
+	claimsSQL, args, err := ClaimSettingsSQL(user.Claims, local)
+	if err != nil {
+		return nil, err
+	}
+	setRole := "SET ROLE "
+	if local {
+		setRole = "SET LOCAL ROLE "
+	}
+	batch := &pgx.Batch{}
+	if role != "" {
+		batch.Queue(setRole + pgx.Identifier{role}.Sanitize())
+	}
+	batch.Queue(claimsSQL, args...)
+	return batch, nil
+}
+
+// queueRequestID queues setting the request's ID to the setting in its context, if any (see
+// PgRequestIDSettingCtxKey). It's set even without a request ID, so a previous request's doesn't linger on
+// the connection.
+func queueRequestID(r *http.Request, batch *pgx.Batch, local bool) {
+	setting, _ := r.Context().Value(PgRequestIDSettingCtxKey).(string)
+	if setting == "" {
+		return
+	}
+	reqID, _ := r.Context().Value(RequestIDCtxKey).(string)
+	batch.Queue("SELECT set_config($1, $2, $3)", setting, reqID, local)
+}
@@ -0,0 +1,98 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/zitadel/oidc/v3/pkg/oidc"
+)
+
+func TestRoleBatch(t *testing.T) {
+	user := &oidc.IntrospectionResponse{Claims: map[string]any{"sub": "alice", "note": "it's"}}
+	batch, err := roleBatch(`Editor"; DROP ROLE x; --`, user, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Len() != 2 {
+		t.Fatalf("batch has %d statements, want 2", batch.Len())
+	}
+	if got, want := batch.QueuedQueries[0].SQL, `SET LOCAL ROLE "Editor""; DROP ROLE x; --"`; got != want {
+		t.Errorf("role statement = %s, want %s", got, want)
+	}
+	if got, want := batch.QueuedQueries[1].SQL, "SELECT set_config($1, $2, true)"; got != want {
+		t.Errorf("claims statement = %s, want %s", got, want)
+	}
+	claims := batch.QueuedQueries[1].Arguments
+	if claims[0] != "request.jwt.claims" || claims[1] != `{"note":"it's","sub":"alice"}` {
+		t.Errorf("claims arguments = %v", claims)
+	}
+}
+
+func TestRoleBatchPresetRole(t *testing.T) {
+	batch, err := roleBatch("", &oidc.IntrospectionResponse{Claims: map[string]any{}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Len() != 1 || batch.QueuedQueries[0].SQL != "SELECT set_config($1, $2, false)" {
+		t.Errorf("expected only the claims statement, got %d statements", batch.Len())
+	}
+}
+
+func TestQueueRequestID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	batch := &pgx.Batch{}
+	queueRequestID(r, batch, true)
+	if batch.Len() != 0 {
+		t.Fatalf("request ID queued without a setting")
+	}
+
+	ctx := context.WithValue(r.Context(), PgRequestIDSettingCtxKey, "application_name")
+	ctx = context.WithValue(ctx, RequestIDCtxKey, "req-1")
+	batch, err := roleBatch("editor", &oidc.IntrospectionResponse{Claims: map[string]any{}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queueRequestID(r.WithContext(ctx), batch, true)
+	if batch.Len() != 3 {
+		t.Fatalf("batch has %d statements, want the role, claims and request ID", batch.Len())
+	}
+	q := batch.QueuedQueries[2]
+	if want := []any{"application_name", "req-1", true}; q.SQL != "SELECT set_config($1, $2, $3)" || !reflect.DeepEqual(q.Arguments, want) {
+		t.Errorf("request ID statement = %s %v", q.SQL, q.Arguments)
+	}
+}
+
+func TestClaimSettings(t *testing.T) {
+	mappings, err := ParseClaimSettings("sub=request.jwt.sub, .org.id=app.org_id:int,admin=app.admin:bool,.=request.jwt.claims:json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetClaimSettings(mappings...)
+	defer SetClaimSettings()
+
+	claims := map[string]any{"sub": "alice", "org": map[string]any{"id": float64(42)}}
+	sql, args, err := ClaimSettingsSQL(claims, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT set_config($1, $2, false), set_config($3, $4, false), set_config($5, $6, false), set_config($7, $8, false)"; sql != want {
+		t.Errorf("sql = %s, want %s", sql, want)
+	}
+	want := []any{"request.jwt.sub", "alice", "app.org_id", "42", "app.admin", "", "request.jwt.claims", `{"org":{"id":42},"sub":"alice"}`}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+
+	claims["org"] = map[string]any{"id": "acme"}
+	if _, _, err := ClaimSettingsSQL(claims, false); err == nil {
+		t.Error("expected an error coercing a non-numeric org id to int")
+	}
+
+	if _, err := ParseClaimSettings("sub"); err == nil {
+		t.Error("expected an error for an entry without a setting")
+	}
+}
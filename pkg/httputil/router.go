@@ -3,14 +3,26 @@ package httputil
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/edgeflare/pgo/pkg/util"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // Middleware defines a function type that represents a middleware. Middleware functions wrap an
@@ -28,13 +40,23 @@ type Router struct {
 	prefix     string
 	mu         sync.RWMutex // Mutex for concurrency safety
 
+	h2c       bool
+	fallbacks *fallbackHandlers // shared with groups
+	routes    *routeTable       // shared with groups
+	hooks     *lifecycleHooks   // shared with groups
+	autocert  *autocert.Manager
+	challenge *http.Server // serves ACME HTTP-01 challenges for autocert, guarded by mu
+
 }
 
 // NewRouter creates a new instance of Router with the given options.
 func NewRouter(opts ...RouterOptions) *Router {
 	r := &Router{
-		mux:    http.NewServeMux(),
-		server: &http.Server{}, // Initialize with default server
+		mux:       http.NewServeMux(),
+		server:    &http.Server{}, // Initialize with default server
+		fallbacks: &fallbackHandlers{notFound: map[string]http.Handler{}, methodNotAllowed: map[string]http.Handler{}},
+		routes:    &routeTable{},
+		hooks:     &lifecycleHooks{},
 	}
 	for _, opt := range opts {
 		opt(r)
@@ -51,10 +73,49 @@ func WithServerOptions(opts ...func(*http.Server)) RouterOptions {
 	}
 }
 
+// WithH2C serves HTTP/2 over cleartext connections alongside HTTP/1.1, for load balancers and gRPC-aware
+// proxies that terminate TLS and speak HTTP/2 to their backends. It has no effect on TLS servers,
+// which negotiate HTTP/2 anyway.
+func WithH2C() RouterOptions {
+	return func(r *Router) {
+		r.h2c = true
+	}
+}
+
+// WithReadHeaderTimeout sets how long the server waits for a request's headers, guarding against slow clients.
+func WithReadHeaderTimeout(d time.Duration) RouterOptions {
+	return func(r *Router) {
+		r.server.ReadHeaderTimeout = d
+	}
+}
+
+// WithIdleTimeout sets how long keep-alive connections stay open between requests.
+func WithIdleTimeout(d time.Duration) RouterOptions {
+	return func(r *Router) {
+		r.server.IdleTimeout = d
+	}
+}
+
+// WithMaxHeaderBytes limits the size of request headers.
+func WithMaxHeaderBytes(n int) RouterOptions {
+	return func(r *Router) {
+		r.server.MaxHeaderBytes = n
+	}
+}
+
+// WithConnState sets a hook called when a client connection changes state, e.g. to count open connections.
+func WithConnState(fn func(net.Conn, http.ConnState)) RouterOptions {
+	return func(r *Router) {
+		r.server.ConnState = fn
+	}
+}
+
 // WithTLS provides a simplified way to enable HTTPS in your router.
 func WithTLS(certFile, keyFile string) RouterOptions {
 	return func(r *Router) {
-		r.server.TLSConfig = &tls.Config{}               // Initialize TLS config
+		if r.server.TLSConfig == nil {
+			r.server.TLSConfig = &tls.Config{} // Initialize TLS config
+		}
 		r.server.TLSConfig.MinVersion = tls.VersionTLS12 // Enforce secure TLS version (optional)
 
 		var cert tls.Certificate
@@ -78,8 +139,57 @@ func WithTLS(certFile, keyFile string) RouterOptions {
 	}
 }
 
+// WithAutoTLS enables HTTPS with certificates for domains obtained and renewed automatically from
+// Let's Encrypt, which are cached in cacheDir across restarts. ListenAndServe also listens on port 80 to answer
+// HTTP-01 challenges and redirect plain HTTP requests to HTTPS; the server must be reachable on ports 80 and 443
+// under the domains. TLS-ALPN-01 challenges are answered on the HTTPS port.
+func WithAutoTLS(domains []string, cacheDir string) RouterOptions {
+	return func(r *Router) {
+		if len(domains) == 0 {
+			log.Fatalf("autocert requires at least one domain")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(cacheDir),
+		}
+		if r.server.TLSConfig == nil {
+			r.server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		r.server.TLSConfig.GetCertificate = m.GetCertificate
+		r.server.TLSConfig.NextProtos = append(r.server.TLSConfig.NextProtos, "h2", "http/1.1", acme.ALPNProto)
+		r.autocert = m
+	}
+}
+
+// WithClientCerts makes the server request client certificates signed by the CAs in the PEM file caFile,
+// for mutual TLS. Unless optional is true, connections without a valid certificate are rejected during
+// the handshake. Combine it with WithTLS, and with middleware.ClientCertAuth to map certificates to Postgres roles.
+func WithClientCerts(caFile string, optional ...bool) RouterOptions {
+	return func(r *Router) {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			log.Fatalf("failed to read client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Fatalf("no certificates found in client CA file %s", caFile)
+		}
+
+		if r.server.TLSConfig == nil {
+			r.server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		r.server.TLSConfig.ClientCAs = pool
+		r.server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if len(optional) > 0 && optional[0] {
+			r.server.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+}
+
 // Use adds one or more middleware to the router. At least one middleware must be provided.
-// Middleware functions are applied in the order they are added.
+// Middleware functions are applied in the order they are added, to the routes registered afterwards and,
+// on the root router, to requests matching no route. Each request runs through them once.
 func (r *Router) Use(mw Middleware, additional ...Middleware) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -99,13 +209,45 @@ func (r *Router) Group(prefix string) *Router {
 		middleware: append([]Middleware{}, r.middleware...),
 		server:     r.server,
 		prefix:     r.prefix + prefix,
+		fallbacks:  r.fallbacks,
+		routes:     r.routes,
+		hooks:      r.hooks,
 	}
 }
 
+// NotFound sets the handler for requests matching no route under the router's prefix, replacing the
+// mux's plain text 404 response. It runs with the router's middleware, like a route's handler.
+// A group's handler takes precedence over its parent's for paths under the group's prefix.
+func (r *Router) NotFound(handler http.Handler) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.fallbacks.set(r.fallbacks.notFound, r.prefix, r.wrap(handler))
+}
+
+// MethodNotAllowed sets the handler for requests whose path matches a route under the router's prefix
+// but whose method doesn't, replacing the mux's plain text 405 response. The Allow header listing
+// the path's methods is set before the handler runs.
+func (r *Router) MethodNotAllowed(handler http.Handler) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	r.fallbacks.set(r.fallbacks.methodNotAllowed, r.prefix, r.wrap(handler))
+}
+
+// wrap applies the router's middleware to handler. The caller must hold r.mu.
+func (r *Router) wrap(handler http.Handler) http.Handler {
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	return handler
+}
+
 // Handle registers an HTTP handler function for a given method and pattern as introduced in
 // [Routing Enhancements for Go 1.22](https://go.dev/blog/routing-enhancements)
 // The handler `METHOD /pattern` on a route group with a /prefix resolves to `METHOD /prefix/pattern`
-func (r *Router) Handle(methodPattern string, handler http.Handler) {
+//
+// Optional route middleware applies to this route only, inside the router's middleware,
+// e.g. r.Handle("GET /admin", h, requireAdmin) for a route with stricter auth than its siblings.
+func (r *Router) Handle(methodPattern string, handler http.Handler, routeMiddleware ...Middleware) {
 	parts := strings.SplitN(methodPattern, " ", 2)
 	if len(parts) != 2 {
 		log.Fatalf("invalid method pattern: %s", methodPattern)
@@ -117,13 +259,82 @@ func (r *Router) Handle(methodPattern string, handler http.Handler) {
 
 	// Create the final handler with all middleware applied
 	finalHandler := handler
-	for i := len(r.middleware) - 1; i >= 0; i-- {
-		finalHandler = r.middleware[i](finalHandler)
+	for i := len(routeMiddleware) - 1; i >= 0; i-- {
+		finalHandler = routeMiddleware[i](finalHandler)
 	}
+	finalHandler = r.wrap(finalHandler)
 	// fullPattern := r.prefix + pattern
 	fullPattern := fmt.Sprintf("%s %s%s", method, r.prefix, pattern)
 
 	r.mux.Handle(fullPattern, finalHandler)
+
+	names := make([]string, 0, len(r.middleware)+len(routeMiddleware))
+	for _, mw := range append(slices.Clone(r.middleware), routeMiddleware...) {
+		names = append(names, middlewareName(mw))
+	}
+	r.routes.add(Route{Method: method, Pattern: r.prefix + pattern, Prefix: r.prefix, Middleware: names})
+}
+
+// Route describes a registered route.
+type Route struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"` // including the group prefix
+	Prefix  string `json:"prefix"`  // of the group the route was registered on
+	// Middleware names the router and route middleware, outermost first, e.g. "middleware.VerifyJWT".
+	Middleware []string `json:"middleware"`
+}
+
+// Routes returns the routes registered on the router and all its groups, in registration order.
+func (r *Router) Routes() []Route {
+	return r.routes.all()
+}
+
+// RoutesHandler serves Routes as JSON, e.g. r.Handle("GET /debug/routes", r.RoutesHandler()) to audit
+// an application's surface. Like other debug endpoints, it shouldn't be exposed publicly.
+func (r *Router) RoutesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		JSON(w, http.StatusOK, r.Routes())
+	})
+}
+
+type routeTable struct {
+	mu     sync.RWMutex
+	routes []Route
+}
+
+func (t *routeTable) add(route Route) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, route)
+}
+
+func (t *routeTable) all() []Route {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Clone(t.routes)
+}
+
+// middlewareName returns the name of the function that created mw, e.g. "middleware.Timeout"
+// for the closure returned by middleware.Timeout(d).
+func middlewareName(mw Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	// drop the closure suffixes of middleware factories, e.g. ".func1" or ".func1.1"
+	parts := strings.Split(name, ".")
+	for len(parts) > 2 && (strings.HasPrefix(parts[len(parts)-1], "func") || isDigits(parts[len(parts)-1])) {
+		parts = parts[:len(parts)-1]
+	}
+	return strings.Join(parts, ".")
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
 }
 
 // ListenAndServe starts the server, automatically choosing between HTTP and HTTPS based on TLS config.
@@ -132,32 +343,215 @@ func (r *Router) ListenAndServe(addr string) error {
 	fmt.Printf("starting server on %s\n", addr)
 
 	r.server.Addr = addr
-	r.server.Handler = r.applyMiddleware()
+	r.server.Handler = r.serverHandler()
+
+	if addr == "" {
+		addr = ":http"
+		if r.server.TLSConfig != nil {
+			addr = ":https"
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	// hooks run once the server can accept connections, e.g. to register it with service discovery
+	if err := r.hooks.start(context.Background()); err != nil {
+		ln.Close()
+		return fmt.Errorf("start hook failed: %w", err)
+	}
+
+	if r.autocert != nil {
+		challenge := &http.Server{Addr: ":http", Handler: r.autocert.HTTPHandler(nil)}
+		r.mu.Lock()
+		r.challenge = challenge
+		r.mu.Unlock()
+		go func() {
+			if err := challenge.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("ACME challenge server failed: %v", err)
+			}
+		}()
+	}
 
 	if r.server.TLSConfig != nil {
 		// HTTPS
-		return r.server.ListenAndServeTLS("", "") // Use empty strings to auto-detect cert/key in TLSConfig
+		return r.server.ServeTLS(ln, "", "") // Use empty strings to auto-detect cert/key in TLSConfig
 	}
 	// HTTP
-	return r.server.ListenAndServe()
+	return r.server.Serve(ln)
 }
 
-// Shutdown gracefully shuts down the HTTP server.
+// OnStart registers fn to run when ListenAndServe has bound its address, before it serves requests, e.g. to
+// register the server with service discovery or start pipelines. Hooks run in registration order; if one fails,
+// ListenAndServe returns its error without serving.
+func (r *Router) OnStart(fn func(ctx context.Context) error) {
+	r.hooks.mu.Lock()
+	defer r.hooks.mu.Unlock()
+	r.hooks.onStart = append(r.hooks.onStart, fn)
+}
+
+// OnShutdown registers fn to run during Shutdown once in-flight requests are done, e.g. to flush pipelines,
+// close pools or deregister from service discovery. Hooks run in reverse registration order, like deferred calls,
+// so resources are released after the ones depending on them; all run even if some fail.
+func (r *Router) OnShutdown(fn func(ctx context.Context) error) {
+	r.hooks.mu.Lock()
+	defer r.hooks.mu.Unlock()
+	r.hooks.onShutdown = append(r.hooks.onShutdown, fn)
+}
+
+// Shutdown gracefully shuts down the HTTP server, then runs the OnShutdown hooks with ctx.
+// It returns the errors of the server and the hooks.
 func (r *Router) Shutdown(ctx context.Context) error {
 	log.Println("shutting down server")
-	return r.server.Shutdown(ctx)
+	r.mu.RLock()
+	challenge := r.challenge
+	r.mu.RUnlock()
+	if challenge != nil {
+		if err := challenge.Shutdown(ctx); err != nil {
+			log.Printf("failed to shut down ACME challenge server: %v", err)
+		}
+	}
+	err := r.server.Shutdown(ctx)
+	return errors.Join(err, r.hooks.shutdown(ctx))
+}
+
+type lifecycleHooks struct {
+	mu         sync.Mutex
+	onStart    []func(ctx context.Context) error
+	onShutdown []func(ctx context.Context) error
+}
+
+func (h *lifecycleHooks) start(ctx context.Context) error {
+	h.mu.Lock()
+	hooks := slices.Clone(h.onStart)
+	h.mu.Unlock()
+	for _, fn := range hooks {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *lifecycleHooks) shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	hooks := slices.Clone(h.onShutdown)
+	h.mu.Unlock()
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Handler returns the handler ListenAndServe serves, e.g. for httptest.NewServer or an http.Server
+// configured by the caller. Routes registered later are served too, but not middleware added later.
+func (r *Router) Handler() http.Handler {
+	return r.serverHandler()
+}
+
+// serverHandler returns the handler the server runs: the mux with middleware applied, accepting h2c if enabled.
+func (r *Router) serverHandler() http.Handler {
+	handler := r.applyMiddleware()
+	if r.h2c && r.server.TLSConfig == nil {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: r.server.IdleTimeout})
+	}
+	return handler
 }
 
 // applyMiddleware applies middleware to the http.Handler and returns a new http.Handler.
+// Routes and fallback handlers already run with the middleware, applied when they're registered, so it's only
+// applied to the mux's responses to requests matching no route, each request running through it once.
 func (r *Router) applyMiddleware() http.Handler {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	var handler http.Handler = r.mux
-	for i := len(r.middleware) - 1; i >= 0; i-- {
-		handler = r.middleware[i](handler)
+	unmatched := r.wrap(r.mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.route(w, req, unmatched)
+	})
+}
+
+// route serves a request with the mux, or if it matches no route with the NotFound or MethodNotAllowed
+// handler set for its path, or else with unmatched.
+func (r *Router) route(w http.ResponseWriter, req *http.Request, unmatched http.Handler) {
+	if _, pattern := r.mux.Handler(req); pattern != "" {
+		r.mux.ServeHTTP(w, req)
+		return
 	}
-	return handler
+	if r.fallbacks.empty() {
+		unmatched.ServeHTTP(w, req)
+		return
+	}
+
+	allow := r.allowedMethods(req)
+	fallbacks := r.fallbacks.notFound
+	if len(allow) > 0 {
+		fallbacks = r.fallbacks.methodNotAllowed
+	}
+	handler := r.fallbacks.lookup(fallbacks, req.URL.Path)
+	if handler == nil {
+		unmatched.ServeHTTP(w, req)
+		return
+	}
+	if len(allow) > 0 {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+	}
+	handler.ServeHTTP(w, req)
+}
+
+var routeMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// allowedMethods returns the methods of the routes matching req's path.
+func (r *Router) allowedMethods(req *http.Request) []string {
+	var allow []string
+	probe := *req
+	for _, method := range routeMethods {
+		probe.Method = method
+		if _, pattern := r.mux.Handler(&probe); pattern != "" {
+			allow = append(allow, method)
+		}
+	}
+	return allow
+}
+
+// fallbackHandlers holds NotFound and MethodNotAllowed handlers by router prefix.
+type fallbackHandlers struct {
+	mu               sync.RWMutex
+	notFound         map[string]http.Handler
+	methodNotAllowed map[string]http.Handler
+}
+
+func (f *fallbackHandlers) set(handlers map[string]http.Handler, prefix string, handler http.Handler) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	handlers[prefix] = handler
+}
+
+func (f *fallbackHandlers) empty() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.notFound) == 0 && len(f.methodNotAllowed) == 0
+}
+
+// lookup returns the handler of the longest prefix containing path.
+func (f *fallbackHandlers) lookup(handlers map[string]http.Handler, path string) http.Handler {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var match http.Handler
+	longest := -1
+	for prefix, handler := range handlers {
+		under := prefix == "" || path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+		if under && len(prefix) > longest {
+			match, longest = handler, len(prefix)
+		}
+	}
+	return match
 }
 
 // Constants for ASCII art and console colors
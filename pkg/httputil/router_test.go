@@ -2,12 +2,22 @@ package httputil
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/http2"
 )
 
 // TestNewRouter tests the creation of a new Router
@@ -75,6 +85,47 @@ func TestRouterGroup(t *testing.T) {
 	}
 }
 
+// TestRouterRouteMiddleware tests middleware applied to a single route
+func TestRouterRouteMiddleware(t *testing.T) {
+	r := NewRouter()
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r.Use(tag("router"))
+	r.Handle("GET /public", ok)
+	r.Handle("GET /tagged", ok, tag("route1"), tag("route2"))
+	r.Handle("GET /admin", ok, deny)
+
+	for path, want := range map[string]int{"/public": http.StatusOK, "/tagged": http.StatusOK, "/admin": http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		r.mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d", path, want, w.Code)
+		}
+	}
+
+	order = nil
+	r.mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tagged", nil))
+	if fmt.Sprint(order) != "[router route1 route2]" {
+		t.Errorf("expected middleware order [router route1 route2], got %v", order)
+	}
+}
+
 // TestRouterListenAndServe tests server start and shutdown
 func TestRouterListenAndServe(t *testing.T) {
 	r := NewRouter()
@@ -116,6 +167,48 @@ func TestRouterListenAndServe(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRouterLifecycleHooks(t *testing.T) {
+	r := NewRouter()
+	var mu sync.Mutex
+	var calls []string
+	hook := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, name)
+			return err
+		}
+	}
+	started := make(chan struct{})
+	r.OnStart(hook("register", nil))
+	r.Group("/api").OnStart(func(context.Context) error { close(started); return nil })
+	r.OnShutdown(hook("close pool", nil))
+	r.OnShutdown(hook("flush pipeline", errors.New("flush failed")))
+
+	served := make(chan error, 1)
+	go func() { served <- r.ListenAndServe("127.0.0.1:0") }()
+	<-started
+
+	err := r.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "flush failed") {
+		t.Errorf("Shutdown() error = %v, want hook error", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("ListenAndServe() error = %v", err)
+	}
+	want := []string{"register", "flush pipeline", "close pool"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	// a failing start hook stops ListenAndServe
+	r = NewRouter()
+	r.OnStart(hook("fail", errors.New("registry unavailable")))
+	if err := r.ListenAndServe("127.0.0.1:0"); err == nil || !strings.Contains(err.Error(), "registry unavailable") {
+		t.Errorf("ListenAndServe() error = %v, want start hook error", err)
+	}
+}
+
 // TestRouterTLS tests the TLS configuration of the router.
 // func TestRouterTLS(t *testing.T) {
 // 	certPath := "./test_tls/tls.crt"
@@ -262,3 +355,152 @@ func BenchmarkRouterServeHTTPConcurrent(b *testing.B) {
 		}
 	})
 }
+
+func TestWithAutoTLS(t *testing.T) {
+	r := NewRouter(WithAutoTLS([]string{"example.com"}, t.TempDir()))
+	if r.autocert == nil || r.server.TLSConfig == nil || r.server.TLSConfig.GetCertificate == nil {
+		t.Fatal("expected autocert to provide TLS certificates")
+	}
+	if !slices.Contains(r.server.TLSConfig.NextProtos, acme.ALPNProto) {
+		t.Errorf("NextProtos = %v, want %s for TLS-ALPN challenges", r.server.TLSConfig.NextProtos, acme.ALPNProto)
+	}
+	if err := r.autocert.HostPolicy(context.Background(), "other.com"); err == nil {
+		t.Error("expected certificates for other hosts to be refused")
+	}
+}
+
+func TestWithH2C(t *testing.T) {
+	r := NewRouter(WithH2C(), WithReadHeaderTimeout(5*time.Second), WithMaxHeaderBytes(1<<16))
+	if r.server.ReadHeaderTimeout != 5*time.Second || r.server.MaxHeaderBytes != 1<<16 {
+		t.Errorf("server options not applied: %+v", r.server)
+	}
+	r.Handle("GET /proto", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Proto))
+	}))
+
+	ts := httptest.NewServer(r.serverHandler())
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(ts.URL + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("got protocol %s, want HTTP/2.0", body)
+	}
+}
+
+func TestRouterFallbackHandlers(t *testing.T) {
+	r := NewRouter()
+	r.Handle("GET /items", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	r.Handle("POST /items", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	r.NotFound(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Error(w, http.StatusNotFound, "root not found")
+	}))
+	r.MethodNotAllowed(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Error(w, http.StatusMethodNotAllowed, "method not allowed")
+	}))
+
+	api := r.Group("/api")
+	api.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Group", "api")
+			next.ServeHTTP(w, req)
+		})
+	})
+	api.NotFound(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		Error(w, http.StatusNotFound, "api not found")
+	}))
+
+	handler := r.serverHandler()
+	tests := []struct {
+		method, path   string
+		expectedStatus int
+		expectedBody   string
+		expectedAllow  string
+		expectedGroup  string
+	}{
+		{"GET", "/items", http.StatusOK, "", "", ""},
+		{"GET", "/missing", http.StatusNotFound, "root not found", "", ""},
+		{"GET", "/api/missing", http.StatusNotFound, "api not found", "", "api"},
+		{"DELETE", "/items", http.StatusMethodNotAllowed, "method not allowed", "GET, HEAD, POST", ""},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if rr.Code != tt.expectedStatus || !strings.Contains(rr.Body.String(), tt.expectedBody) {
+			t.Errorf("%s %s: got %d %q, want %d %q", tt.method, tt.path, rr.Code, rr.Body.String(), tt.expectedStatus, tt.expectedBody)
+		}
+		if got := rr.Header().Get("Allow"); got != tt.expectedAllow {
+			t.Errorf("%s %s: Allow = %q, want %q", tt.method, tt.path, got, tt.expectedAllow)
+		}
+		if got := rr.Header().Get("X-Group"); got != tt.expectedGroup {
+			t.Errorf("%s %s: group middleware header = %q, want %q", tt.method, tt.path, got, tt.expectedGroup)
+		}
+	}
+}
+
+func TestRouterAppliesMiddlewareOnce(t *testing.T) {
+	r := NewRouter()
+	calls := 0
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			calls++
+			next.ServeHTTP(w, req)
+		})
+	})
+	r.Handle("GET /items", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	r.Group("/api").Handle("GET /items", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	handler := r.Handler()
+	for _, tt := range []struct{ method, path string }{
+		{"GET", "/items"}, {"GET", "/api/items"}, {"GET", "/missing"}, {"DELETE", "/items"},
+	} {
+		calls = 0
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+		if calls != 1 {
+			t.Errorf("%s %s: middleware ran %d times, want 1", tt.method, tt.path, calls)
+		}
+	}
+}
+
+func headerMiddleware(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("X-Middleware", name)
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	r := NewRouter()
+	r.Use(headerMiddleware("root"))
+	r.Handle("GET /health", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	api := r.Group("/api")
+	api.Handle("POST /items", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}), func(next http.Handler) http.Handler {
+		return next
+	})
+
+	want := []Route{
+		{Method: "GET", Pattern: "/health", Prefix: "", Middleware: []string{"httputil.headerMiddleware"}},
+		{Method: "POST", Pattern: "/api/items", Prefix: "/api", Middleware: []string{"httputil.headerMiddleware", "httputil.TestRouterRoutes"}},
+	}
+	if got := r.Routes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Routes() = %+v, want %+v", got, want)
+	}
+
+	rr := httptest.NewRecorder()
+	r.RoutesHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/debug/routes", nil))
+	if !strings.Contains(rr.Body.String(), `"pattern":"/api/items"`) {
+		t.Errorf("RoutesHandler body = %s", rr.Body.String())
+	}
+}
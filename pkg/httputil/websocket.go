@@ -0,0 +1,171 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketConfig holds the configuration for AcceptWebSocket.
+type WebSocketConfig struct {
+	// PingInterval is how often the server pings the client. A client not answering within twice the
+	// interval is considered gone and its reads fail. Defaults to 30 seconds.
+	PingInterval time.Duration
+	// WriteTimeout bounds each write. Defaults to 10 seconds.
+	WriteTimeout time.Duration
+	// ReadLimit is the maximum message size in bytes. Defaults to 1 MiB.
+	ReadLimit int64
+	// AllowedOrigins lists the origins (e.g. https://app.example.com) allowed to connect from browsers;
+	// "*" allows any. By default only same-origin requests are accepted.
+	AllowedOrigins []string
+}
+
+// WebSocket is a server side WebSocket connection. Its methods may be called concurrently with one reader
+// and any number of writers.
+type WebSocket struct {
+	conn *websocket.Conn
+	cfg  WebSocketConfig
+
+	writeMu   sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// AcceptWebSocket upgrades the request to a WebSocket connection and starts pinging the client to keep
+// the connection alive. On failure it has already responded to the client with an HTTP error.
+func AcceptWebSocket(w http.ResponseWriter, r *http.Request, cfg ...WebSocketConfig) (*WebSocket, error) {
+	var c WebSocketConfig
+	if len(cfg) > 0 {
+		c = cfg[0]
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = 30 * time.Second
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = 10 * time.Second
+	}
+	if c.ReadLimit <= 0 {
+		c.ReadLimit = 1 << 20
+	}
+
+	upgrader := websocket.Upgrader{}
+	if len(c.AllowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" || slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin) {
+				return true
+			}
+			u, err := url.Parse(origin)
+			return err == nil && u.Host == r.Host
+		}
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &WebSocket{conn: conn, cfg: c, done: make(chan struct{})}
+	pongWait := 2 * c.PingInterval
+	conn.SetReadLimit(c.ReadLimit)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go ws.keepalive()
+	return ws, nil
+}
+
+func (ws *WebSocket) keepalive() {
+	ticker := time.NewTicker(ws.cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-ticker.C:
+			if err := ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(ws.cfg.WriteTimeout)); err != nil {
+				ws.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Read reads the next text or binary message. It returns early with ctx's error if ctx is done,
+// closing the connection.
+func (ws *WebSocket) Read(ctx context.Context) (messageType int, data []byte, err error) {
+	stop := context.AfterFunc(ctx, func() { ws.conn.Close() })
+	defer stop()
+	messageType, data, err = ws.conn.ReadMessage()
+	if err != nil && ctx.Err() != nil {
+		return 0, nil, ctx.Err()
+	}
+	return messageType, data, err
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (ws *WebSocket) ReadJSON(ctx context.Context, v any) error {
+	stop := context.AfterFunc(ctx, func() { ws.conn.Close() })
+	defer stop()
+	if err := ws.conn.ReadJSON(v); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// Write sends a text or binary message. The write is bounded by WriteTimeout and ctx's deadline.
+func (ws *WebSocket) Write(ctx context.Context, messageType int, data []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.conn.SetWriteDeadline(ws.writeDeadline(ctx))
+	return ws.conn.WriteMessage(messageType, data)
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (ws *WebSocket) WriteJSON(ctx context.Context, v any) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.conn.SetWriteDeadline(ws.writeDeadline(ctx))
+	return ws.conn.WriteJSON(v)
+}
+
+func (ws *WebSocket) writeDeadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(ws.cfg.WriteTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// Close sends a close message with code (e.g. websocket.CloseNormalClosure) and reason, and closes the connection.
+// It is safe to call more than once.
+func (ws *WebSocket) Close(code int, reason string) error {
+	var err error
+	ws.closeOnce.Do(func() {
+		close(ws.done)
+		ws.writeMu.Lock()
+		msg := websocket.FormatCloseMessage(code, reason)
+		werr := ws.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(ws.cfg.WriteTimeout))
+		ws.writeMu.Unlock()
+		err = errors.Join(werr, ws.conn.Close())
+		if errors.Is(err, websocket.ErrCloseSent) || errors.Is(err, net.ErrClosed) {
+			err = nil
+		}
+	})
+	return err
+}
+
+// IsWebSocketClose reports whether err is the client closing the connection normally or going away.
+func IsWebSocketClose(err error) bool {
+	return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived)
+}
@@ -0,0 +1,108 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	serverErr := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := AcceptWebSocket(w, r, WebSocketConfig{PingInterval: 20 * time.Millisecond})
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer ws.Close(websocket.CloseNormalClosure, "")
+		for {
+			var msg map[string]any
+			if err := ws.ReadJSON(r.Context(), &msg); err != nil {
+				if !IsWebSocketClose(err) {
+					serverErr <- err
+				}
+				close(serverErr)
+				return
+			}
+			msg["echo"] = true
+			if err := ws.WriteJSON(r.Context(), msg); err != nil {
+				serverErr <- err
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	if err := conn.WriteJSON(map[string]any{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]any
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply["n"] != float64(1) || reply["echo"] != true {
+		t.Errorf("reply = %v", reply)
+	}
+
+	// reading lets the ping handler run
+	go conn.ReadMessage()
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Error("server didn't ping")
+	}
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if err := <-serverErr; err != nil {
+		t.Errorf("server: %v", err)
+	}
+}
+
+func TestWebSocketReadContext(t *testing.T) {
+	done := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := AcceptWebSocket(w, r)
+		if err != nil {
+			done <- err
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 20*time.Millisecond)
+		defer cancel()
+		_, _, err = ws.Read(ctx)
+		done <- err
+	}))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Read returned %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read didn't return when its context was done")
+	}
+}
@@ -0,0 +1,35 @@
+// Package metrics holds the Prometheus registry shared by pgo components, so HTTP, CDC and database
+// metrics are exposed together on one endpoint.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the names of pgo metrics.
+const Namespace = "pgo"
+
+// Registry is the registry pgo components register their collectors with.
+// It includes the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MustRegister registers collectors with Registry. It panics if a collector is already registered.
+func MustRegister(cs ...prometheus.Collector) {
+	Registry.MustRegister(cs...)
+}
+
+// Handler serves the metrics of Registry in the Prometheus exposition format, e.g. on GET /metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -1,7 +1,8 @@
 package pglogrepl
 
 import (
-	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/jackc/pglogrepl"
@@ -33,8 +34,9 @@ type CDC struct {
 			Lsn       int64  `json:"lsn"`            // Log Sequence Number
 			Xmin      *int64 `json:"xmin,omitempty"` // XID for in-progress transaction
 		} `json:"source"`
-		Op          string `json:"op"`    // Operation type: c=create, u=update, d=delete, r=read
-		TsMs        int64  `json:"ts_ms"` // Processing timestamp
+		Op          string          `json:"op"`                // Operation type: c=create, u=update, d=delete, r=read, t=truncate, m=message
+		TsMs        int64           `json:"ts_ms"`             // Processing timestamp
+		Message     *LogicalMessage `json:"message,omitempty"` // Set for op=m only
 		Transaction *struct {
 			Id                  string `json:"id"`
 			TotalOrder          int64  `json:"total_order"`
@@ -43,6 +45,14 @@ type CDC struct {
 	} `json:"payload"`
 }
 
+// LogicalMessage is a message written with pg_logical_emit_message, e.g. an outbox marker or a cache invalidation.
+// Content is marshaled as base64, matching Debezium's logical decoding message events.
+type LogicalMessage struct {
+	Prefix        string `json:"prefix"`
+	Content       []byte `json:"content"`
+	Transactional bool   `json:"transactional"` // false for messages emitted outside of transaction order
+}
+
 // Field represents a schema field in Debezium's format
 type Field struct {
 	Field    string  `json:"field"`            // Field name
@@ -96,8 +106,9 @@ func GetDefaultSchema() struct {
 	}
 }
 
-// createSource creates a source struct with common fields populated
-func createSource(serverName, dbName string, msg interface{}, rel *pglogrepl.RelationMessageV2, lsn int64) struct {
+// createSource creates a source struct with common fields populated. rel is nil for events not tied to a table.
+// tsMs is the event time, shared with Payload.TsMs.
+func createSource(serverName, dbName string, msg interface{}, rel *pglogrepl.RelationMessageV2, lsn, tsMs int64) struct {
 	Version   string `json:"version"`
 	Connector string `json:"connector"`
 	Name      string `json:"name"`
@@ -121,6 +132,13 @@ func createSource(serverName, dbName string, msg interface{}, rel *pglogrepl.Rel
 		txID = int64(m.Xid)
 	case *pglogrepl.TruncateMessageV2:
 		txID = int64(m.Xid)
+	case *pglogrepl.LogicalDecodingMessageV2:
+		txID = int64(m.Xid)
+	}
+
+	var schemaName, tableName string
+	if rel != nil {
+		schemaName, tableName = rel.Namespace, rel.RelationName
 	}
 
 	return struct {
@@ -140,13 +158,39 @@ func createSource(serverName, dbName string, msg interface{}, rel *pglogrepl.Rel
 		Version:   "2.5", // Match your Debezium version
 		Connector: "postgresql",
 		Name:      serverName,
-		TsMs:      time.Now().UnixMilli(),
+		TsMs:      tsMs,
 		Snapshot:  false,
 		Db:        dbName,
-		Sequence:  fmt.Sprintf("[%d,%d]", lsn, lsn),
-		Schema:    rel.Namespace,
-		Table:     rel.RelationName,
+		Sequence:  sequence(lsn),
+		Schema:    schemaName,
+		Table:     tableName,
 		TxId:      txID,
 		Lsn:       lsn,
 	}
 }
+
+// sequence formats the Debezium source sequence "[lsn,lsn]".
+func sequence(lsn int64) string {
+	b := make([]byte, 0, 42)
+	b = append(b, '[')
+	b = strconv.AppendInt(b, lsn, 10)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, lsn, 10)
+	return string(append(b, ']'))
+}
+
+// defaultSchema is built once; newEvent hands out copies of it.
+var defaultSchema = GetDefaultSchema()
+
+// newEvent returns an event with its schema, source, op and timestamp populated.
+// Transforms may rewrite top-level schema fields in place, so each event gets its own
+// copy of Schema.Fields; the nested field descriptions are shared and must be treated as read-only.
+func newEvent(serverName, dbName string, msg interface{}, rel *pglogrepl.RelationMessageV2, lsn int64, op string) CDC {
+	tsMs := time.Now().UnixMilli()
+	event := CDC{Schema: defaultSchema}
+	event.Schema.Fields = slices.Clone(defaultSchema.Fields)
+	event.Payload.Source = createSource(serverName, dbName, msg, rel, lsn, tsMs)
+	event.Payload.Op = op
+	event.Payload.TsMs = tsMs
+	return event
+}
@@ -0,0 +1,84 @@
+package pglogrepl
+
+import (
+	"sync"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+)
+
+// decoder parses pgoutput messages on the caller's goroutine and fans tuple decoding out to workers.
+// Messages of a relation are always routed to the same worker, which keeps events of a table in commit order.
+// Relationless messages, i.e. logical decoding and two-phase commit messages, and truncates of several
+// relations are barriers: they're emitted after the events of the messages before them and before those of the
+// messages after them, so they stay in place among the rows of every relation.
+type decoder struct {
+	parser  *parser
+	jobs    []chan decodeJob
+	pending sync.WaitGroup // jobs queued and not emitted yet
+	wg      sync.WaitGroup
+}
+
+type decodeJob struct {
+	msg pglogrepl.Message
+	rel *pglogrepl.RelationMessageV2
+	buf *rowBuffer
+}
+
+// newDecoder starts n workers that send events parsed by p to out.
+func newDecoder(n int, p *parser, out chan<- CDC, dbName, dbHost string) *decoder {
+	d := &decoder{
+		parser: p,
+		jobs:   make([]chan decodeJob, n),
+	}
+	for i := range d.jobs {
+		d.jobs[i] = make(chan decodeJob, 64)
+		d.wg.Add(1)
+		go func(jobs <-chan decodeJob) {
+			defer d.wg.Done()
+			// pgtype.Map caches scan plans and isn't safe for concurrent use
+			typeMap := pgtype.NewMap()
+			for job := range jobs {
+				event := decodeV2(job.msg, job.rel, typeMap, dbHost, dbName)
+				job.buf.release()
+				out <- event
+				d.pending.Done()
+			}
+		}(d.jobs[i])
+	}
+	return d
+}
+
+// dispatch parses walData and queues row-level messages for decoding.
+// It must be called from a single goroutine, in WAL order.
+func (d *decoder) dispatch(walData []byte) {
+	msg, rel, buf := d.parser.parse(walData)
+	if msg == nil {
+		return
+	}
+	if rel == nil && !isRelationless(msg) {
+		zap.L().Error("unknown relation for message", zap.String("type", msg.Type().String()))
+		buf.release()
+		return
+	}
+	if rel == nil || spansRelations(msg) {
+		// rows of the relations may be queued on several workers
+		d.pending.Wait()
+		d.pending.Add(1)
+		d.jobs[0] <- decodeJob{msg: msg, rel: rel, buf: buf}
+		d.pending.Wait()
+		return
+	}
+	// relation messages replace map entries rather than mutating them, so rel is safe to share
+	d.pending.Add(1)
+	d.jobs[rel.RelationID%uint32(len(d.jobs))] <- decodeJob{msg: msg, rel: rel, buf: buf}
+}
+
+// close waits for queued messages to be decoded and stops the workers.
+func (d *decoder) close() {
+	for _, jobs := range d.jobs {
+		close(jobs)
+	}
+	d.wg.Wait()
+}
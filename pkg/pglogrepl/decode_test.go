@@ -0,0 +1,407 @@
+package pglogrepl
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// walRelation encodes a pgoutput Relation message with text, int4 and timestamptz columns.
+func walRelation(relID uint32, name string) []byte {
+	return walRelationColumns(relID, name, RelationColumn{Name: "id", DataType: pgtype.Int4OID, Key: true},
+		RelationColumn{Name: "name", DataType: pgtype.TextOID}, RelationColumn{Name: "created_at", DataType: pgtype.TimestamptzOID})
+}
+
+// walRelationColumns encodes a pgoutput Relation message with the given columns.
+func walRelationColumns(relID uint32, name string, cols ...RelationColumn) []byte {
+	b := []byte{'R'}
+	b = binary.BigEndian.AppendUint32(b, relID)
+	b = append(b, "public\x00"...)
+	b = append(b, name+"\x00"...)
+	b = append(b, 'd')
+	b = binary.BigEndian.AppendUint16(b, uint16(len(cols)))
+	for _, c := range cols {
+		var flags byte
+		if c.Key {
+			flags = 1
+		}
+		b = append(b, flags)
+		b = append(b, c.Name+"\x00"...)
+		b = binary.BigEndian.AppendUint32(b, c.DataType)
+		b = binary.BigEndian.AppendUint32(b, 0xffffffff)
+	}
+	return b
+}
+
+// walInsert encodes a pgoutput Insert message matching walRelation's columns.
+func walInsert(relID uint32, id int) []byte {
+	b := []byte{'I'}
+	b = binary.BigEndian.AppendUint32(b, relID)
+	b = append(b, 'N')
+	vals := []string{fmt.Sprint(id), fmt.Sprintf("row-%d", id), "2024-01-02 03:04:05.123456+00"}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(vals)))
+	for _, v := range vals {
+		b = append(b, 't')
+		b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+// walUpdate encodes a pgoutput Update message carrying the full old row, as with REPLICA IDENTITY FULL.
+func walUpdate(relID uint32, id int) []byte {
+	b := []byte{'U'}
+	b = binary.BigEndian.AppendUint32(b, relID)
+	b = append(b, 'O')
+	b = append(b, walInsert(relID, id)[6:]...) // tuple data of the old row
+	b = append(b, 'N')
+	return append(b, walInsert(relID, id+1)[6:]...)
+}
+
+// walDelete encodes a pgoutput Delete message carrying the replica identity key, with null and unchanged toast
+// columns.
+func walDelete(relID uint32, id int) []byte {
+	b := []byte{'D'}
+	b = binary.BigEndian.AppendUint32(b, relID)
+	b = append(b, 'K')
+	b = binary.BigEndian.AppendUint16(b, 3)
+	b = append(b, 't')
+	b = binary.BigEndian.AppendUint32(b, uint32(len(fmt.Sprint(id))))
+	b = append(b, fmt.Sprint(id)...)
+	return append(b, 'n', 'u')
+}
+
+func walMessages(tables, rows int) [][]byte {
+	var msgs [][]byte
+	for t := 0; t < tables; t++ {
+		msgs = append(msgs, walRelation(uint32(t+1), fmt.Sprintf("t%d", t)))
+	}
+	for i := 0; i < rows; i++ {
+		msgs = append(msgs, walInsert(uint32(i%tables+1), i))
+	}
+	return msgs
+}
+
+func TestDecoderPreservesTableOrder(t *testing.T) {
+	const tables, rows = 4, 400
+	out := make(chan CDC, rows)
+	dec := newDecoder(3, newParser(Config{}), out, "db", "host")
+	for _, msg := range walMessages(tables, rows) {
+		dec.dispatch(msg)
+	}
+	dec.close()
+	close(out)
+
+	last := map[string]int32{}
+	n := 0
+	for event := range out {
+		n++
+		table := event.Payload.Source.Table
+		id := event.Payload.After.(map[string]interface{})["id"].(int32)
+		if prev, ok := last[table]; ok && id <= prev {
+			t.Fatalf("table %s: id %d emitted after %d", table, id, prev)
+		}
+		last[table] = id
+	}
+	if n != rows {
+		t.Errorf("got %d events, want %d", n, rows)
+	}
+}
+
+func TestDecoderKeepsRelationlessMessagesInPlace(t *testing.T) {
+	const tables, rows = 4, 200
+	out := make(chan CDC, 2*rows)
+	dec := newDecoder(3, newParser(Config{}), out, "db", "host")
+	for i, msg := range walMessages(tables, rows) {
+		dec.dispatch(msg)
+		if i >= tables && i%10 == 0 {
+			dec.dispatch(walMessage("mark", fmt.Sprint(i-tables)))
+		}
+	}
+	dec.close()
+	close(out)
+
+	// every insert before a mark is emitted before it, and every insert after it, after it
+	inserted, marks := 0, 0
+	for event := range out {
+		if msg := event.Payload.Message; msg != nil {
+			marks++
+			var id int
+			fmt.Sscan(string(msg.Content), &id)
+			if inserted != id+1 {
+				t.Fatalf("mark after insert %d emitted after %d inserts", id, inserted)
+			}
+			continue
+		}
+		inserted++
+	}
+	if inserted != rows || marks != rows/10 {
+		t.Errorf("got %d inserts and %d marks, want %d and %d", inserted, marks, rows, rows/10)
+	}
+}
+
+func TestDecoderKeepsMultiRelationTruncatesInPlace(t *testing.T) {
+	const tables, rows = 2, 200
+	out := make(chan CDC, 2*rows)
+	dec := newDecoder(3, newParser(Config{}), out, "db", "host")
+	for i, msg := range walMessages(tables, rows) {
+		dec.dispatch(msg)
+		if i >= tables && i%10 == 0 {
+			dec.dispatch(walTruncate(1, 2))
+		}
+	}
+	dec.close()
+	close(out)
+
+	// every insert before a truncate is emitted before it, and every insert after it, after it
+	inserted, truncates := 0, 0
+	for event := range out {
+		if event.Payload.Op == "t" {
+			truncates++
+			if want := truncates*10 - tables + 1; inserted != want {
+				t.Fatalf("truncate %d emitted after %d inserts, want %d", truncates, inserted, want)
+			}
+			continue
+		}
+		inserted++
+	}
+	if inserted != rows || truncates != rows/10 {
+		t.Errorf("got %d inserts and %d truncates, want %d and %d", inserted, truncates, rows, rows/10)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	msgs := walMessages(8, 1000)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p := newParser(Config{})
+			typeMap := pgtype.NewMap()
+			for _, msg := range msgs {
+				_ = processV2(msg, p, typeMap, "db", "host")
+			}
+		}
+	})
+
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				out := make(chan CDC, 128)
+				done := make(chan struct{})
+				go func() {
+					for range out {
+					}
+					close(done)
+				}()
+				dec := newDecoder(workers, newParser(Config{}), out, "db", "host")
+				for _, msg := range msgs {
+					dec.dispatch(msg)
+				}
+				dec.close()
+				close(out)
+				<-done
+			}
+		})
+	}
+}
+
+// walTruncate encodes a pgoutput Truncate of relationIDs.
+func walTruncate(relationIDs ...uint32) []byte {
+	b := []byte{'T'}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(relationIDs)))
+	b = append(b, 0)
+	for _, id := range relationIDs {
+		b = binary.BigEndian.AppendUint32(b, id)
+	}
+	return b
+}
+
+// walMessage encodes a non-transactional pgoutput logical decoding Message.
+func walMessage(prefix, content string) []byte {
+	b := []byte{'M', 0}
+	b = binary.BigEndian.AppendUint64(b, 42)
+	b = append(b, prefix+"\x00"...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(content)))
+	return append(b, content...)
+}
+
+func TestProcessV2LogicalMessage(t *testing.T) {
+	events := processV2(walMessage("outbox", `{"id":1}`), newParser(Config{}), pgtype.NewMap(), "db", "host")
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Payload.Op != "m" || event.Payload.Message == nil {
+		t.Fatalf("unexpected event: %+v", event.Payload)
+	}
+	if m := event.Payload.Message; m.Prefix != "outbox" || string(m.Content) != `{"id":1}` || m.Transactional {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if event.Payload.Source.Lsn != 42 || event.Payload.Source.Table != "" {
+		t.Errorf("unexpected source: %+v", event.Payload.Source)
+	}
+}
+
+func TestParserMapsPartitionToRoot(t *testing.T) {
+	p := newParser(Config{})
+	p.partitionRoots = map[uint32]relationName{1: {schema: "sales", table: "orders"}}
+
+	events := processV2(walRelation(1, "orders_2024_01"), p, pgtype.NewMap(), "db", "host")
+	events = append(events, processV2(walInsert(1, 1), p, pgtype.NewMap(), "db", "host")...)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if src := events[0].Payload.Source; src.Schema != "sales" || src.Table != "orders" {
+		t.Errorf("got %s.%s, want sales.orders", src.Schema, src.Table)
+	}
+}
+
+func TestParserTableOps(t *testing.T) {
+	p := newParser(Config{
+		Ops:      []string{"insert", "update", "delete"},
+		TableOps: map[string][]string{"public.t1": {"update"}, "t2": {}},
+	})
+	typeMap := pgtype.NewMap()
+
+	var tables []string
+	for _, msg := range walMessages(3, 6) {
+		for _, event := range processV2(msg, p, typeMap, "db", "host") {
+			tables = append(tables, event.Payload.Source.Table)
+		}
+	}
+	// t0 follows the global filter, t1 allows updates only, t2's empty list allows everything
+	if want := []string{"t0", "t2", "t0", "t2"}; !slices.Equal(tables, want) {
+		t.Errorf("got events for %v, want %v", tables, want)
+	}
+}
+
+func TestParseRowMatchesParseV2(t *testing.T) {
+	for _, inStream := range []bool{false, true} {
+		for _, msg := range [][]byte{walInsert(1, 1), walUpdate(1, 1), walDelete(1, 1)} {
+			if inStream {
+				msg = slices.Concat(msg[:1], binary.BigEndian.AppendUint32(nil, 42), msg[1:])
+			}
+			want, err := pglogrepl.ParseV2(msg, inStream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf, got, err := parseRow(slices.Clone(msg), inStream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseRow(%c, inStream=%v) = %+v, want %+v", msg[0], inStream, got, want)
+			}
+			buf.release()
+		}
+	}
+
+	if _, _, err := parseRow(walInsert(1, 1)[:10], false); err == nil {
+		t.Error("parseRow of a truncated message succeeded")
+	}
+	if buf, msg, err := parseRow(walRelation(1, "users"), false); buf != nil || msg != nil || err != nil {
+		t.Errorf("parseRow of a relation message = %v, %v, %v, want nils", buf, msg, err)
+	}
+}
+
+func BenchmarkProcessV2(b *testing.B) {
+	msgs := [][]byte{walRelation(1, "t")}
+	for i := 0; i < 100; i++ {
+		msgs = append(msgs, walInsert(1, i), walUpdate(1, i))
+	}
+
+	p := newParser(Config{})
+	typeMap := pgtype.NewMap()
+	_ = processV2(msgs[0], p, typeMap, "db", "host")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, msg := range msgs[1:] {
+			_ = processV2(msg, p, typeMap, "db", "host")
+		}
+	}
+}
+
+func TestParserSchemaChange(t *testing.T) {
+	p := newParser(Config{})
+	typeMap := pgtype.NewMap()
+	id := RelationColumn{Name: "id", DataType: pgtype.Int4OID, Key: true}
+	email := RelationColumn{Name: "email", DataType: pgtype.TextOID}
+
+	// the first relation message and an unchanged resend aren't changes
+	for i := 0; i < 2; i++ {
+		if events := processV2(walRelationColumns(1, "users", id), p, typeMap, "db", "host"); len(events) != 0 {
+			t.Fatalf("got %d events for an unchanged relation, want 0", len(events))
+		}
+	}
+
+	events := processV2(walRelationColumns(1, "users", id, email), p, typeMap, "db", "host")
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	msg := events[0].Payload.Message
+	if events[0].Payload.Op != "m" || msg == nil || msg.Prefix != SchemaChangePrefix {
+		t.Fatalf("got op %q message %+v, want a schema change", events[0].Payload.Op, msg)
+	}
+	var change SchemaChange
+	if err := json.Unmarshal(msg.Content, &change); err != nil {
+		t.Fatal(err)
+	}
+	if change.Table != "users" || change.Version != 2 || len(change.Before) != 1 || len(change.After) != 2 {
+		t.Errorf("got change %+v", change)
+	}
+
+	stream := &Stream{relations: p.registry}
+	v, ok := stream.Relation("public", "users")
+	if !ok || v.Version != 2 || !slices.Equal(v.Columns, []RelationColumn{id, email}) {
+		t.Errorf("got relation %+v, %v", v, ok)
+	}
+}
+
+// walCommitPrepared encodes a pgoutput Commit Prepared message.
+func walCommitPrepared(lsn int64, xid uint32, gid string) []byte {
+	b := []byte{'K', 0}
+	b = binary.BigEndian.AppendUint64(b, uint64(lsn))
+	b = binary.BigEndian.AppendUint64(b, uint64(lsn+8))
+	b = binary.BigEndian.AppendUint64(b, uint64(time.Hour/time.Microsecond))
+	b = binary.BigEndian.AppendUint32(b, xid)
+	return append(b, gid+"\x00"...)
+}
+
+func TestProcessV2TwoPhase(t *testing.T) {
+	events := processV2(walCommitPrepared(100, 7, "txn-1"), newParser(Config{}), pgtype.NewMap(), "db", "host")
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	msg := events[0].Payload.Message
+	if msg == nil || msg.Prefix != TwoPhasePrefix {
+		t.Fatalf("got message %+v, want a two-phase event", msg)
+	}
+	var txn PreparedTransaction
+	if err := json.Unmarshal(msg.Content, &txn); err != nil {
+		t.Fatal(err)
+	}
+	want := PreparedTransaction{Event: CommitPrepared, GID: "txn-1", Xid: 7, Lsn: 100, EndLsn: 108, Timestamp: time.Date(2000, 1, 1, 1, 0, 0, 0, time.UTC)}
+	if !txn.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("timestamp = %v, want %v", txn.Timestamp, want.Timestamp)
+	}
+	txn.Timestamp = want.Timestamp
+	if txn != want {
+		t.Errorf("got %+v, want %+v", txn, want)
+	}
+	if events[0].Payload.Source.TxId != 7 {
+		t.Errorf("txId = %d, want 7", events[0].Payload.Source.TxId)
+	}
+
+	if _, err := parseTwoPhase(walCommitPrepared(100, 7, "txn-1")[:20]); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
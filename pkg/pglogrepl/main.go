@@ -5,12 +5,14 @@ package pglogrepl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"strings"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
@@ -27,27 +29,41 @@ func init() {
 
 // Main starts the logical replication process and returns a channel of PostgresCDC events.
 // It sets up the necessary publication and replication slot, and begins streaming changes from the WAL.
+// Publication, slot and output plugin are taken from the PGO_LOGREPL_* environment variables.
 func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string) (<-chan CDC, error) {
-	cdcEventsChan := make(chan CDC)
-	dbHost := conn.Conn().RemoteAddr().String()
+	return Start(ctx, conn, Config{
+		PublicationName:       publicationName,
+		SlotName:              slotName,
+		OutputPlugin:          outputPlugin,
+		StandbyMessageTimeout: 10 * time.Second,
+	}, publicationTables...)
+}
 
-	publicationExists, err := checkPublicationExists(conn, publicationName)
+// Start is like Main but takes the replication settings from config instead of the environment.
+// Zero values in config fall back to the same defaults Main uses.
+func Start(ctx context.Context, conn *pgconn.PgConn, config Config, publicationTables ...string) (<-chan CDC, error) {
+	stream, err := Open(ctx, conn, config, publicationTables...)
 	if err != nil {
-		log.Println("checkPublicationExists failed:", err)
 		return nil, err
 	}
-	if !publicationExists {
-		err = createPublication(conn, publicationName)
-		if err != nil {
-			log.Fatalln("createPublication failed:", err)
+	return stream.Events(), nil
+}
+
+// Open is like Start but returns a Stream handle, which exposes the stream's state along with its events.
+func Open(ctx context.Context, conn *pgconn.PgConn, config Config, publicationTables ...string) (*Stream, error) {
+	config = config.withDefaults()
+	publicationName, slotName, outputPlugin := config.publications()[0], config.SlotName, config.OutputPlugin
+
+	cdcEventsChan := make(chan CDC)
+	dbHost := conn.Conn().RemoteAddr().String()
+
+	for _, name := range config.publications() {
+		if err := ensurePublication(conn, name); err != nil {
 			return nil, err
 		}
-		logger.Info("Created publication", zap.String("publicationName", publicationName))
-	} else {
-		logger.Info("Publication", zap.String("publicationName", publicationName), zap.Error(err))
 	}
 
-	// Add tables to the publication as needed
+	// Add tables to the (first) publication as needed
 	// tableNames := strings.Split(os.Getenv("PGO_POSTGRES_LOGREPL_TABLES"), ",")
 	for _, fullTableName := range publicationTables {
 		fullTableName = strings.TrimSpace(fullTableName)
@@ -63,7 +79,7 @@ func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string)
 			schemaName, tableName = "public", fullTableName
 		}
 
-		err = addTableToPublication(conn, publicationName, schemaName, tableName)
+		err := addTableToPublication(conn, publicationName, schemaName, tableName)
 		if err != nil {
 			if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.SQLState() == "42710" {
 				// Table is already a member of the publication
@@ -85,21 +101,16 @@ func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string)
 	var pluginArguments []string
 	var v2 bool
 	if outputPlugin == "pgoutput" {
-		// streaming of large transactions is available since PG 14 (protocol version 2)
-		// we also need to set 'streaming' to 'true'
-		pluginArguments = []string{
-			"proto_version '2'",
-			fmt.Sprintf("publication_names '%s'", publicationName), // use the publicationName variable
-			"messages 'true'",
-			"streaming 'true'",
+		serverVersion, err := serverMajorVersion(conn)
+		if err != nil {
+			logger.Error("failed to detect server version", zap.Error(err))
+			return nil, err
 		}
+		var protoVersion int
+		pluginArguments, protoVersion = pgoutputArgs(config, serverVersion)
+		logger.Info("Negotiated pgoutput options", zap.Int("serverVersion", serverVersion), zap.Int("protoVersion", protoVersion), zap.Strings("args", pluginArguments))
+		// the V2 parser is a superset of V1 and handles all negotiated protocol versions
 		v2 = true
-		// uncomment for v1
-		// pluginArguments = []string{
-		//	"proto_version '1'",
-		//	fmt.Sprintf("publication_names '%s'", publicationName),
-		//	"messages 'true'",
-		// }
 	} else if outputPlugin == "wal2json" {
 		pluginArguments = []string{"\"pretty-print\" 'true'"}
 	}
@@ -136,6 +147,26 @@ func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string)
 		logger.Info("Replication slot already exists", zap.String("slotName", slotName))
 	}
 
+	// parser keeps relations and streaming state across messages (pgoutput only)
+	parser := newParser(config)
+
+	// prepare runs on every new connection before replication starts, while it can still execute queries
+	prepare := func(conn *pgconn.PgConn) error {
+		if !config.MapPartitionsToRoot {
+			return nil
+		}
+		roots, err := loadPartitionRoots(conn)
+		if err != nil {
+			return err
+		}
+		parser.partitionRoots = roots
+		return nil
+	}
+	if err := prepare(conn); err != nil {
+		logger.Error("Preparing replication failed", zap.Error(err))
+		return nil, err
+	}
+
 	err = pglogrepl.StartReplication(context.Background(), conn, slotName, sysident.XLogPos, pglogrepl.StartReplicationOptions{PluginArgs: pluginArguments})
 	if err != nil {
 		log.Fatalln("StartReplication failed:", err)
@@ -144,45 +175,99 @@ func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string)
 	logger.Info("Logical replication started on slot", zap.String("slotName", slotName))
 
 	clientXLogPos := sysident.XLogPos
-	standbyMessageTimeout := time.Second * 10
+	standbyMessageTimeout := config.StandbyMessageTimeout
 	nextStandbyMessageDeadline := time.Now().Add(standbyMessageTimeout)
 	relations := map[uint32]*pglogrepl.RelationMessage{}
-	relationsV2 := map[uint32]*pglogrepl.RelationMessageV2{}
 	typeMap := pgtype.NewMap()
 
-	// whenever we get StreamStartMessage we set inStream to true and then pass it to DecodeV2 function
-	// on StreamStopMessage we set it back to false
-	inStream := false
+	// with more than one decode worker, tuple decoding happens off the receive loop
+	var dec *decoder
+	if v2 && config.DecodeWorkers > 1 {
+		dec = newDecoder(config.DecodeWorkers, parser, cdcEventsChan, sysident.DBName, dbHost)
+	}
+
+	// resume replaces conn with a new replication connection after a connection failure,
+	// resuming from the last position reported to the server. It reports whether streaming can continue.
+	resume := func(err error) bool {
+		if !isConnectionError(conn, err) {
+			return false
+		}
+		if config.ConnString == "" {
+			logger.Error("Connection lost and Config.ConnString is unset, cannot reconnect", zap.Error(err))
+			return false
+		}
+		logger.Warn("Connection lost, attempting to reconnect", zap.String("startLSN", clientXLogPos.String()))
+		newConn, err := reconnect(ctx, config, pluginArguments, clientXLogPos, prepare)
+		if err != nil {
+			logger.Error("Failed to reconnect", zap.Error(err))
+			return false
+		}
+		conn.Close(context.Background())
+		conn = newConn
+
+		// the new session resends relation messages before first use and starts outside a streamed transaction
+		parser.inStream = false
+		nextStandbyMessageDeadline = time.Now().Add(standbyMessageTimeout)
+		return true
+	}
+
+	// the watchdog sends to cdcEventsChan too, so it must be stopped before the channel is closed
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	var watchDone chan struct{}
+	if config.WALRetention.MaxBytes > 0 {
+		if config.ConnString == "" {
+			logger.Warn("WAL retention watchdog requires Config.ConnString, not starting it")
+		} else {
+			watchDone = make(chan struct{})
+			go func() {
+				defer close(watchDone)
+				watchRetention(watchCtx, config, sysident.DBName, func(event CDC) {
+					select {
+					case cdcEventsChan <- event:
+					case <-watchCtx.Done():
+					}
+				})
+			}()
+		}
+	}
 
 	go func() {
 		defer close(cdcEventsChan)
+		defer func() {
+			stopWatch()
+			if watchDone != nil {
+				<-watchDone
+			}
+		}()
+		if dec != nil {
+			defer dec.close()
+		}
 		for {
 			if time.Now().After(nextStandbyMessageDeadline) {
 				err = pglogrepl.SendStandbyStatusUpdate(context.Background(), conn, pglogrepl.StandbyStatusUpdate{WALWritePosition: clientXLogPos})
 				if err != nil {
-					log.Fatalln("SendStandbyStatusUpdate failed:", err)
+					logger.Error("SendStandbyStatusUpdate failed", zap.Error(err))
+					if !resume(err) {
+						return
+					}
+					continue
 				}
 				// log.Printf("Sent Standby status message at %s\n", clientXLogPos.String())
 				nextStandbyMessageDeadline = time.Now().Add(standbyMessageTimeout)
 			}
 
-			ctx, cancel := context.WithDeadline(context.Background(), nextStandbyMessageDeadline)
-			rawMsg, err := conn.ReceiveMessage(ctx)
+			recvCtx, cancel := context.WithDeadline(context.Background(), nextStandbyMessageDeadline)
+			rawMsg, err := conn.ReceiveMessage(recvCtx)
 			cancel()
 			if err != nil {
 				if pgconn.Timeout(err) {
 					continue
 				}
 				logger.Error("ReceiveMessage failed", zap.Error(err))
-				if err == io.EOF || err == io.ErrUnexpectedEOF {
-					logger.Warn("Connection closed, attempting to reconnect")
-					if err := reconnect(ctx, conn); err != nil {
-						logger.Error("Failed to reconnect", zap.Error(err))
-						return
-					}
-					continue
+				if !resume(err) {
+					return
 				}
-				return
+				continue
 			}
 
 			if errMsg, ok := rawMsg.(*pgproto3.ErrorResponse); ok {
@@ -219,8 +304,10 @@ func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string)
 					log.Printf("wal2json data: %s\n", string(xld.WALData))
 				} else {
 					// log.Printf("XLogData => WALStart %s ServerWALEnd %s ServerTime %s WALData:\n", xld.WALStart, xld.ServerWALEnd, xld.ServerTime)
-					if v2 {
-						events := processV2(xld.WALData, relationsV2, typeMap, &inStream, sysident.DBName, dbHost)
+					if dec != nil {
+						dec.dispatch(xld.WALData)
+					} else if v2 {
+						events := processV2(xld.WALData, parser, typeMap, sysident.DBName, dbHost)
 						for _, event := range events {
 							cdcEventsChan <- event
 						}
@@ -243,24 +330,64 @@ func Main(ctx context.Context, conn *pgconn.PgConn, publicationTables ...string)
 		}
 	}()
 
-	return cdcEventsChan, nil
+	return &Stream{events: cdcEventsChan, relations: parser.registry}, nil
+}
+
+// isConnectionError reports whether err means the replication connection is gone and needs to be re-dialed.
+func isConnectionError(conn *pgconn.PgConn, err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || conn.IsClosed()
 }
 
-// reconnect attempts to re-establish a connection to the PostgreSQL server.
-// It will try to reconnect up to maxRetries times, with an increasing delay between attempts.
+// reconnect dials config.ConnString again and restarts replication at startLSN.
+// Multi-host connection strings (e.g. with target_session_attrs=read-write) let this land on a promoted standby.
+// If the slot no longer exists, which is the case after failing over to a standby without synchronized slots,
+// it is recreated when config.RecreateSlot is set; otherwise reconnecting fails.
 //
-// If successful, it returns nil. If all attempts fail, it returns an error.
-func reconnect(ctx context.Context, conn *pgconn.PgConn) error {
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		logger.Info("Attempting to reconnect", zap.Int("attempt", i+1))
-		err := conn.Ping(ctx)
-		if err == nil {
-			logger.Info("Reconnection successful")
-			return nil
+// prepare is called on the new connection right before replication is restarted.
+//
+// It retries with exponential backoff until it succeeds, a permanent error occurs, or ctx is done.
+func reconnect(ctx context.Context, config Config, pluginArguments []string, startLSN pglogrepl.LSN, prepare func(*pgconn.PgConn) error) (*pgconn.PgConn, error) {
+	attempt := 0
+	operation := func() (*pgconn.PgConn, error) {
+		attempt++
+		logger.Info("Attempting to reconnect", zap.Int("attempt", attempt))
+
+		conn, err := pgconn.Connect(ctx, config.ConnString)
+		if err != nil {
+			logger.Warn("Reconnection failed", zap.Error(err))
+			return nil, err
 		}
-		logger.Warn("Reconnection failed", zap.Error(err))
-		time.Sleep(time.Second * time.Duration(i+1))
+
+		slotExists, err := checkSlotExists(conn, config.SlotName)
+		if err != nil {
+			conn.Close(context.Background())
+			return nil, err
+		}
+		if !slotExists {
+			if !config.RecreateSlot {
+				conn.Close(context.Background())
+				return nil, backoff.Permanent(fmt.Errorf("replication slot %s no longer exists", config.SlotName))
+			}
+			if err := createReplicationSlot(conn, config.SlotName, config.OutputPlugin); err != nil {
+				conn.Close(context.Background())
+				return nil, err
+			}
+			logger.Warn("Recreated replication slot, changes made before its creation are not replayed", zap.String("slotName", config.SlotName))
+		}
+
+		if err := prepare(conn); err != nil {
+			conn.Close(context.Background())
+			return nil, err
+		}
+
+		err = pglogrepl.StartReplication(ctx, conn, config.SlotName, startLSN, pglogrepl.StartReplicationOptions{PluginArgs: pluginArguments})
+		if err != nil {
+			conn.Close(context.Background())
+			return nil, err
+		}
+		logger.Info("Reconnection successful", zap.String("host", conn.Conn().RemoteAddr().String()), zap.String("startLSN", startLSN.String()))
+		return conn, nil
 	}
-	return fmt.Errorf("failed to reconnect after %d attempts", maxRetries)
+
+	return backoff.RetryWithData(operation, backoff.WithContext(backoff.NewExponentialBackOff(), ctx))
 }
@@ -0,0 +1,109 @@
+package pglogrepl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// StartAll streams several databases from a single process. It dials a replication connection
+// for each config's ConnString, starts replication on it as Start does, and multiplexes the events
+// into one channel. Events identify their database by Payload.Source.Db and their server by Payload.Source.Name.
+//
+// Replication slot names are unique per server, so configs without a SlotName get the default slot name suffixed
+// with their database name, e.g. pgo_logrepl_orders; configs ending up with the same slot name on the same server
+// are rejected.
+// If any database fails to start, the ones already started are stopped and the error is returned.
+// The returned channel is closed once every stream has ended.
+func StartAll(ctx context.Context, configs []Config, publicationTables ...string) (<-chan CDC, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no databases configured")
+	}
+
+	// canceling streamCtx stops the reconnect loops of streams started before a failure
+	streamCtx, cancel := context.WithCancel(ctx)
+	var conns []*pgconn.PgConn
+	var streams []<-chan CDC
+	fail := func(err error) (<-chan CDC, error) {
+		cancel()
+		for _, conn := range conns {
+			conn.Close(context.Background())
+		}
+		return nil, err
+	}
+
+	configs = slices.Clone(configs)
+	slots := make(map[string]int) // by server and slot name
+	for i, config := range configs {
+		if config.ConnString == "" {
+			return fail(fmt.Errorf("database %d: missing connection string", i))
+		}
+		connConfig, err := pgconn.ParseConfig(config.ConnString)
+		if err != nil {
+			return fail(fmt.Errorf("database %d: invalid connection string: %w", i, err))
+		}
+		if config.SlotName == "" {
+			configs[i].SlotName = databaseSlotName(slotName, connConfig.Database)
+		}
+		slot := fmt.Sprintf("%s:%d/%s", connConfig.Host, connConfig.Port, configs[i].SlotName)
+		if other, ok := slots[slot]; ok {
+			return fail(fmt.Errorf("database %d: slot name %s is also used by database %d on the same server", i, configs[i].SlotName, other))
+		}
+		slots[slot] = i
+	}
+
+	for i, config := range configs {
+		conn, err := pgconn.Connect(streamCtx, config.ConnString)
+		if err != nil {
+			return fail(fmt.Errorf("database %d: failed to connect: %w", i, err))
+		}
+		conns = append(conns, conn)
+
+		events, err := Start(streamCtx, conn, config, publicationTables...)
+		if err != nil {
+			return fail(fmt.Errorf("database %d: failed to start replication: %w", i, err))
+		}
+		streams = append(streams, events)
+		logger.Info("Started replication for database", zap.Int("index", i), zap.String("host", conn.Conn().RemoteAddr().String()))
+	}
+
+	out := make(chan CDC)
+	var wg sync.WaitGroup
+	for _, events := range streams {
+		wg.Add(1)
+		go func(events <-chan CDC) {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(events)
+	}
+	go func() {
+		wg.Wait()
+		cancel()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// databaseSlotName returns the slot name prefix suffixed with the database name dbName, replacing characters
+// slot names can't have with underscores and truncating it to the 63 bytes of an identifier.
+func databaseSlotName(prefix, dbName string) string {
+	name := []byte(prefix + "_" + strings.ToLower(dbName))
+	for i, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			name[i] = '_'
+		}
+	}
+	return string(name[:min(len(name), 63)])
+}
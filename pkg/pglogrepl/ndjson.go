@@ -0,0 +1,35 @@
+package pglogrepl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// WriteTo streams CDC events as newline-delimited JSON (one event per line) to w, e.g. os.Stdout,
+// so changes can be piped into jq, files or other processes. It blocks until ctx is done, the stream ends,
+// or writing fails. A canceled ctx is not reported as an error.
+func WriteTo(ctx context.Context, conn *pgconn.PgConn, config Config, w io.Writer, publicationTables ...string) error {
+	events, err := Start(ctx, conn, config, publicationTables...)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := enc.Encode(event); err != nil {
+				return fmt.Errorf("failed to write event: %w", err)
+			}
+		}
+	}
+}
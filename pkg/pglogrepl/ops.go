@@ -0,0 +1,77 @@
+package pglogrepl
+
+import (
+	"strings"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// opCodes maps operation names accepted in Config.Ops and Config.TableOps to CDC op codes.
+var opCodes = map[string]string{
+	"insert": "c", "c": "c",
+	"update": "u", "u": "u",
+	"delete": "d", "d": "d",
+	"truncate": "t", "t": "t",
+}
+
+// opFilter decides which row operations are emitted, globally and per table.
+// A nil set allows every operation.
+type opFilter struct {
+	global map[string]bool
+	tables map[string]map[string]bool
+}
+
+func newOpFilter(ops []string, tableOps map[string][]string) opFilter {
+	f := opFilter{global: opSet(ops)}
+	if len(tableOps) > 0 {
+		f.tables = make(map[string]map[string]bool, len(tableOps))
+		for table, ops := range tableOps {
+			f.tables[table] = opSet(ops)
+		}
+	}
+	return f
+}
+
+// opSet returns the set of op codes for ops, or nil if ops is empty. Unknown names are ignored.
+func opSet(ops []string) map[string]bool {
+	if len(ops) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		if code, ok := opCodes[strings.ToLower(strings.TrimSpace(op))]; ok {
+			set[code] = true
+		}
+	}
+	return set
+}
+
+// allows reports whether op on schema.table should be emitted. Table-specific filters take precedence
+// over the global one; an empty op (e.g. logical decoding messages) is always allowed.
+func (f opFilter) allows(schema, table, op string) bool {
+	if op == "" {
+		return true
+	}
+	set := f.global
+	if s, ok := f.tables[schema+"."+table]; ok {
+		set = s
+	} else if s, ok := f.tables[table]; ok {
+		set = s
+	}
+	return set == nil || set[op]
+}
+
+// opOf returns the CDC op code of a row-level message, or "" for other messages.
+func opOf(msg pglogrepl.Message) string {
+	switch msg.(type) {
+	case *pglogrepl.InsertMessageV2:
+		return "c"
+	case *pglogrepl.UpdateMessageV2:
+		return "u"
+	case *pglogrepl.DeleteMessageV2:
+		return "d"
+	case *pglogrepl.TruncateMessageV2:
+		return "t"
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package pglogrepl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// relationName is a schema-qualified table name.
+type relationName struct {
+	schema string
+	table  string
+}
+
+// loadPartitionRoots returns the root partitioned table of every partition in the database, keyed by partition OID.
+// Partitions created after loading are not mapped until the next (re)connect.
+func loadPartitionRoots(conn *pgconn.PgConn) (map[uint32]relationName, error) {
+	query := `SELECT c.oid, rn.nspname, rc.relname
+FROM pg_class c
+JOIN pg_class rc ON rc.oid = pg_partition_root(c.oid)
+JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+WHERE c.relispartition;`
+	results, err := conn.Exec(context.Background(), query).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load partition roots: %w", err)
+	}
+
+	roots := map[uint32]relationName{}
+	for _, result := range results {
+		for _, row := range result.Rows {
+			oid, err := strconv.ParseUint(string(row[0]), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse partition oid %q: %w", row[0], err)
+			}
+			roots[uint32(oid)] = relationName{schema: string(row[1]), table: string(row[2])}
+		}
+	}
+	return roots, nil
+}
@@ -6,20 +6,34 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 )
 
 // Config holds the configuration for the replication process.
 type Config struct {
-	// ConnString is the PostgreSQL connection string.
+	// ConnString is the PostgreSQL connection string. Start uses it to re-dial and resume
+	// replication when the connection is lost; without it, a lost connection ends the stream.
 	ConnString string
 
+	// RecreateSlot recreates the replication slot when reconnecting finds it missing,
+	// e.g. after failing over to a standby the slot wasn't synchronized to.
+	RecreateSlot bool
+
 	// PublicationName is the name of the publication to be used or created.
 	PublicationName string
 
+	// Publications lists several publications to consume on the same slot. When set, it takes
+	// precedence over PublicationName; each publication is created if it doesn't exist, and
+	// tables passed to Start are added to the first one.
+	Publications []string
+
 	// SlotName is the name of the replication slot to be used or created.
 	SlotName string
 
@@ -28,6 +42,52 @@ type Config struct {
 
 	// StandbyMessageTimeout is the duration between standby status messages.
 	StandbyMessageTimeout time.Duration
+
+	// DecodeWorkers is the number of goroutines decoding tuple data (pgoutput only).
+	// Events of the same table are always decoded by the same worker, so per-table order is preserved.
+	// Values <= 1 decode on the receiving goroutine.
+	DecodeWorkers int
+
+	// ProtoVersion is the pgoutput protocol version (1-4). 0 selects the highest version the server supports;
+	// a version the server doesn't support falls back to the highest one it does.
+	ProtoVersion int
+
+	// Streaming controls streaming of large in-progress transactions: "on", "parallel" or "off".
+	// Empty means "on" when the negotiated protocol supports it. "parallel" requires protocol 4 (PostgreSQL 16+)
+	// and falls back to "on" otherwise.
+	Streaming string
+
+	// Binary requests tuple data in binary format instead of text (PostgreSQL 14+).
+	Binary bool
+
+	// TwoPhase decodes prepared transactions at PREPARE TRANSACTION rather than at COMMIT PREPARED,
+	// and reports their two-phase commit steps as TwoPhasePrefix message events (PostgreSQL 15+).
+	TwoPhase bool
+
+	// MapPartitionsToRoot reports changes to partitions under the name of their root partitioned table,
+	// giving sinks a stable table identity when the publication isn't created with publish_via_partition_root.
+	// Partitions are looked up from pg_inherits when replication starts or reconnects.
+	MapPartitionsToRoot bool
+
+	// Ops limits the row operations emitted for all tables: "insert", "update", "delete" and "truncate"
+	// (or their event codes c, u, d, t). Empty means all operations.
+	Ops []string
+
+	// TableOps overrides Ops for individual tables, keyed by "schema.table" or "table",
+	// e.g. {"orders": {"insert", "update"}, "audit_log": {"insert"}}.
+	TableOps map[string][]string
+
+	// WALRetention enables a watchdog for the WAL retained by the slot. It requires ConnString.
+	WALRetention WALRetention
+}
+
+// withDefaults returns a copy of c with zero values replaced by the package defaults.
+func (c Config) withDefaults() Config {
+	c.PublicationName = cmp.Or(c.PublicationName, publicationName)
+	c.SlotName = cmp.Or(c.SlotName, slotName)
+	c.OutputPlugin = cmp.Or(c.OutputPlugin, outputPlugin)
+	c.StandbyMessageTimeout = cmp.Or(c.StandbyMessageTimeout, 10*time.Second)
+	return c
 }
 
 // replication config
@@ -46,20 +106,11 @@ func SetupReplication(config Config) (*pgconn.PgConn, pglogrepl.IdentifySystemRe
 		return nil, pglogrepl.IdentifySystemResult{}, err
 	}
 
-	exists, err := checkPublicationExists(conn, config.PublicationName)
-	if err != nil {
-		conn.Close(context.Background())
-		return nil, pglogrepl.IdentifySystemResult{}, err
-	}
-	if !exists {
-		err = createPublication(conn, config.PublicationName)
-		if err != nil {
+	for _, name := range config.publications() {
+		if err := ensurePublication(conn, name); err != nil {
 			conn.Close(context.Background())
 			return nil, pglogrepl.IdentifySystemResult{}, err
 		}
-		log.Println("Created publication", config.PublicationName)
-	} else {
-		log.Println("Publication", config.PublicationName, "already exists")
 	}
 
 	sysident, err := pglogrepl.IdentifySystem(context.Background(), conn)
@@ -138,3 +189,114 @@ func addTableToPublication(conn *pgconn.PgConn, publicationName string, schemaNa
 	_, err := result.ReadAll()
 	return err
 }
+
+// publications returns the publications to consume: Publications if set, otherwise PublicationName.
+func (c Config) publications() []string {
+	if len(c.Publications) > 0 {
+		return c.Publications
+	}
+	return []string{c.PublicationName}
+}
+
+// ensurePublication creates the publication if it doesn't exist yet.
+func ensurePublication(conn *pgconn.PgConn, publicationName string) error {
+	exists, err := checkPublicationExists(conn, publicationName)
+	if err != nil {
+		logger.Error("checkPublicationExists failed", zap.String("publicationName", publicationName), zap.Error(err))
+		return err
+	}
+	if exists {
+		logger.Info("Publication already exists", zap.String("publicationName", publicationName))
+		return nil
+	}
+	if err := createPublication(conn, publicationName); err != nil {
+		return err
+	}
+	logger.Info("Created publication", zap.String("publicationName", publicationName))
+	return nil
+}
+
+// pgoutputArgs negotiates the pgoutput plugin arguments for config against the server major version.
+// It returns the arguments along with the protocol version in use.
+func pgoutputArgs(config Config, serverVersion int) ([]string, int) {
+	maxProto := 1
+	switch {
+	case serverVersion >= 16:
+		maxProto = 4 // parallel streaming
+	case serverVersion == 15:
+		maxProto = 3 // two-phase commit
+	case serverVersion == 14:
+		maxProto = 2 // streaming of in-progress transactions
+	}
+
+	proto := config.ProtoVersion
+	if proto <= 0 || proto > maxProto {
+		if proto > maxProto {
+			logger.Warn("pgoutput protocol version not supported by server, falling back",
+				zap.Int("requested", proto), zap.Int("using", maxProto), zap.Int("serverVersion", serverVersion))
+		}
+		proto = maxProto
+	}
+
+	streaming := strings.ToLower(config.Streaming)
+	switch {
+	case proto < 2:
+		streaming = "off"
+	case streaming == "":
+		streaming = "on"
+	case streaming == "parallel" && proto < 4:
+		logger.Warn("parallel streaming requires pgoutput protocol 4, falling back to on", zap.Int("protoVersion", proto))
+		streaming = "on"
+	}
+
+	args := []string{
+		fmt.Sprintf("proto_version '%d'", proto),
+		fmt.Sprintf("publication_names '%s'", strings.Join(config.publications(), ",")),
+	}
+	if serverVersion >= 14 {
+		// logical decoding messages, sent with pg_logical_emit_message
+		args = append(args, "messages 'true'")
+	}
+	if streaming != "off" {
+		args = append(args, fmt.Sprintf("streaming '%s'", streaming))
+	}
+	if config.TwoPhase {
+		if proto >= 3 {
+			args = append(args, "two_phase 'on'")
+		} else {
+			logger.Warn("two-phase commit requires pgoutput protocol 3, ignoring", zap.Int("protoVersion", proto))
+		}
+	}
+	if config.Binary {
+		if serverVersion >= 14 {
+			args = append(args, "binary 'true'")
+		} else {
+			logger.Warn("binary format requires PostgreSQL 14+, using text format", zap.Int("serverVersion", serverVersion))
+		}
+	}
+	return args, proto
+}
+
+// serverMajorVersion returns the major version of the server conn is connected to.
+func serverMajorVersion(conn *pgconn.PgConn) (int, error) {
+	version := conn.ParameterStatus("server_version")
+	major, _, _ := strings.Cut(version, ".")
+	major, _, _ = strings.Cut(major, " ") // e.g. "17beta1 (Debian ...)" or "16 (Ubuntu ...)"
+	major = strings.TrimRightFunc(major, func(r rune) bool { return r < '0' || r > '9' })
+	v, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse server version %q: %w", version, err)
+	}
+	return v, nil
+}
+
+// queryConnConfig parses connString, which may be a replication connection string, into the config of
+// a regular connection for running queries alongside the replication connection.
+func queryConnConfig(connString string) (*pgx.ConnConfig, error) {
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %w", err)
+	}
+	delete(config.RuntimeParams, "replication")
+	return config, nil
+}
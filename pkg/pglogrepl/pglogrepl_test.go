@@ -0,0 +1,112 @@
+package pglogrepl
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPgoutputArgs(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		serverVersion int
+		wantProto     int
+		wantArgs      []string
+	}{
+		{
+			name:          "auto on PG16",
+			config:        Config{PublicationName: "pub"},
+			serverVersion: 16,
+			wantProto:     4,
+			wantArgs:      []string{"proto_version '4'", "publication_names 'pub'", "messages 'true'", "streaming 'on'"},
+		},
+		{
+			name:          "parallel falls back on PG15",
+			config:        Config{PublicationName: "pub", Streaming: "parallel"},
+			serverVersion: 15,
+			wantProto:     3,
+			wantArgs:      []string{"proto_version '3'", "publication_names 'pub'", "messages 'true'", "streaming 'on'"},
+		},
+		{
+			name:          "requested version too high",
+			config:        Config{PublicationName: "pub", ProtoVersion: 4, Binary: true},
+			serverVersion: 14,
+			wantProto:     2,
+			wantArgs:      []string{"proto_version '2'", "publication_names 'pub'", "messages 'true'", "streaming 'on'", "binary 'true'"},
+		},
+		{
+			name:          "no streaming or binary before PG14",
+			config:        Config{PublicationName: "pub", Streaming: "on", Binary: true},
+			serverVersion: 13,
+			wantProto:     1,
+			wantArgs:      []string{"proto_version '1'", "publication_names 'pub'"},
+		},
+		{
+			name:          "multiple publications",
+			config:        Config{PublicationName: "ignored", Publications: []string{"orders_pub", "users_pub"}, ProtoVersion: 1},
+			serverVersion: 16,
+			wantProto:     1,
+			wantArgs:      []string{"proto_version '1'", "publication_names 'orders_pub,users_pub'", "messages 'true'"},
+		},
+		{
+			name:          "two-phase on PG15",
+			config:        Config{PublicationName: "pub", TwoPhase: true},
+			serverVersion: 15,
+			wantProto:     3,
+			wantArgs:      []string{"proto_version '3'", "publication_names 'pub'", "messages 'true'", "streaming 'on'", "two_phase 'on'"},
+		},
+		{
+			name:          "no two-phase before protocol 3",
+			config:        Config{PublicationName: "pub", TwoPhase: true},
+			serverVersion: 14,
+			wantProto:     2,
+			wantArgs:      []string{"proto_version '2'", "publication_names 'pub'", "messages 'true'", "streaming 'on'"},
+		},
+		{
+			name:          "streaming off",
+			config:        Config{PublicationName: "pub", ProtoVersion: 2, Streaming: "off"},
+			serverVersion: 17,
+			wantProto:     2,
+			wantArgs:      []string{"proto_version '2'", "publication_names 'pub'", "messages 'true'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, proto := pgoutputArgs(tt.config, tt.serverVersion)
+			if proto != tt.wantProto {
+				t.Errorf("proto = %d, want %d", proto, tt.wantProto)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestStartAllRequiresConnString(t *testing.T) {
+	if _, err := StartAll(context.Background(), nil); err == nil {
+		t.Error("expected an error for no databases")
+	}
+	if _, err := StartAll(context.Background(), []Config{{SlotName: "a"}}); err == nil {
+		t.Error("expected an error for a config without ConnString")
+	}
+	sameDB := []Config{{ConnString: "postgres://localhost:1/orders"}, {ConnString: "postgres://localhost:1/orders?application_name=b"}}
+	if _, err := StartAll(context.Background(), sameDB); err == nil || !strings.Contains(err.Error(), "slot name") {
+		t.Errorf("expected an error for databases sharing a slot name, got %v", err)
+	}
+}
+
+func TestDatabaseSlotName(t *testing.T) {
+	for dbName, want := range map[string]string{
+		"orders":                "pgo_logrepl_orders",
+		"Sales-EU.2024":         "pgo_logrepl_sales_eu_2024",
+		strings.Repeat("x", 80): "pgo_logrepl_" + strings.Repeat("x", 51),
+	} {
+		if got := databaseSlotName("pgo_logrepl", dbName); got != want {
+			t.Errorf("databaseSlotName(%q) = %q, want %q", dbName, got, want)
+		}
+	}
+}
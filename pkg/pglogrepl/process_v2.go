@@ -1,22 +1,100 @@
 package pglogrepl
 
 import (
-	"time"
-
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v5/pgtype"
 	"go.uber.org/zap"
 )
 
-func processV2(walData []byte, relations map[uint32]*pglogrepl.RelationMessageV2, typeMap *pgtype.Map, inStream *bool, dbName, dbHost string) []CDC {
+// parser holds the state carried across the messages of a pgoutput stream.
+type parser struct {
+	relations      map[uint32]*pglogrepl.RelationMessageV2
+	partitionRoots map[uint32]relationName // nil unless Config.MapPartitionsToRoot is set
+	ops            opFilter
+	registry       *relationRegistry
+
+	// whenever we get StreamStartMessage we set inStream to true and then pass it to ParseV2 function
+	// on StreamStopMessage we set it back to false
+	inStream bool
+}
+
+func newParser(config Config) *parser {
+	return &parser{
+		relations: map[uint32]*pglogrepl.RelationMessageV2{},
+		ops:       newOpFilter(config.Ops, config.TableOps),
+		registry:  newRelationRegistry(),
+	}
+}
+
+func processV2(walData []byte, p *parser, typeMap *pgtype.Map, dbName, dbHost string) []CDC {
+	msg, rel, buf := p.parse(walData)
+	defer buf.release()
+	if msg == nil {
+		return nil
+	}
+	if rel == nil && !isRelationless(msg) {
+		zap.L().Error("unknown relation for message", zap.String("type", msg.Type().String()))
+		return nil
+	}
+	return []CDC{decodeV2(msg, rel, typeMap, dbHost, dbName)}
+}
+
+// parse parses walData and updates the relation and streaming state. For messages that become events
+// (insert, update, delete, truncate, logical decoding and two-phase commit messages) it returns the message along with
+// the relation it refers to, which is all decodeV2 needs; other messages are handled in place and yield a nil message.
+// A relation message that changes a known table's columns yields a schemaChangeMessage.
+// Relations found in partitionRoots are renamed to their root table, and row operations rejected by
+// the op filter are dropped here, before any tuple data is decoded.
+// Insert, update and delete messages are parsed into a pooled rowBuffer, returned along with them, which the
+// caller releases once the message is decoded; the buffer is nil for other messages.
+func (p *parser) parse(walData []byte) (pglogrepl.Message, *pglogrepl.RelationMessageV2, *rowBuffer) {
+	msg, rel, buf := p.parseMessage(walData)
+	if rel != nil && !p.ops.allows(rel.Namespace, rel.RelationName, opOf(msg)) {
+		buf.release()
+		return nil, nil, nil
+	}
+	return msg, rel, buf
+}
+
+func (p *parser) parseMessage(walData []byte) (pglogrepl.Message, *pglogrepl.RelationMessageV2, *rowBuffer) {
+	relations, partitionRoots, inStream := p.relations, p.partitionRoots, &p.inStream
+	if isTwoPhase(walData) {
+		msg, err := parseTwoPhase(walData)
+		if err != nil {
+			zap.L().Error("failed to parse two-phase commit message", zap.Error(err))
+			return nil, nil, nil
+		}
+		return msg, nil, nil
+	}
+	buf, rowMsg, err := parseRow(walData, *inStream)
+	if err != nil {
+		zap.L().Fatal("ParseV2 failed", zap.Error(err))
+	}
+	if buf != nil {
+		var relationID uint32
+		switch rowMsg := rowMsg.(type) {
+		case *pglogrepl.InsertMessageV2:
+			relationID = rowMsg.RelationID
+		case *pglogrepl.UpdateMessageV2:
+			relationID = rowMsg.RelationID
+		case *pglogrepl.DeleteMessageV2:
+			relationID = rowMsg.RelationID
+		}
+		return rowMsg, relations[relationID], buf
+	}
 	logicalMsg, err := pglogrepl.ParseV2(walData, *inStream)
 	if err != nil {
 		zap.L().Fatal("ParseV2 failed", zap.Error(err))
 	}
-	var cdcEvents []CDC
 	switch logicalMsg := logicalMsg.(type) {
 	case *pglogrepl.RelationMessageV2:
+		if root, ok := partitionRoots[logicalMsg.RelationID]; ok {
+			logicalMsg.Namespace, logicalMsg.RelationName = root.schema, root.table
+		}
 		relations[logicalMsg.RelationID] = logicalMsg
+		if change := p.registry.update(logicalMsg); change != nil {
+			return &schemaChangeMessage{change: change}, logicalMsg, nil
+		}
 		// zap.L().Info("Relation message received", zap.Uint32("relationID", logicalMsg.RelationID))
 
 	case *pglogrepl.BeginMessage:
@@ -25,32 +103,18 @@ func processV2(walData []byte, relations map[uint32]*pglogrepl.RelationMessageV2
 	case *pglogrepl.CommitMessage:
 		// zap.L().Info("Commit message", zap.Uint32("xid", uint32(logicalMsg.TransactionEndLSN)))
 
-	case *pglogrepl.InsertMessageV2:
-		cdcEvent := handleInsertMessageV2(logicalMsg, relations, typeMap, dbHost, dbName, int64(logicalMsg.Xid))
-		cdcEvents = append(cdcEvents, cdcEvent)
-		// Remove the logging from here
-
-	case *pglogrepl.UpdateMessageV2:
-		cdcEvent := handleUpdateMessageV2(logicalMsg, relations, typeMap, dbHost, dbName, int64(logicalMsg.Xid))
-		cdcEvents = append(cdcEvents, cdcEvent)
-		// Remove the logging from here
-
-	case *pglogrepl.DeleteMessageV2:
-		cdcEvent := handleDeleteMessageV2(logicalMsg, relations, typeMap, dbHost, dbName, int64(logicalMsg.Xid))
-		cdcEvents = append(cdcEvents, cdcEvent)
-		// Remove the logging from here
-
 	case *pglogrepl.TruncateMessageV2:
-		cdcEvent := handleTruncateMessageV2(logicalMsg, relations, dbHost, dbName, int64(logicalMsg.Xid))
-		cdcEvents = append(cdcEvents, cdcEvent)
-		// Remove the logging from here
+		if len(logicalMsg.RelationIDs) > 0 {
+			return logicalMsg, relations[logicalMsg.RelationIDs[0]], nil
+		}
+		return logicalMsg, nil, nil
 
 	case *pglogrepl.TypeMessageV2:
 		zap.L().Info("Type message received")
 	case *pglogrepl.OriginMessage:
 		zap.L().Info("Origin message received")
 	case *pglogrepl.LogicalDecodingMessageV2:
-		zap.L().Info("Logical decoding message", zap.String("prefix", logicalMsg.Prefix), zap.String("content", string(logicalMsg.Content)))
+		return logicalMsg, nil, nil
 	case *pglogrepl.StreamStartMessageV2:
 		*inStream = true
 		zap.L().Info("Stream start message", zap.Uint32("xid", logicalMsg.Xid))
@@ -65,154 +129,116 @@ func processV2(walData []byte, relations map[uint32]*pglogrepl.RelationMessageV2
 		zap.L().Warn("Unknown message type in pgoutput stream", zap.Any("message", logicalMsg))
 	}
 
-	return cdcEvents
+	return nil, nil, nil
 }
 
-func handleInsertMessageV2(msg *pglogrepl.InsertMessageV2, relations map[uint32]*pglogrepl.RelationMessageV2, typeMap *pgtype.Map, serverName, dbName string, lsn int64) CDC {
-	rel, ok := relations[msg.RelationID]
-	if !ok {
-		zap.L().Error("unknown relation ID", zap.Uint32("relationID", msg.RelationID))
-		return CDC{}
+// decodeV2 turns a message returned by parser.parse into a CDC event.
+// It only reads rel and typeMap, so it can run concurrently with parsing.
+func decodeV2(msg pglogrepl.Message, rel *pglogrepl.RelationMessageV2, typeMap *pgtype.Map, dbHost, dbName string) CDC {
+	switch msg := msg.(type) {
+	case *pglogrepl.InsertMessageV2:
+		return handleInsertMessageV2(msg, rel, typeMap, dbHost, dbName, int64(msg.Xid))
+	case *pglogrepl.UpdateMessageV2:
+		return handleUpdateMessageV2(msg, rel, typeMap, dbHost, dbName, int64(msg.Xid))
+	case *pglogrepl.DeleteMessageV2:
+		return handleDeleteMessageV2(msg, rel, typeMap, dbHost, dbName, int64(msg.Xid))
+	case *pglogrepl.TruncateMessageV2:
+		return handleTruncateMessageV2(msg, rel, dbHost, dbName, int64(msg.Xid))
+	case *pglogrepl.LogicalDecodingMessageV2:
+		return handleLogicalDecodingMessageV2(msg, dbHost, dbName)
+	case *schemaChangeMessage:
+		return handleSchemaChange(msg, rel, dbHost, dbName)
+	case *twoPhaseMessage:
+		return handleTwoPhaseMessage(msg, dbHost, dbName)
 	}
+	return CDC{}
+}
 
-	values := make(map[string]interface{})
-	for idx, col := range msg.Tuple.Columns {
-		colName := rel.Columns[idx].Name
-		values[colName] = decodeColumn(col, typeMap, rel.Columns[idx].DataType)
+// isRelationless reports whether msg becomes an event without referring to a relation.
+func isRelationless(msg pglogrepl.Message) bool {
+	switch msg.(type) {
+	case *pglogrepl.LogicalDecodingMessageV2, *twoPhaseMessage:
+		return true
 	}
+	return false
+}
 
-	event := CDC{
-		Schema: GetDefaultSchema(),
-	}
-	event.Payload.Before = nil
-	event.Payload.After = values
-	event.Payload.Source = createSource(serverName, dbName, msg, rel, lsn)
-	event.Payload.Op = "c"
-	event.Payload.TsMs = time.Now().UnixMilli()
+// spansRelations reports whether msg refers to several relations, i.e. is a truncate of several tables.
+func spansRelations(msg pglogrepl.Message) bool {
+	truncate, ok := msg.(*pglogrepl.TruncateMessageV2)
+	return ok && len(truncate.RelationIDs) > 1
+}
 
+func handleInsertMessageV2(msg *pglogrepl.InsertMessageV2, rel *pglogrepl.RelationMessageV2, typeMap *pgtype.Map, serverName, dbName string, lsn int64) CDC {
+	event := newEvent(serverName, dbName, msg, rel, lsn, "c")
+	event.Payload.After = decodeTuple(msg.Tuple, rel, typeMap)
 	return event
 }
 
-func handleUpdateMessageV2(msg *pglogrepl.UpdateMessageV2, relations map[uint32]*pglogrepl.RelationMessageV2, typeMap *pgtype.Map, serverName, dbName string, lsn int64) CDC {
-	rel, ok := relations[msg.RelationID]
-	if !ok {
-		zap.L().Error("unknown relation ID", zap.Uint32("relationID", msg.RelationID))
-		return CDC{}
+func handleUpdateMessageV2(msg *pglogrepl.UpdateMessageV2, rel *pglogrepl.RelationMessageV2, typeMap *pgtype.Map, serverName, dbName string, lsn int64) CDC {
+	// zap.Any allocates even when the entry is dropped, so skip building debug fields unless they're logged
+	debug := zap.L().Core().Enabled(zap.DebugLevel)
+	if debug {
+		zap.L().Debug("handling update message",
+			zap.Bool("hasOldTuple", msg.OldTuple != nil),
+			zap.Bool("hasNewTuple", msg.NewTuple != nil),
+			zap.String("table", rel.RelationName),
+		)
 	}
 
-	zap.L().Debug("handling update message",
-		zap.Bool("hasOldTuple", msg.OldTuple != nil),
-		zap.Bool("hasNewTuple", msg.NewTuple != nil),
-		zap.String("table", rel.RelationName),
-	)
-
-	var oldValues, newValues map[string]interface{}
-
-	if msg.OldTuple != nil {
-		oldValues = make(map[string]interface{})
-		for idx, col := range msg.OldTuple.Columns {
-			colName := rel.Columns[idx].Name
-			value := decodeColumn(col, typeMap, rel.Columns[idx].DataType)
-			oldValues[colName] = value
-
-			zap.L().Debug("old column value",
-				zap.String("column", colName),
-				zap.Any("value", value),
-			)
-		}
-	} else {
+	oldValues := decodeTuple(msg.OldTuple, rel, typeMap)
+	if msg.OldTuple == nil {
 		zap.L().Warn("OldTuple is nil in update message",
 			zap.String("table", rel.RelationName),
 		)
 	}
+	newValues := decodeTuple(msg.NewTuple, rel, typeMap)
 
-	if msg.NewTuple != nil {
-		newValues = make(map[string]interface{})
-		for idx, col := range msg.NewTuple.Columns {
-			colName := rel.Columns[idx].Name
-			value := decodeColumn(col, typeMap, rel.Columns[idx].DataType)
-			newValues[colName] = value
-
-			zap.L().Debug("new column value",
-				zap.String("column", colName),
-				zap.Any("value", value),
-			)
-		}
-	}
-
-	event := CDC{
-		Schema: GetDefaultSchema(),
-	}
-
-	// Initialize maps if they're nil
-	if oldValues == nil {
-		oldValues = make(map[string]interface{})
-	}
-	if newValues == nil {
-		newValues = make(map[string]interface{})
-	}
-
+	event := newEvent(serverName, dbName, msg, rel, lsn, "u")
 	event.Payload.Before = oldValues
 	event.Payload.After = newValues
-	event.Payload.Source = createSource(serverName, dbName, msg, rel, lsn)
-	event.Payload.Op = "u"
-	event.Payload.TsMs = time.Now().UnixMilli()
 
-	zap.L().Debug("created CDC event",
-		zap.Any("before", event.Payload.Before),
-		zap.Any("after", event.Payload.After),
-		zap.String("op", event.Payload.Op),
-	)
+	if debug {
+		zap.L().Debug("created CDC event",
+			zap.Any("before", event.Payload.Before),
+			zap.Any("after", event.Payload.After),
+			zap.String("op", event.Payload.Op),
+		)
+	}
 
 	return event
 }
 
-func handleDeleteMessageV2(msg *pglogrepl.DeleteMessageV2, relations map[uint32]*pglogrepl.RelationMessageV2, typeMap *pgtype.Map, serverName, dbName string, lsn int64) CDC {
-	rel, ok := relations[msg.RelationID]
-	if !ok {
-		zap.L().Error("unknown relation ID", zap.Uint32("relationID", msg.RelationID))
-		return CDC{}
-	}
+func handleDeleteMessageV2(msg *pglogrepl.DeleteMessageV2, rel *pglogrepl.RelationMessageV2, typeMap *pgtype.Map, serverName, dbName string, lsn int64) CDC {
+	event := newEvent(serverName, dbName, msg, rel, lsn, "d")
+	event.Payload.Before = decodeTuple(msg.OldTuple, rel, typeMap)
+	return event
+}
 
-	oldValues := make(map[string]interface{})
-	for idx, col := range msg.OldTuple.Columns {
-		colName := rel.Columns[idx].Name
-		oldValues[colName] = decodeColumn(col, typeMap, rel.Columns[idx].DataType)
-	}
+// handleTruncateMessageV2 uses rel, the first truncated relation, for source info.
+func handleTruncateMessageV2(msg *pglogrepl.TruncateMessageV2, rel *pglogrepl.RelationMessageV2, serverName, dbName string, lsn int64) CDC {
+	return newEvent(serverName, dbName, msg, rel, lsn, "t")
+}
 
-	event := CDC{
-		Schema: GetDefaultSchema(),
+func handleLogicalDecodingMessageV2(msg *pglogrepl.LogicalDecodingMessageV2, serverName, dbName string) CDC {
+	event := newEvent(serverName, dbName, msg, nil, int64(msg.LSN), "m")
+	event.Payload.Message = &LogicalMessage{
+		Prefix:        msg.Prefix,
+		Content:       msg.Content,
+		Transactional: msg.Transactional,
 	}
-	event.Payload.Before = oldValues
-	event.Payload.After = nil
-	event.Payload.Source = createSource(serverName, dbName, msg, rel, lsn)
-	event.Payload.Op = "d"
-	event.Payload.TsMs = time.Now().UnixMilli()
-
 	return event
 }
 
-func handleTruncateMessageV2(msg *pglogrepl.TruncateMessageV2, relations map[uint32]*pglogrepl.RelationMessageV2, serverName, dbName string, lsn int64) CDC {
-	// Get the first relation for basic source info
-	var rel *pglogrepl.RelationMessageV2
-	for _, relation := range relations {
-		rel = relation
-		break
-	}
-
-	if rel == nil {
-		zap.L().Error("no relations found for truncate message")
-		return CDC{}
+// decodeTuple decodes the columns of tuple into a map keyed by column name.
+// A nil tuple yields an empty map.
+func decodeTuple(tuple *pglogrepl.TupleData, rel *pglogrepl.RelationMessageV2, typeMap *pgtype.Map) map[string]interface{} {
+	if tuple == nil {
+		return make(map[string]interface{})
 	}
-
-	event := CDC{
-		Schema: GetDefaultSchema(),
+	values := make(map[string]interface{}, len(tuple.Columns))
+	for idx, col := range tuple.Columns {
+		values[rel.Columns[idx].Name] = decodeColumn(col, typeMap, rel.Columns[idx].DataType)
 	}
-	event.Payload.Before = nil
-	event.Payload.After = nil
-	event.Payload.Source = createSource(serverName, dbName, msg, rel, lsn)
-	event.Payload.Op = "t"
-	event.Payload.TsMs = time.Now().UnixMilli()
-
-	return event
+	return values
 }
@@ -0,0 +1,126 @@
+package pglogrepl
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// SchemaChangePrefix is the message prefix of events (op "m") emitted when a table's columns change mid-stream.
+// Their content is a JSON encoded SchemaChange.
+const SchemaChangePrefix = "pgo.schema_change"
+
+// RelationColumn describes a column of a replicated table as announced by the server.
+type RelationColumn struct {
+	Name     string `json:"name"`
+	DataType uint32 `json:"dataType"` // type OID
+	Key      bool   `json:"key"`      // part of the replica identity
+}
+
+// RelationVersion is a table's column set as of a relation message. Version starts at 1 and is
+// incremented each time the columns change.
+type RelationVersion struct {
+	RelationID uint32           `json:"relationId"`
+	Schema     string           `json:"schema"`
+	Table      string           `json:"table"`
+	Version    int              `json:"version"`
+	Columns    []RelationColumn `json:"columns"`
+}
+
+// SchemaChange is the content of a schema-changed event.
+type SchemaChange struct {
+	Schema  string           `json:"schema"`
+	Table   string           `json:"table"`
+	Version int              `json:"version"` // version of After
+	Before  []RelationColumn `json:"before"`
+	After   []RelationColumn `json:"after"`
+}
+
+// relationRegistry tracks the current version of each relation. It is written by the parser
+// and may be read concurrently through Stream.
+type relationRegistry struct {
+	mu       sync.RWMutex
+	versions map[uint32]RelationVersion
+}
+
+func newRelationRegistry() *relationRegistry {
+	return &relationRegistry{versions: map[uint32]RelationVersion{}}
+}
+
+// update records rel. If a known relation's columns differ from the recorded ones, it returns the change.
+// Relation messages the server resends without changes, e.g. after a reconnect, are not changes.
+func (r *relationRegistry) update(rel *pglogrepl.RelationMessageV2) *SchemaChange {
+	columns := make([]RelationColumn, len(rel.Columns))
+	for i, col := range rel.Columns {
+		columns[i] = RelationColumn{Name: col.Name, DataType: col.DataType, Key: col.Flags&1 != 0}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	prev, known := r.versions[rel.RelationID]
+	if known && slices.Equal(prev.Columns, columns) {
+		return nil
+	}
+	next := RelationVersion{
+		RelationID: rel.RelationID,
+		Schema:     rel.Namespace,
+		Table:      rel.RelationName,
+		Version:    prev.Version + 1,
+		Columns:    columns,
+	}
+	r.versions[rel.RelationID] = next
+	if !known {
+		return nil
+	}
+	return &SchemaChange{Schema: next.Schema, Table: next.Table, Version: next.Version, Before: prev.Columns, After: columns}
+}
+
+// lookup returns the current version of schema.table.
+func (r *relationRegistry) lookup(schema, table string) (RelationVersion, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.versions {
+		if v.Schema == schema && v.Table == table {
+			return v, true
+		}
+	}
+	return RelationVersion{}, false
+}
+
+// all returns the current versions of all relations, ordered by schema and table.
+func (r *relationRegistry) all() []RelationVersion {
+	r.mu.RLock()
+	versions := make([]RelationVersion, 0, len(r.versions))
+	for _, v := range r.versions {
+		versions = append(versions, v)
+	}
+	r.mu.RUnlock()
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].Schema != versions[j].Schema {
+			return versions[i].Schema < versions[j].Schema
+		}
+		return versions[i].Table < versions[j].Table
+	})
+	return versions
+}
+
+// schemaChangeMessage carries a SchemaChange from the parser to decodeV2.
+type schemaChangeMessage struct {
+	change *SchemaChange
+}
+
+func (*schemaChangeMessage) Type() pglogrepl.MessageType { return pglogrepl.MessageTypeRelation }
+
+func handleSchemaChange(msg *schemaChangeMessage, rel *pglogrepl.RelationMessageV2, serverName, dbName string) CDC {
+	content, _ := json.Marshal(msg.change)
+
+	event := newEvent(serverName, dbName, nil, rel, 0, "m")
+	event.Payload.Message = &LogicalMessage{
+		Prefix:  SchemaChangePrefix,
+		Content: content,
+	}
+	return event
+}
@@ -0,0 +1,168 @@
+package pglogrepl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// WALRetentionPrefix is the LogicalMessage prefix of events the WAL retention watchdog puts on the stream.
+// Their content is a JSON-encoded RetentionStatus.
+const WALRetentionPrefix = "pgo.wal_retention"
+
+// WALRetention configures a watchdog guarding the primary's disk against WAL retained by the replication slot,
+// e.g. when consumers fall behind or the stream is stalled.
+type WALRetention struct {
+	// MaxBytes is the retained WAL threshold. The watchdog is disabled when it's 0.
+	MaxBytes int64
+
+	// Interval between checks. Defaults to one minute.
+	Interval time.Duration
+
+	// DropSlot terminates the stream's walsender and drops the slot once MaxBytes is exceeded.
+	// Changes not yet consumed are lost; with Config.RecreateSlot set, streaming resumes on a new slot.
+	DropSlot bool
+
+	// OnExceeded, if set, is called whenever a check finds MaxBytes exceeded, e.g. to throttle writers.
+	OnExceeded func(RetentionStatus)
+}
+
+// RetentionStatus describes the WAL retained by a replication slot.
+type RetentionStatus struct {
+	Slot          string `json:"slot"`
+	RetainedBytes int64  `json:"retainedBytes"`
+	MaxBytes      int64  `json:"maxBytes"`
+	Exceeded      bool   `json:"exceeded"`
+	SlotDropped   bool   `json:"slotDropped"`
+}
+
+// watchRetention checks the slot's retained WAL every interval until ctx is done. It emits an event when the
+// threshold is crossed in either direction, and when it drops the slot.
+// It needs a regular (non-replication) connection, which it dials from config.ConnString.
+func watchRetention(ctx context.Context, config Config, dbName string, emit func(CDC)) {
+	guard := config.WALRetention
+	interval := guard.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	connConfig, err := queryConnConfig(config.ConnString)
+	if err != nil {
+		logger.Error("WAL retention watchdog disabled", zap.Error(err))
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var conn *pgconn.PgConn
+	defer func() {
+		if conn != nil {
+			conn.Close(context.Background())
+		}
+	}()
+
+	exceeded := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if conn == nil || conn.IsClosed() {
+			if conn, err = pgconn.ConnectConfig(ctx, &connConfig.Config); err != nil {
+				logger.Warn("WAL retention watchdog failed to connect", zap.Error(err))
+				conn = nil
+				continue
+			}
+		}
+
+		status, activePID, err := slotRetention(ctx, conn, config.SlotName)
+		if err != nil {
+			logger.Warn("WAL retention check failed", zap.Error(err))
+			continue
+		}
+		status.MaxBytes = guard.MaxBytes
+		status.Exceeded = status.RetainedBytes > guard.MaxBytes
+
+		if status.Exceeded {
+			logger.Warn("Replication slot retains more WAL than allowed",
+				zap.String("slotName", status.Slot), zap.Int64("retainedBytes", status.RetainedBytes), zap.Int64("maxBytes", guard.MaxBytes))
+			if guard.OnExceeded != nil {
+				guard.OnExceeded(status)
+			}
+			if guard.DropSlot {
+				// emit before dropping: terminating the walsender ends the stream
+				status.SlotDropped = true
+				emit(retentionEvent(status, dbName))
+				if err := dropSlot(ctx, conn, config.SlotName, activePID); err != nil {
+					logger.Error("Failed to drop replication slot", zap.String("slotName", config.SlotName), zap.Error(err))
+				} else {
+					logger.Warn("Dropped replication slot to protect the primary", zap.String("slotName", config.SlotName))
+				}
+				exceeded = false
+				continue
+			}
+		}
+
+		if status.Exceeded != exceeded {
+			exceeded = status.Exceeded
+			emit(retentionEvent(status, dbName))
+		}
+	}
+}
+
+// slotRetention returns the WAL retained by slot and the PID of the walsender using it (0 if inactive).
+func slotRetention(ctx context.Context, conn *pgconn.PgConn, slot string) (RetentionStatus, int, error) {
+	status := RetentionStatus{Slot: slot}
+	result := conn.ExecParams(ctx,
+		"SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn)::bigint, coalesce(active_pid, 0) FROM pg_replication_slots WHERE slot_name = $1",
+		[][]byte{[]byte(slot)}, nil, nil, nil).Read()
+	if result.Err != nil {
+		return status, 0, result.Err
+	}
+	if len(result.Rows) == 0 {
+		return status, 0, fmt.Errorf("replication slot %s not found", slot)
+	}
+
+	var err error
+	if status.RetainedBytes, err = strconv.ParseInt(string(result.Rows[0][0]), 10, 64); err != nil {
+		return status, 0, fmt.Errorf("failed to parse retained WAL %q: %w", result.Rows[0][0], err)
+	}
+	pid, err := strconv.Atoi(string(result.Rows[0][1]))
+	if err != nil {
+		return status, 0, fmt.Errorf("failed to parse active_pid %q: %w", result.Rows[0][1], err)
+	}
+	return status, pid, nil
+}
+
+// dropSlot terminates the walsender holding slot, if any, and drops the slot.
+func dropSlot(ctx context.Context, conn *pgconn.PgConn, slot string, activePID int) error {
+	if activePID != 0 {
+		pid := []byte(strconv.Itoa(activePID))
+		if result := conn.ExecParams(ctx, "SELECT pg_terminate_backend($1::int)", [][]byte{pid}, nil, nil, nil).Read(); result.Err != nil {
+			return fmt.Errorf("failed to terminate walsender %d: %w", activePID, result.Err)
+		}
+		// the slot stays active until the walsender has exited
+		time.Sleep(time.Second)
+	}
+	result := conn.ExecParams(ctx, "SELECT pg_drop_replication_slot($1)", [][]byte{[]byte(slot)}, nil, nil, nil).Read()
+	return result.Err
+}
+
+func retentionEvent(status RetentionStatus, dbName string) CDC {
+	content, _ := json.Marshal(status)
+
+	event := newEvent("", dbName, nil, nil, 0, "m")
+	event.Payload.Message = &LogicalMessage{
+		Prefix:  WALRetentionPrefix,
+		Content: content,
+	}
+	return event
+}
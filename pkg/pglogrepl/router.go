@@ -0,0 +1,115 @@
+package pglogrepl
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Router fans events out to per-table subscriptions. Each subscription has its own buffered channel,
+// so a consumer that is slow on one table holds up the others only once its buffer is full.
+type Router struct {
+	events <-chan CDC
+	buffer int
+
+	mu      sync.Mutex
+	subs    []*subscription
+	started bool
+}
+
+type subscription struct {
+	patterns []string
+	ch       chan CDC
+}
+
+// NewRouter returns a router for events whose subscriptions buffer up to buffer events each.
+func NewRouter(events <-chan CDC, buffer int) *Router {
+	return &Router{events: events, buffer: buffer}
+}
+
+// Router returns a router for the stream's events. Once the router is started,
+// the stream's events must only be read through its subscriptions.
+func (s *Stream) Router(buffer int) *Router {
+	return NewRouter(s.events, buffer)
+}
+
+// Subscribe returns a channel receiving the events of tables matching any of patterns.
+// A pattern is "schema.table" or "table" (any schema) and may contain path.Match wildcards, e.g. "sales.*".
+// An event matching several subscriptions is delivered to each. Events not tied to a table,
+// such as logical decoding and two-phase commit messages, are delivered to every subscription.
+// Subscriptions must be made before Start.
+func (r *Router) Subscribe(patterns ...string) (<-chan CDC, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("at least one table pattern is required")
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return nil, fmt.Errorf("router already started")
+	}
+	sub := &subscription{patterns: patterns, ch: make(chan CDC, r.buffer)}
+	r.subs = append(r.subs, sub)
+	return sub.ch, nil
+}
+
+// Start routes events until the events channel is closed or ctx is done, then closes the subscription channels.
+// Events matching no subscription are dropped.
+func (r *Router) Start(ctx context.Context) {
+	r.mu.Lock()
+	r.started = true
+	subs := r.subs
+	r.mu.Unlock()
+
+	go func() {
+		defer func() {
+			for _, sub := range subs {
+				close(sub.ch)
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-r.events:
+				if !ok {
+					return
+				}
+				for _, sub := range subs {
+					if !sub.matches(event) {
+						continue
+					}
+					select {
+					case sub.ch <- event:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (s *subscription) matches(event CDC) bool {
+	src := event.Payload.Source
+	if src.Table == "" {
+		return true
+	}
+	for _, pattern := range s.patterns {
+		name := src.Table
+		if strings.Contains(pattern, ".") {
+			name = src.Schema + "." + src.Table
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package pglogrepl
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func tableEvent(schema, table string) CDC {
+	var event CDC
+	event.Payload.Source.Schema, event.Payload.Source.Table = schema, table
+	return event
+}
+
+func TestRouter(t *testing.T) {
+	events := make(chan CDC)
+	r := NewRouter(events, 4)
+	orders, err := r.Subscribe("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sales, err := r.Subscribe("sales.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Subscribe("[orders"); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+	r.Start(context.Background())
+	if _, err := r.Subscribe("users"); err == nil {
+		t.Error("expected an error for subscribing after Start")
+	}
+
+	// orders isn't read until the end, which must not hold up sales within its buffer
+	go func() {
+		events <- tableEvent("public", "orders")
+		events <- tableEvent("sales", "invoices")
+		events <- tableEvent("public", "users")
+		events <- tableEvent("", "") // e.g. a logical decoding message
+		close(events)
+	}()
+
+	var got []string
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case event, ok := <-sales:
+			if !ok {
+				done = true
+				break
+			}
+			got = append(got, event.Payload.Source.Table)
+		case <-timeout:
+			t.Fatal("timed out reading sales")
+		}
+	}
+	if len(got) != 2 || got[0] != "invoices" || got[1] != "" {
+		t.Errorf("sales got %q, want [invoices \"\"]", got)
+	}
+
+	var n int
+	for range orders {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("orders got %d events, want 2", n)
+	}
+}
@@ -0,0 +1,199 @@
+package pglogrepl
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// maxPooledRowData is the capacity above which a rowBuffer's copy of the WAL data isn't kept in the pool, so one
+// huge row doesn't pin its memory for the life of the stream.
+const maxPooledRowData = 64 << 10
+
+// rowBuffer holds an insert, update or delete message parsed without allocating per column: its tuples' columns
+// are kept in one reused slice and reference a reused copy of the WAL data, which must be copied as pgconn
+// reuses the buffer it receives messages in. Buffers are taken from rowBuffers by parseRow and returned with
+// release once the message is decoded into an event.
+type rowBuffer struct {
+	data    []byte
+	columns []pglogrepl.TupleDataColumn
+	ptrs    []*pglogrepl.TupleDataColumn
+	tuples  [2]pglogrepl.TupleData
+
+	insert pglogrepl.InsertMessageV2
+	update pglogrepl.UpdateMessageV2
+	delete pglogrepl.DeleteMessageV2
+}
+
+var rowBuffers = sync.Pool{New: func() any { return new(rowBuffer) }}
+
+var errShortRow = errors.New("row message too short")
+
+// parseRow parses walData if it's an insert, update or delete message into a pooled rowBuffer, returning the
+// buffer and the message, which references it. It returns a nil buffer for other messages.
+func parseRow(walData []byte, inStream bool) (*rowBuffer, pglogrepl.Message, error) {
+	if len(walData) == 0 {
+		return nil, nil, nil
+	}
+	switch walData[0] {
+	case 'I', 'U', 'D':
+	default:
+		return nil, nil, nil
+	}
+
+	b := rowBuffers.Get().(*rowBuffer)
+	b.data = append(b.data[:0], walData...)
+	msg, err := b.parse(inStream)
+	if err != nil {
+		b.release()
+		return nil, nil, fmt.Errorf("failed to parse %c message: %w", walData[0], err)
+	}
+	return b, msg, nil
+}
+
+// parse parses b.data, laid out as described in
+// https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html
+func (b *rowBuffer) parse(inStream bool) (pglogrepl.Message, error) {
+	kind, src := b.data[0], b.data[1:]
+	var xid uint32
+	if inStream {
+		if len(src) < 4 {
+			return nil, errShortRow
+		}
+		xid, src = binary.BigEndian.Uint32(src), src[4:]
+	}
+	if len(src) < 5 {
+		return nil, errShortRow
+	}
+	relationID, tupleType := binary.BigEndian.Uint32(src), src[4]
+	src = src[5:]
+
+	// tuples are recorded as ranges of b.columns, whose pointers are only taken once it stops growing
+	b.columns = b.columns[:0]
+	var spans [2][2]int
+	n := 0
+	readTuple := func() error {
+		start := len(b.columns)
+		used, err := b.readTuple(src)
+		if err != nil {
+			return err
+		}
+		src = src[used:]
+		spans[n] = [2]int{start, len(b.columns)}
+		n++
+		return nil
+	}
+
+	var oldTupleType uint8
+	switch kind {
+	case 'I':
+		if tupleType != 'N' {
+			return nil, fmt.Errorf("invalid tuple type %q", tupleType)
+		}
+		if err := readTuple(); err != nil {
+			return nil, err
+		}
+	case 'U':
+		if tupleType == pglogrepl.UpdateMessageTupleTypeKey || tupleType == pglogrepl.UpdateMessageTupleTypeOld {
+			oldTupleType = tupleType
+			if err := readTuple(); err != nil {
+				return nil, err
+			}
+			if len(src) == 0 || src[0] != 'N' {
+				return nil, errors.New("missing new tuple")
+			}
+			src = src[1:]
+		} else if tupleType != 'N' {
+			return nil, fmt.Errorf("invalid tuple type %q", tupleType)
+		}
+		if err := readTuple(); err != nil {
+			return nil, err
+		}
+	case 'D':
+		if tupleType != pglogrepl.DeleteMessageTupleTypeKey && tupleType != pglogrepl.DeleteMessageTupleTypeOld {
+			return nil, fmt.Errorf("invalid tuple type %q", tupleType)
+		}
+		oldTupleType = tupleType
+		if err := readTuple(); err != nil {
+			return nil, err
+		}
+	}
+
+	b.ptrs = b.ptrs[:0]
+	for i := range b.columns {
+		b.ptrs = append(b.ptrs, &b.columns[i])
+	}
+	for i := 0; i < n; i++ {
+		columns := b.ptrs[spans[i][0]:spans[i][1]:spans[i][1]]
+		b.tuples[i] = pglogrepl.TupleData{ColumnNum: uint16(len(columns)), Columns: columns}
+	}
+
+	switch kind {
+	case 'I':
+		b.insert = pglogrepl.InsertMessageV2{}
+		b.insert.SetType(pglogrepl.MessageTypeInsert)
+		b.insert.RelationID, b.insert.Tuple, b.insert.Xid = relationID, &b.tuples[0], xid
+		return &b.insert, nil
+	case 'U':
+		b.update = pglogrepl.UpdateMessageV2{}
+		b.update.SetType(pglogrepl.MessageTypeUpdate)
+		b.update.RelationID, b.update.Xid = relationID, xid
+		b.update.OldTupleType, b.update.NewTuple = oldTupleType, &b.tuples[n-1]
+		if oldTupleType != 0 {
+			b.update.OldTuple = &b.tuples[0]
+		}
+		return &b.update, nil
+	default:
+		b.delete = pglogrepl.DeleteMessageV2{}
+		b.delete.SetType(pglogrepl.MessageTypeDelete)
+		b.delete.RelationID, b.delete.Xid = relationID, xid
+		b.delete.OldTupleType, b.delete.OldTuple = oldTupleType, &b.tuples[0]
+		return &b.delete, nil
+	}
+}
+
+// readTuple appends the columns of the TupleData at the start of src to b.columns, returning its length.
+func (b *rowBuffer) readTuple(src []byte) (int, error) {
+	if len(src) < 2 {
+		return 0, errShortRow
+	}
+	n := int(binary.BigEndian.Uint16(src))
+	low := 2
+	for i := 0; i < n; i++ {
+		if low >= len(src) {
+			return 0, errShortRow
+		}
+		col := pglogrepl.TupleDataColumn{DataType: src[low]}
+		low++
+		switch col.DataType {
+		case pglogrepl.TupleDataTypeText, pglogrepl.TupleDataTypeBinary:
+			if low+4 > len(src) {
+				return 0, errShortRow
+			}
+			col.Length = binary.BigEndian.Uint32(src[low:])
+			low += 4
+			end := low + int(col.Length)
+			if end > len(src) || end < low {
+				return 0, errShortRow
+			}
+			col.Data = src[low:end:end]
+			low = end
+		}
+		b.columns = append(b.columns, col)
+	}
+	return low, nil
+}
+
+// release returns b to rowBuffers. The message parsed into b must no longer be used.
+func (b *rowBuffer) release() {
+	if b == nil {
+		return
+	}
+	if cap(b.data) > maxPooledRowData {
+		b.data = nil
+	}
+	rowBuffers.Put(b)
+}
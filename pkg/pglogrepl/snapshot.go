@@ -0,0 +1,123 @@
+package pglogrepl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// ExportSnapshot performs a consistent export of tables without streaming changes: each row is sent to out
+// as a read event (op=r, source.snapshot=true). All tables are read from the same snapshot, exported by a
+// temporary replication slot that is dropped when ExportSnapshot returns, so nothing is retained on the server.
+// It's meant for seeding sinks and one-off migrations.
+//
+// conn must be a replication connection; the rows are read over a regular connection dialed from
+// config.ConnString. tables are "schema.table" or "table" (in public). ExportSnapshot doesn't close out.
+// It returns the LSN the snapshot is consistent with, from which streaming can pick up.
+func ExportSnapshot(ctx context.Context, conn *pgconn.PgConn, config Config, out chan<- CDC, tables ...string) (pglogrepl.LSN, error) {
+	config = config.withDefaults()
+	if config.ConnString == "" {
+		return 0, fmt.Errorf("ExportSnapshot requires Config.ConnString")
+	}
+
+	// the slot and its snapshot live as long as the replication session, so conn must stay idle until we're done
+	slotName := fmt.Sprintf("%s_snapshot_%d", config.SlotName, time.Now().UnixNano())
+	slot, err := pglogrepl.CreateReplicationSlot(ctx, conn, slotName, config.OutputPlugin, pglogrepl.CreateReplicationSlotOptions{
+		Temporary:      true,
+		SnapshotAction: "EXPORT_SNAPSHOT",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create snapshot slot: %w", err)
+	}
+	defer func() {
+		if err := pglogrepl.DropReplicationSlot(context.Background(), conn, slotName, pglogrepl.DropReplicationSlotOptions{}); err != nil {
+			logger.Warn("Failed to drop temporary snapshot slot, it's dropped when the connection closes", zap.String("slotName", slotName), zap.Error(err))
+		}
+	}()
+
+	lsn, err := pglogrepl.ParseLSN(slot.ConsistentPoint)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse consistent point %q: %w", slot.ConsistentPoint, err)
+	}
+	logger.Info("Exported snapshot", zap.String("snapshot", slot.SnapshotName), zap.String("consistentPoint", slot.ConsistentPoint))
+
+	connConfig, err := queryConnConfig(config.ConnString)
+	if err != nil {
+		return 0, err
+	}
+	db, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect for snapshot export: %w", err)
+	}
+	defer db.Close(context.Background())
+
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", slot.SnapshotName)); err != nil {
+		return 0, fmt.Errorf("failed to import snapshot: %w", err)
+	}
+
+	for _, table := range tables {
+		if err := exportTable(ctx, tx, table, lsn, config, out); err != nil {
+			return 0, err
+		}
+	}
+	return lsn, nil
+}
+
+// exportTable sends every row of table to out as a read event.
+func exportTable(ctx context.Context, tx pgx.Tx, table string, lsn pglogrepl.LSN, config Config, out chan<- CDC) error {
+	table = strings.TrimSpace(table)
+	schemaName, tableName := "public", table
+	if parts := strings.SplitN(table, ".", 2); len(parts) == 2 {
+		schemaName, tableName = parts[0], parts[1]
+	}
+
+	rows, err := tx.Query(ctx, "SELECT * FROM "+pgx.Identifier{schemaName, tableName}.Sanitize())
+	if err != nil {
+		return fmt.Errorf("failed to export %s.%s: %w", schemaName, tableName, err)
+	}
+	defer rows.Close()
+
+	rel := &pglogrepl.RelationMessageV2{RelationMessage: pglogrepl.RelationMessage{Namespace: schemaName, RelationName: tableName}}
+	serverName := tx.Conn().PgConn().Conn().RemoteAddr().String()
+	dbName := tx.Conn().Config().Database
+
+	var n int
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return fmt.Errorf("failed to read row of %s.%s: %w", schemaName, tableName, err)
+		}
+		after := make(map[string]interface{}, len(values))
+		for i, fd := range rows.FieldDescriptions() {
+			after[fd.Name] = values[i]
+		}
+
+		event := newEvent(serverName, dbName, nil, rel, int64(lsn), "r")
+		event.Payload.After = after
+		event.Payload.Source.Snapshot = true
+
+		select {
+		case out <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export %s.%s: %w", schemaName, tableName, err)
+	}
+	logger.Info("Exported table", zap.String("table", schemaName+"."+tableName), zap.Int("rows", n))
+	return nil
+}
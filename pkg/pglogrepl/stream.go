@@ -0,0 +1,23 @@
+package pglogrepl
+
+// Stream is a running replication stream, returned by Open.
+type Stream struct {
+	events    <-chan CDC
+	relations *relationRegistry
+}
+
+// Events returns the stream's CDC events. The channel is closed when the stream ends.
+func (s *Stream) Events() <-chan CDC {
+	return s.events
+}
+
+// Relation returns the current column set of schema.table, as last announced by the server.
+// Tables are known once the stream has seen a change to them.
+func (s *Stream) Relation(schema, table string) (RelationVersion, bool) {
+	return s.relations.lookup(schema, table)
+}
+
+// Relations returns the current column sets of all tables seen by the stream.
+func (s *Stream) Relations() []RelationVersion {
+	return s.relations.all()
+}
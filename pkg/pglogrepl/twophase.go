@@ -0,0 +1,163 @@
+package pglogrepl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// TwoPhasePrefix is the message prefix of events (op "m") emitted for two-phase commit messages
+// when Config.TwoPhase is set. Their content is a JSON encoded PreparedTransaction.
+const TwoPhasePrefix = "pgo.two_phase"
+
+// Two-phase commit events, in the order the server sends them for a prepared transaction.
+const (
+	BeginPrepare     = "begin_prepare"     // changes of the prepared transaction follow
+	Prepare          = "prepare"           // PREPARE TRANSACTION completed
+	CommitPrepared   = "commit_prepared"   // COMMIT PREPARED
+	RollbackPrepared = "rollback_prepared" // ROLLBACK PREPARED; the transaction's changes must be discarded
+)
+
+// PreparedTransaction describes a two-phase commit step of the transaction identified by GID.
+type PreparedTransaction struct {
+	Event     string    `json:"event"`     // one of BeginPrepare, Prepare, CommitPrepared, RollbackPrepared
+	GID       string    `json:"gid"`       // global transaction identifier given to PREPARE TRANSACTION
+	Xid       uint32    `json:"xid"`       // transaction ID
+	Lsn       int64     `json:"lsn"`       // LSN of the prepare, commit or, for rollbacks, end of the prepared transaction
+	EndLsn    int64     `json:"endLsn"`    // end LSN of the message's transaction step
+	Timestamp time.Time `json:"timestamp"` // prepare, commit or rollback time
+}
+
+// pgoutput message types of two-phase commit (protocol version 3+), which pglogrepl.ParseV2 doesn't support.
+const (
+	messageTypeBeginPrepare     = 'b'
+	messageTypePrepare          = 'P'
+	messageTypeCommitPrepared   = 'K'
+	messageTypeRollbackPrepared = 'r'
+	messageTypeStreamPrepare    = 'p'
+)
+
+// twoPhaseMessage carries a parsed two-phase commit message from the parser to decodeV2.
+type twoPhaseMessage struct {
+	txn PreparedTransaction
+}
+
+func (*twoPhaseMessage) Type() pglogrepl.MessageType { return pglogrepl.MessageType(messageTypePrepare) }
+
+// isTwoPhase reports whether walData is a two-phase commit message.
+func isTwoPhase(walData []byte) bool {
+	if len(walData) == 0 {
+		return false
+	}
+	switch walData[0] {
+	case messageTypeBeginPrepare, messageTypePrepare, messageTypeCommitPrepared, messageTypeRollbackPrepared, messageTypeStreamPrepare:
+		return true
+	}
+	return false
+}
+
+// parseTwoPhase decodes a two-phase commit message. Streamed prepares are reported as Prepare.
+func parseTwoPhase(walData []byte) (*twoPhaseMessage, error) {
+	r := twoPhaseReader{buf: walData[1:]}
+	var txn PreparedTransaction
+	switch walData[0] {
+	case messageTypeBeginPrepare:
+		txn.Event = BeginPrepare
+		txn.Lsn, txn.EndLsn, txn.Timestamp = r.int64(), r.int64(), r.time()
+	case messageTypePrepare, messageTypeStreamPrepare:
+		txn.Event = Prepare
+		r.flags()
+		txn.Lsn, txn.EndLsn, txn.Timestamp = r.int64(), r.int64(), r.time()
+	case messageTypeCommitPrepared:
+		txn.Event = CommitPrepared
+		r.flags()
+		txn.Lsn, txn.EndLsn, txn.Timestamp = r.int64(), r.int64(), r.time()
+	case messageTypeRollbackPrepared:
+		txn.Event = RollbackPrepared
+		r.flags()
+		txn.Lsn, txn.EndLsn = r.int64(), r.int64()
+		r.time() // prepare time
+		txn.Timestamp = r.time()
+	default:
+		return nil, fmt.Errorf("not a two-phase commit message: %q", walData[0])
+	}
+	txn.Xid = r.uint32()
+	txn.GID = r.string()
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to parse %s message: %w", txn.Event, r.err)
+	}
+	return &twoPhaseMessage{txn: txn}, nil
+}
+
+// twoPhaseReader reads big-endian protocol fields, recording the first short read in err.
+type twoPhaseReader struct {
+	buf []byte
+	err error
+}
+
+func (r *twoPhaseReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = fmt.Errorf("message too short")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *twoPhaseReader) flags() { r.next(1) }
+
+func (r *twoPhaseReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *twoPhaseReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// time reads a timestamp in microseconds since 2000-01-01 UTC.
+func (r *twoPhaseReader) time() time.Time {
+	return pgEpoch.Add(time.Duration(r.int64()) * time.Microsecond)
+}
+
+func (r *twoPhaseReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(r.buf, 0)
+	if i < 0 {
+		r.err = fmt.Errorf("unterminated string")
+		return ""
+	}
+	s := string(r.buf[:i])
+	r.buf = r.buf[i+1:]
+	return s
+}
+
+var pgEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func handleTwoPhaseMessage(msg *twoPhaseMessage, serverName, dbName string) CDC {
+	content, _ := json.Marshal(msg.txn)
+
+	event := newEvent(serverName, dbName, nil, nil, msg.txn.Lsn, "m")
+	event.Payload.Source.TxId = int64(msg.txn.Xid)
+	event.Payload.Message = &LogicalMessage{
+		Prefix:        TwoPhasePrefix,
+		Content:       content,
+		Transactional: true,
+	}
+	return event
+}
@@ -0,0 +1,184 @@
+package pglogrepl
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// TypedCDC is a change event for a single table whose row images are decoded into T.
+type TypedCDC[T any] struct {
+	Op     string // c=create, u=update, d=delete, t=truncate
+	Schema string
+	Table  string
+	Before *T // nil for INSERT
+	After  *T // nil for DELETE
+	TxId   int64
+	Lsn    int64
+	TsMs   int64
+}
+
+// StreamInto reads events, keeps the ones for table and emits them decoded into T.
+// table is either "table" or "schema.table". Columns are mapped to struct fields by their `db` tag,
+// falling back to the lowercased field name; fields tagged `db:"-"` are skipped.
+// The column-to-field mapping is computed once, so no per-event struct inspection is needed.
+//
+// The returned channel is closed when events is closed or ctx is done.
+func StreamInto[T any](ctx context.Context, events <-chan CDC, table string) (<-chan TypedCDC[T], error) {
+	m, err := newRowMapper[T]()
+	if err != nil {
+		return nil, err
+	}
+
+	schemaName, tableName := "", table
+	if parts := strings.SplitN(table, ".", 2); len(parts) == 2 {
+		schemaName, tableName = parts[0], parts[1]
+	}
+
+	out := make(chan TypedCDC[T])
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				src := event.Payload.Source
+				// messages (op "m"), such as schema changes, carry no row images
+				if event.Payload.Op == "m" || src.Table != tableName || (schemaName != "" && src.Schema != schemaName) {
+					continue
+				}
+
+				typed, err := decodeTyped(m, event)
+				if err != nil {
+					zap.L().Error("failed to decode typed CDC event", zap.String("table", table), zap.Error(err))
+					continue
+				}
+
+				select {
+				case out <- typed:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func decodeTyped[T any](m *rowMapper[T], event CDC) (TypedCDC[T], error) {
+	typed := TypedCDC[T]{
+		Op:     event.Payload.Op,
+		Schema: event.Payload.Source.Schema,
+		Table:  event.Payload.Source.Table,
+		TxId:   event.Payload.Source.TxId,
+		Lsn:    event.Payload.Source.Lsn,
+		TsMs:   event.Payload.TsMs,
+	}
+
+	var err error
+	if typed.Before, err = m.decode(event.Payload.Before); err != nil {
+		return typed, fmt.Errorf("before: %w", err)
+	}
+	if typed.After, err = m.decode(event.Payload.After); err != nil {
+		return typed, fmt.Errorf("after: %w", err)
+	}
+	return typed, nil
+}
+
+// rowMapper maps decoded column values onto fields of T.
+type rowMapper[T any] struct {
+	fields map[string][]int // column name => field index path
+}
+
+func newRowMapper[T any]() (*rowMapper[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("StreamInto: type %s is not a struct", t)
+	}
+
+	m := &rowMapper[T]{fields: make(map[string][]int)}
+	m.collect(t, nil)
+	return m, nil
+}
+
+// collect walks the exported fields of t, descending into embedded structs.
+func (m *rowMapper[T]) collect(t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		path := append(append([]int{}, index...), i)
+
+		tag := f.Tag.Get("db")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			m.collect(f.Type, path)
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		m.fields[name] = path
+	}
+}
+
+// decode converts a row image (map[string]interface{}) into *T. It returns nil for a nil row.
+func (m *rowMapper[T]) decode(row interface{}) (*T, error) {
+	if row == nil {
+		return nil, nil
+	}
+	values, ok := row.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected row type %T", row)
+	}
+
+	var dst T
+	rv := reflect.ValueOf(&dst).Elem()
+	for col, val := range values {
+		path, ok := m.fields[col]
+		if !ok || val == nil {
+			continue
+		}
+		if err := assign(rv.FieldByIndex(path), val); err != nil {
+			return nil, fmt.Errorf("column %s: %w", col, err)
+		}
+	}
+	return &dst, nil
+}
+
+// assign sets field to val, converting between compatible types and allocating pointer fields.
+func assign(field reflect.Value, val interface{}) error {
+	v := reflect.ValueOf(val)
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if err := assign(ptr.Elem(), val); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	switch {
+	case v.Type().AssignableTo(field.Type()):
+		field.Set(v)
+	case v.Type().ConvertibleTo(field.Type()) && (field.Kind() != reflect.String || v.Kind() == reflect.String):
+		// guard against int => string conversions, which yield runes rather than digits
+		field.Set(v.Convert(field.Type()))
+	default:
+		return fmt.Errorf("cannot assign %s to %s", v.Type(), field.Type())
+	}
+	return nil
+}
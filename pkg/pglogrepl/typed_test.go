@@ -0,0 +1,70 @@
+package pglogrepl
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testOrder struct {
+	ID       int64     `db:"id"`
+	Customer string    `db:"customer_name"`
+	Amount   float64   // mapped as "amount"
+	Note     *string   `db:"note"`
+	Created  time.Time `db:"created_at"`
+	Ignored  string    `db:"-"`
+}
+
+func TestStreamInto(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan CDC, 2)
+	typed, err := StreamInto[testOrder](ctx, events, "public.orders")
+	if err != nil {
+		t.Fatalf("StreamInto: %v", err)
+	}
+
+	now := time.Now()
+	other := CDC{}
+	other.Payload.Source.Schema, other.Payload.Source.Table = "public", "customers"
+	other.Payload.Op = "c"
+	events <- other
+
+	event := CDC{}
+	event.Payload.Source.Schema, event.Payload.Source.Table = "public", "orders"
+	event.Payload.Op = "c"
+	event.Payload.After = map[string]interface{}{
+		"id":            int32(7),
+		"customer_name": "ada",
+		"amount":        float64(12.5),
+		"note":          "rush",
+		"created_at":    now,
+		"ignored":       "x",
+		"unknown":       true,
+	}
+	events <- event
+	close(events)
+
+	got, ok := <-typed
+	if !ok {
+		t.Fatal("expected an event")
+	}
+	if got.Op != "c" || got.Before != nil || got.After == nil {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+	a := got.After
+	if a.ID != 7 || a.Customer != "ada" || a.Amount != 12.5 || a.Note == nil || *a.Note != "rush" || !a.Created.Equal(now) || a.Ignored != "" {
+		t.Errorf("unexpected row: %+v", a)
+	}
+
+	if _, ok := <-typed; ok {
+		t.Error("expected channel to be closed")
+	}
+}
+
+func TestStreamIntoRejectsNonStruct(t *testing.T) {
+	if _, err := StreamInto[int](context.Background(), nil, "orders"); err == nil {
+		t.Error("expected error for non-struct type")
+	}
+}
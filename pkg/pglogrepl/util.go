@@ -15,6 +15,7 @@ import (
 //   - dataType: The OID of the PostgreSQL data type.
 //
 // It returns nil for null values, unchanged toast values, or in case of decoding errors.
+// Both text and binary (pgoutput binary option) column formats are supported.
 func decodeColumn(col *pglogrepl.TupleDataColumn, typeMap *pgtype.Map, dataType uint32) interface{} {
 	switch col.DataType {
 	case 'n':
@@ -28,6 +29,13 @@ func decodeColumn(col *pglogrepl.TupleDataColumn, typeMap *pgtype.Map, dataType
 			return nil
 		}
 		return val
+	case 'b':
+		val, err := decodeBinaryColumnData(typeMap, col.Data, dataType)
+		if err != nil {
+			zap.L().Error("error decoding binary column data", zap.Error(err))
+			return nil
+		}
+		return val
 	default:
 		zap.L().Warn("unknown column data type", zap.Any("dataType", col.DataType))
 		return nil
@@ -50,3 +58,12 @@ func decodeTextColumnData(mi *pgtype.Map, data []byte, dataType uint32) (interfa
 	}
 	return string(data), nil
 }
+
+// decodeBinaryColumnData is like decodeTextColumnData for columns sent in binary format
+// (pgoutput binary option). Data of unknown types is returned as a copy of the raw bytes.
+func decodeBinaryColumnData(mi *pgtype.Map, data []byte, dataType uint32) (interface{}, error) {
+	if dt, ok := mi.TypeForOID(dataType); ok {
+		return dt.Codec.DecodeValue(mi, dataType, pgtype.BinaryFormatCode, data)
+	}
+	return append([]byte(nil), data...), nil
+}
@@ -0,0 +1,179 @@
+package pgx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CopyConn is a connection supporting COPY, e.g. *pgx.Conn, *pgxpool.Pool or pgx.Tx.
+type CopyConn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// CopyRows bulk inserts rows into the specified table with COPY, which is much faster than inserting rows
+// one by one. The columns copied are those of the first row, in the table's column order; absent keys of
+// other rows are copied as NULL, and keys not in the first row are an error.
+//
+// Values are converted to the columns' types as needed to decode JSON: strings into timestamps and dates
+// (RFC 3339 or YYYY-MM-DD), and json.Numbers into numbers.
+//
+//	n, err := pgx.CopyRows(ctx, pool, "events", slices.Values(events))
+func CopyRows(ctx context.Context, conn CopyConn, tableName string, rows iter.Seq[map[string]any], schema ...string) (int64, error) {
+	qb := newQueryBuilder(tableName, schema...)
+
+	next, stop := iter.Pull(rows)
+	defer stop()
+	first, ok := next()
+	if !ok {
+		return 0, nil
+	}
+
+	tableColumns, err := columnTypes(ctx, conn, qb.schema, qb.table)
+	if err != nil {
+		return 0, err
+	}
+	var columns, types []string
+	for _, col := range tableColumns {
+		if _, ok := first[col.name]; ok {
+			columns = append(columns, col.name)
+			types = append(types, col.typ)
+		}
+	}
+	for key := range first {
+		if !slices.Contains(columns, key) {
+			return 0, fmt.Errorf("column %q of table %s doesn't exist", key, qb.tableIdentifier())
+		}
+	}
+
+	src := &copyRowsSource{next: next, row: first, columns: columns, types: types, pending: true}
+	n, err := conn.CopyFrom(ctx, pgx.Identifier{qb.schema, qb.table}, columns, src)
+	if err != nil {
+		return n, fmt.Errorf("copy into %s: %w", qb.tableIdentifier(), err)
+	}
+	return n, nil
+}
+
+type tableColumn struct {
+	name string
+	typ  string // the type's name, e.g. int4 or timestamptz
+}
+
+// columnTypes returns the columns of a table in order.
+func columnTypes(ctx context.Context, conn CopyConn, schema, table string) ([]tableColumn, error) {
+	rows, err := conn.Query(ctx, `
+        SELECT a.attname, t.typname
+        FROM pg_attribute a
+        JOIN pg_type t ON t.oid = a.atttypid
+        WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+        ORDER BY a.attnum;
+    `, pgx.Identifier{schema, table}.Sanitize())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns of %s.%s: %w", schema, table, err)
+	}
+	columns, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (tableColumn, error) {
+		var c tableColumn
+		err := row.Scan(&c.name, &c.typ)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns of %s.%s: %w", schema, table, err)
+	}
+	return columns, nil
+}
+
+// copyRowsSource is a pgx.CopyFromSource of maps.
+type copyRowsSource struct {
+	next    func() (map[string]any, bool)
+	row     map[string]any
+	pending bool // row hasn't been returned by Next yet
+	columns []string
+	types   []string
+	values  []any
+	err     error
+}
+
+func (s *copyRowsSource) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.pending {
+		s.pending = false
+	} else {
+		row, ok := s.next()
+		if !ok {
+			return false
+		}
+		s.row = row
+	}
+
+	for key := range s.row {
+		if !slices.Contains(s.columns, key) {
+			s.err = fmt.Errorf("column %q isn't in the first row", key)
+			return false
+		}
+	}
+	s.values = s.values[:0]
+	for i, col := range s.columns {
+		v, err := convertValue(s.row[col], s.types[i])
+		if err != nil {
+			s.err = fmt.Errorf("column %q: %w", col, err)
+			return false
+		}
+		s.values = append(s.values, v)
+	}
+	return true
+}
+
+func (s *copyRowsSource) Values() ([]any, error) {
+	return s.values, nil
+}
+
+func (s *copyRowsSource) Err() error {
+	return s.err
+}
+
+// convertValue converts a JSON decoded value for a column of type typ, which COPY's binary format
+// can't do implicitly.
+func convertValue(v any, typ string) (any, error) {
+	switch v := v.(type) {
+	case string:
+		switch typ {
+		case "timestamptz", "timestamp":
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %q", v)
+			}
+			return t, nil
+		case "date":
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date %q", v)
+			}
+			return t, nil
+		}
+	case json.Number:
+		switch typ {
+		case "int2", "int4", "int8":
+			return v.Int64()
+		case "numeric":
+			var n pgtype.Numeric
+			if err := n.Scan(string(v)); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "float4", "float8":
+			return v.Float64()
+		default:
+			return string(v), nil
+		}
+	}
+	return v, nil
+}
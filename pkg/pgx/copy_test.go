@@ -0,0 +1,56 @@
+package pgx
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestConvertValue(t *testing.T) {
+	ts, err := convertValue("2024-05-01T10:00:00Z", "timestamptz")
+	if err != nil || !ts.(time.Time).Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamptz = %v, %v", ts, err)
+	}
+	if n, err := convertValue(json.Number("42"), "int8"); err != nil || n != int64(42) {
+		t.Errorf("int8 = %v, %v", n, err)
+	}
+	if s, err := convertValue(json.Number("42"), "text"); err != nil || s != "42" {
+		t.Errorf("text = %v, %v", s, err)
+	}
+	if _, err := convertValue("yesterday", "date"); err == nil {
+		t.Error("expected an invalid date error")
+	}
+}
+
+func TestCopyRows(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, testConnString)
+	if err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, `CREATE TEMP TABLE copy_rows_test (id int8 PRIMARY KEY, name text, created_at timestamptz DEFAULT now())`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []map[string]any{
+		{"name": "a", "id": json.Number("1"), "created_at": "2024-05-01T10:00:00Z"},
+		{"id": 2.0, "name": "b"},
+	}
+	n, err := CopyRows(ctx, conn, "copy_rows_test", slices.Values(rows), "pg_temp")
+	if err != nil || n != 2 {
+		t.Fatalf("CopyRows() = %d, %v", n, err)
+	}
+
+	_, err = CopyRows(ctx, conn, "copy_rows_test", slices.Values([]map[string]any{{"id": 3, "missing": 1}}), "pg_temp")
+	if err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+}
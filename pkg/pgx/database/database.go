@@ -0,0 +1,199 @@
+// Package database provides functions for preparing a PostgreSQL cluster: creating and dropping databases,
+// installing extensions, and checking and applying server settings, e.g. those logical replication needs.
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateOptions configures Create.
+type CreateOptions struct {
+	// Owner owns the database. Defaults to the current user.
+	Owner string
+	// Template is the database copied. Defaults to template1.
+	Template string
+	// Encoding is the database's character set, e.g. UTF8. Defaults to the template's.
+	Encoding string
+}
+
+// Exists reports whether a database exists.
+func Exists(ctx context.Context, conn pg.Conn, name string) (bool, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check database: %w", err)
+	}
+	return exists, nil
+}
+
+// Create creates a database if it doesn't exist, reporting whether it did. CREATE DATABASE can't run in a
+// transaction, so conn mustn't be a pgx.Tx.
+func Create(ctx context.Context, conn pg.Conn, name string, opts CreateOptions) (bool, error) {
+	exists, err := Exists(ctx, conn, name)
+	if err != nil || exists {
+		return false, err
+	}
+
+	query := "CREATE DATABASE " + pgx.Identifier{name}.Sanitize()
+	if opts.Owner != "" {
+		query += " OWNER " + pgx.Identifier{opts.Owner}.Sanitize()
+	}
+	if opts.Template != "" {
+		query += " TEMPLATE " + pgx.Identifier{opts.Template}.Sanitize()
+	}
+	if opts.Encoding != "" {
+		query += " ENCODING " + pg.QuoteLiteral(opts.Encoding)
+	}
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return false, fmt.Errorf("failed to create database: %w", err)
+	}
+	return true, nil
+}
+
+// Drop drops a database if it exists. With force, connections to it are terminated first, which requires
+// PostgreSQL 13; otherwise dropping a database in use fails.
+func Drop(ctx context.Context, conn pg.Conn, name string, force bool) error {
+	query := "DROP DATABASE IF EXISTS " + pgx.Identifier{name}.Sanitize()
+	if force {
+		query += " WITH (FORCE)"
+	}
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+	return nil
+}
+
+// CreateExtension installs an extension in the current database if it isn't installed, e.g. vector,
+// pg_trgm or postgis, in schema if given, installing the extensions it requires too.
+func CreateExtension(ctx context.Context, conn pg.Conn, name string, schema ...string) error {
+	query := "CREATE EXTENSION IF NOT EXISTS " + pgx.Identifier{name}.Sanitize()
+	if len(schema) > 0 && schema[0] != "" {
+		query += " SCHEMA " + pgx.Identifier{schema[0]}.Sanitize()
+	}
+	if _, err := conn.Exec(ctx, query+" CASCADE"); err != nil {
+		return fmt.Errorf("failed to create extension %s: %w", name, err)
+	}
+	return nil
+}
+
+// Extensions returns the versions of the extensions installed in the current database, by name.
+func Extensions(ctx context.Context, conn pg.Conn) (map[string]string, error) {
+	rows, err := conn.Query(ctx, `SELECT extname, extversion FROM pg_extension`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query extensions: %w", err)
+	}
+	defer rows.Close()
+
+	extensions := make(map[string]string)
+	for rows.Next() {
+		var name, version string
+		if err := rows.Scan(&name, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan extension: %w", err)
+		}
+		extensions[name] = version
+	}
+	return extensions, rows.Err()
+}
+
+// Requirement is a required value of a server setting.
+type Requirement struct {
+	// Setting is the setting's name, e.g. wal_level.
+	Setting string
+	// Value is the exact value required, e.g. logical.
+	Value string
+	// Min is the minimum value of numeric settings, used if Value is empty.
+	Min int64
+}
+
+// ReplicationRequirements are the settings logical replication, e.g. of pgo pipelines, needs to stream
+// from the server through up to slots replication slots.
+func ReplicationRequirements(slots int64) []Requirement {
+	return []Requirement{
+		{Setting: "wal_level", Value: "logical"},
+		{Setting: "max_replication_slots", Min: slots},
+		{Setting: "max_wal_senders", Min: slots},
+	}
+}
+
+// want returns the value applied to meet r.
+func (r Requirement) want() string {
+	if r.Value != "" {
+		return r.Value
+	}
+	return strconv.FormatInt(r.Min, 10)
+}
+
+// satisfiedBy reports whether current meets r.
+func (r Requirement) satisfiedBy(current string) bool {
+	if r.Value != "" {
+		return strings.EqualFold(current, r.Value)
+	}
+	n, err := strconv.ParseInt(current, 10, 64)
+	return err == nil && n >= r.Min
+}
+
+// Problem is a setting not meeting a requirement.
+type Problem struct {
+	Requirement
+	// Current is the setting's current value.
+	Current string
+	// Restart reports whether changing the setting takes a server restart.
+	Restart bool
+}
+
+func (p Problem) String() string {
+	if p.Value != "" {
+		return fmt.Sprintf("%s is %s, want %s", p.Setting, p.Current, p.Value)
+	}
+	return fmt.Sprintf("%s is %s, want at least %d", p.Setting, p.Current, p.Min)
+}
+
+// settingRe matches the names of settings, e.g. wal_level or pgrst.db_schemas.
+var settingRe = regexp.MustCompile(`^[A-Za-z_][\w.]*$`)
+
+// Check returns the settings not meeting requirements. Unknown settings are errors.
+func Check(ctx context.Context, conn pg.Conn, requirements ...Requirement) ([]Problem, error) {
+	var problems []Problem
+	for _, r := range requirements {
+		var current, settingContext string
+		err := conn.QueryRow(ctx, `SELECT setting, context FROM pg_settings WHERE name = $1`, r.Setting).Scan(&current, &settingContext)
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("unknown setting %s", r.Setting)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get setting %s: %w", r.Setting, err)
+		}
+		if !r.satisfiedBy(current) {
+			problems = append(problems, Problem{Requirement: r, Current: current, Restart: settingContext == "postmaster"})
+		}
+	}
+	return problems, nil
+}
+
+// Fix changes the settings of problems with ALTER SYSTEM and reloads the configuration, reporting whether
+// the server must be restarted for some changes to take effect. It requires a superuser, or the ALTER SYSTEM
+// privilege on the settings, and can't run in a transaction.
+func Fix(ctx context.Context, conn pg.Conn, problems []Problem) (restart bool, err error) {
+	if len(problems) == 0 {
+		return false, nil
+	}
+	for _, p := range problems {
+		if !settingRe.MatchString(p.Setting) {
+			return false, fmt.Errorf("invalid setting %q", p.Setting)
+		}
+		if _, err := conn.Exec(ctx, fmt.Sprintf("ALTER SYSTEM SET %s = %s", p.Setting, pg.QuoteLiteral(p.want()))); err != nil {
+			return false, fmt.Errorf("failed to set %s: %w", p.Setting, err)
+		}
+		restart = restart || p.Restart
+	}
+	if _, err := conn.Exec(ctx, "SELECT pg_reload_conf()"); err != nil {
+		return restart, fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	return restart, nil
+}
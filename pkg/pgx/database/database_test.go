@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestRequirementSatisfiedBy(t *testing.T) {
+	tests := []struct {
+		r       Requirement
+		current string
+		want    bool
+	}{
+		{Requirement{Setting: "wal_level", Value: "logical"}, "logical", true},
+		{Requirement{Setting: "wal_level", Value: "logical"}, "replica", false},
+		{Requirement{Setting: "max_replication_slots", Min: 10}, "10", true},
+		{Requirement{Setting: "max_replication_slots", Min: 10}, "4", false},
+		{Requirement{Setting: "max_replication_slots", Min: 10}, "", false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.satisfiedBy(tt.current); got != tt.want {
+			t.Errorf("%s %+v satisfied by %q = %v, want %v", tt.r.Setting, tt.r, tt.current, got, tt.want)
+		}
+	}
+
+	p := Problem{Requirement: Requirement{Setting: "max_wal_senders", Min: 10}, Current: "4"}
+	if got := p.String(); got != "max_wal_senders is 4, want at least 10" {
+		t.Errorf("unexpected problem description %q", got)
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("TEST_POSTGRES_CONN_STRING"))
+	if err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	const name = "pgo_database_test"
+	if err := Drop(ctx, conn, name, false); err != nil {
+		t.Fatal(err)
+	}
+	created, err := Create(ctx, conn, name, CreateOptions{Encoding: "UTF8"})
+	if err != nil || !created {
+		t.Fatalf("Create() = %v, %v", created, err)
+	}
+	if created, err := Create(ctx, conn, name, CreateOptions{}); err != nil || created {
+		t.Errorf("expected existing database to be kept, got %v, %v", created, err)
+	}
+	if err := Drop(ctx, conn, name, false); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := Exists(ctx, conn, name); err != nil || exists {
+		t.Errorf("Exists() = %v, %v after Drop", exists, err)
+	}
+
+	if err := CreateExtension(ctx, conn, "pg_trgm"); err != nil {
+		t.Fatal(err)
+	}
+	extensions, err := Extensions(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := extensions["pg_trgm"]; !ok {
+		t.Errorf("expected pg_trgm in %v", extensions)
+	}
+
+	if _, err := Check(ctx, conn, ReplicationRequirements(1)...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Check(ctx, conn, Requirement{Setting: "no_such_setting", Value: "on"}); err == nil {
+		t.Error("expected an unknown setting error")
+	}
+}
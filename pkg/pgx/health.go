@@ -0,0 +1,214 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultFailureThreshold    = 3
+)
+
+// PoolHealth is the state of a managed pool's primary as of its last health check.
+type PoolHealth struct {
+	Healthy   bool
+	LastCheck time.Time
+	LastError error
+	// Failures counts the consecutive failed checks.
+	Failures int
+	// FailedOver is true once the pool has been switched to its standby.
+	FailedOver bool
+}
+
+// poolMonitor periodically checks a managed pool, failing it over to its standby.
+type poolMonitor struct {
+	name      string
+	standby   string
+	promote   bool
+	interval  time.Duration
+	threshold int
+	cancel    context.CancelFunc
+
+	mu     sync.Mutex
+	health PoolHealth
+}
+
+// startMonitor starts health checks of the named pool, unless cfg disables them. m.mu must be held.
+func (m *PoolManager) startMonitor(cfg Pool) {
+	if cfg.HealthCheckInterval < 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	mon := &poolMonitor{
+		name:      cfg.Name,
+		standby:   cfg.Standby,
+		promote:   cfg.PromoteStandby,
+		interval:  cfg.HealthCheckInterval,
+		threshold: cfg.FailureThreshold,
+		cancel:    cancel,
+		health:    PoolHealth{Healthy: true, LastCheck: time.Now()}, // createPool pinged it
+	}
+	if mon.interval == 0 {
+		mon.interval = defaultHealthCheckInterval
+	}
+	if mon.threshold <= 0 {
+		mon.threshold = defaultFailureThreshold
+	}
+	m.monitors[cfg.Name] = mon
+	go m.monitor(ctx, mon)
+}
+
+func (m *PoolManager) monitor(ctx context.Context, mon *poolMonitor) {
+	ticker := time.NewTicker(mon.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.mu.RLock()
+		pool := m.pools[mon.name]
+		m.mu.RUnlock()
+		if pool == nil || ctx.Err() != nil {
+			return
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, mon.interval)
+		err := pool.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		mon.mu.Lock()
+		mon.health.LastCheck, mon.health.LastError, mon.health.Healthy = time.Now(), err, err == nil
+		if err == nil {
+			mon.health.Failures = 0
+		} else {
+			mon.health.Failures++
+			log.Printf("pgx: health check of pool %s failed (%d/%d): %v", mon.name, mon.health.Failures, mon.threshold, err)
+		}
+		failover := mon.health.Failures >= mon.threshold && mon.standby != ""
+		mon.mu.Unlock()
+
+		if failover {
+			if err := m.failover(ctx, mon, pool); err != nil {
+				log.Printf("pgx: failing over pool %s: %v", mon.name, err)
+			}
+		}
+	}
+}
+
+// failover replaces the failed primary of mon's pool with a pool connected to its standby, configured like
+// the failed pool, promoting the standby if it's still in recovery and mon.promote is set.
+func (m *PoolManager) failover(ctx context.Context, mon *poolMonitor, failed *pgxpool.Pool) error {
+	poolConfig, err := m.standbyConfig(failed, mon.standby)
+	if err != nil {
+		return err
+	}
+	standby, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return fmt.Errorf("creating standby pool: %w", err)
+	}
+	if err := standby.Ping(ctx); err != nil {
+		standby.Close()
+		return fmt.Errorf("connecting to standby: %w", err)
+	}
+
+	if mon.promote {
+		var inRecovery bool
+		if err := standby.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+			standby.Close()
+			return fmt.Errorf("checking standby: %w", err)
+		}
+		if inRecovery {
+			var promoted bool
+			if err := standby.QueryRow(ctx, "SELECT pg_promote(true, 60)").Scan(&promoted); err != nil || !promoted {
+				standby.Close()
+				return fmt.Errorf("promoting standby: promoted=%t: %v", promoted, err)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	if ctx.Err() != nil || m.pools[mon.name] != failed {
+		m.mu.Unlock()
+		standby.Close() // removed or replaced meanwhile
+		return nil
+	}
+	m.pools[mon.name] = standby
+	// role pools connect to the failed primary; requests of their roles use the standby's pool instead
+	roles := m.roles[mon.name]
+	delete(m.roles, mon.name)
+	m.mu.Unlock()
+
+	mon.mu.Lock()
+	mon.standby = "" // a failed over pool has no standby left
+	mon.health = PoolHealth{Healthy: true, LastCheck: time.Now(), FailedOver: true}
+	mon.mu.Unlock()
+
+	log.Printf("pgx: pool %s failed over to its standby", mon.name)
+	// waits for connections acquired from the failed primary to be released
+	go failed.Close()
+	go closePools(roles)
+	return nil
+}
+
+// standbyConfig returns a copy of the config of the failed pool connecting to the standby at connString
+// instead, keeping its pool size, hooks and tracer. TLS settings are the standby's, with the manager's
+// certificates, if any.
+func (m *PoolManager) standbyConfig(failed *pgxpool.Pool, connString string) (*pgxpool.Config, error) {
+	poolConfig := failed.Config()
+	if err := retarget(poolConfig, connString); err != nil {
+		return nil, fmt.Errorf("parsing standby connection string: %w", err)
+	}
+	if m.tls != nil {
+		m.tls.Configure(poolConfig)
+	}
+	return poolConfig, nil
+}
+
+// retarget points poolConfig at the server of connString, taking its host, database, credentials, TLS settings
+// and runtime parameters and keeping the rest of poolConfig.
+func retarget(poolConfig *pgxpool.Config, connString string) error {
+	target, err := pgconn.ParseConfig(connString)
+	if err != nil {
+		return err
+	}
+	conn := &poolConfig.ConnConfig.Config
+	conn.Host, conn.Port, conn.Database = target.Host, target.Port, target.Database
+	conn.User, conn.Password = target.User, target.Password
+	conn.TLSConfig, conn.Fallbacks, conn.ValidateConnect = target.TLSConfig, target.Fallbacks, target.ValidateConnect
+	for key, value := range target.RuntimeParams {
+		conn.RuntimeParams[key] = value
+	}
+	return nil
+}
+
+// Health returns the state of the named pool's primary as of its last health check.
+func (m *PoolManager) Health(name string) (PoolHealth, error) {
+	m.mu.RLock()
+	_, ok := m.pools[name]
+	mon := m.monitors[name]
+	m.mu.RUnlock()
+
+	if !ok {
+		return PoolHealth{}, ErrPoolNotFound
+	}
+	if mon == nil {
+		return PoolHealth{}, fmt.Errorf("pgx: health checks of pool %q are disabled", name)
+	}
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	return mon.health, nil
+}
@@ -0,0 +1,111 @@
+package pgx
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/edgeflare/pgo/pkg/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector exposes the Stat() of the pools of every PoolManager in metrics.Registry, labeled by pool
+// name and instance, "primary", "replica-<n>" or "role-<role>".
+type poolCollector struct {
+	mu       sync.Mutex
+	managers map[*PoolManager]struct{}
+}
+
+var (
+	poolMetricsOnce sync.Once
+	poolStats       = &poolCollector{managers: make(map[*PoolManager]struct{})}
+
+	poolLabels           = []string{"pool", "instance"}
+	poolAcquiredConns    = poolDesc("acquired_connections", "Number of connections acquired from the pool.")
+	poolIdleConns        = poolDesc("idle_connections", "Number of idle connections in the pool.")
+	poolTotalConns       = poolDesc("connections", "Number of connections in the pool.")
+	poolMaxConns         = poolDesc("max_connections", "Maximum number of connections of the pool.")
+	poolAcquires         = poolDesc("acquires_total", "Number of connections acquired from the pool.")
+	poolEmptyAcquires    = poolDesc("empty_acquires_total", "Number of acquires waiting for a connection as the pool had none idle.")
+	poolCanceledAcquires = poolDesc("canceled_acquires_total", "Number of acquires canceled by their context.")
+	poolAcquireDuration  = poolDesc("acquire_wait_seconds_total", "Time spent acquiring connections from the pool.")
+	poolUp               = poolDesc("up", "Whether the last health check of the pool's primary succeeded.")
+)
+
+func poolDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "pool", name), help, poolLabels, nil)
+}
+
+// register adds m's pools to the metrics, registering the collector on first use.
+func (c *poolCollector) register(m *PoolManager) {
+	poolMetricsOnce.Do(func() { metrics.MustRegister(c) })
+	c.mu.Lock()
+	c.managers[m] = struct{}{}
+	c.mu.Unlock()
+}
+
+func (c *poolCollector) unregister(m *PoolManager) {
+	c.mu.Lock()
+	delete(c.managers, m)
+	c.mu.Unlock()
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		poolAcquiredConns, poolIdleConns, poolTotalConns, poolMaxConns,
+		poolAcquires, poolEmptyAcquires, poolCanceledAcquires, poolAcquireDuration, poolUp,
+	} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	managers := make([]*PoolManager, 0, len(c.managers))
+	for m := range c.managers {
+		managers = append(managers, m)
+	}
+	c.mu.Unlock()
+
+	for _, m := range managers {
+		m.mu.RLock()
+		for name, pool := range m.pools {
+			collectPool(ch, pool.Stat(), name, "primary")
+			if mon, ok := m.monitors[name]; ok {
+				mon.mu.Lock()
+				up := 0.0
+				if mon.health.Healthy {
+					up = 1
+				}
+				mon.mu.Unlock()
+				ch <- prometheus.MustNewConstMetric(poolUp, prometheus.GaugeValue, up, name, "primary")
+			}
+			if set, ok := m.replicas[name]; ok {
+				for i, r := range set.replicas {
+					collectPool(ch, r.pool.Stat(), name, fmt.Sprintf("replica-%d", i))
+				}
+			}
+			for role, pool := range m.roles[name] {
+				collectPool(ch, pool.Stat(), name, "role-"+role)
+			}
+		}
+		m.mu.RUnlock()
+	}
+}
+
+func collectPool(ch chan<- prometheus.Metric, s *pgxpool.Stat, labels ...string) {
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v, labels...)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, labels...)
+	}
+	gauge(poolAcquiredConns, float64(s.AcquiredConns()))
+	gauge(poolIdleConns, float64(s.IdleConns()))
+	gauge(poolTotalConns, float64(s.TotalConns()))
+	gauge(poolMaxConns, float64(s.MaxConns()))
+	counter(poolAcquires, float64(s.AcquireCount()))
+	counter(poolEmptyAcquires, float64(s.EmptyAcquireCount()))
+	counter(poolCanceledAcquires, float64(s.CanceledAcquireCount()))
+	counter(poolAcquireDuration, s.AcquireDuration().Seconds())
+}
@@ -0,0 +1,295 @@
+// Package migrate applies versioned SQL migrations, e.g. embedded with embed.FS, recording them in a table
+// so each is applied once. Concurrent migrators, e.g. replicas of a starting application, are serialized
+// with an advisory lock.
+//
+// Migrations are files named <version>_<name>.up.sql, with optional <version>_<name>.down.sql files
+// reverting them, e.g. 0001_create_users.up.sql. Versions are positive integers, applied in ascending order.
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	m, err := migrate.New(pool, migrations, migrate.Config{Dir: "migrations"})
+//	...
+//	applied, err := m.Up(ctx, 0)
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Config holds the configuration for New.
+type Config struct {
+	// Dir is the directory of the migrations in the file system. Defaults to its root.
+	Dir string
+	// Table records the applied migrations. It is created if it doesn't exist. Defaults to schema_migrations.
+	Table string
+}
+
+// Migration is a versioned SQL migration.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down reverts Up. It's empty if the migration can't be reverted.
+	Down string
+}
+
+// Status is the state of a migration.
+type Status struct {
+	Migration
+	// AppliedAt is when the migration was applied, or nil if it's pending.
+	AppliedAt *time.Time
+	// Missing is true for applied migrations without files, e.g. deleted or from another branch. Only their
+	// Version and Name are set.
+	Missing bool
+}
+
+// All is the steps of Up and Down applying or reverting all migrations.
+const All = -1
+
+// ErrNoDown is returned by Down for migrations without a down file.
+var ErrNoDown = errors.New("migration can't be reverted")
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	table      string
+	lockID     int64
+	migrations []Migration
+}
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// New reads the migrations in fsys.
+func New(pool *pgxpool.Pool, fsys fs.FS, cfg Config) (*Migrator, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = "."
+	}
+	if cfg.Table == "" {
+		cfg.Table = "schema_migrations"
+	}
+
+	entries, err := fs.ReadDir(fsys, cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", e.Name())
+		}
+		sql, err := fs.ReadFile(fsys, path.Join(cfg.Dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	mg := &Migrator{pool: pool, table: pgx.Identifier{cfg.Table}.Sanitize()}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		mg.migrations = append(mg.migrations, *m)
+	}
+	slices.SortFunc(mg.migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+
+	h := fnv.New64a()
+	h.Write([]byte("pgo/migrate:" + cfg.Table))
+	mg.lockID = int64(h.Sum64())
+	return mg, nil
+}
+
+// Migrations returns the migrations, in ascending order of version.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Up applies up to steps pending migrations, or all of them if steps is 0 or All, returning those applied.
+// Each migration is applied in a transaction with its record, so a failed one leaves no trace.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (version, name) VALUES ($1, $2)`, m.table), mig.Version, mig.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts up to steps applied migrations, latest first, returning those reverted: one if steps is 0, all
+// of them if it's All. It stops at migrations without a down file, returning ErrNoDown.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps == 0 {
+		steps = 1
+	}
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		done, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range slices.Backward(m.migrations) {
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, ErrNoDown)
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, m.table), mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns the state of every migration, and of applied migrations without files, in ascending order
+// of version. It only reads the database: it neither takes the lock nor creates the migration table.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, m.table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	done := make(map[int64]appliedMigration)
+	if exists {
+		if done, err = m.applied(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []Status
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if a, ok := done[mig.Version]; ok {
+			s.AppliedAt = &a.at
+			delete(done, mig.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range done {
+		statuses = append(statuses, Status{Migration: Migration{Version: version, Name: a.name}, AppliedAt: &a.at, Missing: true})
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
+
+// withLock runs fn on a connection holding the migrator's advisory lock, after creating the migration table.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, m.lockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, m.lockID)
+
+	_, err = conn.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`, m.table))
+	if err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+	return fn(conn)
+}
+
+// appliedMigration is the record of an applied migration.
+type appliedMigration struct {
+	name string
+	at   time.Time
+}
+
+// applied returns the applied migrations by version.
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf(`SELECT version, name, applied_at FROM %s`, m.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.at); err != nil {
+			return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,110 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestNew(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email text")},
+		"migrations/0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP email")},
+		"migrations/0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id int)")},
+		"migrations/0010_seed.up.sql":           {Data: []byte("INSERT INTO users VALUES (1)")},
+		"migrations/README.md":                  {Data: []byte("ignored")},
+		"migrations/0003_orphan_down.down.sql":  {Data: []byte("SELECT 1")},
+		"migrations/0004_not_a_migration.sql":   {Data: []byte("ignored")},
+		"migrations/nested/0005_ignored.up.sql": {Data: []byte("ignored")},
+	}
+	if _, err := New(nil, fsys, Config{Dir: "migrations"}); err == nil {
+		t.Fatal("expected an error for a migration without an up file")
+	}
+
+	delete(fsys, "migrations/0003_orphan_down.down.sql")
+	m, err := New(nil, fsys, Config{Dir: "migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, mig := range m.Migrations() {
+		versions = append(versions, mig.Version)
+	}
+	if len(versions) != 3 || versions[0] != 1 || versions[1] != 2 || versions[2] != 10 {
+		t.Fatalf("versions = %v", versions)
+	}
+	if m.Migrations()[1].Down == "" || m.Migrations()[2].Down != "" {
+		t.Error("down migrations not read")
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, os.Getenv("TEST_DATABASE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if err := pool.Ping(ctx); err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+
+	fsys := fstest.MapFS{
+		"1_create.up.sql":   {Data: []byte("CREATE TABLE migrate_test (id int)")},
+		"1_create.down.sql": {Data: []byte("DROP TABLE migrate_test")},
+		"2_alter.up.sql":    {Data: []byte("ALTER TABLE migrate_test ADD name text")},
+		"2_alter.down.sql":  {Data: []byte("ALTER TABLE migrate_test DROP name")},
+	}
+	m, err := New(pool, fsys, Config{Table: "migrate_test_migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), "DROP TABLE IF EXISTS migrate_test, migrate_test_migrations")
+	})
+
+	// Status doesn't create the migration table
+	if statuses, err := m.Status(ctx); err != nil || len(statuses) != 2 || statuses[0].AppliedAt != nil {
+		t.Fatalf("Status() = %v, %v", statuses, err)
+	}
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('migrate_test_migrations') IS NOT NULL`).Scan(&exists); err != nil || exists {
+		t.Fatalf("migration table created by Status: %v, %v", exists, err)
+	}
+
+	if applied, err := m.Up(ctx, 1); err != nil || len(applied) != 1 {
+		t.Fatalf("Up(1) = %v, %v", applied, err)
+	}
+	if applied, err := m.Up(ctx, 0); err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("Up(0) = %v, %v", applied, err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 2 || statuses[1].AppliedAt == nil {
+		t.Fatalf("Status() = %v, %v", statuses, err)
+	}
+
+	// applied migrations whose files are gone are reported
+	delete(fsys, "2_alter.up.sql")
+	delete(fsys, "2_alter.down.sql")
+	partial, err := New(pool, fsys, Config{Table: "migrate_test_migrations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err = partial.Status(ctx)
+	if err != nil || len(statuses) != 2 || !statuses[1].Missing || statuses[1].Name != "alter" || statuses[1].AppliedAt == nil {
+		t.Fatalf("Status() = %v, %v", statuses, err)
+	}
+
+	if reverted, err := m.Down(ctx, 0); err != nil || len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("Down(0) = %v, %v", reverted, err)
+	}
+	if reverted, err := m.Down(ctx, All); err != nil || len(reverted) != 1 || reverted[0].Version != 1 {
+		t.Fatalf("Down(All) = %v, %v", reverted, err)
+	}
+}
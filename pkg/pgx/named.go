@@ -0,0 +1,153 @@
+package pgx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Named rewrites the :name and @name parameters of a query to positional $n parameters, returning the
+// arguments in order, e.g. for
+//
+//	sql, args, err := pgx.Named(`SELECT * FROM users WHERE org = :org AND created_at > :since`, map[string]any{
+//		"org":   org,
+//		"since": since,
+//	})
+//	rows, err := pool.Query(ctx, sql, args...)
+//
+// A parameter used several times is passed once. Parameters missing from args, and args not used by the
+// query, are errors, catching typos either side. Names are letters, digits and underscores, not starting
+// with a digit, and directly follow the colon or at sign. String literals, including escape strings (E'...'),
+// quoted identifiers, comments and casts (::type) are left alone, as are operators containing @, e.g. @> or @@.
+func Named(sql string, args map[string]any) (string, []any, error) {
+	var b strings.Builder
+	var names []string
+	b.Grow(len(sql))
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := closingQuote(sql, i+1, c, false)
+			b.WriteString(sql[i:end])
+			i = end
+		case (c == 'E' || c == 'e') && strings.HasPrefix(sql[i+1:], "'") && (i == 0 || !isNameChar(sql[i-1])):
+			// escape string, e.g. E'it\'s'
+			end := closingQuote(sql, i+2, '\'', true)
+			b.WriteString(sql[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			b.WriteString(sql[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i
+			} else {
+				end += 4
+			}
+			b.WriteString(sql[i : i+end])
+			i += end
+		case c == '$' && dollarTag(sql[i:]) != "":
+			tag := dollarTag(sql[i:])
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				end = len(sql) - i
+			} else {
+				end += 2 * len(tag)
+			}
+			b.WriteString(sql[i : i+end])
+			i += end
+		case c == ':' && strings.HasPrefix(sql[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == '@' && i > 0 && isOperatorChar(sql[i-1]):
+			// part of an operator, e.g. @@ or <@
+			b.WriteByte(c)
+			i++
+		case (c == ':' || c == '@') && i+1 < len(sql) && isNameStart(sql[i+1]):
+			end := i + 2
+			for end < len(sql) && isNameChar(sql[end]) {
+				end++
+			}
+			name := sql[i+1 : end]
+			if _, ok := args[name]; !ok {
+				return "", nil, fmt.Errorf("missing argument for parameter %q", name)
+			}
+			n := slices.Index(names, name)
+			if n < 0 {
+				names = append(names, name)
+				n = len(names) - 1
+			}
+			fmt.Fprintf(&b, "$%d", n+1)
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	if len(names) < len(args) {
+		for name := range args {
+			if !slices.Contains(names, name) {
+				return "", nil, fmt.Errorf("argument %q isn't a parameter of the query", name)
+			}
+		}
+	}
+	positional := make([]any, len(names))
+	for i, name := range names {
+		positional[i] = args[name]
+	}
+	return b.String(), positional, nil
+}
+
+// closingQuote returns the index after the quote closing a literal or identifier starting at i. Doubled
+// quotes are escaped quotes, as are quotes after a backslash if backslashes is set, for escape strings.
+func closingQuote(sql string, i int, quote byte, backslashes bool) int {
+	for i < len(sql) {
+		if backslashes && sql[i] == '\\' {
+			i += 2
+			continue
+		}
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(sql)
+}
+
+// dollarTag returns the tag opening a dollar-quoted string at the start of s, e.g. $$ or $body$, or "" if
+// there's none, e.g. for a $1 parameter.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1]
+		case !isNameChar(s[i]) || (i == 1 && !isNameStart(s[i])):
+			return ""
+		}
+	}
+	return ""
+}
+
+// isOperatorChar reports whether c may be part of an operator.
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("+-*/<>=~!@#%^&|`?", c) >= 0
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
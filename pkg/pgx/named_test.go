@@ -0,0 +1,92 @@
+package pgx
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNamed(t *testing.T) {
+	tests := []struct {
+		name     string
+		sql      string
+		args     map[string]any
+		wantSQL  string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{
+			name:     "colon and at",
+			sql:      "SELECT * FROM users WHERE org = :org AND name = @name",
+			args:     map[string]any{"org": 1, "name": "a"},
+			wantSQL:  "SELECT * FROM users WHERE org = $1 AND name = $2",
+			wantArgs: []any{1, "a"},
+		},
+		{
+			name:     "repeated parameter",
+			sql:      "SELECT :id::int8, :id, :other",
+			args:     map[string]any{"id": 1, "other": 2},
+			wantSQL:  "SELECT $1::int8, $1, $2",
+			wantArgs: []any{1, 2},
+		},
+		{
+			name:     "literals, identifiers and comments",
+			sql:      "SELECT ':no', 'it''s :no', \":no\", $$:no$$, $f$:no$f$ -- :no\n, /* :no */ :yes, tags @> '{}'",
+			args:     map[string]any{"yes": true},
+			wantSQL:  "SELECT ':no', 'it''s :no', \":no\", $$:no$$, $f$:no$f$ -- :no\n, /* :no */ $1, tags @> '{}'",
+			wantArgs: []any{true},
+		},
+		{
+			name:     "escape strings",
+			sql:      `SELECT E'it\'s :no', e'\\', :yes`,
+			args:     map[string]any{"yes": true},
+			wantSQL:  `SELECT E'it\'s :no', e'\\', $1`,
+			wantArgs: []any{true},
+		},
+		{
+			name:     "operators with at signs",
+			sql:      "SELECT tsv @@to_tsquery(:q), ids <@array[@id], tags @>'{}', @ abs",
+			args:     map[string]any{"q": "a", "id": 1},
+			wantSQL:  "SELECT tsv @@to_tsquery($1), ids <@array[$2], tags @>'{}', @ abs",
+			wantArgs: []any{"a", 1},
+		},
+		{
+			name:     "positional parameters",
+			sql:      "SELECT $1",
+			wantSQL:  "SELECT $1",
+			wantArgs: []any{},
+		},
+		{
+			name:    "missing argument",
+			sql:     "SELECT :id",
+			args:    map[string]any{},
+			wantErr: true,
+		},
+		{
+			name:    "unused argument",
+			sql:     "SELECT :id",
+			args:    map[string]any{"id": 1, "typo": 2},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := Named(tt.sql, tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", sql)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("got SQL %q, want %q", sql, tt.wantSQL)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("got args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
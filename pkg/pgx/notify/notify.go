@@ -0,0 +1,165 @@
+// Package notify dispatches PostgreSQL notifications, sent with NOTIFY or pg_notify, to handlers of their
+// channels. A Listener holds one connection listening on every channel, reconnecting and listening again
+// with backoff when the connection is lost.
+//
+//	l := notify.NewListener(pool, notify.Config{})
+//	l.Handle("orders", notify.JSON(func(ctx context.Context, order Order) error {
+//		...
+//	}))
+//	l.Start(ctx)
+//	defer l.Close()
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Handler handles a notification. Errors are logged.
+type Handler func(ctx context.Context, n *pgconn.Notification) error
+
+// JSON returns a Handler decoding JSON payloads into T before calling fn.
+func JSON[T any](fn func(ctx context.Context, payload T) error) Handler {
+	return func(ctx context.Context, n *pgconn.Notification) error {
+		var payload T
+		if err := json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+			return fmt.Errorf("failed to decode payload: %w", err)
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// Config holds the configuration for NewListener.
+type Config struct {
+	// OnConnect is called after listening on a new connection, including the first. Notifications sent while
+	// the listener was disconnected are lost, so it typically reloads whatever the notifications invalidate.
+	// Errors fail the connection, which is retried.
+	OnConnect func(ctx context.Context) error
+}
+
+// Listener listens on channels, calling their handlers in the order notifications arrive.
+type Listener struct {
+	pool *pgxpool.Pool
+	cfg  Config
+
+	mu       sync.Mutex
+	handlers map[string][]Handler
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewListener returns a Listener acquiring its connection from pool.
+func NewListener(pool *pgxpool.Pool, cfg Config) *Listener {
+	return &Listener{pool: pool, cfg: cfg, handlers: make(map[string][]Handler)}
+}
+
+// Handle adds a handler of notifications on channel. Handlers must be added before Start.
+func (l *Listener) Handle(channel string, h Handler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.handlers[channel] = append(l.handlers[channel], h)
+}
+
+// Start listens in the background until ctx is done or Close is called.
+func (l *Listener) Start(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done != nil {
+		return
+	}
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+	go func() {
+		defer close(l.done)
+		l.listen(ctx)
+	}()
+}
+
+// Close stops listening, waiting for a running handler to return.
+func (l *Listener) Close() {
+	l.mu.Lock()
+	cancel, done := l.cancel, l.done
+	l.mu.Unlock()
+	if done == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Channels returns the channels listened on, sorted.
+func (l *Listener) Channels() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Sorted(maps.Keys(l.handlers))
+}
+
+// listen listens until ctx is done, reconnecting with backoff.
+func (l *Listener) listen(ctx context.Context) {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+	for ctx.Err() == nil {
+		err := l.listenOnce(ctx, b)
+		if ctx.Err() != nil {
+			return
+		}
+		wait := b.NextBackOff()
+		log.Printf("Listener on %v failed, retrying in %s: %v", l.Channels(), wait, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (l *Listener) listenOnce(ctx context.Context, b backoff.BackOff) error {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// the connection may still be listening, so don't return it to the pool
+	defer conn.Hijack().Close(context.Background())
+
+	for _, channel := range l.Channels() {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+	}
+	if l.cfg.OnConnect != nil {
+		if err := l.cfg.OnConnect(ctx); err != nil {
+			return err
+		}
+	}
+	b.Reset()
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		l.dispatch(ctx, n)
+	}
+}
+
+// dispatch calls the handlers of n's channel.
+func (l *Listener) dispatch(ctx context.Context, n *pgconn.Notification) {
+	l.mu.Lock()
+	handlers := l.handlers[n.Channel]
+	l.mu.Unlock()
+	for _, h := range handlers {
+		if err := h(ctx, n); err != nil {
+			log.Printf("Failed to handle notification on %s: %v", n.Channel, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestDispatch(t *testing.T) {
+	type event struct {
+		ID int `json:"id"`
+	}
+	var got []int
+	l := NewListener(nil, Config{})
+	l.Handle("events", JSON(func(ctx context.Context, e event) error {
+		got = append(got, e.ID)
+		return nil
+	}))
+	l.Handle("other", func(ctx context.Context, n *pgconn.Notification) error {
+		t.Errorf("unexpected notification on %s", n.Channel)
+		return nil
+	})
+
+	ctx := context.Background()
+	l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `{"id": 1}`})
+	l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `not json`})
+	l.dispatch(ctx, &pgconn.Notification{Channel: "events", Payload: `{"id": 2}`})
+	l.dispatch(ctx, &pgconn.Notification{Channel: "unknown", Payload: `{"id": 3}`})
+
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("expected events 1 and 2, got %v", got)
+	}
+	if channels := l.Channels(); !slices.Equal(channels, []string{"events", "other"}) {
+		t.Errorf("unexpected channels %v", channels)
+	}
+}
+
+func TestListener(t *testing.T) {
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, os.Getenv("TEST_POSTGRES_CONN_STRING"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if err := pool.Ping(ctx); err != nil {
+		t.Skipf("failed to connect to database: %v", err)
+	}
+
+	payloads := make(chan string, 1)
+	connected := make(chan struct{}, 1)
+	l := NewListener(pool, Config{OnConnect: func(ctx context.Context) error {
+		connected <- struct{}{}
+		return nil
+	}})
+	l.Handle("pgo_notify_test", func(ctx context.Context, n *pgconn.Notification) error {
+		payloads <- n.Payload
+		return nil
+	})
+	l.Start(ctx)
+	defer l.Close()
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't connect")
+	}
+	if _, err := pool.Exec(ctx, "SELECT pg_notify('pgo_notify_test', 'hello')"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-payloads:
+		if p != "hello" {
+			t.Errorf("expected payload hello, got %q", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+
+	l.Close()
+	if _, err := pool.Exec(ctx, "SELECT pg_notify('pgo_notify_test', 'after close')"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-payloads:
+		t.Errorf("unexpected notification %q after Close", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
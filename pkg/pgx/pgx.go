@@ -3,6 +3,7 @@ package pgx
 
 import (
 	"context"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -32,3 +33,14 @@ type Conn interface {
 	// the context only affects the begin command. i.e. there is no auto-rollback on context cancellation.
 	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
 }
+
+// QuoteLiteral quotes s as a SQL string literal, for statements that can't take parameters, e.g. ALTER ROLE
+// ... PASSWORD or the body of a function. Strings containing backslashes are quoted as escape strings, so they
+// read the same whatever standard_conforming_strings is.
+func QuoteLiteral(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if strings.Contains(s, `\`) {
+		return `E'` + strings.ReplaceAll(s, `\`, `\\`) + "'"
+	}
+	return "'" + s + "'"
+}
@@ -55,3 +55,14 @@ func NewTestRunner(t testing.TB) *TestRunner {
 		t:    t,
 	}
 }
+
+func TestQuoteLiteral(t *testing.T) {
+	for s, want := range map[string]string{
+		"plain":    `'plain'`,
+		"it's":     `'it''s'`,
+		`a\b`:      `E'a\\b'`,
+		`it's\'; `: `E'it''s\\''; '`,
+	} {
+		require.Equal(t, want, QuoteLiteral(s), "QuoteLiteral(%q)", s)
+	}
+}
@@ -5,15 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// PoolManager manages one or more named *pgxpool.Pool's.
+// PoolManager manages one or more named *pgxpool.Pool's. It checks the health of pools periodically,
+// failing them over to their standby, and exposes their statistics in metrics.Registry.
 type PoolManager struct {
-	mu     sync.RWMutex
-	pools  map[string]*pgxpool.Pool
-	active string
+	mu       sync.RWMutex
+	pools    map[string]*pgxpool.Pool
+	replicas map[string]*replicaSet
+	monitors map[string]*poolMonitor
+	roles    map[string]map[string]*pgxpool.Pool // pools of roles, by pool name then role
+	active   string
+	tracer   pgx.QueryTracer // traces queries of every pool, if set
+	tls      *TLSCerts       // secures connections of every pool, if set
 }
 
 // Pool represents a named connection configuration.
@@ -21,6 +32,37 @@ type Pool struct {
 	Name       string
 	ConnString string          // Used if Config is nil
 	Config     *pgxpool.Config // Takes precedence over ConnString
+	// Replicas are connection strings of read replicas of the pool, serving queries run on Reader pools.
+	Replicas []string
+	// Balancing selects the replica serving a Reader call. Defaults to RoundRobin.
+	Balancing Balancing
+	// MaxReplicaLag excludes replicas replaying WAL further behind the primary, or unreachable, until they
+	// catch up. Zero disables lag checks.
+	MaxReplicaLag time.Duration
+	// Standby is the connection string of a standby the pool fails over to after FailureThreshold
+	// consecutive failed health checks, with the pool's settings. Get the pool from the PoolManager when
+	// it's used, rather than keeping it, to follow failovers.
+	Standby string
+	// PromoteStandby promotes the standby with pg_promote on failover if it's in recovery. Leave it off when
+	// a cluster manager, e.g. Patroni, promotes standbys: a primary only unreachable from this process may
+	// still be serving others, and promoting its standby splits the cluster.
+	PromoteStandby bool
+	// HealthCheckInterval is how often the primary is pinged. Defaults to 10s; negative disables checks.
+	HealthCheckInterval time.Duration
+	// FailureThreshold is the number of consecutive failed checks failing the pool over. Defaults to 3.
+	FailureThreshold int
+	// TransactionPooling configures the pool for a transaction-mode pooler such as PgBouncer, which may run
+	// each transaction on a different server connection (see TransactionPoolingMode). Session state doesn't
+	// carry over between transactions then: use middleware.PostgresTx, which sets roles and claims with
+	// SET LOCAL, rather than middleware.Postgres, and connect LISTEN-based components, e.g. schema.Cache,
+	// directly or through a session-mode pool.
+	TransactionPooling bool
+	// RolePools maps roles to the size of a pool of their own, whose connections switch to the role once, when
+	// they connect (see PresetRole), so requests of high-traffic roles skip SET ROLE. Get them with ForRole.
+	// They connect like the pool, in addition to its connections, so the total is bounded by the pool's
+	// MaxConns plus their sizes. They're closed on failover, after which requests of their roles use the pool.
+	// They can't be combined with TransactionPooling, which doesn't keep session roles.
+	RolePools map[string]int32
 }
 
 var (
@@ -31,9 +73,51 @@ var (
 	// once                 sync.Once
 )
 
+// PoolManagerOption configures a PoolManager.
+type PoolManagerOption func(*PoolManager)
+
+// WithQueryTracer traces the queries of every pool the manager creates, including replicas and standbys,
+// with tracers, e.g. a Tracer recording spans and a query logger (see NewQueryLogger). Components given these
+// pools, e.g. schema.Cache and the HTTP middleware, are traced too. Tracers set in a Pool's Config are kept.
+func WithQueryTracer(tracers ...pgx.QueryTracer) PoolManagerOption {
+	return func(m *PoolManager) {
+		switch len(tracers) {
+		case 0:
+		case 1:
+			m.tracer = tracers[0]
+		default:
+			m.tracer = multitracer.New(tracers...)
+		}
+	}
+}
+
+// WithTLS secures the connections of every pool the manager creates, including replicas, standbys and role
+// pools, with certs, whatever the sslmode of their connection strings. Certificates reloaded by certs.Watch
+// are used by new connections of all pools:
+//
+//	certs, err := pgx.LoadTLS(pgx.TLSOptions{CAFile: "/etc/pgo/tls/ca.crt", CertFile: "/etc/pgo/tls/tls.crt", KeyFile: "/etc/pgo/tls/tls.key"})
+//	...
+//	go certs.Watch(ctx, time.Minute)
+//	manager := pgx.NewPoolManager(pgx.WithTLS(certs))
+func WithTLS(certs *TLSCerts) PoolManagerOption {
+	return func(m *PoolManager) {
+		m.tls = certs
+	}
+}
+
 // NewPoolManager returns a new connection manager.
-func NewPoolManager() *PoolManager {
-	return &PoolManager{pools: make(map[string]*pgxpool.Pool)}
+func NewPoolManager(opts ...PoolManagerOption) *PoolManager {
+	m := &PoolManager{
+		pools:    make(map[string]*pgxpool.Pool),
+		replicas: make(map[string]*replicaSet),
+		monitors: make(map[string]*poolMonitor),
+		roles:    make(map[string]map[string]*pgxpool.Pool),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	poolStats.register(m)
+	return m
 }
 
 // Add creates and adds a new connection pool. If `setActive=true` the connection is set as active/default connection
@@ -44,13 +128,44 @@ func (m *PoolManager) Add(ctx context.Context, cfg Pool, setActive ...bool) erro
 	if _, ok := m.pools[cfg.Name]; ok {
 		return ErrPoolAlreadyExists
 	}
+	if cfg.TransactionPooling && len(cfg.RolePools) > 0 {
+		return errors.New("pgx: role pools require session pooling")
+	}
+	roleCfg := cfg
+	if cfg.Config != nil {
+		// before the pool's settings are applied to cfg.Config
+		roleCfg.Config = cfg.Config.Copy()
+	}
 
 	pool, err := m.createPool(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("pgx: %w", err)
 	}
 
+	if len(cfg.Replicas) > 0 {
+		set, err := m.newReplicaSet(ctx, cfg)
+		if err != nil {
+			pool.Close()
+			return fmt.Errorf("pgx: %w", err)
+		}
+		m.replicas[cfg.Name] = set
+	}
+
+	if len(cfg.RolePools) > 0 {
+		roles, err := m.createRolePools(ctx, roleCfg)
+		if err != nil {
+			pool.Close()
+			if set, ok := m.replicas[cfg.Name]; ok {
+				set.close()
+				delete(m.replicas, cfg.Name)
+			}
+			return fmt.Errorf("pgx: %w", err)
+		}
+		m.roles[cfg.Name] = roles
+	}
+
 	m.pools[cfg.Name] = pool
+	m.startMonitor(cfg)
 
 	// Check if `setActive` is provided and set to true
 	if len(setActive) > 0 && setActive[0] {
@@ -62,7 +177,7 @@ func (m *PoolManager) Add(ctx context.Context, cfg Pool, setActive ...bool) erro
 	return nil
 }
 
-// Get returns a connection pool by name.
+// Get returns a connection pool by name. It connects to the primary, if the pool has replicas.
 func (m *PoolManager) Get(name string) (*pgxpool.Pool, error) {
 	m.mu.RLock()
 	pool, ok := m.pools[name]
@@ -74,6 +189,22 @@ func (m *PoolManager) Get(name string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
+// ForRole returns the named pool's pool of role, with preset true, if it has one (see Pool.RolePools), and
+// otherwise the pool itself, whose connections must be switched to role, e.g. with SET ROLE.
+func (m *PoolManager) ForRole(name, role string) (pool *pgxpool.Pool, preset bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if pool, ok := m.roles[name][role]; ok {
+		return pool, true, nil
+	}
+	pool, ok := m.pools[name]
+	if !ok {
+		return nil, false, ErrPoolNotFound
+	}
+	return pool, false, nil
+}
+
 // Active returns the current active connection pool.
 func (m *PoolManager) Active() (*pgxpool.Pool, error) {
 	m.mu.RLock()
@@ -109,6 +240,16 @@ func (m *PoolManager) Remove(name string) error {
 
 	pool.Close()
 	delete(m.pools, name)
+	if set, ok := m.replicas[name]; ok {
+		set.close()
+		delete(m.replicas, name)
+	}
+	closePools(m.roles[name])
+	delete(m.roles, name)
+	if mon, ok := m.monitors[name]; ok {
+		mon.cancel()
+		delete(m.monitors, name)
+	}
 
 	if m.active == name {
 		m.active = ""
@@ -128,7 +269,20 @@ func (m *PoolManager) Close() {
 	for _, p := range m.pools {
 		p.Close()
 	}
+	for _, set := range m.replicas {
+		set.close()
+	}
+	for _, roles := range m.roles {
+		closePools(roles)
+	}
+	for _, mon := range m.monitors {
+		mon.cancel()
+	}
+	poolStats.unregister(m)
 	m.pools = nil
+	m.replicas = nil
+	m.monitors = nil
+	m.roles = nil
 	m.active = ""
 }
 
@@ -144,18 +298,77 @@ func (m *PoolManager) List() []string {
 	return names
 }
 
-func (m *PoolManager) createPool(ctx context.Context, cfg Pool) (*pgxpool.Pool, error) {
-	var pool *pgxpool.Pool
-	var err error
+// CancelQueriesOnContextDone configures cfg's connections to send a cancel request to the server when
+// a query's context is done, e.g. when a request times out. By default pgx only sets a deadline on the
+// network connection, leaving the query running server-side while the connection is discarded.
+// The connection is still closed if the server hasn't responded to the cancel request within a second.
+func CancelQueriesOnContextDone(cfg *pgxpool.Config) {
+	cfg.ConnConfig.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{Conn: conn, DeadlineDelay: time.Second}
+	}
+}
 
-	if cfg.Config != nil {
-		pool, err = pgxpool.NewWithConfig(ctx, cfg.Config)
-	} else if cfg.ConnString != "" {
-		pool, err = pgxpool.New(ctx, cfg.ConnString)
-	} else {
-		return nil, errors.New("either Pool or ConnString must be provided")
+// ResetSessionOnRelease configures cfg's pool to reset the role and settings of connections when they're
+// released, with RESET ROLE and RESET ALL, so a role or claims set for one request never leak to the next
+// user of the connection. Connections failing to reset are closed.
+// Pools created by PoolManager are configured this way, unless they use TransactionPooling, except role pools,
+// which use PresetRole.
+func ResetSessionOnRelease(cfg *pgxpool.Config) {
+	next := cfg.AfterRelease
+	cfg.AfterRelease = func(conn *pgx.Conn) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(ctx, "RESET ROLE; RESET ALL"); err != nil {
+			return false
+		}
+		return next == nil || next(conn)
 	}
+}
+
+// TransactionPoolingMode configures cfg's connections to work behind a transaction-mode pooler such as
+// PgBouncer, by sending queries with the simple protocol and caching neither prepared statements nor their
+// descriptions. Prepared statements are per server connection, so ones prepared through one transaction may
+// be missing, or different, in the next. Queries are slightly slower, as they're parsed on every run.
+func TransactionPoolingMode(cfg *pgxpool.Config) {
+	cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	cfg.ConnConfig.StatementCacheCapacity = 0
+	cfg.ConnConfig.DescriptionCacheCapacity = 0
+}
 
+// PresetRole configures cfg's connections to switch to role with SET ROLE when they connect, and to reset
+// settings, such as claims, and the role, in case a user switched it, when they're released, e.g. for a pool
+// serving requests of a single role. Connections failing to reset are closed.
+func PresetRole(cfg *pgxpool.Config, role string) {
+	setRole := "SET ROLE " + pgx.Identifier{role}.Sanitize()
+	nextConnect := cfg.AfterConnect
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if nextConnect != nil {
+			if err := nextConnect(ctx, conn); err != nil {
+				return err
+			}
+		}
+		_, err := conn.Exec(ctx, setRole)
+		return err
+	}
+	nextRelease := cfg.AfterRelease
+	cfg.AfterRelease = func(conn *pgx.Conn) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// RESET ALL leaves the role as it is
+		if _, err := conn.Exec(ctx, "RESET ALL; "+setRole); err != nil {
+			return false
+		}
+		return nextRelease == nil || nextRelease(conn)
+	}
+}
+
+func (m *PoolManager) createPool(ctx context.Context, cfg Pool) (*pgxpool.Pool, error) {
+	poolConfig, err := m.poolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("creating pool: %w", err)
 	}
@@ -168,6 +381,95 @@ func (m *PoolManager) createPool(ctx context.Context, cfg Pool) (*pgxpool.Pool,
 	return pool, nil
 }
 
+// createRolePools creates the pools of cfg's roles. m.mu must be held.
+func (m *PoolManager) createRolePools(ctx context.Context, cfg Pool) (map[string]*pgxpool.Pool, error) {
+	roles := make(map[string]*pgxpool.Pool, len(cfg.RolePools))
+	for role, size := range cfg.RolePools {
+		if size <= 0 {
+			closePools(roles)
+			return nil, fmt.Errorf("invalid size %d of the pool of role %s", size, role)
+		}
+		poolConfig, err := connConfig(cfg)
+		if err != nil {
+			closePools(roles)
+			return nil, err
+		}
+		if cfg.Config != nil {
+			poolConfig = poolConfig.Copy()
+		}
+		PresetRole(poolConfig, role)
+		poolConfig.MaxConns = size
+		poolConfig.MinConns = min(poolConfig.MinConns, size)
+		m.configure(poolConfig)
+
+		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+		if err == nil {
+			// connecting switches to the role, failing if it doesn't exist or can't be switched to
+			err = pool.Ping(ctx)
+		}
+		if err != nil {
+			if pool != nil {
+				pool.Close()
+			}
+			closePools(roles)
+			return nil, fmt.Errorf("creating pool of role %s: %w", role, err)
+		}
+		roles[role] = pool
+	}
+	return roles, nil
+}
+
+func closePools(pools map[string]*pgxpool.Pool) {
+	for _, pool := range pools {
+		pool.Close()
+	}
+}
+
+// connConfig returns cfg.Config, or the configuration parsed from cfg.ConnString.
+func connConfig(cfg Pool) (*pgxpool.Config, error) {
+	if cfg.Config != nil {
+		return cfg.Config, nil
+	}
+	if cfg.ConnString == "" {
+		return nil, errors.New("either Pool or ConnString must be provided")
+	}
+	poolConfig, err := pgxpool.ParseConfig(cfg.ConnString)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection string: %w", err)
+	}
+	return poolConfig, nil
+}
+
+// poolConfig returns the configuration of cfg's pool, with the manager's settings applied.
+func (m *PoolManager) poolConfig(cfg Pool) (*pgxpool.Config, error) {
+	poolConfig, err := connConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TransactionPooling {
+		// resetting would reach an arbitrary server connection rather than the one used
+		TransactionPoolingMode(poolConfig)
+	} else {
+		ResetSessionOnRelease(poolConfig)
+	}
+	m.configure(poolConfig)
+	return poolConfig, nil
+}
+
+// configure applies the manager's TLS certificates and tracer, if any, to poolConfig.
+func (m *PoolManager) configure(poolConfig *pgxpool.Config) {
+	if m.tls != nil {
+		m.tls.Configure(poolConfig)
+	}
+	if m.tracer != nil {
+		if poolConfig.ConnConfig.Tracer == nil {
+			poolConfig.ConnConfig.Tracer = m.tracer
+		} else if poolConfig.ConnConfig.Tracer != m.tracer {
+			poolConfig.ConnConfig.Tracer = multitracer.New(poolConfig.ConnConfig.Tracer, m.tracer)
+		}
+	}
+}
+
 // // PoolManagerSingleton returns the singleton pool manager instance.
 // func PoolManagerSingleton() *PoolManager {
 // 	once.Do(func() {
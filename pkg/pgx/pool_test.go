@@ -0,0 +1,172 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/tracelog"
+)
+
+func TestResetSessionOnRelease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cfg, err := pgxpool.ParseConfig(testConnString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxConns = 1 // so every request gets the same connection
+	ResetSessionOnRelease(cfg)
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if err := pool.Ping(ctx); err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+
+	_, err = pool.Exec(ctx, `DO $$ BEGIN CREATE ROLE pgo_reset_test NOLOGIN; EXCEPTION WHEN duplicate_object THEN NULL; END $$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a request switching role and setting claims on the session, as httputil.ConnWithRole does
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := conn.Conn().PgConn().PID()
+	if _, err := conn.Exec(ctx, `SET ROLE pgo_reset_test; SET request.jwt.claims TO '{"sub":"alice"}'`); err != nil {
+		t.Fatal(err)
+	}
+	conn.Release()
+
+	// the next request on the same connection
+	conn, err = pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if conn.Conn().PgConn().PID() != pid {
+		t.Fatal("expected the same connection")
+	}
+	var sessionUser, currentUser, claims string
+	err = conn.QueryRow(ctx, `SELECT session_user, current_user, coalesce(current_setting('request.jwt.claims', true), '')`).
+		Scan(&sessionUser, &currentUser, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currentUser != sessionUser || claims != "" {
+		t.Errorf("leaked session state: current_user = %s (session_user %s), claims = %q", currentUser, sessionUser, claims)
+	}
+}
+
+func TestTransactionPoolingMode(t *testing.T) {
+	cfg, err := pgxpool.ParseConfig("postgres://localhost:6432/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	TransactionPoolingMode(cfg)
+	if cfg.ConnConfig.DefaultQueryExecMode != pgx.QueryExecModeSimpleProtocol {
+		t.Errorf("expected the simple protocol, got %v", cfg.ConnConfig.DefaultQueryExecMode)
+	}
+	if cfg.ConnConfig.StatementCacheCapacity != 0 || cfg.ConnConfig.DescriptionCacheCapacity != 0 {
+		t.Error("expected statement caching disabled")
+	}
+}
+
+func TestWithQueryTracer(t *testing.T) {
+	tracer := NewTracer(nil)
+	logger := NewQueryLogger(tracelog.LogLevelError)
+
+	m := NewPoolManager(WithQueryTracer(tracer))
+	defer m.Close()
+	cfg, err := m.poolConfig(Pool{ConnString: "postgres://localhost/test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConnConfig.Tracer != tracer {
+		t.Errorf("expected the manager's tracer, got %T", cfg.ConnConfig.Tracer)
+	}
+
+	// tracers of the pool's config are kept
+	own, err := pgxpool.ParseConfig("postgres://localhost/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	own.ConnConfig.Tracer = logger
+	cfg, err = m.poolConfig(Pool{Config: own})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.ConnConfig.Tracer.(*multitracer.Tracer); !ok {
+		t.Errorf("expected both tracers, got %T", cfg.ConnConfig.Tracer)
+	}
+}
+
+func TestPresetRole(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	setup, err := pgxpool.New(ctx, testConnString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setup.Close()
+	if err := setup.Ping(ctx); err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+	_, err = setup.Exec(ctx, `DO $$ BEGIN CREATE ROLE pgo_preset_test NOLOGIN; EXCEPTION WHEN duplicate_object THEN NULL; END $$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := pgxpool.ParseConfig(testConnString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxConns = 1 // so every request gets the same connection
+	PresetRole(cfg, "pgo_preset_test")
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// a request setting claims, and switching role
+	if _, err := pool.Exec(ctx, `SET request.jwt.claims TO '{"sub":"alice"}'; RESET ROLE`); err != nil {
+		t.Fatal(err)
+	}
+
+	var currentUser, claims string
+	err = pool.QueryRow(ctx, `SELECT current_user, coalesce(current_setting('request.jwt.claims', true), '')`).
+		Scan(&currentUser, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currentUser != "pgo_preset_test" || claims != "" {
+		t.Errorf("current_user = %s, claims = %q; want the preset role without claims", currentUser, claims)
+	}
+}
+
+func TestRolePoolsRequireSessionPooling(t *testing.T) {
+	m := NewPoolManager()
+	defer m.Close()
+	err := m.Add(context.Background(), Pool{
+		Name:               "main",
+		ConnString:         "postgres://localhost:6432/test",
+		TransactionPooling: true,
+		RolePools:          map[string]int32{"web_user": 4},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, _, err := m.ForRole("main", "web_user"); err != ErrPoolNotFound {
+		t.Errorf("ForRole error = %v, want ErrPoolNotFound", err)
+	}
+}
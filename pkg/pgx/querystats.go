@@ -0,0 +1,364 @@
+package pgx
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxQueries = 500
+	defaultSamples    = 1000
+	// otherQuery aggregates the queries beyond QueryStatsOptions.MaxQueries.
+	otherQuery = "other"
+)
+
+var (
+	queryLabels       = []string{"endpoint", "query"}
+	queryDurationDesc = queryDesc("duration_seconds", "Time taken to run queries, by endpoint and query fingerprint.")
+	queryErrorsDesc   = queryDesc("errors_total", "Number of failed queries, by endpoint and query fingerprint.")
+	queryRowsDesc     = queryDesc("rows_total", "Number of rows returned or affected by queries, by endpoint and query fingerprint.")
+	inListRe          = regexp.MustCompile(`\((?:\?|\$\d+)(?:, ?(?:\?|\$\d+))*\)`)
+)
+
+// queryStatsCtxKey keys the values QueryStats stores in contexts.
+type queryStatsCtxKey int
+
+const (
+	queryEndpointCtxKey queryStatsCtxKey = iota
+	queryStartedCtxKey
+)
+
+func queryDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(metrics.Namespace, "query", name), help, queryLabels, nil)
+}
+
+// QueryStatsOptions configures NewQueryStats.
+type QueryStatsOptions struct {
+	// MaxQueries bounds the number of distinct endpoint and query fingerprint pairs tracked, and so the
+	// memory used and the cardinality of the metrics. Further queries are aggregated as "other".
+	// Defaults to 500.
+	MaxQueries int
+	// Samples is the number of latest durations of each query its percentiles are computed from.
+	// Defaults to 1000.
+	Samples int
+}
+
+// QueryStat holds the statistics of a query fingerprint run by an endpoint.
+type QueryStat struct {
+	Endpoint string
+	Query    string
+	Calls    int64
+	Errors   int64
+	Rows     int64
+	Total    time.Duration
+	Max      time.Duration
+	// P50, P95 and P99 are percentiles of the latest durations.
+	P50, P95, P99 time.Duration
+}
+
+// Mean returns the mean duration of the query.
+func (s QueryStat) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// QueryStats is a pgx.QueryTracer aggregating the calls, errors, rows and latency percentiles of queries in
+// memory, by fingerprint (see Fingerprint) and endpoint (see WithQueryEndpoint), like pg_stat_statements but
+// without the extension, and per endpoint. It's a prometheus.Collector exposing them as pgo_query_* metrics,
+// and serves them for debugging with Handler:
+//
+//	stats := pgx.NewQueryStats(pgx.QueryStatsOptions{})
+//	metrics.MustRegister(stats)
+//	manager := pgx.NewPoolManager(pgx.WithQueryTracer(stats))
+//	r.Handle("GET /debug/queries", stats.Handler())
+//
+// Queries sent in batches aren't traced by pgx.QueryTracer, so they're not included.
+type QueryStats struct {
+	maxQueries int
+	samples    int
+
+	mu      sync.Mutex
+	queries map[queryKey]*queryEntry
+}
+
+type queryKey struct{ endpoint, query string }
+
+type queryEntry struct {
+	calls, errors, rows int64
+	total, max          time.Duration
+	durations           []time.Duration // ring buffer of the latest durations
+	next                int
+}
+
+type queryStarted struct {
+	sql   string
+	start time.Time
+}
+
+// NewQueryStats returns a QueryStats configured with opts.
+func NewQueryStats(opts QueryStatsOptions) *QueryStats {
+	if opts.MaxQueries <= 0 {
+		opts.MaxQueries = defaultMaxQueries
+	}
+	if opts.Samples <= 0 {
+		opts.Samples = defaultSamples
+	}
+	return &QueryStats{maxQueries: opts.MaxQueries, samples: opts.Samples, queries: make(map[queryKey]*queryEntry)}
+}
+
+// WithQueryEndpoint returns a context attributing the queries run with it to endpoint in QueryStats, e.g.
+// the route pattern of an HTTP request, as middleware.QueryEndpoint does.
+func WithQueryEndpoint(ctx context.Context, endpoint string) context.Context {
+	return context.WithValue(ctx, queryEndpointCtxKey, endpoint)
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (s *QueryStats) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartedCtxKey, queryStarted{sql: data.SQL, start: time.Now()})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (s *QueryStats) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	started, ok := ctx.Value(queryStartedCtxKey).(queryStarted)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(started.start)
+	endpoint, _ := ctx.Value(queryEndpointCtxKey).(string)
+	key := queryKey{endpoint: endpoint, query: Fingerprint(started.sql)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.queries[key]
+	if !ok {
+		if len(s.queries) >= s.maxQueries {
+			key.query = otherQuery
+			e = s.queries[key]
+		}
+		if e == nil {
+			e = &queryEntry{}
+			s.queries[key] = e
+		}
+	}
+	e.calls++
+	if data.Err != nil {
+		e.errors++
+	} else {
+		e.rows += data.CommandTag.RowsAffected()
+	}
+	e.total += elapsed
+	e.max = max(e.max, elapsed)
+	if len(e.durations) < s.samples {
+		e.durations = append(e.durations, elapsed)
+	} else {
+		e.durations[e.next] = elapsed
+		e.next = (e.next + 1) % s.samples
+	}
+}
+
+// Snapshot returns the statistics of the queries, slowest in total first.
+func (s *QueryStats) Snapshot() []QueryStat {
+	s.mu.Lock()
+	stats := make([]QueryStat, 0, len(s.queries))
+	for key, e := range s.queries {
+		durations := slices.Clone(e.durations)
+		slices.Sort(durations)
+		stats = append(stats, QueryStat{
+			Endpoint: key.endpoint,
+			Query:    key.query,
+			Calls:    e.calls,
+			Errors:   e.errors,
+			Rows:     e.rows,
+			Total:    e.total,
+			Max:      e.max,
+			P50:      percentile(durations, 0.5),
+			P95:      percentile(durations, 0.95),
+			P99:      percentile(durations, 0.99),
+		})
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(stats, func(a, b QueryStat) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Endpoint, b.Endpoint), cmp.Compare(a.Query, b.Query))
+	})
+	return stats
+}
+
+// Reset discards the statistics.
+func (s *QueryStats) Reset() {
+	s.mu.Lock()
+	s.queries = make(map[queryKey]*queryEntry)
+	s.mu.Unlock()
+}
+
+// percentile returns the p-th percentile of sorted durations, by the nearest rank.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+// Describe implements prometheus.Collector.
+func (s *QueryStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queryDurationDesc
+	ch <- queryErrorsDesc
+	ch <- queryRowsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *QueryStats) Collect(ch chan<- prometheus.Metric) {
+	for _, stat := range s.Snapshot() {
+		quantiles := map[float64]float64{0.5: stat.P50.Seconds(), 0.95: stat.P95.Seconds(), 0.99: stat.P99.Seconds()}
+		ch <- prometheus.MustNewConstSummary(queryDurationDesc, uint64(stat.Calls), stat.Total.Seconds(), quantiles,
+			stat.Endpoint, stat.Query)
+		ch <- prometheus.MustNewConstMetric(queryErrorsDesc, prometheus.CounterValue, float64(stat.Errors),
+			stat.Endpoint, stat.Query)
+		ch <- prometheus.MustNewConstMetric(queryRowsDesc, prometheus.CounterValue, float64(stat.Rows),
+			stat.Endpoint, stat.Query)
+	}
+}
+
+// Handler serves the statistics as JSON, slowest in total first, with durations in milliseconds. The limit
+// query parameter returns the first queries only, and endpoint those of an endpoint. Mount it on an admin
+// route, as queries reveal the schema.
+func (s *QueryStats) Handler() http.Handler {
+	type queryJSON struct {
+		Endpoint string  `json:"endpoint,omitempty"`
+		Query    string  `json:"query"`
+		Calls    int64   `json:"calls"`
+		Errors   int64   `json:"errors"`
+		Rows     int64   `json:"rows"`
+		TotalMs  float64 `json:"total_ms"`
+		MeanMs   float64 `json:"mean_ms"`
+		P50Ms    float64 `json:"p50_ms"`
+		P95Ms    float64 `json:"p95_ms"`
+		P99Ms    float64 `json:"p99_ms"`
+		MaxMs    float64 `json:"max_ms"`
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := -1
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		endpoint, filter := r.URL.Query().Get("endpoint"), r.URL.Query().Has("endpoint")
+
+		list := []queryJSON{}
+		for _, stat := range s.Snapshot() {
+			if limit >= 0 && len(list) == limit {
+				break
+			}
+			if filter && stat.Endpoint != endpoint {
+				continue
+			}
+			list = append(list, queryJSON{
+				Endpoint: stat.Endpoint, Query: stat.Query, Calls: stat.Calls, Errors: stat.Errors, Rows: stat.Rows,
+				TotalMs: ms(stat.Total), MeanMs: ms(stat.Mean()), P50Ms: ms(stat.P50), P95Ms: ms(stat.P95),
+				P99Ms: ms(stat.P99), MaxMs: ms(stat.Max),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})
+}
+
+// Fingerprint normalizes a query so runs differing only in literal values, parameter counts of lists,
+// whitespace or comments get the same fingerprint: literals are replaced with ?, and lists of literals or
+// parameters, e.g. of IN or VALUES, with (...):
+//
+//	SELECT * FROM users WHERE id IN (1, 2, 3) AND name = 'alice'
+//	SELECT * FROM users WHERE id IN (...) AND name = ?
+func Fingerprint(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	space := false
+	write := func(s string) {
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+		case c == '\'':
+			i = closingQuote(sql, i+1, c, false)
+			write("?")
+		case c == '"':
+			end := closingQuote(sql, i+1, c, false)
+			write(sql[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			space = true
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i
+			} else {
+				end += 4
+			}
+			space = true
+			i += end
+		case c == '$' && dollarTag(sql[i:]) != "":
+			tag := dollarTag(sql[i:])
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				end = len(sql) - i
+			} else {
+				end += 2 * len(tag)
+			}
+			write("?")
+			i += end
+		case '0' <= c && c <= '9' && (i == 0 || !isNameChar(sql[i-1]) && sql[i-1] != '$'):
+			end := i + 1
+			for end < len(sql) && ('0' <= sql[end] && sql[end] <= '9' || sql[end] == '.') {
+				end++
+			}
+			write("?")
+			i = end
+		case isNameChar(c) || c == '$':
+			end := i + 1
+			for end < len(sql) && isNameChar(sql[end]) {
+				end++
+			}
+			write(sql[i:end])
+			i = end
+		default:
+			write(sql[i : i+1])
+			i++
+		}
+	}
+	return inListRe.ReplaceAllString(b.String(), "(...)")
+}
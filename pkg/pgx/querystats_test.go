@@ -0,0 +1,89 @@
+package pgx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ pgx.QueryTracer = (*QueryStats)(nil)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		sql, expected string
+	}{
+		{"SELECT * FROM users WHERE id IN (1, 2, 3) AND name = 'o''brien'", "SELECT * FROM users WHERE id IN (...) AND name = ?"},
+		{"select *\n  from users -- by id\n where id = $1", "select * from users where id = $1"},
+		{"SELECT * FROM t2 WHERE x IN ($1,$2) LIMIT 10", "SELECT * FROM t2 WHERE x IN (...) LIMIT ?"},
+		{`INSERT INTO "Users1" (a, b) VALUES ($1, 2.5), ($3, $$x$$)`, `INSERT INTO "Users1" (a, b) VALUES (...), (...)`},
+		{"SELECT /* hint */ 1", "SELECT ?"},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.sql); got != tt.expected {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.sql, got, tt.expected)
+		}
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	stats := NewQueryStats(QueryStatsOptions{MaxQueries: 2})
+	run := func(ctx context.Context, sql string, err error) {
+		qctx := stats.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: sql})
+		stats.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 2"), Err: err})
+	}
+	ctx := WithQueryEndpoint(context.Background(), "GET /users/{id}")
+	run(ctx, "SELECT * FROM users WHERE id = 1", nil)
+	run(ctx, "SELECT * FROM users WHERE id = 2", nil)
+	run(ctx, "SELECT * FROM users WHERE id = 3", errors.New("canceled"))
+	run(context.Background(), "SELECT now()", nil)
+	run(context.Background(), "SELECT version()", nil) // beyond MaxQueries
+
+	byQuery := map[string]QueryStat{}
+	for _, s := range stats.Snapshot() {
+		byQuery[s.Query] = s
+	}
+	if len(byQuery) != 3 {
+		t.Fatalf("got %d queries, want 3: %v", len(byQuery), byQuery)
+	}
+	users := byQuery["SELECT * FROM users WHERE id = ?"]
+	if users.Endpoint != "GET /users/{id}" || users.Calls != 3 || users.Errors != 1 || users.Rows != 4 {
+		t.Errorf("unexpected stats of the users query: %+v", users)
+	}
+	if users.P50 <= 0 || users.P99 < users.P50 || users.Max < users.P99 {
+		t.Errorf("unexpected percentiles: %+v", users)
+	}
+	if _, ok := byQuery[otherQuery]; !ok {
+		t.Error("expected queries beyond MaxQueries aggregated as other")
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(stats)
+	if n, err := testutil.GatherAndCount(registry, "pgo_query_errors_total"); err != nil || n != 3 {
+		t.Errorf("got %d error series (%v), want 3", n, err)
+	}
+
+	rec := httptest.NewRecorder()
+	stats.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?endpoint=GET+/users/{id}", nil))
+	var list []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0]["calls"] != float64(3) {
+		t.Errorf("unexpected response: %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	stats.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?limit=x", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "limit") {
+		t.Errorf("expected an invalid limit rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,198 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Balancing selects a read replica of a pool.
+type Balancing int
+
+const (
+	// RoundRobin cycles through the replicas.
+	RoundRobin Balancing = iota
+	// LeastConn picks the replica with the fewest acquired connections.
+	LeastConn
+)
+
+// replicaLagQuery returns how far a standby's replay lags behind, in seconds; 0 if it has replayed all WAL it
+// received, as pg_last_xact_replay_timestamp ages on idle databases.
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8`
+
+// replicaSet holds the read replicas of a managed pool.
+type replicaSet struct {
+	replicas  []*replica
+	balancing Balancing
+	maxLag    time.Duration
+	next      atomic.Uint64
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool // reachable and within the maximum lag
+}
+
+// newReplicaSet creates pools for cfg's replicas and, if cfg.MaxReplicaLag is set, starts monitoring their lag.
+func (m *PoolManager) newReplicaSet(ctx context.Context, cfg Pool) (*replicaSet, error) {
+	set := &replicaSet{balancing: cfg.Balancing, maxLag: cfg.MaxReplicaLag, done: make(chan struct{})}
+	for i, connString := range cfg.Replicas {
+		replicaCfg, err := replicaPool(cfg, i, connString)
+		if err != nil {
+			set.close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		pool, err := m.createPool(ctx, replicaCfg)
+		if err != nil {
+			set.close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		r := &replica{pool: pool}
+		r.healthy.Store(true)
+		set.replicas = append(set.replicas, r)
+	}
+
+	monitorCtx, cancel := context.WithCancel(context.Background())
+	set.cancel = cancel
+	if set.maxLag > 0 {
+		go set.monitor(monitorCtx, cfg.Name)
+	} else {
+		close(set.done)
+	}
+	return set, nil
+}
+
+// replicaPool returns the Pool of cfg's replica i at connString, configured like cfg, e.g. for a
+// transaction-mode pooler.
+func replicaPool(cfg Pool, i int, connString string) (Pool, error) {
+	replica := cfg
+	replica.Name = fmt.Sprintf("%s-replica-%d", cfg.Name, i)
+	replica.ConnString = connString
+	if cfg.Config != nil {
+		replica.Config = cfg.Config.Copy()
+		if err := retarget(replica.Config, connString); err != nil {
+			return Pool{}, fmt.Errorf("parsing replica connection string: %w", err)
+		}
+	}
+	return replica, nil
+}
+
+// pick returns a healthy replica, or nil if there's none.
+func (s *replicaSet) pick() *pgxpool.Pool {
+	var healthy []*replica
+	for _, r := range s.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if s.balancing == LeastConn {
+		best := healthy[0]
+		for _, r := range healthy[1:] {
+			if r.pool.Stat().AcquiredConns() < best.pool.Stat().AcquiredConns() {
+				best = r
+			}
+		}
+		return best.pool
+	}
+	return healthy[s.next.Add(1)%uint64(len(healthy))].pool
+}
+
+// monitor checks the replicas' lag until ctx is done, excluding unreachable and lagging replicas.
+func (s *replicaSet) monitor(ctx context.Context, name string) {
+	defer close(s.done)
+	interval := max(s.maxLag/2, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.checkLag(ctx, name, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *replicaSet) checkLag(ctx context.Context, name string, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for i, r := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			var lagSeconds float64
+			err := r.pool.QueryRow(ctx, replicaLagQuery).Scan(&lagSeconds)
+			lag := time.Duration(lagSeconds * float64(time.Second))
+			healthy := err == nil && lag <= s.maxLag
+			if was := r.healthy.Swap(healthy); was != healthy && ctx.Err() == nil {
+				if healthy {
+					log.Printf("pgx: replica %d of %s is back in rotation", i, name)
+				} else if err != nil {
+					log.Printf("pgx: excluding replica %d of %s: %v", i, name, err)
+				} else {
+					log.Printf("pgx: excluding replica %d of %s lagging %s behind", i, name, lag)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *replicaSet) close() {
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	for _, r := range s.replicas {
+		r.pool.Close()
+	}
+}
+
+// Reader returns a pool for read-only queries of the named pool: one of its replicas, balanced as configured
+// by Pool.Balancing and excluding replicas lagging more than Pool.MaxReplicaLag, or the primary if it has no
+// healthy replicas. Writes, and reads that must see the request's own writes, should use Get. Pass Reader
+// pools to helpers such as SelectStream, or to middleware.PostgresReplicas to serve GET requests from them.
+func (m *PoolManager) Reader(name string) (*pgxpool.Pool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	primary, ok := m.pools[name]
+	if !ok {
+		return nil, ErrPoolNotFound
+	}
+	if set, ok := m.replicas[name]; ok {
+		if pool := set.pick(); pool != nil {
+			return pool, nil
+		}
+	}
+	return primary, nil
+}
+
+// ActiveReader is like Reader for the active pool.
+func (m *PoolManager) ActiveReader() (*pgxpool.Pool, error) {
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	if active == "" {
+		return nil, fmt.Errorf("pgx: no active connection")
+	}
+	return m.Reader(active)
+}
@@ -0,0 +1,100 @@
+package pgx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestReplicaSetPick(t *testing.T) {
+	ctx := context.Background()
+	newReplica := func(healthy bool) *replica {
+		// pools connect lazily, so none of these reach a server
+		pool, err := pgxpool.New(ctx, "postgres://localhost:1/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		r := &replica{pool: pool}
+		r.healthy.Store(healthy)
+		return r
+	}
+	a, b, lagging := newReplica(true), newReplica(true), newReplica(false)
+	set := &replicaSet{replicas: []*replica{a, lagging, b}}
+
+	seen := map[*pgxpool.Pool]int{}
+	for range 4 {
+		seen[set.pick()]++
+	}
+	if seen[a.pool] != 2 || seen[b.pool] != 2 {
+		t.Errorf("round robin picked a %d, b %d times, lagging %d times", seen[a.pool], seen[b.pool], seen[lagging.pool])
+	}
+
+	set.balancing = LeastConn
+	if p := set.pick(); p != a.pool {
+		t.Error("least conn should pick the first of equally loaded replicas")
+	}
+
+	a.healthy.Store(false)
+	b.healthy.Store(false)
+	if p := set.pick(); p != nil {
+		t.Error("expected no replica when all are excluded")
+	}
+}
+
+func TestPoolManagerReader(t *testing.T) {
+	primary, err := pgxpool.New(context.Background(), "postgres://localhost:1/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewPoolManager()
+	defer m.Close()
+	m.pools["main"] = primary
+	m.active = "main"
+	m.replicas["main"] = &replicaSet{} // all replicas excluded
+
+	if p, err := m.ActiveReader(); err != nil || p != primary {
+		t.Errorf("ActiveReader() = %v, %v; want the primary", p, err)
+	}
+	if _, err := m.Reader("missing"); err != ErrPoolNotFound {
+		t.Errorf("Reader(missing) error = %v", err)
+	}
+}
+
+func TestReplicaPoolInheritsPooling(t *testing.T) {
+	m := NewPoolManager()
+	defer m.Close()
+
+	parsed, err := pgxpool.ParseConfig("postgres://primary:6432/test?pool_max_conns=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []Pool{
+		{Name: "main", ConnString: "postgres://primary:6432/test", TransactionPooling: true},
+		{Name: "main", Config: parsed, TransactionPooling: true},
+	} {
+		replica, err := replicaPool(cfg, 0, "postgres://replica:6432/test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replica.Name != "main-replica-0" || !replica.TransactionPooling {
+			t.Errorf("got replica %q, transaction pooling %t", replica.Name, replica.TransactionPooling)
+		}
+		poolConfig, err := m.poolConfig(replica)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if poolConfig.ConnConfig.Host != "replica" {
+			t.Errorf("expected the replica's host, got %q", poolConfig.ConnConfig.Host)
+		}
+		if poolConfig.ConnConfig.DefaultQueryExecMode != pgx.QueryExecModeSimpleProtocol || poolConfig.AfterRelease != nil {
+			t.Error("expected the replica in transaction pooling mode")
+		}
+	}
+	if parsed.ConnConfig.Host != "primary" || parsed.MaxConns != 7 {
+		t.Errorf("expected the primary's config unchanged, got host %q", parsed.ConnConfig.Host)
+	}
+}
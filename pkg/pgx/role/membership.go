@@ -0,0 +1,117 @@
+package role
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/jackc/pgx/v5"
+)
+
+// Membership is the membership of a role in another, whose privileges it may use, e.g. an authenticator
+// role switching to the role named by a JWT claim with SET ROLE.
+type Membership struct {
+	// Role is the role granted.
+	Role string `json:"role"`
+	// Member is the role Role is granted to.
+	Member string `json:"member"`
+	// Admin lets Member grant Role to others.
+	Admin bool `json:"admin"`
+	// Inherit makes Member use Role's privileges without SET ROLE. Nil keeps the default, which is Member's
+	// INHERIT attribute. Setting it requires PostgreSQL 16.
+	Inherit *bool `json:"inherit,omitempty"`
+}
+
+// GrantMembership grants m.Role to m.Member.
+func GrantMembership(ctx context.Context, conn pg.Conn, m Membership) error {
+	if _, err := conn.Exec(ctx, grantMembershipQuery(m)); err != nil {
+		return fmt.Errorf("failed to grant role %s to %s: %w", m.Role, m.Member, err)
+	}
+	return nil
+}
+
+// RevokeMembership revokes m.Role from m.Member, or only the admin option if m.Admin is set.
+func RevokeMembership(ctx context.Context, conn pg.Conn, m Membership) error {
+	if _, err := conn.Exec(ctx, revokeMembershipQuery(m)); err != nil {
+		return fmt.Errorf("failed to revoke role %s from %s: %w", m.Role, m.Member, err)
+	}
+	return nil
+}
+
+func grantMembershipQuery(m Membership) string {
+	query := fmt.Sprintf("GRANT %s TO %s", pgx.Identifier{m.Role}.Sanitize(), pgx.Identifier{m.Member}.Sanitize())
+	var options []string
+	if m.Admin {
+		options = append(options, "ADMIN OPTION")
+	}
+	if m.Inherit != nil {
+		options = append(options, fmt.Sprintf("INHERIT %t", *m.Inherit))
+	}
+	if len(options) > 0 {
+		query += " WITH " + strings.Join(options, ", ")
+	}
+	return query
+}
+
+func revokeMembershipQuery(m Membership) string {
+	query := "REVOKE "
+	if m.Admin {
+		query += "ADMIN OPTION FOR "
+	}
+	return query + fmt.Sprintf("%s FROM %s", pgx.Identifier{m.Role}.Sanitize(), pgx.Identifier{m.Member}.Sanitize())
+}
+
+// Memberships returns every role membership, the edges of the role graph, ordered by member and role.
+// Inherit is always set, to the membership's inherit option on PostgreSQL 16 and the member's INHERIT
+// attribute before.
+func Memberships(ctx context.Context, conn pg.Conn) ([]Membership, error) {
+	// inherit_option is new in PostgreSQL 16, so it's read through to_jsonb to work on older versions too
+	rows, err := conn.Query(ctx, `
+        SELECT r.rolname, m.rolname, am.admin_option,
+            coalesce((to_jsonb(am)->>'inherit_option')::bool, m.rolinherit)
+        FROM pg_auth_members am
+        JOIN pg_roles r ON r.oid = am.roleid
+        JOIN pg_roles m ON m.oid = am.member
+        ORDER BY m.rolname, r.rolname;
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role memberships: %w", err)
+	}
+	memberships, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Membership, error) {
+		var m Membership
+		var inherit bool
+		err := row.Scan(&m.Role, &m.Member, &m.Admin, &inherit)
+		m.Inherit = &inherit
+		return m, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan role membership: %w", err)
+	}
+	return memberships, nil
+}
+
+// MemberOf returns the roles roleName is a member of, directly or through other roles, sorted. Whether
+// their privileges are inherited doesn't matter, as roleName may SET ROLE to any of them.
+func MemberOf(ctx context.Context, conn pg.Conn, roleName string) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+        WITH RECURSIVE member_of(oid) AS (
+            SELECT am.roleid FROM pg_auth_members am
+            JOIN pg_roles m ON m.oid = am.member
+            WHERE m.rolname = $1
+            UNION
+            SELECT am.roleid FROM pg_auth_members am
+            JOIN member_of ON am.member = member_of.oid
+        )
+        SELECT r.rolname FROM member_of JOIN pg_roles r ON r.oid = member_of.oid
+        ORDER BY r.rolname;
+    `, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role memberships: %w", err)
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan role membership: %w", err)
+	}
+	return roles, nil
+}
@@ -0,0 +1,23 @@
+package role
+
+import "testing"
+
+func TestMembershipQueries(t *testing.T) {
+	inherit := false
+	tests := []struct {
+		query, want string
+	}{
+		{grantMembershipQuery(Membership{Role: "anon", Member: "authenticator"}), `GRANT "anon" TO "authenticator"`},
+		{
+			grantMembershipQuery(Membership{Role: "admin", Member: "alice", Admin: true, Inherit: &inherit}),
+			`GRANT "admin" TO "alice" WITH ADMIN OPTION, INHERIT false`,
+		},
+		{revokeMembershipQuery(Membership{Role: "anon", Member: "authenticator"}), `REVOKE "anon" FROM "authenticator"`},
+		{revokeMembershipQuery(Membership{Role: "admin", Member: "alice", Admin: true}), `REVOKE ADMIN OPTION FOR "admin" FROM "alice"`},
+	}
+	for _, tt := range tests {
+		if tt.query != tt.want {
+			t.Errorf("got %q, want %q", tt.query, tt.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package role
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/jackc/pgx/v5"
+)
+
+// ObjectType is the type of the objects privileges are granted on.
+type ObjectType string
+
+const (
+	Tables    ObjectType = "TABLE"
+	Sequences ObjectType = "SEQUENCE"
+	Functions ObjectType = "FUNCTION"
+	Schemas   ObjectType = "SCHEMA"
+)
+
+// privilegesOn lists the privileges that may be granted on each type of object.
+var privilegesOn = map[ObjectType][]string{
+	Tables:    {"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER"},
+	Sequences: {"USAGE", "SELECT", "UPDATE"},
+	Functions: {"EXECUTE"},
+	Schemas:   {"USAGE", "CREATE"},
+}
+
+// Privilege describes privileges on objects granted to, or revoked from, roles, e.g.
+//
+//	role.Privilege{Privileges: []string{"SELECT"}, On: role.Tables, InSchema: "api", To: []string{"anon"}}
+type Privilege struct {
+	// Privileges are privileges of the object type, e.g. SELECT and INSERT on tables. Empty means ALL.
+	Privileges []string
+	// Columns restricts table privileges to some columns.
+	Columns []string
+	On      ObjectType
+	// Objects are the names of the objects, optionally schema-qualified, e.g. "public.users". Functions may
+	// list argument types to select an overload, e.g. "api.login(text, text)".
+	Objects []string
+	// InSchema selects all objects of the type in a schema instead of Objects, e.g. ALL TABLES IN SCHEMA api.
+	// Only objects existing at the time are affected; see DefaultPrivilege for future ones.
+	InSchema string
+	// To are the roles privileges are granted to or revoked from. PUBLIC is every role.
+	To []string
+	// WithGrantOption lets the roles grant the privileges to others. Revoking it revokes only the grant option.
+	WithGrantOption bool
+}
+
+// DefaultPrivilege describes privileges granted on objects created in the future, e.g. tables created by
+// migrations, as set by ALTER DEFAULT PRIVILEGES.
+type DefaultPrivilege struct {
+	// ForRole is the role creating the objects. Defaults to the current role.
+	ForRole string
+	// InSchema restricts the default privileges to objects created in a schema.
+	InSchema string
+	// Privileges are privileges of the object type. Empty means ALL.
+	Privileges []string
+	On         ObjectType
+	To         []string
+	// WithGrantOption lets the roles grant the privileges to others.
+	WithGrantOption bool
+}
+
+// Grant grants privileges on objects to roles.
+func Grant(ctx context.Context, conn pg.Conn, p Privilege) error {
+	return execPrivilege(ctx, conn, p, true)
+}
+
+// Revoke revokes privileges on objects from roles.
+func Revoke(ctx context.Context, conn pg.Conn, p Privilege) error {
+	return execPrivilege(ctx, conn, p, false)
+}
+
+// GrantDefault grants privileges on objects created in the future to roles.
+func GrantDefault(ctx context.Context, conn pg.Conn, p DefaultPrivilege) error {
+	return execDefaultPrivilege(ctx, conn, p, true)
+}
+
+// RevokeDefault revokes default privileges from roles.
+func RevokeDefault(ctx context.Context, conn pg.Conn, p DefaultPrivilege) error {
+	return execDefaultPrivilege(ctx, conn, p, false)
+}
+
+func execPrivilege(ctx context.Context, conn pg.Conn, p Privilege, grant bool) error {
+	query, err := privilegeQuery(p, grant)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to %s privileges: %w", action(grant), err)
+	}
+	return nil
+}
+
+func execDefaultPrivilege(ctx context.Context, conn pg.Conn, p DefaultPrivilege, grant bool) error {
+	query, err := defaultPrivilegeQuery(p, grant)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to %s default privileges: %w", action(grant), err)
+	}
+	return nil
+}
+
+func action(grant bool) string {
+	if grant {
+		return "grant"
+	}
+	return "revoke"
+}
+
+// privilegeQuery builds the GRANT or REVOKE statement of p.
+func privilegeQuery(p Privilege, grant bool) (string, error) {
+	privileges, err := privilegeList(p.On, p.Privileges)
+	if err != nil {
+		return "", err
+	}
+	if len(p.Columns) > 0 {
+		if p.On != Tables {
+			return "", fmt.Errorf("column privileges apply to tables only")
+		}
+		privileges += " (" + identifierList(p.Columns) + ")"
+	}
+
+	var on string
+	switch {
+	case p.InSchema != "" && len(p.Objects) > 0:
+		return "", fmt.Errorf("either objects or a schema must be given, not both")
+	case p.InSchema != "":
+		if p.On == Schemas {
+			return "", fmt.Errorf("privileges on schemas are granted on the schemas themselves")
+		}
+		on = fmt.Sprintf("ALL %sS IN SCHEMA %s", p.On, pgx.Identifier{p.InSchema}.Sanitize())
+	case len(p.Objects) > 0:
+		objects := make([]string, len(p.Objects))
+		for i, name := range p.Objects {
+			if objects[i], err = objectName(p.On, name); err != nil {
+				return "", err
+			}
+		}
+		on = string(p.On) + " " + strings.Join(objects, ", ")
+	default:
+		return "", fmt.Errorf("no objects to %s privileges on", action(grant))
+	}
+
+	to, err := roleList(p.To)
+	if err != nil {
+		return "", err
+	}
+	if grant {
+		query := fmt.Sprintf("GRANT %s ON %s TO %s", privileges, on, to)
+		if p.WithGrantOption {
+			query += " WITH GRANT OPTION"
+		}
+		return query, nil
+	}
+	if p.WithGrantOption {
+		return fmt.Sprintf("REVOKE GRANT OPTION FOR %s ON %s FROM %s", privileges, on, to), nil
+	}
+	return fmt.Sprintf("REVOKE %s ON %s FROM %s", privileges, on, to), nil
+}
+
+// defaultPrivilegeQuery builds the ALTER DEFAULT PRIVILEGES statement of p.
+func defaultPrivilegeQuery(p DefaultPrivilege, grant bool) (string, error) {
+	privileges, err := privilegeList(p.On, p.Privileges)
+	if err != nil {
+		return "", err
+	}
+	to, err := roleList(p.To)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("ALTER DEFAULT PRIVILEGES")
+	if p.ForRole != "" {
+		b.WriteString(" FOR ROLE " + pgx.Identifier{p.ForRole}.Sanitize())
+	}
+	if p.InSchema != "" {
+		if p.On == Schemas {
+			return "", fmt.Errorf("default privileges on schemas can't be restricted to a schema")
+		}
+		b.WriteString(" IN SCHEMA " + pgx.Identifier{p.InSchema}.Sanitize())
+	}
+	objects := string(p.On) + "S"
+	if grant {
+		fmt.Fprintf(&b, " GRANT %s ON %s TO %s", privileges, objects, to)
+		if p.WithGrantOption {
+			b.WriteString(" WITH GRANT OPTION")
+		}
+	} else if p.WithGrantOption {
+		fmt.Fprintf(&b, " REVOKE GRANT OPTION FOR %s ON %s FROM %s", privileges, objects, to)
+	} else {
+		fmt.Fprintf(&b, " REVOKE %s ON %s FROM %s", privileges, objects, to)
+	}
+	return b.String(), nil
+}
+
+// privilegeList validates privileges, which are keywords that can't be quoted, against those of the object type.
+func privilegeList(on ObjectType, privileges []string) (string, error) {
+	valid, ok := privilegesOn[on]
+	if !ok {
+		return "", fmt.Errorf("unsupported object type %q", on)
+	}
+	if len(privileges) == 0 {
+		return "ALL", nil
+	}
+	list := make([]string, len(privileges))
+	for i, p := range privileges {
+		list[i] = strings.ToUpper(strings.TrimSpace(p))
+		if list[i] != "ALL" && !slices.Contains(valid, list[i]) {
+			return "", fmt.Errorf("invalid privilege %q on %s", p, on)
+		}
+	}
+	return strings.Join(list, ", "), nil
+}
+
+// functionArgsRe matches the argument types of a function signature, e.g. "text, int[]".
+var functionArgsRe = regexp.MustCompile(`^[\w\s,."\[\]]*$`)
+
+// objectName quotes an optionally schema-qualified object name, keeping the argument types of functions.
+func objectName(on ObjectType, object string) (string, error) {
+	name, args, hasArgs := strings.Cut(object, "(")
+	quoted := pgx.Identifier(strings.Split(strings.TrimSpace(name), ".")).Sanitize()
+	if !hasArgs {
+		return quoted, nil
+	}
+	args, ok := strings.CutSuffix(strings.TrimSpace(args), ")")
+	if on != Functions || !ok || !functionArgsRe.MatchString(args) {
+		return "", fmt.Errorf("invalid object name %q", object)
+	}
+	return quoted + "(" + args + ")", nil
+}
+
+// roleList quotes the names of roles, except PUBLIC.
+func roleList(roles []string) (string, error) {
+	if len(roles) == 0 {
+		return "", fmt.Errorf("no roles to grant privileges to")
+	}
+	list := make([]string, len(roles))
+	for i, r := range roles {
+		if strings.EqualFold(r, "PUBLIC") {
+			list[i] = "PUBLIC"
+		} else {
+			list[i] = pgx.Identifier{r}.Sanitize()
+		}
+	}
+	return strings.Join(list, ", "), nil
+}
+
+func identifierList(names []string) string {
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = pgx.Identifier{name}.Sanitize()
+	}
+	return strings.Join(list, ", ")
+}
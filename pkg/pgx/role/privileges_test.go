@@ -0,0 +1,100 @@
+package role
+
+import "testing"
+
+func TestPrivilegeQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Privilege
+		grant   bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "tables in schema",
+			p:     Privilege{Privileges: []string{"select", "INSERT"}, On: Tables, InSchema: "api", To: []string{"anon", "public"}},
+			grant: true,
+			want:  `GRANT SELECT, INSERT ON ALL TABLES IN SCHEMA "api" TO "anon", PUBLIC`,
+		},
+		{
+			name:  "columns",
+			p:     Privilege{Privileges: []string{"UPDATE"}, Columns: []string{"name"}, On: Tables, Objects: []string{"public.users"}, To: []string{"web"}},
+			grant: true,
+			want:  `GRANT UPDATE ("name") ON TABLE "public"."users" TO "web"`,
+		},
+		{
+			name:  "function with arguments",
+			p:     Privilege{On: Functions, Objects: []string{"api.login(text, text)"}, To: []string{"anon"}, WithGrantOption: true},
+			grant: true,
+			want:  `GRANT ALL ON FUNCTION "api"."login"(text, text) TO "anon" WITH GRANT OPTION`,
+		},
+		{
+			name: "revoke schema usage",
+			p:    Privilege{Privileges: []string{"USAGE"}, On: Schemas, Objects: []string{"api"}, To: []string{"anon"}},
+			want: `REVOKE USAGE ON SCHEMA "api" FROM "anon"`,
+		},
+		{
+			name: "revoke grant option",
+			p:    Privilege{Privileges: []string{"USAGE"}, On: Sequences, InSchema: "api", To: []string{"web"}, WithGrantOption: true},
+			want: `REVOKE GRANT OPTION FOR USAGE ON ALL SEQUENCES IN SCHEMA "api" FROM "web"`,
+		},
+		{
+			name:    "invalid privilege",
+			p:       Privilege{Privileges: []string{"SELECT; DROP TABLE users"}, On: Tables, Objects: []string{"users"}, To: []string{"anon"}},
+			wantErr: true,
+		},
+		{
+			name:    "privilege of another object type",
+			p:       Privilege{Privileges: []string{"EXECUTE"}, On: Tables, Objects: []string{"users"}, To: []string{"anon"}},
+			wantErr: true,
+		},
+		{
+			name:    "injected function arguments",
+			p:       Privilege{On: Functions, Objects: []string{"f(); DROP TABLE users; --)"}, To: []string{"anon"}},
+			wantErr: true,
+		},
+		{
+			name:    "no roles",
+			p:       Privilege{On: Tables, Objects: []string{"users"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := privilegeQuery(tt.p, tt.grant)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultPrivilegeQuery(t *testing.T) {
+	got, err := defaultPrivilegeQuery(DefaultPrivilege{
+		ForRole:    "migrator",
+		InSchema:   "api",
+		Privileges: []string{"SELECT"},
+		On:         Tables,
+		To:         []string{"anon"},
+	}, true)
+	want := `ALTER DEFAULT PRIVILEGES FOR ROLE "migrator" IN SCHEMA "api" GRANT SELECT ON TABLES TO "anon"`
+	if err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+
+	got, err = defaultPrivilegeQuery(DefaultPrivilege{On: Functions, To: []string{"public"}}, false)
+	want = `ALTER DEFAULT PRIVILEGES REVOKE ALL ON FUNCTIONS FROM PUBLIC`
+	if err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
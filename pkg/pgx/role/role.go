@@ -17,7 +17,9 @@ import (
 var ErrRoleNotFound = fmt.Errorf("role not found")
 
 const roleSelectQuery = `SELECT rolname, rolsuper, rolinherit, rolcreaterole, rolcreatedb, rolcanlogin,
-rolreplication, rolconnlimit, rolvaliduntil, rolbypassrls, rolconfig, oid FROM pg_roles`
+rolreplication, rolconnlimit, rolvaliduntil, rolbypassrls, rolconfig, oid,
+ARRAY(SELECT g.rolname FROM pg_auth_members am JOIN pg_roles g ON g.oid = am.roleid WHERE am.member = r.oid ORDER BY 1)
+FROM pg_roles r`
 
 // Role represents a PostgreSQL role with its associated attributes and privileges.
 type Role struct {
@@ -47,6 +49,8 @@ type Role struct {
 	Config []string `json:"rolconfig"`
 	// OID is the object identifier (OID) of the role.
 	OID uint32 `json:"oid"`
+	// MemberOf lists the roles granted to the role directly. Create and Update ignore it; see GrantMembership and Sync.
+	MemberOf []string `json:"memberof"`
 }
 
 // List retrieves all PostgreSQL roles from the database.
@@ -130,6 +134,7 @@ func scanRole(row pgx.Row) (*Role, error) {
 		&role.BypassRLS,
 		&role.Config,
 		&role.OID,
+		&role.MemberOf,
 	)
 	if err != nil {
 		return nil, err
@@ -165,7 +170,7 @@ func addRoleAttributes(builder *strings.Builder, role Role) {
 	}
 
 	if role.ValidUntil.Valid {
-		builder.WriteString(fmt.Sprintf(" VALID UNTIL '%s'", role.ValidUntil.Time.Format(time.RFC3339)))
+		builder.WriteString(" VALID UNTIL " + pg.QuoteLiteral(role.ValidUntil.Time.Format(time.RFC3339)))
 	}
 }
 
@@ -179,7 +184,12 @@ func alterRoleConfigAndPassword(ctx context.Context, conn pg.Conn, role Role) er
 	}
 
 	if role.Password != "" {
-		passwordQuery := fmt.Sprintf("ALTER ROLE %s WITH PASSWORD '%s'", pgx.Identifier{role.Name}.Sanitize(), role.Password)
+		// hashed client-side, so the plaintext password never reaches the server
+		verifier, err := HashPassword(role.Password)
+		if err != nil {
+			return err
+		}
+		passwordQuery := fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s", pgx.Identifier{role.Name}.Sanitize(), pg.QuoteLiteral(verifier))
 		if _, err := conn.Exec(ctx, passwordQuery); err != nil {
 			return fmt.Errorf("failed to update role password: %w", err)
 		}
@@ -0,0 +1,95 @@
+package role
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xdg-go/stringprep"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramIterations is the iteration count of SCRAM-SHA-256 verifiers, PostgreSQL's default.
+const scramIterations = 4096
+
+// HashPassword returns the SCRAM-SHA-256 verifier of password, as stored in pg_authid, so setting it with
+// ALTER ROLE ... PASSWORD sends only the hash, keeping the password out of server logs and
+// pg_stat_activity. Passwords that are already SCRAM-SHA-256 verifiers or MD5 hashes are returned unchanged,
+// as PostgreSQL stores those as is; it returns an error for malformed SCRAM-SHA-256 verifiers.
+//
+// Like the server, it normalizes passwords with SASLprep, using them as is if they can't be normalized.
+func HashPassword(password string) (string, error) {
+	if strings.HasPrefix(password, "SCRAM-SHA-256$") {
+		if err := validateScramVerifier(password); err != nil {
+			return "", err
+		}
+		return password, nil
+	}
+	if isMD5Hash(password) {
+		return password, nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if prepared, err := stringprep.SASLprep.Prepare(password); err == nil {
+		password = prepared
+	}
+	return scramVerifier(password, salt, scramIterations), nil
+}
+
+func scramVerifier(password string, salt []byte, iterations int) string {
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(saltedPassword, "Server Key")
+
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s", iterations, b64(salt), b64(storedKey[:]), b64(serverKey))
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// validateScramVerifier returns an error unless verifier is laid out as
+// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>, with base64 salt and keys.
+func validateScramVerifier(verifier string) error {
+	invalid := errors.New("invalid SCRAM-SHA-256 verifier")
+	parts := strings.Split(strings.TrimPrefix(verifier, "SCRAM-SHA-256$"), "$")
+	if len(parts) != 2 {
+		return invalid
+	}
+	iterations, salt, ok := strings.Cut(parts[0], ":")
+	if n, err := strconv.Atoi(iterations); !ok || err != nil || n <= 0 {
+		return invalid
+	}
+	if b, err := base64.StdEncoding.DecodeString(salt); err != nil || len(b) == 0 {
+		return invalid
+	}
+	storedKey, serverKey, ok := strings.Cut(parts[1], ":")
+	if !ok {
+		return invalid
+	}
+	for _, key := range []string{storedKey, serverKey} {
+		if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != sha256.Size {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// isMD5Hash reports whether password is an MD5 hash, md5 followed by 32 hex digits.
+func isMD5Hash(password string) bool {
+	if len(password) != 35 || !strings.HasPrefix(password, "md5") {
+		return false
+	}
+	return strings.Trim(password[3:], "0123456789abcdef") == ""
+}
@@ -0,0 +1,63 @@
+package role
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestScramVerifier(t *testing.T) {
+	// StoredKey = SHA256(HMAC(SaltedPassword, "Client Key")), ServerKey = HMAC(SaltedPassword, "Server Key"),
+	// as in RFC 5802
+	salt, _ := base64.StdEncoding.DecodeString("c2FsdHNhbHRzYWx0c2FsdA==")
+	want := "SCRAM-SHA-256$4096:c2FsdHNhbHRzYWx0c2FsdA==$Ce3wZiZ+yIBCjltccfRiqM0+XDsLE3qPdkEeZKe3hus=:k3q4nlLsA09ST5FLo9zNmfyXR+Ci1J4KmBK5JRVSxeI="
+	if got := scramVerifier("secret", salt, 4096); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	h1, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, _ := HashPassword("secret")
+	if h1 == h2 {
+		t.Error("expected random salts")
+	}
+	if strings.Contains(h1, "secret") {
+		t.Error("verifier contains the password")
+	}
+
+	for _, hash := range []string{h1, "md5" + strings.Repeat("0a", 16)} {
+		if got, _ := HashPassword(hash); got != hash {
+			t.Errorf("expected hash %q unchanged, got %q", hash, got)
+		}
+	}
+}
+
+func TestHashPasswordSASLprep(t *testing.T) {
+	// SASLprep maps the soft hyphen to nothing and the no-break space to a space
+	h, err := HashPassword("pass\u00adword\u00a0x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, _ := base64.StdEncoding.DecodeString(strings.Split(strings.Split(h, ":")[1], "$")[0])
+	if want := scramVerifier("password x", salt, scramIterations); h != want {
+		t.Errorf("got %q, want the verifier of the normalized password %q", h, want)
+	}
+}
+
+func TestHashPasswordInvalidVerifier(t *testing.T) {
+	for _, verifier := range []string{
+		"SCRAM-SHA-256$",
+		"SCRAM-SHA-256$4096:c2FsdA==",
+		"SCRAM-SHA-256$0:c2FsdA==$" + strings.Repeat("A", 43) + "=:" + strings.Repeat("A", 43) + "=",
+		"SCRAM-SHA-256$4096:c2FsdA==$short:key",
+		"SCRAM-SHA-256$4096:c2FsdA==$x';DROP ROLE postgres;--",
+	} {
+		if _, err := HashPassword(verifier); err == nil {
+			t.Errorf("HashPassword(%q) succeeded, want an error", verifier)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package role
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	pg "github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/jackc/pgx/v5"
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// DryRun returns the statements Sync would run without running them.
+	DryRun bool
+	// Prune drops existing roles that aren't desired, except system roles, e.g. postgres and the predefined
+	// pg_* roles, the current user and roles matching Exclude. Without it, Sync only creates and alters roles.
+	Prune bool
+	// Exclude lists patterns, as in path.Match, of roles Prune keeps, e.g. rds* for the roles of a managed
+	// service.
+	Exclude []string
+}
+
+// firstNormalOID is the first OID of objects created by users. Lower ones belong to the system.
+const firstNormalOID = 16384
+
+// Sync makes the roles of the database match desired, comparing their attributes, config and memberships
+// (MemberOf) with the existing roles', and returns the statements run. Statements run in a transaction, so
+// either all of them apply or none does.
+//
+// Like Create, Sync sets the attributes set in desired only: a ConnLimit of 0 or an unset ValidUntil keep the
+// role's, or PostgreSQL's defaults. Flags an existing role has but desired doesn't are revoked, except
+// Inherit, which Create can't revoke either.
+//
+// Passwords are set on roles Sync creates only, as existing password hashes can't be compared.
+// Password hashes in the returned statements are masked.
+func Sync(ctx context.Context, conn pg.Conn, desired []Role, opts SyncOptions) ([]string, error) {
+	existing, err := List(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var currentUser string
+	if err := conn.QueryRow(ctx, "SELECT current_user").Scan(&currentUser); err != nil {
+		return nil, fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	stmts, err := syncStatements(existing, desired, opts, currentUser)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		plan[i] = stmt.display()
+	}
+	if opts.DryRun || len(stmts) == 0 {
+		return plan, nil
+	}
+
+	err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(ctx, stmt.sql); err != nil {
+				return fmt.Errorf("failed to sync roles: %s: %w", stmt.display(), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// syncStatement is a statement of Sync, with the password hash it sets, if any, masked in display.
+type syncStatement struct {
+	sql    string
+	secret string
+}
+
+func (s syncStatement) display() string {
+	if s.secret == "" {
+		return s.sql
+	}
+	return strings.ReplaceAll(s.sql, s.secret, "********")
+}
+
+// configKeyRe matches the names of configuration parameters, e.g. search_path or pgrst.db_schemas.
+var configKeyRe = regexp.MustCompile(`^[A-Za-z_][\w.]*$`)
+
+// syncStatements returns the statements making existing roles match desired ones: creating roles first,
+// then altering them and their memberships, then dropping roles.
+func syncStatements(existing, desired []Role, opts SyncOptions, currentUser string) ([]syncStatement, error) {
+	byName := make(map[string]Role, len(existing))
+	for _, r := range existing {
+		byName[r.Name] = r
+	}
+
+	var creates, alters, memberships, drops []syncStatement
+	for _, want := range desired {
+		if want.Name == "" {
+			return nil, fmt.Errorf("role without a name")
+		}
+		name := pgx.Identifier{want.Name}.Sanitize()
+		wantConfig, err := parseConfig(want.Config)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", want.Name, err)
+		}
+
+		have, exists := byName[want.Name]
+		if !exists {
+			stmt := syncStatement{sql: "CREATE ROLE " + name + roleAttributes(Role{}, want)}
+			if want.Password != "" {
+				verifier, err := HashPassword(want.Password)
+				if err != nil {
+					return nil, err
+				}
+				stmt.sql += " PASSWORD " + pg.QuoteLiteral(verifier)
+				stmt.secret = verifier
+			}
+			creates = append(creates, stmt)
+		} else if attributes := roleAttributes(have, want); attributes != "" {
+			alters = append(alters, syncStatement{sql: "ALTER ROLE " + name + attributes})
+		}
+
+		haveConfig, _ := parseConfig(have.Config)
+		for _, key := range slices.Sorted(maps.Keys(wantConfig)) {
+			if v, ok := haveConfig[key]; !ok || v != wantConfig[key] {
+				alters = append(alters, syncStatement{sql: fmt.Sprintf("ALTER ROLE %s SET %s = %s", name, key, wantConfig[key])})
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(haveConfig)) {
+			if _, ok := wantConfig[key]; !ok {
+				alters = append(alters, syncStatement{sql: fmt.Sprintf("ALTER ROLE %s RESET %s", name, key)})
+			}
+		}
+
+		for _, group := range want.MemberOf {
+			if !slices.Contains(have.MemberOf, group) {
+				memberships = append(memberships, syncStatement{sql: grantMembershipQuery(Membership{Role: group, Member: want.Name})})
+			}
+		}
+		for _, group := range have.MemberOf {
+			if !slices.Contains(want.MemberOf, group) {
+				memberships = append(memberships, syncStatement{sql: revokeMembershipQuery(Membership{Role: group, Member: want.Name})})
+			}
+		}
+	}
+
+	if opts.Prune {
+		for _, pattern := range opts.Exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			}
+		}
+		for _, have := range existing {
+			wanted := slices.ContainsFunc(desired, func(r Role) bool { return r.Name == have.Name })
+			system := have.OID < firstNormalOID || strings.HasPrefix(have.Name, "pg_")
+			excluded := slices.ContainsFunc(opts.Exclude, func(pattern string) bool {
+				ok, _ := path.Match(pattern, have.Name)
+				return ok
+			})
+			if !wanted && !system && !excluded && have.Name != currentUser {
+				drops = append(drops, syncStatement{sql: "DROP ROLE " + pgx.Identifier{have.Name}.Sanitize()})
+			}
+		}
+	}
+
+	return slices.Concat(creates, alters, memberships, drops), nil
+}
+
+// roleAttributes returns the attributes altering have to want, empty if there are none. Those not set in want
+// are kept as they are, except the ones granted to have, which are revoked. Inherit is granted only, as Create
+// can't revoke it either, and PostgreSQL grants it by default.
+func roleAttributes(have, want Role) string {
+	attributes := []struct {
+		have, want bool
+		attribute  string
+	}{
+		{have.Superuser, want.Superuser, "SUPERUSER"},
+		{have.Inherit, want.Inherit, "INHERIT"},
+		{have.CreateRole, want.CreateRole, "CREATEROLE"},
+		{have.CreateDB, want.CreateDB, "CREATEDB"},
+		{have.CanLogin, want.CanLogin, "LOGIN"},
+		{have.Replication, want.Replication, "REPLICATION"},
+		{have.BypassRLS, want.BypassRLS, "BYPASSRLS"},
+	}
+
+	var b strings.Builder
+	for _, attr := range attributes {
+		switch {
+		case attr.want && !attr.have:
+			b.WriteString(" " + attr.attribute)
+		case !attr.want && attr.have && attr.attribute != "INHERIT":
+			b.WriteString(" NO" + attr.attribute)
+		}
+	}
+
+	if want.ConnLimit != 0 && want.ConnLimit != have.ConnLimit {
+		fmt.Fprintf(&b, " CONNECTION LIMIT %d", want.ConnLimit)
+	}
+	if want.ValidUntil.Valid && (!have.ValidUntil.Valid || !have.ValidUntil.Time.Equal(want.ValidUntil.Time)) {
+		b.WriteString(" VALID UNTIL " + pg.QuoteLiteral(want.ValidUntil.Time.UTC().Format(time.RFC3339)))
+	}
+	return b.String()
+}
+
+// parseConfig parses config settings of the form key=value by key.
+func parseConfig(config []string) (map[string]string, error) {
+	settings := make(map[string]string, len(config))
+	for _, setting := range config {
+		key, value, ok := strings.Cut(setting, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		// values are interpolated as is, to allow lists like search_path=api, public
+		if !ok || !configKeyRe.MatchString(key) || strings.Contains(value, ";") {
+			return nil, fmt.Errorf("invalid config setting %q", setting)
+		}
+		settings[key] = value
+	}
+	return settings, nil
+}
@@ -0,0 +1,82 @@
+package role
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSyncStatements(t *testing.T) {
+	existing := []Role{
+		{Name: "postgres", Superuser: true, Inherit: true, CanLogin: true, ConnLimit: -1, OID: 10},
+		{Name: "pg_read_all_data", Inherit: true, ConnLimit: -1, OID: 6181},
+		{Name: "anon", Inherit: true, ConnLimit: -1, Config: []string{"statement_timeout=5s"}, OID: 16390},
+		{Name: "authenticator", Inherit: true, CanLogin: true, ConnLimit: 10, MemberOf: []string{"anon", "old"}, OID: 16391},
+		{Name: "old", Inherit: true, ConnLimit: -1, OID: 16392},
+		{Name: "rds_admin", Inherit: true, ConnLimit: -1, OID: 16393},
+	}
+	desired := []Role{
+		{Name: "anon", Inherit: true, Config: []string{"statement_timeout = 5s"}},
+		{Name: "authenticator", CanLogin: true, Config: []string{"search_path=api"}, MemberOf: []string{"anon", "web"}},
+		{Name: "web", Inherit: true, Password: "secret"},
+	}
+
+	stmts, err := syncStatements(existing, desired, SyncOptions{}, "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range stmts {
+		got = append(got, s.display())
+	}
+	want := []string{
+		`CREATE ROLE "web" INHERIT PASSWORD '********'`,
+		`ALTER ROLE "authenticator" SET search_path = api`,
+		`GRANT "web" TO "authenticator"`,
+		`REVOKE "old" FROM "authenticator"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.Contains(stmts[0].sql, "SCRAM-SHA-256$") {
+		t.Errorf("expected the password hash in the executed statement, got %q", stmts[0].sql)
+	}
+
+	// altered attributes, reset config and pruned roles
+	desired[0] = Role{Name: "anon", BypassRLS: true, ConnLimit: 5}
+	// postgres is kept as a system role, rds_admin as excluded
+	stmts, err = syncStatements(existing, desired, SyncOptions{Prune: true, Exclude: []string{"rds*"}}, "authenticator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = got[:0]
+	for _, s := range stmts {
+		if !strings.HasPrefix(s.sql, "CREATE") {
+			got = append(got, s.display())
+		}
+	}
+	want = []string{
+		`ALTER ROLE "anon" BYPASSRLS CONNECTION LIMIT 5`,
+		`ALTER ROLE "anon" RESET statement_timeout`,
+		`ALTER ROLE "authenticator" SET search_path = api`,
+		`GRANT "web" TO "authenticator"`,
+		`REVOKE "old" FROM "authenticator"`,
+		`DROP ROLE "old"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// revoked flags
+	stmts, err = syncStatements(existing, []Role{{Name: "postgres", CanLogin: true}}, SyncOptions{}, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 1 || stmts[0].sql != `ALTER ROLE "postgres" NOSUPERUSER` {
+		t.Errorf("got %v, want NOSUPERUSER only", stmts)
+	}
+
+	if _, err := syncStatements(existing, []Role{{Name: "x", Config: []string{"a; DROP ROLE y=1"}}}, SyncOptions{}, "postgres"); err == nil {
+		t.Error("expected an invalid config error")
+	}
+}
@@ -0,0 +1,693 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/edgeflare/pgo/pkg/pgx"
+	"github.com/edgeflare/pgo/pkg/pgx/notify"
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReloadPayload is the NOTIFY payload reloading a Cache, e.g. NOTIFY pgo, 'reload schema'.
+// Notifications with an empty payload reload it too.
+const ReloadPayload = "reload schema"
+
+// ReloadTablePayload prefixes the NOTIFY payload reloading a single table of a Cache, followed by its
+// schema-qualified name, e.g. NOTIFY pgo, 'reload table public.users'. The DDL trigger sends these for
+// changes to tables, their columns and policies, sparing large databases full reloads.
+const ReloadTablePayload = "reload table "
+
+// reloadDebounce coalesces notifications arriving in bursts, e.g. from migrations, into one reload.
+const reloadDebounce = 100 * time.Millisecond
+
+// maxReloadDelay caps the debounce of a burst, so a steady stream of notifications doesn't postpone the
+// reload indefinitely.
+const maxReloadDelay = time.Second
+
+// reloadRetryDelay is the delay before retrying a failed reload.
+const reloadRetryDelay = 5 * time.Second
+
+// CacheConfig holds the configuration for NewCache.
+type CacheConfig struct {
+	// Schemas are the schemas whose tables are cached, or glob patterns matching them, e.g. "tenant_*".
+	// Patterns don't match system schemas, which must be named. Defaults to public.
+	Schemas []string
+	// ExcludeSchemas are patterns of schemas skipped entirely, e.g. "tenant_archive_*".
+	ExcludeSchemas []string
+	// IncludeTables are patterns of the schema-qualified names of the tables cached, e.g. "public.*" or
+	// "*.orders". All tables of the schemas are cached if it's empty.
+	IncludeTables []string
+	// ExcludeTables are patterns of tables not cached, e.g. "*.audit_*". They take precedence over
+	// IncludeTables. Excluded tables aren't queried at all.
+	ExcludeTables []string
+	// StatementTimeout limits the introspection queries of reloads, so huge catalogs fail a reload rather
+	// than tie up a connection for minutes. Zero keeps the role's statement_timeout.
+	StatementTimeout time.Duration
+	// Channel is the channel notifications reloading the cache are sent on. Defaults to pgo.
+	Channel string
+	// InstallDDLTrigger installs an event trigger notifying Channel whenever DDL is run, e.g. a table or
+	// column is created, altered or dropped, so the cache reloads without a manual NOTIFY.
+	// Creating event triggers requires a superuser.
+	InstallDDLTrigger bool
+}
+
+// Cache holds the tables and user-defined types of schemas, reloading them when notified on its channel.
+type Cache struct {
+	pool *pgxpool.Pool
+	cfg  CacheConfig
+
+	mu      sync.RWMutex
+	schemas []string          // resolved from cfg.Schemas
+	tables  map[string]Table  // by schema-qualified name
+	oids    map[string]uint32 // of tables, by schema-qualified name, to find the tables renamed
+	types   map[string]Type   // by schema-qualified name
+	grants  *Grants
+
+	listener *notify.Listener
+	cancel   context.CancelFunc
+
+	// reloads requested by notifications, run by reloadPending
+	pendingMu     sync.Mutex
+	pendingFull   bool
+	pendingTables map[string]bool
+	reloads       chan struct{}
+}
+
+// NewCache loads the tables of cfg.Schemas once listening for reload notifications, so none is missed, and
+// listens until ctx is done or Close is called. Its queries are traced by pool's tracer, e.g. set with
+// pgx.WithQueryTracer.
+func NewCache(ctx context.Context, pool *pgxpool.Pool, cfg CacheConfig) (*Cache, error) {
+	if len(cfg.Schemas) == 0 {
+		cfg.Schemas = []string{"public"}
+	}
+	if cfg.Channel == "" {
+		cfg.Channel = "pgo"
+	}
+	for _, pattern := range slices.Concat(cfg.Schemas, cfg.ExcludeSchemas, cfg.IncludeTables, cfg.ExcludeTables) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid schema cache pattern %q: %w", pattern, err)
+		}
+	}
+	c := &Cache{pool: pool, cfg: cfg, pendingTables: make(map[string]bool), reloads: make(chan struct{}, 1)}
+
+	if cfg.InstallDDLTrigger {
+		if err := InstallDDLTrigger(ctx, pool, cfg.Channel); err != nil {
+			return nil, err
+		}
+	}
+	// fail fast rather than wait for the listener to connect
+	if err := pool.Ping(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	// the cache is loaded once listening, and reloaded after reconnecting, as notifications may have been
+	// missed meanwhile
+	loaded := make(chan error, 1)
+	var first sync.Once
+	c.listener = notify.NewListener(pool, notify.Config{OnConnect: func(ctx context.Context) error {
+		err := c.Reload(ctx)
+		first.Do(func() { loaded <- err })
+		return err
+	}})
+	c.listener.Handle(cfg.Channel, c.notified)
+	c.listener.Start(ctx)
+
+	select {
+	case err := <-loaded:
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	case <-ctx.Done():
+		c.Close()
+		return nil, ctx.Err()
+	}
+	go c.reloadPending(ctx)
+	return c, nil
+}
+
+// InstallDDLTrigger creates, or replaces, event triggers on ddl_command_end and sql_drop notifying channel
+// with ReloadTablePayload for each table changed by a command, or ReloadPayload for other changes, e.g. of
+// types or grants. It requires a superuser.
+func InstallDDLTrigger(ctx context.Context, conn pgx.Conn, channel string) error {
+	fn := pgxv5.Identifier{channel + "_notify_ddl"}.Sanitize()
+	end := pgxv5.Identifier{channel + "_ddl_command_end"}.Sanitize()
+	drop := pgxv5.Identifier{channel + "_sql_drop"}.Sanitize()
+	_, err := conn.Exec(ctx, fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION %[1]s() RETURNS event_trigger LANGUAGE plpgsql AS $$
+		DECLARE
+			obj record;
+			tbl text;
+			tables text[] := '{}';
+		BEGIN
+			IF TG_TAG IN ('GRANT', 'REVOKE') THEN
+				PERFORM pg_notify(%[4]s, %[5]s);
+				RETURN;
+			END IF;
+
+			IF TG_EVENT = 'sql_drop' THEN
+				FOR obj IN SELECT * FROM pg_event_trigger_dropped_objects() WHERE original LOOP
+					IF obj.object_type IN ('table', 'table column', 'table constraint', 'policy') THEN
+						tables := tables || (obj.address_names[1] || '.' || obj.address_names[2]);
+					ELSIF obj.object_type NOT IN ('index', 'sequence', 'view', 'materialized view', 'trigger') THEN
+						PERFORM pg_notify(%[4]s, %[5]s);
+						RETURN;
+					END IF;
+				END LOOP;
+			ELSE
+				FOR obj IN SELECT * FROM pg_event_trigger_ddl_commands() LOOP
+					tbl := NULL;
+					IF obj.classid = 'pg_class'::regclass THEN
+						SELECT n.nspname || '.' || c.relname INTO tbl FROM pg_class c
+						JOIN pg_namespace n ON n.oid = c.relnamespace
+						WHERE c.oid = obj.objid AND c.relkind IN ('r', 'p');
+						CONTINUE WHEN tbl IS NULL; -- indexes, sequences, views
+					ELSIF obj.classid = 'pg_policy'::regclass THEN
+						SELECT n.nspname || '.' || c.relname INTO tbl FROM pg_policy p
+						JOIN pg_class c ON c.oid = p.polrelid
+						JOIN pg_namespace n ON n.oid = c.relnamespace
+						WHERE p.oid = obj.objid;
+					ELSIF obj.classid = 'pg_constraint'::regclass THEN
+						SELECT n.nspname || '.' || c.relname INTO tbl FROM pg_constraint con
+						JOIN pg_class c ON c.oid = con.conrelid
+						JOIN pg_namespace n ON n.oid = c.relnamespace
+						WHERE con.oid = obj.objid;
+					END IF;
+					IF tbl IS NULL THEN
+						PERFORM pg_notify(%[4]s, %[5]s);
+						RETURN;
+					END IF;
+					tables := tables || tbl;
+				END LOOP;
+			END IF;
+
+			FOR tbl IN SELECT DISTINCT unnest(tables) LOOP
+				PERFORM pg_notify(%[4]s, %[6]s || tbl);
+			END LOOP;
+		END $$;
+		DROP EVENT TRIGGER IF EXISTS %[2]s;
+		CREATE EVENT TRIGGER %[2]s ON ddl_command_end EXECUTE FUNCTION %[1]s();
+		DROP EVENT TRIGGER IF EXISTS %[3]s;
+		CREATE EVENT TRIGGER %[3]s ON sql_drop EXECUTE FUNCTION %[1]s();`,
+		fn, end, drop, pgx.QuoteLiteral(channel), pgx.QuoteLiteral(ReloadPayload), pgx.QuoteLiteral(ReloadTablePayload)))
+	if err != nil {
+		return fmt.Errorf("failed to install DDL event trigger: %w", err)
+	}
+	return nil
+}
+
+// Tables returns the cached tables by schema-qualified name, e.g. "public.users".
+// The map must not be modified.
+func (c *Cache) Tables() map[string]Table {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tables
+}
+
+// Table returns a cached table by schema-qualified name, or by name in the first of the cache's schemas
+// having a table of that name.
+func (c *Cache) Table(name string) (Table, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return findTable(c.tables, c.schemas, name)
+}
+
+// findTable returns a table of tables by schema-qualified name, or by name in the first of schemas having
+// a table of that name.
+func findTable(tables map[string]Table, schemas []string, name string) (Table, bool) {
+	if t, ok := tables[name]; ok {
+		return t, true
+	}
+	if !strings.Contains(name, ".") {
+		for _, s := range schemas {
+			if t, ok := tables[s+"."+name]; ok {
+				return t, true
+			}
+		}
+	}
+	return Table{}, false
+}
+
+// Types returns the cached user-defined types by schema-qualified name. The map must not be modified.
+func (c *Cache) Types() map[string]Type {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.types
+}
+
+// ColumnType returns the user-defined type of col, if it has one.
+func (c *Cache) ColumnType(col Column) (Type, bool) {
+	if col.Type == "" {
+		return Type{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.types[col.Type]
+	return t, ok
+}
+
+// UnprotectedTables returns the schema-qualified names of cached tables with row level security disabled,
+// sorted. Servers exposing tables can warn about them at startup, as every row of them is visible to roles
+// granted SELECT.
+func (c *Cache) UnprotectedTables() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var names []string
+	for name, t := range c.tables {
+		if !t.RLSEnabled {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Handler serves the cached tables as JSON, sorted by schema-qualified name, with their columns and row
+// level security policies, so operators can verify which policies protect which tables. The table query
+// parameter selects a single table. It serves every table regardless of the request's role, so mount it on
+// an admin route, behind authentication; see RoleHandler for other clients.
+func (c *Cache) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.RLock()
+		tables, schemas := c.tables, c.schemas
+		c.mu.RUnlock()
+		serveTables(w, r, tables, schemas, func(t Table) (Table, bool) { return t, true })
+	})
+}
+
+// RoleHandler serves, like Handler, the cached tables the Postgres role of the request has privileges on,
+// with only the columns it has privileges on and without policies. The role is the one stored in the request
+// context by authorization middleware, e.g. middleware.Authorize; requests without a role are rejected with
+// 401 Unauthorized.
+func (c *Cache) RoleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, ok := r.Context().Value(httputil.PgRoleCtxKey).(string)
+		if !ok || role == "" {
+			httputil.Error(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		c.mu.RLock()
+		tables, schemas, grants := c.tables, c.schemas, c.grants
+		c.mu.RUnlock()
+		serveTables(w, r, tables, schemas, func(t Table) (Table, bool) { return visibleTable(grants, role, t) })
+	})
+}
+
+// columnPrivileges are the privileges making a column visible to a role.
+var columnPrivileges = []string{"SELECT", "INSERT", "UPDATE", "REFERENCES"}
+
+// visibleTable returns t with the columns role has privileges on, and whether role has privileges on any.
+func visibleTable(grants *Grants, role string, t Table) (Table, bool) {
+	name := t.Schema + "." + t.Name
+	var columns []Column
+	for _, col := range t.Columns {
+		if slices.ContainsFunc(columnPrivileges, func(p string) bool { return grants.HasColumn(role, name, col.Name, p) }) {
+			columns = append(columns, col)
+		}
+	}
+	if len(columns) == 0 && !grants.Has(role, name, "DELETE") && !grants.Has(role, name, "TRUNCATE") {
+		return Table{}, false
+	}
+	t.Columns, t.Policies = columns, nil
+	return t, true
+}
+
+// serveTables serves the tables visible through filter as JSON, or the one named by the table query parameter.
+func serveTables(w http.ResponseWriter, r *http.Request, tables map[string]Table, schemas []string, filter func(Table) (Table, bool)) {
+	if name := r.URL.Query().Get("table"); name != "" {
+		t, ok := findTable(tables, schemas, name)
+		if ok {
+			t, ok = filter(t)
+		}
+		if !ok {
+			httputil.Error(w, http.StatusNotFound, "table not found")
+			return
+		}
+		httputil.JSON(w, http.StatusOK, t)
+		return
+	}
+
+	list := make([]Table, 0, len(tables))
+	for _, name := range slices.Sorted(maps.Keys(tables)) {
+		if t, ok := filter(tables[name]); ok {
+			list = append(list, t)
+		}
+	}
+	httputil.JSON(w, http.StatusOK, list)
+}
+
+// Grants returns the cached privileges of roles on the tables.
+func (c *Cache) Grants() *Grants {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.grants
+}
+
+// Allow returns the HTTP methods role may use on a table, named as by Table, without trial queries.
+func (c *Cache) Allow(role, name string) []string {
+	t, ok := c.Table(name)
+	if !ok {
+		return nil
+	}
+	return c.Grants().Allow(role, t.Schema+"."+t.Name)
+}
+
+// Reload replaces the cached tables, types and privileges with the database's.
+func (c *Cache) Reload(ctx context.Context) error {
+	return c.introspect(ctx, func(conn pgx.Conn) error {
+		schemas, err := c.resolveSchemas(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		tables := make(map[string]Table)
+		types := make(map[string]Type)
+		for _, s := range schemas {
+			names, err := c.tableNames(ctx, conn, s)
+			if err != nil {
+				return fmt.Errorf("failed to load schema %s: %w", s, err)
+			}
+			if len(names) > 0 {
+				loaded, err := LoadTables(ctx, conn, s, names...)
+				if err != nil {
+					return fmt.Errorf("failed to load schema %s: %w", s, err)
+				}
+				for name, t := range loaded {
+					tables[s+"."+name] = t
+				}
+			}
+
+			loadedTypes, err := LoadTypes(ctx, conn, s)
+			if err != nil {
+				return fmt.Errorf("failed to load types of schema %s: %w", s, err)
+			}
+			for name, t := range loadedTypes {
+				types[name] = t
+			}
+		}
+
+		oids, err := tableOIDs(ctx, conn, slices.Collect(maps.Keys(tables)))
+		if err != nil {
+			return err
+		}
+		grants, err := LoadPrivileges(ctx, conn, schemas...)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.schemas, c.tables, c.oids, c.types, c.grants = schemas, tables, oids, types, grants
+		c.mu.Unlock()
+		return nil
+	})
+}
+
+// introspect runs fn on a connection with the configured statement timeout. The timeout is set with SET LOCAL
+// in a transaction, rather than on the session, so it can't outlive the reload, e.g. behind a transaction-mode
+// pooler running the reset on another server connection.
+func (c *Cache) introspect(ctx context.Context, fn func(conn pgx.Conn) error) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if c.cfg.StatementTimeout <= 0 {
+		return fn(conn)
+	}
+	return pgxv5.BeginFunc(ctx, conn, func(tx pgxv5.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", c.cfg.StatementTimeout.Milliseconds())); err != nil {
+			return err
+		}
+		return fn(txConn{tx})
+	})
+}
+
+// txConn is a pgx.Conn running on a transaction, beginning nested transactions as savepoints.
+type txConn struct {
+	pgxv5.Tx
+}
+
+func (c txConn) BeginTx(ctx context.Context, _ pgxv5.TxOptions) (pgxv5.Tx, error) {
+	return c.Begin(ctx)
+}
+
+// resolveSchemas returns the schemas matching cfg.Schemas, in the order of cfg.Schemas, without excluded ones.
+func (c *Cache) resolveSchemas(ctx context.Context, conn pgx.Conn) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+        SELECT nspname FROM pg_namespace
+        WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'
+        ORDER BY nspname;
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schemas: %w", err)
+	}
+	existing, err := pgxv5.CollectRows(rows, pgxv5.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schemas: %w", err)
+	}
+
+	var schemas []string
+	for _, pattern := range c.cfg.Schemas {
+		candidates := existing
+		if !isPattern(pattern) {
+			candidates = []string{pattern} // may be a system schema, or not exist (yet)
+		}
+		for _, s := range candidates {
+			if ok, _ := path.Match(pattern, s); ok && !slices.Contains(schemas, s) && !matchAny(c.cfg.ExcludeSchemas, s) {
+				schemas = append(schemas, s)
+			}
+		}
+	}
+	return schemas, nil
+}
+
+// tableNames returns the names of the tables of a schema the cache includes.
+func (c *Cache) tableNames(ctx context.Context, conn pgx.Conn, schemaName string) ([]string, error) {
+	tables, err := getTables(ctx, conn, schemaName, nil)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range tables {
+		if c.includesTable(schemaName + "." + name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// includesTable reports whether the cache includes a table by schema-qualified name.
+func (c *Cache) includesTable(name string) bool {
+	return (len(c.cfg.IncludeTables) == 0 || matchAny(c.cfg.IncludeTables, name)) && !matchAny(c.cfg.ExcludeTables, name)
+}
+
+func isPattern(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tableOIDs returns the OIDs of the tables, by schema-qualified name, that exist.
+func tableOIDs(ctx context.Context, conn pgx.Conn, names []string) (map[string]uint32, error) {
+	schemaNames, tableNames := make([]string, len(names)), make([]string, len(names))
+	for i, name := range names {
+		schemaNames[i], tableNames[i], _ = strings.Cut(name, ".")
+	}
+	rows, err := conn.Query(ctx, `
+        SELECT t.schema_name || '.' || t.table_name, c.oid
+        FROM unnest($1::text[], $2::text[]) AS t(schema_name, table_name)
+        JOIN pg_namespace n ON n.nspname = t.schema_name
+        JOIN pg_class c ON c.relnamespace = n.oid AND c.relname = t.table_name
+    `, schemaNames, tableNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table OIDs: %w", err)
+	}
+	oids := make(map[string]uint32, len(names))
+	var name string
+	var oid uint32
+	_, err = pgxv5.ForEachRow(rows, []any{&name, &oid}, func() error {
+		oids[name] = oid
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table OIDs: %w", err)
+	}
+	return oids, nil
+}
+
+// ReloadTables reloads the named tables, by schema-qualified name, and the privileges, rather than the whole
+// cache. Tables that no longer exist are removed, and so are cached tables renamed or moved to another schema,
+// found by OID, under their old names. Tables outside the cache's schemas aren't loaded.
+func (c *Cache) ReloadTables(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	c.mu.RLock()
+	schemas := c.schemas
+	c.mu.RUnlock()
+
+	bySchema := make(map[string][]string)
+	for _, name := range names {
+		schemaName, table, ok := strings.Cut(name, ".")
+		if ok && slices.Contains(schemas, schemaName) && c.includesTable(name) {
+			bySchema[schemaName] = append(bySchema[schemaName], table)
+		}
+	}
+
+	loaded := make(map[string]Table)
+	var oids map[string]uint32
+	var grants *Grants
+	err := c.introspect(ctx, func(conn pgx.Conn) error {
+		// names outside the cache's schemas too, as they may be the new names of cached tables
+		var err error
+		if oids, err = tableOIDs(ctx, conn, names); err != nil {
+			return err
+		}
+		if len(bySchema) == 0 {
+			return nil
+		}
+		for schemaName, tables := range bySchema {
+			ts, err := LoadTables(ctx, conn, schemaName, tables...)
+			if err != nil {
+				return fmt.Errorf("failed to load tables of schema %s: %w", schemaName, err)
+			}
+			for name, t := range ts {
+				loaded[schemaName+"."+name] = t
+			}
+		}
+		grants, err = LoadPrivileges(ctx, conn, schemas...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// copy, as callers of Tables may hold the current map
+	tables, cachedOIDs := maps.Clone(c.tables), maps.Clone(c.oids)
+	reloaded := make(map[uint32]bool, len(oids))
+	for _, oid := range oids {
+		reloaded[oid] = true
+	}
+	for name, oid := range c.oids {
+		if reloaded[oid] {
+			// renamed, moved to another schema or reloaded below
+			delete(tables, name)
+			delete(cachedOIDs, name)
+		}
+	}
+	for schemaName, names := range bySchema {
+		for _, name := range names {
+			delete(tables, schemaName+"."+name)
+			delete(cachedOIDs, schemaName+"."+name)
+		}
+	}
+	maps.Copy(tables, loaded)
+	if cachedOIDs == nil {
+		cachedOIDs = make(map[string]uint32, len(loaded))
+	}
+	for name := range loaded {
+		cachedOIDs[name] = oids[name]
+	}
+	c.tables, c.oids = tables, cachedOIDs
+	if grants != nil {
+		c.grants = grants
+	}
+	return nil
+}
+
+// notified records the reload a notification requests, for reloadPending.
+func (c *Cache) notified(ctx context.Context, n *pgconn.Notification) error {
+	c.pendingMu.Lock()
+	switch {
+	case n.Payload == "" || n.Payload == ReloadPayload:
+		c.pendingFull = true
+	case strings.HasPrefix(n.Payload, ReloadTablePayload):
+		c.pendingTables[strings.TrimPrefix(n.Payload, ReloadTablePayload)] = true
+	}
+	c.pendingMu.Unlock()
+
+	select {
+	case c.reloads <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// reloadPending runs the reloads requested by notifications until ctx is done, once notifications pause
+// for reloadDebounce, or maxReloadDelay after the first of a burst. Failed reloads stay pending and are
+// retried after reloadRetryDelay.
+func (c *Cache) reloadPending(ctx context.Context) {
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+	var deadline time.Time // of the burst being coalesced, zero if none
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.reloads:
+			// coalesce the rest of a burst
+			now := time.Now()
+			if deadline.IsZero() {
+				deadline = now.Add(maxReloadDelay)
+			}
+			timer.Reset(min(reloadDebounce, deadline.Sub(now)))
+			continue
+		case <-timer.C:
+		}
+		deadline = time.Time{}
+
+		c.pendingMu.Lock()
+		full, tables := c.pendingFull, slices.Collect(maps.Keys(c.pendingTables))
+		c.pendingFull, c.pendingTables = false, make(map[string]bool)
+		c.pendingMu.Unlock()
+
+		var err error
+		switch {
+		case full:
+			err = c.Reload(ctx)
+		case len(tables) > 0:
+			err = c.ReloadTables(ctx, tables...)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to reload schema cache, retrying in %s: %v", reloadRetryDelay, err)
+			c.pendingMu.Lock()
+			c.pendingFull = c.pendingFull || full
+			for _, name := range tables {
+				c.pendingTables[name] = true
+			}
+			c.pendingMu.Unlock()
+			timer.Reset(reloadRetryDelay)
+		}
+	}
+}
+
+// Close stops listening for reload notifications. The cache keeps serving its tables.
+func (c *Cache) Close() {
+	c.cancel()
+	c.listener.Close()
+}
@@ -0,0 +1,157 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheReloadsOnDDL(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, os.Getenv("TEST_DATABASE"))
+	require.NoError(t, err)
+	defer pool.Close()
+	if err := pool.Ping(ctx); err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+
+	_, err = pool.Exec(ctx, `DROP TABLE IF EXISTS test_cache_ddl`)
+	require.NoError(t, err)
+	cache, err := NewCache(ctx, pool, CacheConfig{InstallDDLTrigger: true})
+	require.NoError(t, err)
+	defer cache.Close()
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DROP TABLE IF EXISTS test_cache_ddl, test_cache_ddl_renamed`)
+	})
+
+	_, ok := cache.Table("test_cache_ddl")
+	require.False(t, ok)
+
+	_, err = pool.Exec(ctx, `CREATE TABLE test_cache_ddl (id int PRIMARY KEY)`)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		table, ok := cache.Table("public.test_cache_ddl")
+		return ok && len(table.Columns) == 1
+	}, 10*time.Second, 50*time.Millisecond)
+
+	_, err = pool.Exec(ctx, `ALTER TABLE test_cache_ddl ADD COLUMN name text`)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		table, _ := cache.Table("test_cache_ddl")
+		return len(table.Columns) == 2
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// renamed tables are removed under their old names
+	_, err = pool.Exec(ctx, `ALTER TABLE test_cache_ddl RENAME TO test_cache_ddl_renamed`)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, old := cache.Table("test_cache_ddl")
+		_, renamed := cache.Table("test_cache_ddl_renamed")
+		return !old && renamed
+	}, 10*time.Second, 50*time.Millisecond)
+	_, err = pool.Exec(ctx, `ALTER TABLE test_cache_ddl_renamed RENAME TO test_cache_ddl`)
+	require.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `DROP TABLE test_cache_ddl`)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, ok := cache.Table("test_cache_ddl")
+		_, renamed := cache.Table("test_cache_ddl_renamed")
+		return !ok && !renamed
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// tables outside the cached schemas are ignored
+	require.NoError(t, cache.ReloadTables(ctx, "other.test_cache_ddl"))
+}
+
+func TestCacheHandler(t *testing.T) {
+	posts := Table{Schema: "public", Name: "posts", RLSEnabled: true, Policies: []Policy{
+		{Name: "own posts", Command: "ALL", Permissive: true, Roles: []string{"public"}, Using: "(author = CURRENT_USER)"},
+	}}
+	cache := &Cache{
+		schemas: []string{"public"},
+		tables:  map[string]Table{"public.posts": posts, "public.tags": {Schema: "public", Name: "tags"}},
+	}
+	require.Equal(t, []string{"public.tags"}, cache.UnprotectedTables())
+
+	rr := httptest.NewRecorder()
+	cache.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?table=posts", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var table Table
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &table))
+	require.Equal(t, posts, table)
+
+	rr = httptest.NewRecorder()
+	cache.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	var tables []Table
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tables))
+	require.Len(t, tables, 2)
+	require.Equal(t, "posts", tables[0].Name)
+
+	rr = httptest.NewRecorder()
+	cache.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?table=missing", nil))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCacheRoleHandler(t *testing.T) {
+	posts := Table{Schema: "public", Name: "posts", Columns: []Column{{Name: "id"}, {Name: "title"}, {Name: "author"}},
+		RLSEnabled: true, Policies: []Policy{{Name: "own posts", Command: "ALL", Roles: []string{"public"}}}}
+	grants := &Grants{
+		privileges: map[string]map[string]Privileges{},
+		memberOf:   map[string][]string{},
+		superusers: map[string]bool{},
+	}
+	grants.add("reader", "public.posts", "id", "SELECT")
+	grants.add("reader", "public.posts", "title", "SELECT")
+	cache := &Cache{
+		schemas: []string{"public"},
+		tables:  map[string]Table{"public.posts": posts, "public.secrets": {Schema: "public", Name: "secrets"}},
+		grants:  grants,
+	}
+
+	serve := func(role, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if role != "" {
+			r = r.WithContext(context.WithValue(r.Context(), httputil.PgRoleCtxKey, role))
+		}
+		rr := httptest.NewRecorder()
+		cache.RoleHandler().ServeHTTP(rr, r)
+		return rr
+	}
+
+	require.Equal(t, http.StatusUnauthorized, serve("", "/").Code)
+
+	rr := serve("reader", "/")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var tables []Table
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tables))
+	require.Len(t, tables, 1)
+	require.Equal(t, []Column{{Name: "id"}, {Name: "title"}}, tables[0].Columns)
+	require.Empty(t, tables[0].Policies)
+
+	require.Equal(t, http.StatusOK, serve("reader", "/?table=posts").Code)
+	require.Equal(t, http.StatusNotFound, serve("reader", "/?table=secrets").Code)
+	require.Equal(t, http.StatusNotFound, serve("stranger", "/?table=posts").Code)
+}
+
+func TestCacheIncludesTable(t *testing.T) {
+	c := &Cache{cfg: CacheConfig{IncludeTables: []string{"public.*", "*.orders"}, ExcludeTables: []string{"*.audit_*"}}}
+	for name, expected := range map[string]bool{
+		"public.users":      true,
+		"tenant_1.orders":   true,
+		"tenant_1.invoices": false,
+		"public.audit_log":  false,
+	} {
+		require.Equal(t, expected, c.includesTable(name), name)
+	}
+}
@@ -0,0 +1,188 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// GenerateModels writes Go source of package pkg declaring a struct for each table, with db and json tags,
+// pointer fields for nullable columns, and a string type with constants for each enum. Composite types are
+// declared as structs too. Tables are named after their table, prefixed by their schema if several schemas
+// have tables of the same name, e.g. table users gets type Users.
+//
+// Columns of types without a Go equivalent, e.g. arrays, are declared any.
+func GenerateModels(w io.Writer, pkg string, tables map[string]Table, types map[string]Type) error {
+	g := &modelGenerator{types: types, imports: map[string]bool{}}
+
+	tableKeys := slices.Sorted(maps.Keys(tables))
+	typeKeys := slices.Sorted(maps.Keys(types))
+
+	var body bytes.Buffer
+	for _, key := range typeKeys {
+		t := types[key]
+		name := g.typeName(t.Schema, t.Name, slices.ContainsFunc(typeKeys, func(k string) bool { return k != key && types[k].Name == t.Name }))
+		switch t.Kind {
+		case EnumType:
+			fmt.Fprintf(&body, "// %s is the enum type %s.\ntype %s string\n\nconst (\n", name, t.QualifiedName(), name)
+			for _, label := range t.Labels {
+				fmt.Fprintf(&body, "\t%s %s = %q\n", name+goName(label), name, label)
+			}
+			body.WriteString(")\n\n")
+		case CompositeType:
+			fmt.Fprintf(&body, "// %s is the composite type %s.\ntype %s struct {\n", name, t.QualifiedName(), name)
+			for _, f := range t.Fields {
+				g.writeField(&body, f)
+			}
+			body.WriteString("}\n\n")
+		}
+	}
+
+	for _, key := range tableKeys {
+		t := tables[key]
+		name := g.typeName(t.Schema, t.Name, slices.ContainsFunc(tableKeys, func(k string) bool { return k != key && tables[k].Name == t.Name }))
+		if t.Comment != "" {
+			body.WriteString(comment(name+" is the table "+t.Schema+"."+t.Name+": "+t.Comment, ""))
+		} else {
+			fmt.Fprintf(&body, "// %s is the table %s.%s.\n", name, t.Schema, t.Name)
+		}
+		fmt.Fprintf(&body, "type %s struct {\n", name)
+		for _, c := range t.Columns {
+			g.writeField(&body, c)
+		}
+		body.WriteString("}\n\n")
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by pgo gen models. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		src.WriteString("import (\n")
+		for _, imp := range slices.Sorted(maps.Keys(g.imports)) {
+			fmt.Fprintf(&src, "\t%q\n", imp)
+		}
+		src.WriteString(")\n\n")
+	}
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format generated models: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+type modelGenerator struct {
+	types   map[string]Type
+	imports map[string]bool
+}
+
+// typeName returns the Go name of a table or type, prefixed by its schema if its name is ambiguous.
+func (g *modelGenerator) typeName(schemaName, name string, ambiguous bool) string {
+	if ambiguous {
+		return goName(schemaName) + goName(name)
+	}
+	return goName(name)
+}
+
+func (g *modelGenerator) writeField(w io.Writer, c Column) {
+	if c.Comment != "" {
+		io.WriteString(w, comment(c.Comment, "\t"))
+	}
+	fmt.Fprintf(w, "\t%s %s `db:%q json:%q`\n", goName(c.Name), g.goType(c), c.Name, c.Name)
+}
+
+// goType returns the Go type of a column's values, a pointer if it's nullable.
+func (g *modelGenerator) goType(c Column) string {
+	typ := ""
+	if t, ok := g.types[c.Type]; ok && t.Kind != DomainType {
+		ambiguous := false
+		for _, other := range g.types {
+			if other.Name == t.Name && other.Schema != t.Schema {
+				ambiguous = true
+			}
+		}
+		typ = g.typeName(t.Schema, t.Name, ambiguous)
+	} else {
+		typ = g.builtinType(c.DataType)
+	}
+
+	if c.IsNullable && typ != "any" && !strings.HasPrefix(typ, "[]") && typ != "json.RawMessage" {
+		return "*" + typ
+	}
+	return typ
+}
+
+// builtinType maps a Postgres type, as named by information_schema or format_type, to a Go type.
+func (g *modelGenerator) builtinType(dataType string) string {
+	if i := strings.IndexByte(dataType, '('); i >= 0 {
+		dataType = dataType[:i] + dataType[strings.IndexByte(dataType, ')')+1:]
+	}
+	switch strings.TrimSpace(dataType) {
+	case "smallint":
+		return "int16"
+	case "integer":
+		return "int32"
+	case "bigint":
+		return "int64"
+	case "real":
+		return "float32"
+	case "double precision":
+		return "float64"
+	case "numeric":
+		g.imports["github.com/jackc/pgx/v5/pgtype"] = true
+		return "pgtype.Numeric"
+	case "boolean":
+		return "bool"
+	case "text", "character varying", "character", "uuid", "citext", "inet", "cidr", "macaddr", "interval":
+		return "string"
+	case "timestamp with time zone", "timestamp without time zone", "date":
+		g.imports["time"] = true
+		return "time.Time"
+	case "json", "jsonb":
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	case "bytea":
+		return "[]byte"
+	default:
+		return "any"
+	}
+}
+
+// initialisms are written in upper case in Go names, e.g. user_id becomes UserID.
+var initialisms = map[string]bool{
+	"api": true, "db": true, "http": true, "id": true, "ip": true, "json": true, "sql": true, "uri": true,
+	"url": true, "uuid": true,
+}
+
+// goName converts a Postgres identifier, e.g. user_id, to an exported Go identifier, e.g. UserID.
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		r := []rune(word)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// comment formats text as a Go comment indented by indent.
+func comment(text, indent string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		b.WriteString(indent + "// " + strings.TrimSpace(line) + "\n")
+	}
+	return b.String()
+}
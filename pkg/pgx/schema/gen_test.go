@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateModels(t *testing.T) {
+	types := map[string]Type{
+		"public.mood": {Schema: "public", Name: "mood", Kind: EnumType, Labels: []string{"happy", "sad"}},
+	}
+	tables := map[string]Table{
+		"public.users": {Schema: "public", Name: "users", Comment: "Registered users.", Columns: []Column{
+			{Name: "id", DataType: "bigint", IsPrimaryKey: true},
+			{Name: "email", DataType: "character varying", Comment: "Login email."},
+			{Name: "mood", DataType: "USER-DEFINED", Type: "public.mood", IsNullable: true},
+			{Name: "balance", DataType: "numeric", IsNullable: true},
+			{Name: "created_at", DataType: "timestamp with time zone"},
+			{Name: "profile", DataType: "jsonb", IsNullable: true},
+			{Name: "tags", DataType: "ARRAY", IsNullable: true},
+		}},
+		"api.users": {Schema: "api", Name: "users", Columns: []Column{{Name: "user_id", DataType: "uuid"}}},
+	}
+
+	var b strings.Builder
+	if err := GenerateModels(&b, "models", tables, types); err != nil {
+		t.Fatal(err)
+	}
+	src := b.String()
+	for _, want := range []string{
+		"// Code generated by pgo gen models. DO NOT EDIT.",
+		"package models",
+		`"encoding/json"`,
+		`"github.com/jackc/pgx/v5/pgtype"`,
+		"type Mood string",
+		`MoodHappy Mood = "happy"`,
+		"// PublicUsers is the table public.users: Registered users.",
+		"type PublicUsers struct {",
+		"type APIUsers struct {",
+		"\tUserID string `db:\"user_id\" json:\"user_id\"`",
+		"\t// Login email.\n\tEmail ",
+		"Mood      *Mood           `db:\"mood\" json:\"mood\"`",
+		"Balance   *pgtype.Numeric",
+		"CreatedAt time.Time",
+		"Profile   json.RawMessage",
+		"Tags      any",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source lacks %q:\n%s", want, src)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for name, want := range map[string]string{
+		"user_id":     "UserID",
+		"createdAt":   "CreatedAt",
+		"api_key":     "APIKey",
+		"2fa_enabled": "X2faEnabled",
+		"very-happy":  "VeryHappy",
+	} {
+		if got := goName(name); got != want {
+			t.Errorf("goName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/edgeflare/pgo/pkg/pgx"
+)
+
+// Privileges are the privileges granted to a role on a table.
+type Privileges struct {
+	// Table lists privileges on the whole table, e.g. SELECT, INSERT, UPDATE, DELETE.
+	Table []string
+	// Columns lists privileges granted on some columns only, by column.
+	Columns map[string][]string
+}
+
+// Grants holds the privileges granted to roles on tables, and the role memberships they're inherited through.
+// Privileges are read from the catalog's ACLs rather than information_schema, which only shows grants
+// involving the current user's roles.
+type Grants struct {
+	privileges map[string]map[string]Privileges // by role, then schema-qualified table
+	memberOf   map[string][]string              // roles a role inherits privileges of
+	superusers map[string]bool
+}
+
+// publicRole is the pseudo-role privileges granted to everyone are keyed by.
+const publicRole = "PUBLIC"
+
+// LoadPrivileges queries the privileges on the tables in the given schemas.
+func LoadPrivileges(ctx context.Context, conn pgx.Conn, schemaNames ...string) (*Grants, error) {
+	g := &Grants{
+		privileges: make(map[string]map[string]Privileges),
+		memberOf:   make(map[string][]string),
+		superusers: make(map[string]bool),
+	}
+
+	rows, err := conn.Query(ctx, `
+        SELECT coalesce(r.rolname, 'PUBLIC'), n.nspname || '.' || c.relname, '', a.privilege_type
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        CROSS JOIN aclexplode(coalesce(c.relacl, acldefault('r', c.relowner))) a
+        LEFT JOIN pg_roles r ON r.oid = a.grantee
+        WHERE n.nspname = ANY($1) AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+        UNION ALL
+        SELECT coalesce(r.rolname, 'PUBLIC'), n.nspname || '.' || c.relname, att.attname, a.privilege_type
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        JOIN pg_attribute att ON att.attrelid = c.oid AND att.attnum > 0 AND NOT att.attisdropped
+        CROSS JOIN aclexplode(att.attacl) a
+        LEFT JOIN pg_roles r ON r.oid = a.grantee
+        WHERE n.nspname = ANY($1) AND c.relkind IN ('r', 'p', 'v', 'm', 'f');
+    `, schemaNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privileges: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role, table, column, privilege string
+		if err := rows.Scan(&role, &table, &column, &privilege); err != nil {
+			return nil, fmt.Errorf("failed to get privileges: %w", err)
+		}
+		g.add(role, table, column, privilege)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get privileges: %w", err)
+	}
+
+	rows, err = conn.Query(ctx, `
+        SELECT r.rolname, m.rolname
+        FROM pg_auth_members am
+        JOIN pg_roles r ON r.oid = am.member
+        JOIN pg_roles m ON m.oid = am.roleid
+        WHERE r.rolinherit
+        UNION ALL
+        SELECT rolname, '' FROM pg_roles WHERE rolsuper;
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role memberships: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var role, memberOf string
+		if err := rows.Scan(&role, &memberOf); err != nil {
+			return nil, fmt.Errorf("failed to get role memberships: %w", err)
+		}
+		if memberOf == "" {
+			g.superusers[role] = true
+		} else {
+			g.memberOf[role] = append(g.memberOf[role], memberOf)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get role memberships: %w", err)
+	}
+
+	return g, nil
+}
+
+func (g *Grants) add(role, table, column, privilege string) {
+	tables, ok := g.privileges[role]
+	if !ok {
+		tables = make(map[string]Privileges)
+		g.privileges[role] = tables
+	}
+	p := tables[table]
+	if column == "" {
+		if !slices.Contains(p.Table, privilege) {
+			p.Table = append(p.Table, privilege)
+		}
+	} else {
+		if p.Columns == nil {
+			p.Columns = make(map[string][]string)
+		}
+		if !slices.Contains(p.Columns[column], privilege) {
+			p.Columns[column] = append(p.Columns[column], privilege)
+		}
+	}
+	tables[table] = p
+}
+
+// Direct returns the privileges granted to role itself on a schema-qualified table, not inherited ones.
+func (g *Grants) Direct(role, table string) Privileges {
+	return g.privileges[role][table]
+}
+
+// Has reports whether role has privilege on the whole of a schema-qualified table, granted to it, a role
+// it inherits privileges of, or PUBLIC. Superusers have every privilege.
+func (g *Grants) Has(role, table, privilege string) bool {
+	return g.any(role, table, func(p Privileges) bool { return slices.Contains(p.Table, privilege) })
+}
+
+// HasColumn reports whether role has privilege on a column of a schema-qualified table, through a grant on
+// the table or on the column.
+func (g *Grants) HasColumn(role, table, column, privilege string) bool {
+	return g.any(role, table, func(p Privileges) bool {
+		return slices.Contains(p.Table, privilege) || slices.Contains(p.Columns[column], privilege)
+	})
+}
+
+// hasSome reports whether role has privilege on the table or any of its columns.
+func (g *Grants) hasSome(role, table, privilege string) bool {
+	return g.any(role, table, func(p Privileges) bool {
+		if slices.Contains(p.Table, privilege) {
+			return true
+		}
+		for _, privs := range p.Columns {
+			if slices.Contains(privs, privilege) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Allow returns the HTTP methods role may use on a schema-qualified table, as listed in an Allow header.
+// Methods reading or writing some columns only are included.
+func (g *Grants) Allow(role, table string) []string {
+	methods := []string{"OPTIONS"}
+	if g.hasSome(role, table, "SELECT") {
+		methods = append(methods, "GET", "HEAD")
+	}
+	insert, update := g.hasSome(role, table, "INSERT"), g.hasSome(role, table, "UPDATE")
+	if insert {
+		methods = append(methods, "POST")
+	}
+	if insert && update {
+		methods = append(methods, "PUT")
+	}
+	if update {
+		methods = append(methods, "PATCH")
+	}
+	if g.Has(role, table, "DELETE") {
+		methods = append(methods, "DELETE")
+	}
+	return methods
+}
+
+// any reports whether fn holds for the privileges on table of role, a role it inherits privileges of, or
+// PUBLIC.
+func (g *Grants) any(role, table string, fn func(Privileges) bool) bool {
+	if g == nil {
+		return false
+	}
+	if g.superusers[role] {
+		return true
+	}
+
+	seen := map[string]bool{}
+	queue := []string{role, publicRole}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		if fn(g.privileges[r][table]) {
+			return true
+		}
+		queue = append(queue, g.memberOf[r]...)
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGrantsAllow(t *testing.T) {
+	g := &Grants{
+		privileges: map[string]map[string]Privileges{},
+		memberOf:   map[string][]string{"alice": {"editor"}, "editor": {"reader"}},
+		superusers: map[string]bool{"postgres": true},
+	}
+	g.add("reader", "public.posts", "", "SELECT")
+	g.add("editor", "public.posts", "", "INSERT")
+	g.add("editor", "public.posts", "title", "UPDATE")
+	g.add("PUBLIC", "public.stats", "", "SELECT")
+
+	tests := []struct {
+		role, table string
+		expected    []string
+	}{
+		{"alice", "public.posts", []string{"OPTIONS", "GET", "HEAD", "POST", "PUT", "PATCH"}},
+		{"reader", "public.posts", []string{"OPTIONS", "GET", "HEAD"}},
+		{"bob", "public.posts", []string{"OPTIONS"}},
+		{"bob", "public.stats", []string{"OPTIONS", "GET", "HEAD"}},
+		{"postgres", "public.posts", []string{"OPTIONS", "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}},
+	}
+	for _, tt := range tests {
+		if methods := g.Allow(tt.role, tt.table); !reflect.DeepEqual(methods, tt.expected) {
+			t.Errorf("Allow(%s, %s) = %v, want %v", tt.role, tt.table, methods, tt.expected)
+		}
+	}
+
+	if g.Has("alice", "public.posts", "UPDATE") {
+		t.Error("column UPDATE grant shouldn't cover the table")
+	}
+	if !g.HasColumn("alice", "public.posts", "title", "UPDATE") || g.HasColumn("alice", "public.posts", "body", "UPDATE") {
+		t.Error("HasColumn should report the title column only")
+	}
+}
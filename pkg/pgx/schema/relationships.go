@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"maps"
+	"slices"
+)
+
+// Cardinality is the cardinality of a relationship between tables.
+type Cardinality string
+
+const (
+	// ManyToOne relationships reference a table through a foreign key of the table, e.g. orders to users.
+	ManyToOne Cardinality = "many-to-one"
+	// OneToMany relationships are referenced by a foreign key of the related table, e.g. users to orders.
+	OneToMany Cardinality = "one-to-many"
+	// OneToOne relationships are through a foreign key that's also the primary key of its table.
+	OneToOne Cardinality = "one-to-one"
+	// ManyToMany relationships are through a junction table referencing both tables with foreign keys that are
+	// part of its primary key, e.g. users to groups through memberships.
+	ManyToMany Cardinality = "many-to-many"
+)
+
+// Relationship is a relationship of a table with a related table, e.g. for embedding related rows, joined
+// on Columns = RelatedColumns, or through Junction for many-to-many relationships.
+type Relationship struct {
+	Cardinality Cardinality
+	// Table and Related are schema-qualified table names.
+	Table   string
+	Related string
+	// Constraint is the foreign key constraint the relationship is through. For many-to-many relationships,
+	// it's the junction's constraint referencing Table, and RelatedConstraint the one referencing Related.
+	Constraint string
+	// Columns of Table are joined on RelatedColumns of Related, in order, or on JunctionColumns of Junction
+	// for many-to-many relationships.
+	Columns        []string
+	RelatedColumns []string
+	// Junction is the schema-qualified name of the junction table of many-to-many relationships, whose
+	// JunctionColumns reference Columns, and JunctionRelatedColumns reference RelatedColumns.
+	Junction               string
+	JunctionColumns        []string
+	JunctionRelatedColumns []string
+	RelatedConstraint      string
+}
+
+// foreignKeyConstraint is a foreign key constraint, with its columns grouped.
+type foreignKeyConstraint struct {
+	name              string
+	table, referenced string // schema-qualified
+	columns, refs     []string
+}
+
+func constraintsOf(t Table) []foreignKeyConstraint {
+	var constraints []foreignKeyConstraint
+	for _, fk := range t.ForeignKeys {
+		refSchema := fk.ReferencedSchema
+		if refSchema == "" {
+			refSchema = t.Schema
+		}
+		n := len(constraints)
+		if n == 0 || constraints[n-1].name != fk.Constraint || fk.Constraint == "" {
+			constraints = append(constraints, foreignKeyConstraint{
+				name:       fk.Constraint,
+				table:      t.Schema + "." + t.Name,
+				referenced: refSchema + "." + fk.ReferencedTable,
+			})
+			n++
+		}
+		constraints[n-1].columns = append(constraints[n-1].columns, fk.Column)
+		constraints[n-1].refs = append(constraints[n-1].refs, fk.ReferencedColumn)
+	}
+	return constraints
+}
+
+// isJunctionKey reports whether the columns of a foreign key of t are part of its primary key.
+func isJunctionKey(t Table, fk foreignKeyConstraint) bool {
+	for _, col := range fk.columns {
+		if !slices.Contains(t.PrimaryKey, col) {
+			return false
+		}
+	}
+	return true
+}
+
+// Relationships returns the relationships of the table with schema-qualified name among tables, keyed by
+// schema-qualified name as in Cache.Tables: many-to-one and one-to-one relationships through its foreign
+// keys, one-to-many relationships through foreign keys referencing it, and many-to-many relationships through
+// junction tables. A table may be related to another in several ways, e.g. orders referencing users as buyer
+// and seller, so consumers should disambiguate by Constraint.
+func Relationships(tables map[string]Table, name string) []Relationship {
+	table, ok := tables[name]
+	if !ok {
+		return nil
+	}
+
+	var rels []Relationship
+	for _, fk := range constraintsOf(table) {
+		cardinality := ManyToOne
+		if len(table.PrimaryKey) > 0 && slices.Equal(sorted(fk.columns), sorted(table.PrimaryKey)) {
+			cardinality = OneToOne
+		}
+		rels = append(rels, Relationship{
+			Cardinality:    cardinality,
+			Table:          name,
+			Related:        fk.referenced,
+			Constraint:     fk.name,
+			Columns:        fk.columns,
+			RelatedColumns: fk.refs,
+		})
+	}
+
+	for _, other := range slices.Sorted(maps.Keys(tables)) {
+		t := tables[other]
+		constraints := constraintsOf(t)
+		for _, fk := range constraints {
+			if fk.referenced != name {
+				continue
+			}
+			cardinality := OneToMany
+			if len(t.PrimaryKey) > 0 && slices.Equal(sorted(fk.columns), sorted(t.PrimaryKey)) {
+				cardinality = OneToOne
+			}
+			rels = append(rels, Relationship{
+				Cardinality:    cardinality,
+				Table:          name,
+				Related:        other,
+				Constraint:     fk.name,
+				Columns:        fk.refs,
+				RelatedColumns: fk.columns,
+			})
+
+			if !isJunctionKey(t, fk) {
+				continue
+			}
+			for _, relatedFK := range constraints {
+				if relatedFK.name == fk.name || !isJunctionKey(t, relatedFK) {
+					continue
+				}
+				rels = append(rels, Relationship{
+					Cardinality:            ManyToMany,
+					Table:                  name,
+					Related:                relatedFK.referenced,
+					Constraint:             fk.name,
+					Columns:                fk.refs,
+					RelatedColumns:         relatedFK.refs,
+					Junction:               other,
+					JunctionColumns:        fk.columns,
+					JunctionRelatedColumns: relatedFK.columns,
+					RelatedConstraint:      relatedFK.name,
+				})
+			}
+		}
+	}
+	return rels
+}
+
+// Relationships returns the relationships of a cached table, named as by Table, with other cached tables.
+func (c *Cache) Relationships(name string) []Relationship {
+	t, ok := c.Table(name)
+	if !ok {
+		return nil
+	}
+	return Relationships(c.Tables(), t.Schema+"."+t.Name)
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelationships(t *testing.T) {
+	tables := map[string]Table{
+		"public.users":  {Schema: "public", Name: "users", PrimaryKey: []string{"id"}},
+		"public.groups": {Schema: "public", Name: "groups", PrimaryKey: []string{"id"}},
+		"public.profiles": {Schema: "public", Name: "profiles", PrimaryKey: []string{"user_id"}, ForeignKeys: []ForeignKey{
+			{Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id", Constraint: "profiles_user_id_fkey", ReferencedSchema: "public"},
+		}},
+		"public.orders": {Schema: "public", Name: "orders", PrimaryKey: []string{"id"}, ForeignKeys: []ForeignKey{
+			{Column: "buyer_id", ReferencedTable: "users", ReferencedColumn: "id", Constraint: "orders_buyer_fkey", ReferencedSchema: "public"},
+		}},
+		"public.memberships": {Schema: "public", Name: "memberships", PrimaryKey: []string{"user_id", "group_id"}, ForeignKeys: []ForeignKey{
+			{Column: "group_id", ReferencedTable: "groups", ReferencedColumn: "id", Constraint: "memberships_group_fkey", ReferencedSchema: "public"},
+			{Column: "user_id", ReferencedTable: "users", ReferencedColumn: "id", Constraint: "memberships_user_fkey", ReferencedSchema: "public"},
+		}},
+	}
+
+	rels := Relationships(tables, "public.users")
+	byRelated := map[string]Relationship{}
+	for _, r := range rels {
+		byRelated[string(r.Cardinality)+" "+r.Related] = r
+	}
+	require.Len(t, rels, 4, "%+v", rels)
+
+	assert.Equal(t, Relationship{
+		Cardinality: OneToMany, Table: "public.users", Related: "public.orders", Constraint: "orders_buyer_fkey",
+		Columns: []string{"id"}, RelatedColumns: []string{"buyer_id"},
+	}, byRelated["one-to-many public.orders"])
+	assert.Contains(t, byRelated, "one-to-one public.profiles")
+	assert.Contains(t, byRelated, "one-to-many public.memberships")
+	assert.Equal(t, Relationship{
+		Cardinality: ManyToMany, Table: "public.users", Related: "public.groups", Constraint: "memberships_user_fkey",
+		Columns: []string{"id"}, RelatedColumns: []string{"id"},
+		Junction: "public.memberships", JunctionColumns: []string{"user_id"}, JunctionRelatedColumns: []string{"group_id"},
+		RelatedConstraint: "memberships_group_fkey",
+	}, byRelated["many-to-many public.groups"])
+
+	rels = Relationships(tables, "public.orders")
+	require.Len(t, rels, 1)
+	assert.Equal(t, ManyToOne, rels[0].Cardinality)
+	assert.Equal(t, "public.users", rels[0].Related)
+
+	assert.Nil(t, Relationships(tables, "public.missing"))
+}
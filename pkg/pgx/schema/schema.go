@@ -9,11 +9,33 @@ import (
 
 // Table represents a database table.
 type Table struct {
-	Schema      string
-	Name        string
+	Schema string
+	Name   string
+	// Comment is set with COMMENT ON TABLE, documenting the table.
+	Comment     string
 	Columns     []Column
 	PrimaryKey  []string
 	ForeignKeys []ForeignKey
+	// RLSEnabled is true if row level security is enabled on the table, and RLSForced if it applies to
+	// the table's owner too.
+	RLSEnabled bool
+	RLSForced  bool
+	// Policies are the row level security policies of the table.
+	Policies []Policy
+}
+
+// Policy represents a row level security policy.
+type Policy struct {
+	Name string
+	// Command is the command the policy applies to: ALL, SELECT, INSERT, UPDATE or DELETE.
+	Command string
+	// Permissive policies are combined with OR, restrictive ones with AND.
+	Permissive bool
+	// Roles the policy applies to, "public" for all roles.
+	Roles []string
+	// Using is the expression rows must satisfy to be visible, and WithCheck the one new rows must satisfy.
+	Using     string
+	WithCheck string
 }
 
 // Column represents a column in a table.
@@ -22,65 +44,132 @@ type Column struct {
 	DataType     string
 	IsNullable   bool
 	IsPrimaryKey bool
+	// Type is the schema-qualified name of the column's enum, composite or domain type, e.g. "public.mood",
+	// or empty for built-in types. DataType is "USER-DEFINED" for enums and composites, and the base type
+	// for domains.
+	Type string
+	// Default is the column's default expression, e.g. "now()", or nil if it has none.
+	Default *string
+	// IsIdentity is true for identity columns. IdentityGeneration is "ALWAYS" or "BY DEFAULT".
+	IsIdentity         bool
+	IdentityGeneration string
+	// IsGenerated is true for generated columns, computed by GenerationExpression.
+	IsGenerated          bool
+	GenerationExpression string
+	// Comment is set with COMMENT ON COLUMN, documenting the column.
+	Comment string
+}
+
+// IsReadOnly reports whether values can't be written to the column: it's generated, or an identity
+// generated always.
+func (c Column) IsReadOnly() bool {
+	return c.IsGenerated || (c.IsIdentity && c.IdentityGeneration == "ALWAYS")
+}
+
+// IsServerAssigned reports whether the server assigns the column's value when an insert omits it.
+func (c Column) IsServerAssigned() bool {
+	return c.Default != nil || c.IsIdentity || c.IsGenerated
+}
+
+// Column returns the named column of t.
+func (t Table) Column(name string) (Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Column{}, false
 }
 
-// ForeignKey represents a foreign key relationship.
+// WritableColumns returns the columns of t values can be inserted into or updated, skipping read-only ones.
+func (t Table) WritableColumns() []Column {
+	var cols []Column
+	for _, c := range t.Columns {
+		if !c.IsReadOnly() {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// ForeignKey represents a column of a foreign key relationship. Foreign keys of several columns have a
+// ForeignKey per column, with the same Constraint, in the key's column order.
 type ForeignKey struct {
 	Column           string
 	ReferencedTable  string
 	ReferencedColumn string
+	// Constraint is the name of the foreign key constraint, and ReferencedSchema the referenced table's schema.
+	Constraint       string
+	ReferencedSchema string
 }
 
 // Load queries and returns the tables in the given schema.
 func Load(ctx context.Context, conn pgx.Conn, schemaName string) (map[string]Table, error) {
-	tables, err := getTables(ctx, conn, schemaName)
+	return LoadTables(ctx, conn, schemaName)
+}
+
+// LoadTables queries and returns the named tables in the given schema, or all of them if no names are
+// given. Tables that don't exist are missing from the result.
+func LoadTables(ctx context.Context, conn pgx.Conn, schemaName string, tableNames ...string) (map[string]Table, error) {
+	tables, err := getTables(ctx, conn, schemaName, tableNames)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tables: %w", err)
 	}
+	if len(tables) == 0 {
+		return tables, nil
+	}
+
+	policies, err := getPolicies(ctx, conn, schemaName, tableNames)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policies: %w", err)
+	}
 
 	cache := make(map[string]Table)
-	for schema, tableName := range tables {
-		columns, primaryKey, err := getColumns(ctx, conn, schema, tableName)
+	for tableName, table := range tables {
+		columns, primaryKey, err := getColumns(ctx, conn, schemaName, tableName)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get columns for table %s: %w", tableName, err)
 		}
 
-		foreignKeys, err := getForeignKeys(ctx, conn, schema, tableName)
+		foreignKeys, err := getForeignKeys(ctx, conn, schemaName, tableName)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get foreign keys for table %s: %w", tableName, err)
 		}
 
-		cache[tableName] = Table{
-			Schema:      schema,
-			Name:        tableName,
-			Columns:     columns,
-			PrimaryKey:  primaryKey,
-			ForeignKeys: foreignKeys,
-		}
+		table.Columns, table.PrimaryKey, table.ForeignKeys = columns, primaryKey, foreignKeys
+		table.Policies = policies[tableName]
+		cache[tableName] = table
 	}
 
 	return cache, nil
 }
 
-// getTables returns a map of schema to table names
-func getTables(ctx context.Context, conn pgx.Conn, schemaName string) (map[string]string, error) {
+// getTables returns the tables in the given schema by name, without their columns and constraints.
+// If tableNames isn't empty, only the named tables are returned.
+func getTables(ctx context.Context, conn pgx.Conn, schemaName string, tableNames []string) (map[string]Table, error) {
 	rows, err := conn.Query(ctx, `
-        SELECT table_schema, table_name
-        FROM information_schema.tables
-        WHERE table_schema = $1 AND table_type = 'BASE TABLE';
-    `, schemaName)
+        SELECT
+            t.table_name,
+            coalesce(obj_description(c.oid, 'pg_class'), ''),
+            c.relrowsecurity,
+            c.relforcerowsecurity
+        FROM information_schema.tables t
+        JOIN pg_class c ON c.oid = format('%I.%I', t.table_schema, t.table_name)::regclass
+        WHERE t.table_schema = $1 AND t.table_type = 'BASE TABLE'
+            AND (coalesce(cardinality($2::text[]), 0) = 0 OR t.table_name = ANY($2));
+    `, schemaName, tableNames)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	tables := make(map[string]string)
+	tables := make(map[string]Table)
 	for rows.Next() {
-		var schema, tableName string
-		if err := rows.Scan(&schema, &tableName); err != nil {
+		t := Table{Schema: schemaName}
+		if err := rows.Scan(&t.Name, &t.Comment, &t.RLSEnabled, &t.RLSForced); err != nil {
 			return nil, err
 		}
-		tables[schema] = tableName
+		tables[t.Name] = t
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
@@ -105,9 +194,21 @@ func getColumns(ctx context.Context, conn pgx.Conn, schema, table string) ([]Col
                     AND tc.table_schema = $1
                     AND tc.table_name = $2
                     AND kcu.column_name = c.column_name
-            )) AS is_primary_key
+            )) AS is_primary_key,
+            CASE
+                WHEN c.domain_name IS NOT NULL THEN c.domain_schema || '.' || c.domain_name
+                WHEN c.data_type = 'USER-DEFINED' THEN c.udt_schema || '.' || c.udt_name
+                ELSE ''
+            END AS type,
+            c.column_default,
+            c.is_identity = 'YES',
+            coalesce(c.identity_generation, ''),
+            c.is_generated = 'ALWAYS',
+            coalesce(c.generation_expression, ''),
+            coalesce(col_description(format('%I.%I', c.table_schema, c.table_name)::regclass, c.ordinal_position), '')
         FROM information_schema.columns c
-        WHERE c.table_schema = $1 AND c.table_name = $2;
+        WHERE c.table_schema = $1 AND c.table_name = $2
+        ORDER BY c.ordinal_position;
     `, schema, table)
 	if err != nil {
 		return nil, nil, err
@@ -118,7 +219,8 @@ func getColumns(ctx context.Context, conn pgx.Conn, schema, table string) ([]Col
 	var primaryKey []string
 	for rows.Next() {
 		var col Column
-		if err := rows.Scan(&col.Name, &col.DataType, &col.IsNullable, &col.IsPrimaryKey); err != nil {
+		if err := rows.Scan(&col.Name, &col.DataType, &col.IsNullable, &col.IsPrimaryKey, &col.Type,
+			&col.Default, &col.IsIdentity, &col.IdentityGeneration, &col.IsGenerated, &col.GenerationExpression, &col.Comment); err != nil {
 			return nil, nil, err
 		}
 		columns = append(columns, col)
@@ -134,21 +236,20 @@ func getColumns(ctx context.Context, conn pgx.Conn, schema, table string) ([]Col
 }
 
 func getForeignKeys(ctx context.Context, conn pgx.Conn, schema, table string) ([]ForeignKey, error) {
+	// information_schema's constraint_column_usage can't pair the columns of multi-column keys, and misses
+	// keys referencing tables in other schemas
 	rows, err := conn.Query(ctx, `
-        SELECT
-            kcu.column_name,
-            ccu.table_name AS referenced_table,
-            ccu.column_name AS referenced_column
-        FROM information_schema.table_constraints AS tc
-        JOIN information_schema.key_column_usage AS kcu
-            ON tc.constraint_name = kcu.constraint_name
-            AND tc.table_schema = kcu.table_schema
-        JOIN information_schema.constraint_column_usage AS ccu
-            ON ccu.constraint_name = tc.constraint_name
-            AND ccu.table_schema = tc.table_schema
-        WHERE tc.constraint_type = 'FOREIGN KEY'
-            AND tc.table_schema = $1
-            AND tc.table_name = $2;
+        SELECT a.attname, rc.relname, ra.attname, con.conname, rn.nspname
+        FROM pg_constraint con
+        JOIN pg_class c ON c.oid = con.conrelid
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        JOIN pg_class rc ON rc.oid = con.confrelid
+        JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+        CROSS JOIN unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refattnum, i)
+        JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+        JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refattnum
+        WHERE con.contype = 'f' AND n.nspname = $1 AND c.relname = $2
+        ORDER BY con.conname, k.i;
     `, schema, table)
 	if err != nil {
 		return nil, err
@@ -158,7 +259,7 @@ func getForeignKeys(ctx context.Context, conn pgx.Conn, schema, table string) ([
 	var foreignKeys []ForeignKey
 	for rows.Next() {
 		var fk ForeignKey
-		if err := rows.Scan(&fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn); err != nil {
+		if err := rows.Scan(&fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn, &fk.Constraint, &fk.ReferencedSchema); err != nil {
 			return nil, err
 		}
 		foreignKeys = append(foreignKeys, fk)
@@ -169,3 +270,33 @@ func getForeignKeys(ctx context.Context, conn pgx.Conn, schema, table string) ([
 
 	return foreignKeys, nil
 }
+
+// getPolicies returns the row level security policies in the given schema by table name.
+func getPolicies(ctx context.Context, conn pgx.Conn, schemaName string, tableNames []string) (map[string][]Policy, error) {
+	rows, err := conn.Query(ctx, `
+        SELECT tablename, policyname, cmd, permissive = 'PERMISSIVE', roles::text[],
+            coalesce(qual, ''), coalesce(with_check, '')
+        FROM pg_policies
+        WHERE schemaname = $1 AND (coalesce(cardinality($2::text[]), 0) = 0 OR tablename = ANY($2))
+        ORDER BY tablename, policyname;
+    `, schemaName, tableNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := make(map[string][]Policy)
+	for rows.Next() {
+		var table string
+		var p Policy
+		if err := rows.Scan(&table, &p.Name, &p.Command, &p.Permissive, &p.Roles, &p.Using, &p.WithCheck); err != nil {
+			return nil, err
+		}
+		policies[table] = append(policies[table], p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
@@ -22,8 +22,11 @@ func TestLoadSchema(t *testing.T) {
 			id SERIAL PRIMARY KEY,
 			username VARCHAR(50) NOT NULL,
 			email VARCHAR(100) UNIQUE NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			email_lower TEXT GENERATED ALWAYS AS (lower(email)) STORED
 		);
+		COMMENT ON TABLE test_users IS 'Registered users';
+		COMMENT ON COLUMN test_users.email IS 'Login email';
 
 		CREATE TABLE test_orders (
 			id SERIAL PRIMARY KEY,
@@ -45,6 +48,7 @@ func TestLoadSchema(t *testing.T) {
 		assert.Equal(t, "public", usersTable.Schema)
 		assert.Equal(t, "test_users", usersTable.Name)
 		assert.Equal(t, []string{"id"}, usersTable.PrimaryKey)
+		assert.Equal(t, "Registered users", usersTable.Comment)
 
 		// Verify test_users columns
 		expectedUserColumns := map[string]Column{
@@ -53,6 +57,7 @@ func TestLoadSchema(t *testing.T) {
 				DataType:     "integer",
 				IsNullable:   false,
 				IsPrimaryKey: true,
+				Default:      ptr("nextval('test_users_id_seq'::regclass)"),
 			},
 			"username": {
 				Name:         "username",
@@ -65,12 +70,21 @@ func TestLoadSchema(t *testing.T) {
 				DataType:     "character varying",
 				IsNullable:   false,
 				IsPrimaryKey: false,
+				Comment:      "Login email",
 			},
 			"created_at": {
 				Name:         "created_at",
 				DataType:     "timestamp without time zone",
 				IsNullable:   true,
 				IsPrimaryKey: false,
+				Default:      ptr("CURRENT_TIMESTAMP"),
+			},
+			"email_lower": {
+				Name:                 "email_lower",
+				DataType:             "text",
+				IsNullable:           true,
+				IsGenerated:          true,
+				GenerationExpression: "lower((email)::text)",
 			},
 		}
 
@@ -79,6 +93,9 @@ func TestLoadSchema(t *testing.T) {
 			require.True(t, exists)
 			assert.Equal(t, expected, col)
 		}
+		emailLower, _ := usersTable.Column("email_lower")
+		assert.True(t, emailLower.IsReadOnly())
+		assert.Len(t, usersTable.WritableColumns(), 4)
 
 		// Verify test_orders table
 		ordersTable, exists := tables["test_orders"]
@@ -93,6 +110,8 @@ func TestLoadSchema(t *testing.T) {
 			Column:           "user_id",
 			ReferencedTable:  "test_users",
 			ReferencedColumn: "id",
+			Constraint:       "test_orders_user_id_fkey",
+			ReferencedSchema: "public",
 		}, ordersTable.ForeignKeys[0])
 	})
 
@@ -109,3 +128,5 @@ func TestLoadSchema(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,175 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/edgeflare/pgo/pkg/pgx"
+)
+
+// TypeKind is the kind of a user-defined type.
+type TypeKind string
+
+const (
+	EnumType      TypeKind = "enum"
+	CompositeType TypeKind = "composite"
+	DomainType    TypeKind = "domain"
+)
+
+// Type represents a user-defined enum, composite or domain type.
+type Type struct {
+	Schema string
+	Name   string
+	Kind   TypeKind
+	// Labels are the values of an enum, in order.
+	Labels []string
+	// Fields are the attributes of a composite type.
+	Fields []Column
+	// BaseType is the type a domain is based on, e.g. "character varying(255)".
+	BaseType string
+	// NotNull is true for domains declared NOT NULL.
+	NotNull bool
+	// Constraints are the CHECK constraints of a domain, e.g. "CHECK (VALUE > 0)".
+	Constraints []string
+}
+
+// QualifiedName returns the schema-qualified name of t, as referenced by Column.Type.
+func (t Type) QualifiedName() string {
+	return t.Schema + "." + t.Name
+}
+
+// Validate checks the value of a JSON decoded request against t, catching invalid values before they reach
+// Postgres: enum values must be one of the labels, composite values may only have t's fields, and NOT NULL
+// domains reject nulls. Domain CHECK constraints are left to Postgres.
+func (t Type) Validate(v any) error {
+	if v == nil {
+		if t.Kind == DomainType && t.NotNull {
+			return fmt.Errorf("%s must not be null", t.Name)
+		}
+		return nil
+	}
+
+	switch t.Kind {
+	case EnumType:
+		s, ok := v.(string)
+		if !ok || !slices.Contains(t.Labels, s) {
+			return fmt.Errorf("%s must be one of %s", t.Name, strings.Join(t.Labels, ", "))
+		}
+	case CompositeType:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be an object", t.Name)
+		}
+		for key := range m {
+			if !slices.ContainsFunc(t.Fields, func(f Column) bool { return f.Name == key }) {
+				return fmt.Errorf("%s has no field %s", t.Name, key)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadTypes queries and returns the user-defined enum, composite and domain types in the given schema,
+// by schema-qualified name.
+func LoadTypes(ctx context.Context, conn pgx.Conn, schemaName string) (map[string]Type, error) {
+	types := make(map[string]Type)
+
+	if err := loadEnums(ctx, conn, schemaName, types); err != nil {
+		return nil, fmt.Errorf("failed to get enum types: %w", err)
+	}
+	if err := loadComposites(ctx, conn, schemaName, types); err != nil {
+		return nil, fmt.Errorf("failed to get composite types: %w", err)
+	}
+	if err := loadDomains(ctx, conn, schemaName, types); err != nil {
+		return nil, fmt.Errorf("failed to get domain types: %w", err)
+	}
+
+	return types, nil
+}
+
+func loadEnums(ctx context.Context, conn pgx.Conn, schemaName string, types map[string]Type) error {
+	rows, err := conn.Query(ctx, `
+        SELECT t.typname, array_agg(e.enumlabel::text ORDER BY e.enumsortorder)
+        FROM pg_type t
+        JOIN pg_namespace n ON n.oid = t.typnamespace
+        JOIN pg_enum e ON e.enumtypid = t.oid
+        WHERE n.nspname = $1
+        GROUP BY t.typname;
+    `, schemaName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := Type{Schema: schemaName, Kind: EnumType}
+		if err := rows.Scan(&t.Name, &t.Labels); err != nil {
+			return err
+		}
+		types[t.QualifiedName()] = t
+	}
+	return rows.Err()
+}
+
+func loadComposites(ctx context.Context, conn pgx.Conn, schemaName string, types map[string]Type) error {
+	rows, err := conn.Query(ctx, `
+        SELECT t.typname, a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull
+        FROM pg_type t
+        JOIN pg_namespace n ON n.oid = t.typnamespace
+        JOIN pg_class c ON c.oid = t.typrelid AND c.relkind = 'c'
+        JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+        WHERE n.nspname = $1
+        ORDER BY t.typname, a.attnum;
+    `, schemaName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var field Column
+		if err := rows.Scan(&name, &field.Name, &field.DataType, &field.IsNullable); err != nil {
+			return err
+		}
+		key := schemaName + "." + name
+		t, ok := types[key]
+		if !ok {
+			t = Type{Schema: schemaName, Name: name, Kind: CompositeType}
+		}
+		t.Fields = append(t.Fields, field)
+		types[key] = t
+	}
+	return rows.Err()
+}
+
+func loadDomains(ctx context.Context, conn pgx.Conn, schemaName string, types map[string]Type) error {
+	rows, err := conn.Query(ctx, `
+        SELECT
+            t.typname,
+            format_type(t.typbasetype, t.typtypmod),
+            t.typnotnull,
+            coalesce(array_agg(pg_get_constraintdef(con.oid) ORDER BY con.conname)
+                FILTER (WHERE con.oid IS NOT NULL), '{}')
+        FROM pg_type t
+        JOIN pg_namespace n ON n.oid = t.typnamespace
+        LEFT JOIN pg_constraint con ON con.contypid = t.oid AND con.contype = 'c'
+        WHERE t.typtype = 'd' AND n.nspname = $1
+        GROUP BY t.oid, t.typname;
+    `, schemaName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := Type{Schema: schemaName, Kind: DomainType}
+		if err := rows.Scan(&t.Name, &t.BaseType, &t.NotNull, &t.Constraints); err != nil {
+			return err
+		}
+		types[t.QualifiedName()] = t
+	}
+	return rows.Err()
+}
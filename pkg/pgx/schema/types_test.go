@@ -0,0 +1,30 @@
+package schema
+
+import "testing"
+
+func TestTypeValidate(t *testing.T) {
+	mood := Type{Name: "mood", Kind: EnumType, Labels: []string{"sad", "happy"}}
+	address := Type{Name: "address", Kind: CompositeType, Fields: []Column{{Name: "street"}, {Name: "city"}}}
+	email := Type{Name: "email", Kind: DomainType, BaseType: "text", NotNull: true}
+
+	tests := []struct {
+		typ   Type
+		value any
+		valid bool
+	}{
+		{mood, "happy", true},
+		{mood, "angry", false},
+		{mood, 1.0, false},
+		{mood, nil, true},
+		{address, map[string]any{"street": "Main St"}, true},
+		{address, map[string]any{"zip": "12345"}, false},
+		{address, "Main St", false},
+		{email, "a@example.com", true},
+		{email, nil, false},
+	}
+	for _, tt := range tests {
+		if err := tt.typ.Validate(tt.value); (err == nil) != tt.valid {
+			t.Errorf("%s.Validate(%v) = %v, want valid %t", tt.typ.Name, tt.value, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultFetchSize is the number of rows SelectStream fetches at a time if fetchSize isn't positive.
+const DefaultFetchSize = 1000
+
+// cursorID numbers cursors, whose names must be unique in a transaction.
+var cursorID atomic.Uint64
+
+// SelectStream runs a query through a cursor, fetching fetchSize rows at a time, and yields its rows scanned
+// by scan, so results of millions of rows are processed in constant memory. The cursor is declared in a
+// read-only transaction begun with conn.BeginTx, which is open until iteration ends.
+//
+// Errors are yielded with a zero row, after which iteration ends.
+//
+//	for event, err := range pgx.SelectStream(ctx, pool, pgx.RowToStructByName[Event], 0, "SELECT * FROM events") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func SelectStream[T any](ctx context.Context, conn Conn, scan pgx.RowToFunc[T], fetchSize int, sql string, args ...any) iter.Seq2[T, error] {
+	if fetchSize <= 0 {
+		fetchSize = DefaultFetchSize
+	}
+	return func(yield func(T, error) bool) {
+		var zero T
+		tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+		if err != nil {
+			yield(zero, fmt.Errorf("failed to begin transaction: %w", err))
+			return
+		}
+		// the transaction only reads, so rolling it back is as good as committing
+		defer tx.Rollback(context.Background())
+
+		cursor := pgx.Identifier{fmt.Sprintf("pgo_stream_%d", cursorID.Add(1))}.Sanitize()
+		if _, err := tx.Exec(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursor, sql), args...); err != nil {
+			yield(zero, fmt.Errorf("failed to declare cursor: %w", err))
+			return
+		}
+
+		fetch := fmt.Sprintf("FETCH %d FROM %s", fetchSize, cursor)
+		for {
+			rows, err := tx.Query(ctx, fetch)
+			if err != nil {
+				yield(zero, fmt.Errorf("failed to fetch rows: %w", err))
+				return
+			}
+			batch, err := pgx.CollectRows(rows, scan)
+			if err != nil {
+				yield(zero, fmt.Errorf("failed to fetch rows: %w", err))
+				return
+			}
+			for _, row := range batch {
+				if !yield(row, nil) {
+					return
+				}
+			}
+			if len(batch) < fetchSize {
+				return
+			}
+		}
+	}
+}
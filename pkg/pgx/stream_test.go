@@ -0,0 +1,55 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestSelectStreamBeginError(t *testing.T) {
+	conn := &beginFailingConn{err: errors.New("connection refused")}
+	n := 0
+	for _, err := range SelectStream(context.Background(), conn, pgx.RowTo[int], 0, "SELECT 1") {
+		n++
+		if err == nil {
+			t.Error("expected an error")
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected the error to be yielded once, got %d yields", n)
+	}
+}
+
+func TestSelectStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, testConnString)
+	if err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	sum, count := 0, 0
+	for n, err := range SelectStream(ctx, conn, pgx.RowTo[int], 7, "SELECT generate_series(1, $1::int)", 100) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += n
+		count++
+	}
+	if count != 100 || sum != 5050 {
+		t.Errorf("expected 100 rows summing to 5050, got %d rows summing to %d", count, sum)
+	}
+
+	// stopping early releases the cursor's transaction
+	for range SelectStream(ctx, conn, pgx.RowTo[int], 7, "SELECT generate_series(1, 100)") {
+		break
+	}
+	if conn.PgConn().TxStatus() != 'I' {
+		t.Errorf("expected no open transaction, got status %c", conn.PgConn().TxStatus())
+	}
+}
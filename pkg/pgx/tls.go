@@ -0,0 +1,208 @@
+package pgx
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TLSOptions configures LoadTLS.
+type TLSOptions struct {
+	// CAFile is a PEM file of the CAs verifying the server's certificate, e.g. a managed Postgres provider's
+	// root certificate. The system's CAs are used if it's empty.
+	CAFile string
+	// CertFile and KeyFile are PEM files of a client certificate and its key, presented to servers requesting
+	// one, e.g. for cert authentication in pg_hba.conf or clientcert=verify-full.
+	CertFile string
+	KeyFile  string
+	// ServerName is the name the server's certificate must be valid for. Defaults to the host connected to.
+	ServerName string
+	// SkipHostnameVerification verifies the server's certificate chain, but not its name, like sslmode=verify-ca,
+	// e.g. for servers reached by IP address. Certificates are otherwise verified like sslmode=verify-full.
+	SkipHostnameVerification bool
+}
+
+// TLSCerts holds the certificates of TLSOptions, reloaded when their files change, e.g. when they're
+// rotated by cert-manager, so new connections use the current ones without recreating pools.
+type TLSCerts struct {
+	opts TLSOptions
+
+	mu       sync.RWMutex
+	roots    *x509.CertPool   // nil for the system's CAs
+	cert     *tls.Certificate // nil without a client certificate
+	modTimes map[string]time.Time
+}
+
+// LoadTLS loads the certificates of opts.
+func LoadTLS(opts TLSOptions) (*TLSCerts, error) {
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("both CertFile and KeyFile must be provided")
+	}
+	c := &TLSCerts{opts: opts}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the certificates' files again. The current certificates are kept if reading fails.
+func (c *TLSCerts) Reload() error {
+	modTimes, err := c.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	var roots *x509.CertPool
+	if c.opts.CAFile != "" {
+		pem, err := os.ReadFile(c.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", c.opts.CAFile)
+		}
+	}
+	var cert *tls.Certificate
+	if c.opts.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.opts.CertFile, c.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &pair
+	}
+
+	c.mu.Lock()
+	c.roots, c.cert, c.modTimes = roots, cert, modTimes
+	c.mu.Unlock()
+	return nil
+}
+
+// fileModTimes returns the modification times of the certificates' files.
+func (c *TLSCerts) fileModTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, name := range []string{c.opts.CAFile, c.opts.CertFile, c.opts.KeyFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate file: %w", err)
+		}
+		modTimes[name] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// Watch reloads the certificates when their files change, checking every interval, until ctx is done.
+// Failed reloads are logged and retried at the next check. Run it in a goroutine.
+func (c *TLSCerts) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modTimes, err := c.fileModTimes()
+		if err != nil {
+			log.Printf("pgx: checking TLS certificates: %v", err)
+			continue
+		}
+		c.mu.RLock()
+		changed := false
+		for name, t := range modTimes {
+			changed = changed || !t.Equal(c.modTimes[name])
+		}
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := c.Reload(); err != nil {
+			log.Printf("pgx: reloading TLS certificates: %v", err)
+			continue
+		}
+		log.Printf("pgx: reloaded TLS certificates")
+	}
+}
+
+// Config returns a TLS configuration for connections to host, verifying the server's certificate with the
+// current CAs and presenting the current client certificate, if any.
+func (c *TLSCerts) Config(host string) *tls.Config {
+	serverName := cmp.Or(c.opts.ServerName, host)
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		// verified by VerifyConnection instead, with the CAs current when connecting
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return c.verify(cs, serverName)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			if c.cert == nil {
+				// no certificate is sent
+				return &tls.Certificate{}, nil
+			}
+			return c.cert, nil
+		},
+	}
+}
+
+// verify verifies the server's certificate chain and, unless SkipHostnameVerification, name.
+func (c *TLSCerts) verify(cs tls.ConnectionState, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server sent no certificate")
+	}
+	c.mu.RLock()
+	opts := x509.VerifyOptions{Roots: c.roots, Intermediates: x509.NewCertPool()}
+	c.mu.RUnlock()
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if !c.opts.SkipHostnameVerification {
+		opts.DNSName = serverName
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// Configure configures cfg's connections to use TLS with the certificates, as ConfigureConn does.
+func (c *TLSCerts) Configure(cfg *pgxpool.Config) {
+	c.ConfigureConn(&cfg.ConnConfig.Config)
+}
+
+// ConfigureConn configures cfg's connections to use TLS with the certificates, e.g. those of a replication
+// connection, whatever the sslmode of their connection string. Fallbacks without TLS, of sslmode=prefer or
+// allow, are removed, so connections are never sent in plain text. Unix socket connections don't use TLS.
+func (c *TLSCerts) ConfigureConn(cfg *pgconn.Config) {
+	if !strings.HasPrefix(cfg.Host, "/") {
+		cfg.TLSConfig = c.Config(cfg.Host)
+	}
+	fallbacks := make([]*pgconn.FallbackConfig, 0, len(cfg.Fallbacks))
+	for _, fb := range cfg.Fallbacks {
+		if strings.HasPrefix(fb.Host, "/") {
+			fallbacks = append(fallbacks, fb)
+			continue
+		}
+		if fb.TLSConfig == nil {
+			continue
+		}
+		fallbacks = append(fallbacks, &pgconn.FallbackConfig{Host: fb.Host, Port: fb.Port, TLSConfig: c.Config(fb.Host)})
+	}
+	cfg.Fallbacks = fallbacks
+}
@@ -0,0 +1,137 @@
+package pgx
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testCert returns a certificate for name signed by parent, or self-signed if parent is nil, and its key.
+func testCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writePEM(t *testing.T, name, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKeyPair(t *testing.T, certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	t.Helper()
+	writePEM(t, certFile, "CERTIFICATE", cert.Raw)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, keyFile, "EC PRIVATE KEY", der)
+}
+
+func TestTLSCerts(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := testCert(t, "test CA", nil, nil)
+	server, _ := testCert(t, "db.example.com", ca, caKey)
+	client, clientKey := testCert(t, "app", ca, caKey)
+	opts := TLSOptions{
+		CAFile:   filepath.Join(dir, "ca.crt"),
+		CertFile: filepath.Join(dir, "tls.crt"),
+		KeyFile:  filepath.Join(dir, "tls.key"),
+	}
+	writePEM(t, opts.CAFile, "CERTIFICATE", ca.Raw)
+	writeKeyPair(t, opts.CertFile, opts.KeyFile, client, clientKey)
+
+	certs, err := LoadTLS(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{server}}
+	if err := certs.Config("db.example.com").VerifyConnection(state); err != nil {
+		t.Errorf("expected the server's certificate verified: %v", err)
+	}
+	if err := certs.Config("10.0.0.1").VerifyConnection(state); err == nil {
+		t.Error("expected a certificate for another name rejected")
+	}
+	other, _ := testCert(t, "db.example.com", nil, nil)
+	if err := certs.Config("db.example.com").VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{other}}); err == nil {
+		t.Error("expected a certificate of another CA rejected")
+	}
+
+	// a rotated client certificate is presented by new connections of configs created before
+	cfg := certs.Config("db.example.com")
+	rotated, rotatedKey := testCert(t, "app", ca, caKey)
+	writeKeyPair(t, opts.CertFile, opts.KeyFile, rotated, rotatedKey)
+	if err := certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	presented, err := cfg.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(presented.Certificate[0]) != string(rotated.Raw) {
+		t.Error("expected the rotated client certificate")
+	}
+
+	// a failed reload keeps the certificates
+	os.WriteFile(opts.CAFile, []byte("garbage"), 0o600)
+	if err := certs.Reload(); err == nil {
+		t.Error("expected an invalid CA file rejected")
+	}
+	if err := cfg.VerifyConnection(state); err != nil {
+		t.Errorf("expected the previous CAs kept: %v", err)
+	}
+}
+
+func TestTLSCertsConfigure(t *testing.T) {
+	certs := &TLSCerts{opts: TLSOptions{ServerName: "db.internal"}}
+	cfg, err := pgxpool.ParseConfig("postgres://app@db.example.com/app?sslmode=prefer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs.Configure(cfg)
+	if cfg.ConnConfig.TLSConfig == nil || cfg.ConnConfig.TLSConfig.ServerName != "db.internal" {
+		t.Errorf("expected TLS with the configured server name, got %+v", cfg.ConnConfig.TLSConfig)
+	}
+	for _, fb := range cfg.ConnConfig.Fallbacks {
+		if fb.TLSConfig == nil {
+			t.Error("expected the plain text fallback removed")
+		}
+	}
+}
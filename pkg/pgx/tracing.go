@@ -0,0 +1,98 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/tracelog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/edgeflare/pgo/pkg/pgx"
+
+// Tracer is a pgx.QueryTracer recording each query as an OpenTelemetry client span,
+// a child of the span in the query's context, e.g. the request span started by middleware.Tracing.
+type Tracer struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+// NewTracer returns a Tracer creating spans with tp, or the global TracerProvider if tp is nil.
+func NewTracer(tp trace.TracerProvider, attrs ...attribute.KeyValue) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{
+		tracer: tp.Tracer(tracerName),
+		attrs:  append([]attribute.KeyValue{attribute.String("db.system", "postgresql")}, attrs...),
+	}
+}
+
+// TraceQueries configures cfg's connections to record queries as spans created with tp,
+// or the global TracerProvider if tp is nil.
+func TraceQueries(cfg *pgxpool.Config, tp trace.TracerProvider) {
+	cfg.ConnConfig.Tracer = NewTracer(tp, attribute.String("db.namespace", cfg.ConnConfig.Database))
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *Tracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = t.tracer.Start(ctx, querySpanName(data.SQL), trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.attrs...),
+		trace.WithAttributes(attribute.String("db.query.text", data.SQL)),
+	)
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.response.returned_rows", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// querySpanName names a query span by its SQL command, e.g. SELECT, keeping span names low-cardinality.
+func querySpanName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// NewQueryLogger returns a tracer logging queries, their duration and errors at or above level with
+// log.Printf, e.g. tracelog.LogLevelError for failed queries only, or tracelog.LogLevelInfo for every query.
+func NewQueryLogger(level tracelog.LogLevel) *tracelog.TraceLog {
+	return &tracelog.TraceLog{
+		LogLevel: level,
+		Logger: tracelog.LoggerFunc(func(_ context.Context, level tracelog.LogLevel, msg string, data map[string]any) {
+			log.Printf("pgx %s: %s%s", level, msg, formatLogData(data))
+		}),
+	}
+}
+
+// formatLogData formats a query log's data as sorted key=value pairs, e.g. " sql=SELECT 1 time=1ms".
+func formatLogData(data map[string]any) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, data[k])
+	}
+	return b.String()
+}
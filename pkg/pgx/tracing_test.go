@@ -0,0 +1,43 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ pgx.QueryTracer = (*Tracer)(nil)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	qctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "  select * from users where id = $1"})
+	tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+	qctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "delete from users"})
+	tracer.TraceQueryEnd(qctx, nil, pgx.TraceQueryEndData{Err: errors.New("permission denied")})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	if spans[0].Name() != "SELECT" || spans[1].Name() != "DELETE" {
+		t.Errorf("span names = %q, %q, want SELECT, DELETE", spans[0].Name(), spans[1].Name())
+	}
+	for _, s := range spans[:2] {
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s span isn't a child of the request span", s.Name())
+		}
+	}
+	if spans[1].Status().Code.String() != "Error" {
+		t.Errorf("failed query status = %v, want Error", spans[1].Status().Code)
+	}
+}
@@ -0,0 +1,73 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TxRetryOptions configures WithTxRetry.
+type TxRetryOptions struct {
+	// IsoLevel is the transaction's isolation level. Defaults to serializable.
+	IsoLevel   pgx.TxIsoLevel
+	AccessMode pgx.TxAccessMode
+	// MaxAttempts caps how many times the transaction is run. Defaults to 5.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, growing exponentially up to MaxBackoff.
+	// Defaults to 10ms and 1s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// WithTxRetry runs fn in a transaction, committing it if fn returns nil and rolling it back otherwise.
+// Transactions failing with a serialization failure (40001) or deadlock (40P01) are retried with jittered
+// exponential backoff, as PostgreSQL expects of serializable transactions, until MaxAttempts is reached or
+// ctx is done. fn may be run several times, so it shouldn't have side effects outside the transaction.
+//
+//	err := pgx.WithTxRetry(ctx, pool, pgx.TxRetryOptions{}, func(tx pgx.Tx) error {
+//		_, err := tx.Exec(ctx, "UPDATE accounts SET balance = balance - $1 WHERE id = $2", amount, id)
+//		return err
+//	})
+func WithTxRetry(ctx context.Context, conn Conn, opts TxRetryOptions, fn func(tx pgx.Tx) error) error {
+	if opts.IsoLevel == "" {
+		opts.IsoLevel = pgx.Serializable
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 10 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Second
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = opts.InitialBackoff
+	b.MaxInterval = opts.MaxBackoff
+	b.MaxElapsedTime = 0
+
+	txOptions := pgx.TxOptions{IsoLevel: opts.IsoLevel, AccessMode: opts.AccessMode}
+	operation := func() error {
+		err := pgx.BeginTxFunc(ctx, conn, txOptions, fn)
+		if err != nil && !IsRetryable(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}
+	return backoff.Retry(operation, backoff.WithContext(backoff.WithMaxRetries(b, uint64(opts.MaxAttempts-1)), ctx))
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock, after which the transaction
+// can be retried.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package pgx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// beginFailingConn is a Conn failing to begin transactions with err.
+type beginFailingConn struct {
+	Conn
+	err      error
+	attempts int
+	opts     pgx.TxOptions
+}
+
+func (c *beginFailingConn) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	c.attempts++
+	c.opts = opts
+	return nil, c.err
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "40001"}, true},
+		{fmt.Errorf("commit: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithTxRetry(t *testing.T) {
+	fn := func(tx pgx.Tx) error { return nil }
+	opts := TxRetryOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	conn := &beginFailingConn{err: &pgconn.PgError{Code: "40001"}}
+	if err := WithTxRetry(context.Background(), conn, opts, fn); !IsRetryable(err) {
+		t.Errorf("expected serialization failure, got %v", err)
+	}
+	if conn.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", conn.attempts)
+	}
+	if conn.opts.IsoLevel != pgx.Serializable {
+		t.Errorf("expected serializable isolation, got %q", conn.opts.IsoLevel)
+	}
+
+	conn = &beginFailingConn{err: &pgconn.PgError{Code: "23505"}}
+	opts.IsoLevel = pgx.RepeatableRead
+	if err := WithTxRetry(context.Background(), conn, opts, fn); err == nil {
+		t.Error("expected error")
+	}
+	if conn.attempts != 1 {
+		t.Errorf("expected no retries of permanent errors, got %d attempts", conn.attempts)
+	}
+	if conn.opts.IsoLevel != pgx.RepeatableRead {
+		t.Errorf("expected repeatable read isolation, got %q", conn.opts.IsoLevel)
+	}
+}
+
+func TestWithTxRetryDB(t *testing.T) {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, testConnString)
+	if err != nil {
+		t.Skipf("failed to connect to database: %v", err)
+	}
+	defer conn.Close(ctx)
+
+	attempts := 0
+	err = WithTxRetry(ctx, conn, TxRetryOptions{}, func(tx pgx.Tx) error {
+		attempts++
+		if attempts == 1 {
+			return &pgconn.PgError{Code: "40001"}
+		}
+		var n int
+		return tx.QueryRow(ctx, "SELECT 1").Scan(&n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
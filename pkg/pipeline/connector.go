@@ -3,6 +3,8 @@ package pipeline
 import (
 	"encoding/json"
 	"errors"
+	"maps"
+	"slices"
 
 	"github.com/edgeflare/pgo/pkg/pglogrepl"
 )
@@ -56,3 +58,8 @@ const (
 func RegisterConnector(name string, c Connector) {
 	connectors[name] = c
 }
+
+// Connectors returns the names of the registered connectors, sorted.
+func Connectors() []string {
+	return slices.Sorted(maps.Keys(connectors))
+}
@@ -203,8 +203,9 @@ func (p *PeerGRPC) Sub(args ...any) (<-chan pglogrepl.CDC, error) {
 						Lsn       int64  `json:"lsn"`
 						Xmin      *int64 `json:"xmin,omitempty"`
 					} `json:"source"`
-					Op          string `json:"op"`
-					TsMs        int64  `json:"ts_ms"`
+					Op          string                    `json:"op"`
+					TsMs        int64                     `json:"ts_ms"`
+					Message     *pglogrepl.LogicalMessage `json:"message,omitempty"`
 					Transaction *struct {
 						Id                  string `json:"id"`
 						TotalOrder          int64  `json:"total_order"`
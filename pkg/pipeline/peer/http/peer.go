@@ -61,6 +61,9 @@ type RetryConfig struct {
 	MaxRetries  int           `json:"maxRetries"`
 	InitialWait time.Duration `json:"initialWait"`
 	MaxWait     time.Duration `json:"maxWait"`
+	// Budget caps the total time spent delivering an event to an endpoint, retries included.
+	// Defaults to MaxRetries * MaxWait.
+	Budget time.Duration `json:"budget,omitempty"`
 }
 
 // EndpointConfig represents configuration for a single endpoint
@@ -208,6 +211,7 @@ func (p *PeerHTTP) Pub(event pglogrepl.CDC, args ...any) error {
 		config.MaxRetries = p.retryConfig.MaxRetries
 		config.InitialBackoff = p.retryConfig.InitialWait
 		config.MaxBackoff = p.retryConfig.MaxWait
+		config.RetryBudget = p.retryConfig.Budget
 
 		resp, err := httputil.Request(context.Background(), config, payload)
 		if err != nil {
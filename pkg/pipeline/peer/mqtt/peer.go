@@ -193,8 +193,9 @@ func (p *PeerMQTT) parseMessage(prefix string, msg mqtt.Message) (pglogrepl.CDC,
 				Lsn       int64  `json:"lsn"`
 				Xmin      *int64 `json:"xmin,omitempty"`
 			} `json:"source"`
-			Op          string `json:"op"`
-			TsMs        int64  `json:"ts_ms"`
+			Op          string                    `json:"op"`
+			TsMs        int64                     `json:"ts_ms"`
+			Message     *pglogrepl.LogicalMessage `json:"message,omitempty"`
 			Transaction *struct {
 				Id                  string `json:"id"`
 				TotalOrder          int64  `json:"total_order"`
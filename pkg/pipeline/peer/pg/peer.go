@@ -3,9 +3,14 @@ package pg
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/edgeflare/pgo/pkg/pglogrepl"
 	"github.com/edgeflare/pgo/pkg/pgx"
@@ -20,8 +25,23 @@ type PeerPG struct {
 	pipeline.Peer
 	pool        *pgxpool.Pool  // used for Pub
 	conn        *pgconn.PgConn // used for Sub
+	connString  string         // used to re-dial Sub's replication connection
+	connStrings []string       // replication connections of several databases streamed by Sub
 	schemaCache map[string]schema.Table
 	mu          sync.RWMutex
+
+	// inserts are buffered and copied in batches if batchSize > 0
+	batchSize int
+	batchMu   sync.Mutex
+	batch     []insert
+	flushErr  error // of the last periodic flush, returned by the next Pub
+	stopFlush chan struct{}
+}
+
+// insert is a buffered insert of a row.
+type insert struct {
+	schema, table string
+	row           map[string]any
 }
 
 func (p *PeerPG) Connect(config json.RawMessage, args ...any) error {
@@ -30,6 +50,16 @@ func (p *PeerPG) Connect(config json.RawMessage, args ...any) error {
 
 	var cfg struct {
 		ConnString string `json:"connString"`
+		// ConnStrings lists replication connection strings of several databases to stream from one peer.
+		// Each database gets its own replication slot, named after it, e.g. pgo_logrepl_orders.
+		ConnStrings []string `json:"connStrings"`
+		// BatchSize buffers up to this many inserted rows, copying them with COPY, which loads much faster
+		// than inserting rows one by one. Updates and deletes flush the buffer first, keeping events in order.
+		// If COPY fails, the batch is inserted row by row, so only the rows failing to insert are lost; they're
+		// reported by Pub. Rows are kept for the next flush while the database can't be reached.
+		BatchSize int `json:"batchSize"`
+		// FlushInterval is the longest rows are buffered, e.g. "500ms". Defaults to 1s.
+		FlushInterval string `json:"flushInterval"`
 	}
 	var err error
 	ctx := context.Background()
@@ -38,6 +68,17 @@ func (p *PeerPG) Connect(config json.RawMessage, args ...any) error {
 		return fmt.Errorf("error parsing config: %w", err)
 	}
 
+	if len(cfg.ConnStrings) > 0 {
+		for _, connString := range cfg.ConnStrings {
+			if !strings.Contains(connString, "replication=database") {
+				return fmt.Errorf("connStrings must be replication connections")
+			}
+		}
+		// connections are dialed by Sub
+		p.connStrings = cfg.ConnStrings
+		return nil
+	}
+
 	connString := cfg.ConnString
 	if connString == "" {
 		return fmt.Errorf("missing connection string in config")
@@ -50,6 +91,7 @@ func (p *PeerPG) Connect(config json.RawMessage, args ...any) error {
 		if err != nil {
 			return fmt.Errorf("failed to connect to PostgreSQL server %w", err)
 		}
+		p.connString = cfg.ConnString
 		return nil
 	}
 
@@ -66,10 +108,92 @@ func (p *PeerPG) Connect(config json.RawMessage, args ...any) error {
 	}
 
 	p.pool = pool
+
+	if cfg.BatchSize > 0 {
+		interval := time.Second
+		if cfg.FlushInterval != "" {
+			if interval, err = time.ParseDuration(cfg.FlushInterval); err != nil || interval <= 0 {
+				pool.Close()
+				return fmt.Errorf("invalid flushInterval %q", cfg.FlushInterval)
+			}
+		}
+		p.batchSize = cfg.BatchSize
+		p.stopFlush = make(chan struct{})
+		go p.flushPeriodically(interval)
+	}
 	return nil
 }
 
-func (p *PeerPG) Pub(event pglogrepl.CDC, args ...any) error {
+// flushPeriodically copies buffered rows every interval until Disconnect.
+func (p *PeerPG) flushPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopFlush:
+			return
+		case <-ticker.C:
+			if err := p.flush(context.Background()); err != nil {
+				log.Printf("pg peer: %v", err)
+				p.batchMu.Lock()
+				p.flushErr = errors.Join(p.flushErr, err)
+				p.batchMu.Unlock()
+			}
+		}
+	}
+}
+
+// flush copies the buffered rows, in batches of consecutive rows of the same table. Batches COPY fails on
+// are inserted row by row, dropping the rows failing to insert, whose errors are returned. If the database
+// can't be reached (see isConnectionError), the rows not inserted yet are kept for the next flush.
+func (p *PeerPG) flush(ctx context.Context) error {
+	p.batchMu.Lock()
+	defer p.batchMu.Unlock()
+
+	var errs []error
+	for len(p.batch) > 0 {
+		first := p.batch[0]
+		n := 1
+		for n < len(p.batch) && p.batch[n].schema == first.schema && p.batch[n].table == first.table {
+			n++
+		}
+		rows := make([]map[string]any, n)
+		for i, ins := range p.batch[:n] {
+			rows[i] = ins.row
+		}
+		if _, err := pgx.CopyRows(ctx, p.pool, first.table, slices.Values(rows), first.schema); err == nil {
+			p.batch = p.batch[n:]
+			continue
+		} else if isConnectionError(err) {
+			return errors.Join(append(errs, fmt.Errorf("failed to copy %d rows into %s: %w", n, first.table, err))...)
+		}
+
+		// COPY is all or nothing, so one bad row fails the batch, e.g. a row violating a constraint, or one
+		// with keys the first row doesn't have
+		for i, row := range rows {
+			if err := pgx.InsertRow(ctx, p.pool, first.table, row, first.schema); err != nil {
+				if isConnectionError(err) {
+					p.batch = p.batch[i:]
+					return errors.Join(append(errs, fmt.Errorf("failed to insert row into %s: %w", first.table, err))...)
+				}
+				errs = append(errs, fmt.Errorf("failed to insert row into %s: %w", first.table, err))
+			}
+		}
+		p.batch = p.batch[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// isConnectionError reports whether err is a failure to reach the database, which retrying may fix,
+// rather than an error of the rows, e.g. a constraint violation or a value that can't be converted.
+func isConnectionError(err error) bool {
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) || errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func (p *PeerPG) Pub(event pglogrepl.CDC, args ...any) (err error) {
 	if p.pool == nil {
 		return fmt.Errorf("database connection not initialized")
 	}
@@ -89,6 +213,32 @@ func (p *PeerPG) Pub(event pglogrepl.CDC, args ...any) error {
 	ctx := context.Background()
 
 	op := event.Payload.Op
+	if p.batchSize > 0 {
+		// rows of periodic flushes that failed are reported here, once
+		p.batchMu.Lock()
+		flushErr := p.flushErr
+		p.flushErr = nil
+		p.batchMu.Unlock()
+		if flushErr != nil {
+			defer func() { err = errors.Join(flushErr, err) }()
+		}
+
+		if row, ok := event.Payload.After.(map[string]any); ok && op == "c" {
+			p.batchMu.Lock()
+			p.batch = append(p.batch, insert{schema: schemaName, table: tableName, row: row})
+			full := len(p.batch) >= p.batchSize
+			p.batchMu.Unlock()
+			if full {
+				return p.flush(ctx)
+			}
+			return nil
+		}
+		// keep events in order
+		if err := p.flush(ctx); err != nil {
+			return err
+		}
+	}
+
 	switch op {
 	case "c":
 		if err := pgx.InsertRow(ctx, p.pool, tableName, event.Payload.After, schemaName); err != nil {
@@ -169,8 +319,20 @@ func (p *PeerPG) Sub(args ...any) (<-chan pglogrepl.CDC, error) {
 
 	ctx := context.Background()
 
+	if len(p.connStrings) > 0 {
+		configs := make([]pglogrepl.Config, len(p.connStrings))
+		for i, connString := range p.connStrings {
+			configs[i] = pglogrepl.Config{ConnString: connString}
+		}
+		cdcChan, err := pglogrepl.StartAll(ctx, configs, publicationTables...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start CDC streaming: %w", err)
+		}
+		return cdcChan, nil
+	}
+
 	// Start CDC streaming
-	cdcChan, err := pglogrepl.Main(ctx, p.conn, publicationTables...)
+	cdcChan, err := pglogrepl.Start(ctx, p.conn, pglogrepl.Config{ConnString: p.connString}, publicationTables...)
 	if err != nil {
 		p.conn.Close(ctx)
 		return nil, fmt.Errorf("failed to start CDC streaming: %w", err)
@@ -199,6 +361,15 @@ func (p *PeerPG) Type() pipeline.ConnectorType {
 }
 
 func (p *PeerPG) Disconnect() error {
+	if p.stopFlush != nil {
+		close(p.stopFlush)
+		p.stopFlush = nil
+		err := p.flush(context.Background())
+		p.batchMu.Lock()
+		defer p.batchMu.Unlock()
+		err, p.flushErr = errors.Join(p.flushErr, err), nil
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,83 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "23505"}, false},
+		{fmt.Errorf(`column "name" isn't in the first row`), false},
+		{fmt.Errorf("copy: %w", context.DeadlineExceeded), true},
+		{&pgconn.ConnectError{}, true},
+	}
+	for _, tt := range tests {
+		if got := isConnectionError(tt.err); got != tt.want {
+			t.Errorf("isConnectionError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestFlushMixedKeys(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	connString := os.Getenv("TEST_DATABASE")
+	pool, err := pgxpool.New(ctx, connString)
+	if err == nil {
+		err = pool.Ping(ctx)
+	}
+	if err != nil {
+		t.Skipf("no test database: %v", err)
+	}
+	defer pool.Close()
+	if _, err := pool.Exec(ctx, `DROP TABLE IF EXISTS pg_peer_flush_test; CREATE TABLE pg_peer_flush_test (id int8 PRIMARY KEY, name text)`); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Exec(context.Background(), `DROP TABLE pg_peer_flush_test`)
+
+	var p PeerPG
+	config, _ := json.Marshal(map[string]any{"connString": connString, "batchSize": 10, "flushInterval": "1h"})
+	if err := p.Connect(config); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Disconnect()
+
+	// COPY fails client-side on the second row, whose keys the first row doesn't have
+	for _, row := range []map[string]any{{"id": 1}, {"id": 2, "name": "b"}, {"id": 1, "name": "duplicate"}} {
+		var event pglogrepl.CDC
+		event.Payload.Op = "c"
+		event.Payload.Source.Schema = "public"
+		event.Payload.Source.Table = "pg_peer_flush_test"
+		event.Payload.After = row
+		if err := p.Pub(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = p.flush(ctx)
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		t.Errorf("expected the duplicate row's unique violation, got %v", err)
+	}
+	if len(p.batch) != 0 {
+		t.Errorf("expected the batch to be flushed, %d rows left", len(p.batch))
+	}
+	var n int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM pg_peer_flush_test`).Scan(&n); err != nil || n != 2 {
+		t.Errorf("got %d rows, %v, want 2", n, err)
+	}
+}
@@ -28,7 +28,7 @@ func (c *FilterConfig) Validate() error {
 		}
 	}
 
-	validOps := map[string]bool{"c": true, "u": true, "d": true, "r": true}
+	validOps := map[string]bool{"c": true, "u": true, "d": true, "r": true, "t": true, "m": true}
 	for _, op := range c.Operations {
 		if !validOps[op] {
 			return fmt.Errorf("invalid operation: %s", op)
@@ -60,8 +60,8 @@ func Filter(config *FilterConfig) TransformFunc {
 	}
 
 	return func(cdc *pglogrepl.CDC) (*pglogrepl.CDC, error) {
-		// Validate CDC event structure
-		if cdc == nil || cdc.Payload.Source.Schema == "" || cdc.Payload.Source.Table == "" {
+		// Validate CDC event structure. Logical decoding messages (op=m) aren't tied to a table.
+		if cdc == nil || (cdc.Payload.Op != "m" && (cdc.Payload.Source.Schema == "" || cdc.Payload.Source.Table == "")) {
 			return nil, fmt.Errorf("invalid CDC event: missing schema or table")
 		}
 
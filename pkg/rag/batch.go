@@ -0,0 +1,149 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// maxUpdateRows caps the rows of an UPDATE, as a statement takes up to 65535 parameters.
+const maxUpdateRows = 65535 / 4
+
+func (c *Client) batchSize() int {
+	return min(max(c.Config.BatchSize, 1), maxUpdateRows)
+}
+
+func (c *Client) concurrency() int {
+	return max(c.Config.Concurrency, 1)
+}
+
+// embedBatches fetches the embeddings of input in batches of Config.BatchSize, up to Config.Concurrency
+// batches at once. Rate limited batches are retried with backoff.
+func (c *Client) embedBatches(ctx context.Context, input []string) ([][]float32, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	embeddings := make([][]float32, len(input))
+	batchSize := c.batchSize()
+	sem := make(chan struct{}, c.concurrency())
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for start := 0; start < len(input); start += batchSize {
+		end := min(start+batchSize, len(input))
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			batch, err := c.fetchWithBackoff(ctx, input[start:end])
+			if err == nil && len(batch) != end-start {
+				err = fmt.Errorf("mismatch between contents and embeddings length: %d vs %d", end-start, len(batch))
+			}
+			if err != nil {
+				once.Do(func() { firstErr = err; cancel() })
+				return
+			}
+			copy(embeddings[start:end], batch)
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// fetchWithBackoff fetches the embeddings of input, retrying with exponential backoff, or after the delay
+// the provider asks for, while it rate limits requests, up to Config.RateLimitTimeout.
+func (c *Client) fetchWithBackoff(ctx context.Context, input []string) ([][]float32, error) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = time.Minute
+	b.MaxElapsedTime = cmp.Or(c.Config.RateLimitTimeout, 5*time.Minute)
+	b.Reset()
+
+	for {
+		embeddings, err := c.FetchEmbedding(ctx, input)
+		var rateLimited *RateLimitError
+		if !errors.As(err, &rateLimited) {
+			return embeddings, err
+		}
+
+		wait := b.NextBackOff()
+		if wait == backoff.Stop {
+			return nil, err
+		}
+		wait = max(wait, rateLimited.RetryAfter)
+		c.logger.Warn("Rate limited, backing off", zap.Duration("wait", wait), zap.Int("inputs", len(input)))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// updateEmbeddings writes the embeddings, content and content hashes of rows with a single
+// UPDATE ... FROM (VALUES ...).
+func (c *Client) updateEmbeddings(ctx context.Context, pkType string, rows []Embedding, embeddings [][]float32) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	model := c.embedder.Model()
+	args := make([]any, 0, 4*len(rows))
+	for i, row := range rows {
+		args = append(args, row.PK, row.Content, c.vectorParam(embeddings[i]), contentHash(model, row.Content))
+	}
+	query := updateEmbeddingsSQL(c.tableIdentifier(), pgx.Identifier{c.Config.TablePrimaryKeyCol}.Sanitize(), pkType,
+		c.embeddingColumn(), c.vectorType(), len(rows))
+	if _, err := c.conn.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update embeddings: %w", err)
+	}
+	return nil
+}
+
+// updateEmbeddingsSQL returns an UPDATE of the embedding column, its hash column, and content of n rows of
+// table, by their primary key pk of pkType, from parameters ($pk, $content, $embedding, $hash) per row,
+// embeddings of vectorType.
+func updateEmbeddingsSQL(table, pk, pkType, column, vectorType string, n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("($%d::%s, $%d::text, $%d::%s, $%d::text)", 4*i+1, pkType, 4*i+2, 4*i+3, vectorType, 4*i+4)
+	}
+	return fmt.Sprintf(`UPDATE %[1]s t SET %[4]s = v.embedding, %[4]s_hash = v.hash, content = v.content
+		FROM (VALUES %[3]s) AS v(pk, content, embedding, hash) WHERE t.%[2]s = v.pk`, table, pk, strings.Join(values, ", "), column)
+}
+
+// primaryKeyType returns the type of the table's primary key column, e.g. bigint.
+func (c *Client) primaryKeyType(ctx context.Context) (string, error) {
+	var pkType string
+	err := c.conn.QueryRow(ctx, `SELECT format_type(atttypid, atttypmod) FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attname = $2 AND NOT attisdropped`,
+		c.tableIdentifier(), c.Config.TablePrimaryKeyCol).Scan(&pkType)
+	if err != nil {
+		return "", fmt.Errorf("failed to get primary key type: %w", err)
+	}
+	return pkType, nil
+}
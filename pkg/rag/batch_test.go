@@ -0,0 +1,104 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeEmbedder embeds a text as [len(text)], rate limiting its first rateLimited calls.
+type fakeEmbedder struct {
+	mu          sync.Mutex
+	calls       int
+	rateLimited int
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (e *fakeEmbedder) Embed(ctx context.Context, input []string) ([][]float32, error) {
+	n := e.inFlight.Add(1)
+	defer e.inFlight.Add(-1)
+	if n > e.maxInFlight.Load() {
+		e.maxInFlight.Store(n)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	e.mu.Lock()
+	e.calls++
+	limited := e.calls <= e.rateLimited
+	e.mu.Unlock()
+	if limited {
+		return nil, &RateLimitError{RetryAfter: 10 * time.Millisecond, Err: errors.New("unexpected status code: 429")}
+	}
+	embeddings := make([][]float32, len(input))
+	for i, text := range input {
+		embeddings[i] = []float32{float32(len(text))}
+	}
+	return embeddings, nil
+}
+
+func (e *fakeEmbedder) Dimensions() int { return 1 }
+func (e *fakeEmbedder) Model() string   { return "fake" }
+
+func TestEmbedBatches(t *testing.T) {
+	embedder := &fakeEmbedder{rateLimited: 1}
+	c := &Client{Config: Config{BatchSize: 3, Concurrency: 2}, logger: zap.NewNop(), embedder: embedder}
+
+	input := make([]string, 10)
+	for i := range input {
+		input[i] = strings.Repeat("x", i+1)
+	}
+	embeddings, err := c.embedBatches(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range embeddings {
+		if e[0] != float32(i+1) {
+			t.Fatalf("embedding %d = %v, want [%d]", i, e, i+1)
+		}
+	}
+	if embedder.calls != 5 {
+		t.Errorf("got %d calls, want 4 batches and a rate limited retry", embedder.calls)
+	}
+	if n := embedder.maxInFlight.Load(); n != 2 {
+		t.Errorf("got %d batches at once, want 2", n)
+	}
+
+	// rate limiting beyond the timeout fails
+	c.Config.RateLimitTimeout = time.Millisecond
+	c.embedder = &fakeEmbedder{rateLimited: 100}
+	var rateLimited *RateLimitError
+	if _, err := c.embedBatches(context.Background(), input); !errors.As(err, &rateLimited) {
+		t.Errorf("expected a rate limit error, got %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if d := retryAfter("3"); d != 3*time.Second {
+		t.Errorf("retryAfter(3) = %s", d)
+	}
+	if d := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d <= 50*time.Second || d > time.Minute {
+		t.Errorf("retryAfter(date) = %s", d)
+	}
+	if d := retryAfter(""); d != 0 {
+		t.Errorf("retryAfter() = %s", d)
+	}
+}
+
+func TestUpdateEmbeddingsSQL(t *testing.T) {
+	got := updateEmbeddingsSQL(`"public"."docs"`, `"id"`, "bigint", "embedding", "halfvec", 2)
+	expected := fmt.Sprintf(`UPDATE "public"."docs" t SET embedding = v.embedding, embedding_hash = v.hash, content = v.content
+		FROM (VALUES %s) AS v(pk, content, embedding, hash) WHERE t."id" = v.pk`,
+		"($1::bigint, $2::text, $3::halfvec, $4::text), ($5::bigint, $6::text, $7::halfvec, $8::text)")
+	if got != expected {
+		t.Errorf("got %s, want %s", got, expected)
+	}
+}
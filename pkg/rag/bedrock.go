@@ -0,0 +1,167 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BedrockEmbedder creates embeddings with a model on Amazon Bedrock, e.g. amazon.titan-embed-text-v2:0 or
+// cohere.embed-english-v3, signing requests with AWS Signature Version 4.
+type BedrockEmbedder struct {
+	Region          string
+	ModelID         string
+	Dims            int
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// URL overrides the runtime endpoint, e.g. https://bedrock-runtime.us-east-1.amazonaws.com.
+	URL string
+	// now returns the signing time; time.Now if nil
+	now func() time.Time
+}
+
+func (e *BedrockEmbedder) Embed(ctx context.Context, input []string) ([][]float32, error) {
+	if strings.HasPrefix(e.ModelID, "cohere.") {
+		// Cohere models embed several texts per request
+		var response struct {
+			Embeddings [][]float32 `json:"embeddings"`
+		}
+		body := map[string]any{"texts": input, "input_type": "search_document"}
+		if err := e.invoke(ctx, body, &response); err != nil {
+			return nil, err
+		}
+		return response.Embeddings, checkCount(response.Embeddings, input)
+	}
+
+	// Titan models embed a text per request
+	embeddings := make([][]float32, len(input))
+	for i, text := range input {
+		var response struct {
+			Embedding []float32 `json:"embedding"`
+		}
+		body := map[string]any{"inputText": text}
+		if e.Dims > 0 {
+			body["dimensions"] = e.Dims
+		}
+		if err := e.invoke(ctx, body, &response); err != nil {
+			return nil, err
+		}
+		embeddings[i] = response.Embedding
+	}
+	return embeddings, nil
+}
+
+func (e *BedrockEmbedder) Dimensions() int { return e.Dims }
+func (e *BedrockEmbedder) Model() string   { return e.ModelID }
+
+// invoke invokes the model with body, decoding its response into out.
+func (e *BedrockEmbedder) invoke(ctx context.Context, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request data: %w", err)
+	}
+	endpoint := cmp.Or(e.URL, fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", e.Region))
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/model/" + awsEscape(e.ModelID) + "/invoke")
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %w", err)
+	}
+	now := time.Now
+	if e.now != nil {
+		now = e.now
+	}
+
+	headers := map[string]string{
+		"content-type":         "application/json",
+		"host":                 u.Host,
+		"x-amz-content-sha256": sha256Hex(payload),
+		"x-amz-date":           now().UTC().Format(amzDateFormat),
+	}
+	if e.SessionToken != "" {
+		headers["x-amz-security-token"] = e.SessionToken
+	}
+	authorization := signV4("POST", u, headers, payload, e.Region, "bedrock", e.AccessKeyID, e.SecretAccessKey)
+
+	signed := map[string][]string{"Authorization": {authorization}}
+	for name, value := range headers {
+		if name != "host" {
+			signed[name] = []string{value}
+		}
+	}
+	return postJSON(ctx, u.String(), signed, payload, out)
+}
+
+const amzDateFormat = "20060102T150405Z"
+
+// signV4 returns the Authorization header of a request with AWS Signature Version 4. headers are the
+// request's headers to sign, by lowercase name, including host and x-amz-date.
+func signV4(method string, u *url.URL, headers map[string]string, payload []byte, region, service, accessKeyID, secretAccessKey string) string {
+	amzDate := headers["x-amz-date"]
+	date := amzDate[:8]
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// path segments are escaped twice by every service but S3
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	canonicalPath := cmp.Or(strings.Join(segments, "/"), "/")
+
+	canonicalRequest := strings.Join([]string{
+		method, canonicalPath, u.RawQuery, canonicalHeaders.String(), signedHeaders, sha256Hex(payload),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature)
+}
+
+// awsEscape escapes s as AWS Signature Version 4 does, leaving only unreserved characters, e.g. the colon
+// of model IDs.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,232 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Roles of chat messages.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// defaultChatTokenBudget is the number of tokens of the prompts of GenerateChat, unless
+// Config.ChatTokenBudget is set.
+const defaultChatTokenBudget = 4096
+
+// Message is a message of a conversation stored by GenerateChat.
+type Message struct {
+	ID             int64
+	ConversationID string
+	// Role is RoleUser or RoleAssistant
+	Role      string
+	Content   string
+	CreatedAt time.Time
+}
+
+// GenerateChat answers userMsg in the conversation of conversationID, created if it doesn't exist, so chat
+// apps keep their state in Postgres only. The prompt holds the rows retrieved for userMsg and the most
+// recent messages of the conversation, fitting in Config.ChatTokenBudget; the user message and the answer
+// are then appended to the conversation.
+//
+// The conversations and messages tables (Config.ConversationTableName and Config.MessageTableName) are
+// created if they don't exist.
+func (c *Client) GenerateChat(ctx context.Context, conversationID, userMsg string) (string, error) {
+	if err := c.ensureChatTables(ctx); err != nil {
+		return "", fmt.Errorf("failed to ensure chat tables: %w", err)
+	}
+	budget := cmp.Or(c.Config.ChatTokenBudget, defaultChatTokenBudget)
+
+	history, err := c.recentMessages(ctx, conversationID, budget)
+	if err != nil {
+		return "", err
+	}
+	relevantInfo, err := c.Retrieve(ctx, userMsg, cmp.Or(c.Config.ChatRetrievalLimit, 5))
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve relevant information: %w", err)
+	}
+
+	tokens, err := c.GenerateStream(ctx, chatPrompt(history, relevantInfo, userMsg, budget))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate response: %w", err)
+	}
+	var sb strings.Builder
+	for token := range tokens {
+		if token.Err != nil {
+			return "", fmt.Errorf("failed to generate response: %w", token.Err)
+		}
+		sb.WriteString(token.Text)
+	}
+	response := strings.TrimSpace(sb.String())
+
+	if err := c.appendMessages(ctx, conversationID, userMsg, response); err != nil {
+		return "", err
+	}
+	return response, nil
+}
+
+// Messages returns the messages of the conversation of conversationID, oldest first.
+func (c *Client) Messages(ctx context.Context, conversationID string) ([]Message, error) {
+	rows, err := c.conn.Query(ctx, fmt.Sprintf(
+		"SELECT id, conversation_id, role, content, created_at FROM %s WHERE conversation_id = $1 ORDER BY id",
+		c.messageTableIdentifier()), conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[Message])
+}
+
+// DeleteConversation deletes the conversation of conversationID with its messages.
+func (c *Client) DeleteConversation(ctx context.Context, conversationID string) error {
+	_, err := c.conn.Exec(ctx, "DELETE FROM "+c.conversationTableIdentifier()+" WHERE id = $1", conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	return nil
+}
+
+// recentMessages returns the most recent messages of the conversation fitting in budget tokens, oldest
+// first.
+func (c *Client) recentMessages(ctx context.Context, conversationID string, budget int) ([]Message, error) {
+	rows, err := c.conn.Query(ctx, fmt.Sprintf(
+		"SELECT id, conversation_id, role, content, created_at FROM %s WHERE conversation_id = $1 ORDER BY id DESC LIMIT $2",
+		c.messageTableIdentifier()), conversationID, budget) // messages are at least a token each
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if budget -= estimateTokens(m.Content); budget < 0 {
+			break
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+// appendMessages stores the user message and the response in the conversation, creating it if it doesn't
+// exist, in a transaction.
+func (c *Client) appendMessages(ctx context.Context, conversationID, userMsg, response string) error {
+	tx, err := c.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	insert := "INSERT INTO " + c.messageTableIdentifier() + " (conversation_id, role, content) VALUES ($1, $2, $3)"
+	batch := &pgx.Batch{}
+	batch.Queue("INSERT INTO "+c.conversationTableIdentifier()+" (id) VALUES ($1) ON CONFLICT (id) DO UPDATE SET updated_at = now()",
+		conversationID)
+	batch.Queue(insert, conversationID, RoleUser, userMsg)
+	batch.Queue(insert, conversationID, RoleAssistant, response)
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to store messages: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// chatPrompt returns the prompt answering userMsg, with the retrieved rows and the history, oldest first,
+// that fit in budget tokens. The user message is always included; the rows may take up to half of the rest,
+// and the most recent messages the remainder.
+func chatPrompt(history []Message, relevantInfo []Embedding, userMsg string, budget int) string {
+	budget -= estimateTokens(userMsg)
+
+	var contents []string
+	contentBudget := budget / 2
+	for _, info := range relevantInfo {
+		if contentBudget -= estimateTokens(info.Content); contentBudget < 0 {
+			break
+		}
+		contents = append(contents, info.Content)
+		budget -= estimateTokens(info.Content)
+	}
+
+	first := len(history)
+	for first > 0 && budget-estimateTokens(history[first-1].Content) >= 0 {
+		first--
+		budget -= estimateTokens(history[first].Content)
+	}
+
+	var sb strings.Builder
+	if len(contents) > 0 {
+		sb.WriteString("Given the following context:\n\n")
+		for _, content := range contents {
+			fmt.Fprintf(&sb, "- %s\n", content)
+		}
+		sb.WriteString("\n")
+	}
+	if first < len(history) {
+		sb.WriteString("Continue the following conversation:\n\n")
+		for _, m := range history[first:] {
+			fmt.Fprintf(&sb, "%s: %s\n", m.Role, m.Content)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "%s: %s\n%s:", RoleUser, userMsg, RoleAssistant)
+	return sb.String()
+}
+
+// estimateTokens estimates the number of tokens of text, at about 4 characters per token of English text.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// ensureChatTables creates the conversations and messages tables if they don't exist.
+func (c *Client) ensureChatTables(ctx context.Context) error {
+	conversations, messages := c.conversationTableIdentifier(), c.messageTableIdentifier()
+	_, err := c.conn.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (
+			id TEXT PRIMARY KEY,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS %[2]s (
+			id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+			conversation_id TEXT NOT NULL REFERENCES %[1]s (id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK (role IN ('user', 'assistant')),
+			content TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS %[3]s ON %[2]s (conversation_id, id)`,
+		conversations, messages, pgx.Identifier{c.messageTableName() + "_conversation_id_idx"}.Sanitize()))
+	if err != nil {
+		return err
+	}
+	c.logger.Debug("Chat tables ensured", zap.String("conversations", conversations), zap.String("messages", messages))
+	return nil
+}
+
+// conversationTableIdentifier returns the quoted name of the conversations table.
+func (c *Client) conversationTableIdentifier() string {
+	schema, _ := splitSchemaTableName(c.Config.TableName)
+	return pgx.Identifier{schema, cmp.Or(c.Config.ConversationTableName, "rag_conversations")}.Sanitize()
+}
+
+// messageTableIdentifier returns the quoted name of the messages table.
+func (c *Client) messageTableIdentifier() string {
+	schema, _ := splitSchemaTableName(c.Config.TableName)
+	return pgx.Identifier{schema, c.messageTableName()}.Sanitize()
+}
+
+// messageTableName returns the unqualified name of the messages table.
+func (c *Client) messageTableName() string {
+	return cmp.Or(c.Config.MessageTableName, "rag_messages")
+}
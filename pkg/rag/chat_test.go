@@ -0,0 +1,42 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChatPrompt(t *testing.T) {
+	history := []Message{
+		{Role: RoleUser, Content: strings.Repeat("a", 400)}, // 100 tokens
+		{Role: RoleAssistant, Content: "first answer"},
+		{Role: RoleUser, Content: "second question"},
+		{Role: RoleAssistant, Content: "second answer"},
+	}
+	relevantInfo := []Embedding{{Content: "relevant row"}, {Content: strings.Repeat("b", 400)}}
+
+	prompt := chatPrompt(history, relevantInfo, "third question", 60)
+	expected := "Given the following context:\n\n" +
+		"- relevant row\n\n" +
+		"Continue the following conversation:\n\n" +
+		"assistant: first answer\n" +
+		"user: second question\n" +
+		"assistant: second answer\n\n" +
+		"user: third question\nassistant:"
+	if prompt != expected {
+		t.Errorf("chatPrompt() = %q, want %q", prompt, expected)
+	}
+
+	if prompt := chatPrompt(nil, nil, "hi", 0); prompt != "user: hi\nassistant:" {
+		t.Errorf("chatPrompt() without history = %q", prompt)
+	}
+}
+
+func TestChatTableIdentifiers(t *testing.T) {
+	c := &Client{Config: Config{TableName: "app.docs", MessageTableName: "chat_messages"}}
+	if got := c.conversationTableIdentifier(); got != `"app"."rag_conversations"` {
+		t.Errorf("conversationTableIdentifier() = %s", got)
+	}
+	if got := c.messageTableIdentifier(); got != `"app"."chat_messages"` {
+		t.Errorf("messageTableIdentifier() = %s", got)
+	}
+}
@@ -0,0 +1,123 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Progress reports the progress of CreateEmbedding to Config.OnProgress, once per wave of rows.
+type Progress struct {
+	// Total is the number of rows of the content query
+	Total int
+	// Processed is the number of rows processed, including those of interrupted runs resumed from and rows
+	// skipped as unchanged
+	Processed int
+	// Embedded is the number of rows whose embedding was written by this run
+	Embedded int
+	// LastPK is the primary key of the last row processed
+	LastPK interface{}
+}
+
+// checkpoint is the progress of a CreateEmbedding run, stored so interrupted runs resume from it.
+type checkpoint struct {
+	// lastPK is the text of the primary key of the last row processed, nil if none
+	lastPK    *string
+	processed int
+}
+
+// pageSQL returns the query of the rows of query after the primary key $1, nil for the first page, ordered
+// by their primary key pk of type pkType, and limited to $2 rows.
+func pageSQL(query, pk, pkType string) string {
+	pk = pgx.Identifier{pk}.Sanitize()
+	return fmt.Sprintf("SELECT * FROM (%s) AS q WHERE $1::text IS NULL OR q.%s > ($1::text)::%s ORDER BY q.%s LIMIT $2",
+		query, pk, pkType, pk)
+}
+
+// queryPrimaryKey returns the name of the first column of query, the primary key of its rows.
+func (c *Client) queryPrimaryKey(ctx context.Context, query string) (string, error) {
+	rows, err := c.conn.Query(ctx, fmt.Sprintf("SELECT * FROM (%s) AS q LIMIT 0", query))
+	if err != nil {
+		return "", fmt.Errorf("failed to query database: %w", err)
+	}
+	defer rows.Close()
+	fields := rows.FieldDescriptions()
+	if len(fields) == 0 {
+		return "", errors.New("content query returns no columns")
+	}
+	return fields[0].Name, nil
+}
+
+// countRows returns the number of rows of query.
+func (c *Client) countRows(ctx context.Context, query string) (int, error) {
+	var count int
+	if err := c.conn.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM (%s) AS q", query)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// ensureCheckpointTable creates the table of CreateEmbedding checkpoints if it doesn't exist.
+func (c *Client) ensureCheckpointTable(ctx context.Context) error {
+	_, err := c.conn.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			query TEXT NOT NULL,
+			last_pk TEXT NOT NULL,
+			processed BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (table_name, column_name)
+		)`, c.checkpointTableIdentifier()))
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint table: %w", err)
+	}
+	return nil
+}
+
+// loadCheckpoint returns the checkpoint of the embedding column. Checkpoints of other content queries are
+// ignored.
+func (c *Client) loadCheckpoint(ctx context.Context, query string) (checkpoint, error) {
+	var cp checkpoint
+	err := c.conn.QueryRow(ctx, fmt.Sprintf(
+		"SELECT last_pk, processed FROM %s WHERE table_name = $1 AND column_name = $2 AND query = $3",
+		c.checkpointTableIdentifier()), c.Config.TableName, c.embeddingColumn(), query).Scan(&cp.lastPK, &cp.processed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return checkpoint{}, nil
+	}
+	if err != nil {
+		return checkpoint{}, fmt.Errorf("failed to query checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint stores the checkpoint of the embedding column.
+func (c *Client) saveCheckpoint(ctx context.Context, query string, cp checkpoint) error {
+	_, err := c.conn.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (table_name, column_name, query, last_pk, processed)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (table_name, column_name)
+		DO UPDATE SET query = $3, last_pk = $4, processed = $5, updated_at = now()`, c.checkpointTableIdentifier()),
+		c.Config.TableName, c.embeddingColumn(), query, *cp.lastPK, cp.processed)
+	if err != nil {
+		return fmt.Errorf("failed to store checkpoint: %w", err)
+	}
+	return nil
+}
+
+// deleteCheckpoint deletes the checkpoint of the embedding column, once CreateEmbedding completes.
+func (c *Client) deleteCheckpoint(ctx context.Context) error {
+	_, err := c.conn.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE table_name = $1 AND column_name = $2",
+		c.checkpointTableIdentifier()), c.Config.TableName, c.embeddingColumn())
+	if err != nil {
+		return fmt.Errorf("failed to delete checkpoint: %w", err)
+	}
+	return nil
+}
+
+// checkpointTableIdentifier returns the quoted name of the checkpoint table.
+func (c *Client) checkpointTableIdentifier() string {
+	schema, _ := splitSchemaTableName(c.Config.TableName)
+	return pgx.Identifier{schema, cmp.Or(c.Config.CheckpointTableName, "rag_checkpoints")}.Sanitize()
+}
@@ -0,0 +1,22 @@
+package rag
+
+import "testing"
+
+func TestPageSQL(t *testing.T) {
+	got := pageSQL("SELECT id, content FROM docs", "id", "bigint")
+	expected := `SELECT * FROM (SELECT id, content FROM docs) AS q WHERE $1::text IS NULL OR q."id" > ($1::text)::bigint ORDER BY q."id" LIMIT $2`
+	if got != expected {
+		t.Errorf("pageSQL() = %s, want %s", got, expected)
+	}
+}
+
+func TestCheckpointTableIdentifier(t *testing.T) {
+	c := &Client{Config: Config{TableName: "app.docs"}}
+	if got := c.checkpointTableIdentifier(); got != `"app"."rag_checkpoints"` {
+		t.Errorf("checkpointTableIdentifier() = %s", got)
+	}
+	c.Config.CheckpointTableName = "embedding_runs"
+	if got := c.checkpointTableIdentifier(); got != `"app"."embedding_runs"` {
+		t.Errorf("checkpointTableIdentifier() = %s", got)
+	}
+}
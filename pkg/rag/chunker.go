@@ -0,0 +1,150 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Chunker splits long content into chunks, embedded separately, so embeddings represent passages short
+// enough for the model's context and precise enough to match queries.
+type Chunker interface {
+	Chunk(text string) []string
+}
+
+// FixedSizeChunker splits content into chunks of up to Size characters, overlapping by Overlap characters
+// so passages at chunk boundaries aren't lost. Chunks end at whitespace when possible, not mid-word.
+type FixedSizeChunker struct {
+	// Size defaults to 1000.
+	Size    int
+	Overlap int
+}
+
+func (c FixedSizeChunker) Chunk(text string) []string {
+	size, overlap := chunkSizes(c.Size, c.Overlap, 1000)
+	runes := []rune(text)
+
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			// end at the last whitespace of the second half of the chunk, if any
+			for i := end; i > start+size/2; i-- {
+				if unicode.IsSpace(runes[i]) {
+					end = i
+					break
+				}
+			}
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+// TokenChunker splits content into chunks of up to Size tokens, overlapping by Overlap tokens, keeping chunks
+// within the model's input limit. Tokens are approximated by words; a word is about 1.3 tokens of English.
+type TokenChunker struct {
+	// Size defaults to 256.
+	Size    int
+	Overlap int
+}
+
+func (c TokenChunker) Chunk(text string) []string {
+	size, overlap := chunkSizes(c.Size, c.Overlap, 256)
+	words := strings.Fields(text)
+
+	var chunks []string
+	for start := 0; start < len(words); start += size - overlap {
+		end := min(start+size, len(words))
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+	}
+	return chunks
+}
+
+// SentenceChunker splits content into chunks of whole sentences, up to MaxSize characters, the next chunk
+// repeating the last Overlap sentences of the previous one. Sentences longer than MaxSize are split as
+// FixedSizeChunker does.
+type SentenceChunker struct {
+	// MaxSize defaults to 1000.
+	MaxSize int
+	Overlap int
+}
+
+func (c SentenceChunker) Chunk(text string) []string {
+	maxSize, _ := chunkSizes(c.MaxSize, 0, 1000)
+
+	var sentences []string
+	for _, s := range splitSentences(text) {
+		if len([]rune(s)) > maxSize {
+			sentences = append(sentences, FixedSizeChunker{Size: maxSize}.Chunk(s)...)
+		} else {
+			sentences = append(sentences, s)
+		}
+	}
+
+	var chunks []string
+	for start := 0; start < len(sentences); {
+		// pack sentences from start up to maxSize
+		end, size := start, 0
+		for end < len(sentences) {
+			n := len([]rune(sentences[end]))
+			if end > start {
+				n++ // the joining space
+			}
+			if end > start && size+n > maxSize {
+				break
+			}
+			size += n
+			end++
+		}
+		chunks = append(chunks, strings.Join(sentences[start:end], " "))
+		if end == len(sentences) {
+			break
+		}
+		start = max(end-c.Overlap, start+1)
+	}
+	return chunks
+}
+
+// splitSentences splits text into sentences, ending at ., ! or ? followed by whitespace, and at blank lines.
+func splitSentences(text string) []string {
+	runes := []rune(text)
+	var sentences []string
+	start := 0
+	add := func(end int) {
+		if s := strings.Join(strings.Fields(string(runes[start:end])), " "); s != "" {
+			sentences = append(sentences, s)
+		}
+		start = end
+	}
+	for i, r := range runes {
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case (r == '.' || r == '!' || r == '?') && (next == 0 || unicode.IsSpace(next)):
+			add(i + 1)
+		case r == '\n' && next == '\n':
+			add(i)
+		}
+	}
+	add(len(runes))
+	return sentences
+}
+
+// chunkSizes returns size, or def if it's not positive, and overlap, less than size.
+func chunkSizes(size, overlap, def int) (int, int) {
+	if size <= 0 {
+		size = def
+	}
+	return size, min(max(overlap, 0), size-1)
+}
@@ -0,0 +1,63 @@
+package rag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFixedSizeChunker(t *testing.T) {
+	chunks := FixedSizeChunker{Size: 12, Overlap: 4}.Chunk("the quick brown fox jumps over the lazy dog")
+	expected := []string{"the quick", "uick brown", "rown fox", "fox jumps", "umps over", "over the", "the lazy", "lazy dog"}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("got %q, want %q", chunks, expected)
+	}
+	for _, chunk := range (FixedSizeChunker{Size: 5, Overlap: 10}).Chunk(strings.Repeat("x", 12)) {
+		if len(chunk) > 5 {
+			t.Errorf("chunk %q longer than size", chunk)
+		}
+	}
+}
+
+func TestTokenChunker(t *testing.T) {
+	chunks := TokenChunker{Size: 4, Overlap: 1}.Chunk("one two three four five six seven")
+	expected := []string{"one two three four", "four five six seven"}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("got %q, want %q", chunks, expected)
+	}
+}
+
+func TestSentenceChunker(t *testing.T) {
+	text := "Postgres is a database. It stores rows!\n\nPgvector adds vectors? Yes.\nIndexes  make search fast."
+	chunks := SentenceChunker{MaxSize: 50, Overlap: 1}.Chunk(text)
+	expected := []string{
+		"Postgres is a database. It stores rows!",
+		"It stores rows! Pgvector adds vectors? Yes.",
+		"Yes. Indexes make search fast.",
+	}
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("got %q, want %q", chunks, expected)
+	}
+
+	long := SentenceChunker{MaxSize: 10}.Chunk("Short. " + strings.Repeat("word ", 6))
+	if len(long) < 3 || long[0] != "Short." {
+		t.Errorf("expected the long sentence split, got %q", long)
+	}
+}
+
+func TestGroupChunks(t *testing.T) {
+	chunks := []Chunk{
+		{ParentPK: int64(1), Index: 3, Distance: 0.1},
+		{ParentPK: int64(2), Index: 0, Distance: 0.2},
+		{ParentPK: int64(1), Index: 1, Distance: 0.3},
+		{ParentPK: int64(3), Index: 0, Distance: 0.4},
+		{ParentPK: int64(2), Index: 5, Distance: 0.5},
+	}
+	documents := groupChunks(chunks, 2)
+	if len(documents) != 2 || documents[0].PK != int64(1) || documents[1].PK != int64(2) {
+		t.Fatalf("unexpected documents %+v", documents)
+	}
+	if documents[0].Distance != 0.1 || documents[0].Chunks[0].Index != 1 || len(documents[1].Chunks) != 2 {
+		t.Errorf("unexpected chunks %+v", documents)
+	}
+}
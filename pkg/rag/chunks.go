@@ -0,0 +1,181 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+	"go.uber.org/zap"
+)
+
+// Chunk is a chunk of a row's content, stored in the chunk table with its embedding.
+type Chunk struct {
+	// ParentPK is the primary key of the row the chunk is of
+	ParentPK interface{}
+	// Index is the position of the chunk in the row's content
+	Index     int
+	Content   string
+	Embedding pgvector.Vector
+	// Distance is the distance, by Config.Distance, of the chunk to the input it was retrieved by
+	Distance float64
+}
+
+// Document is a row retrieved by its chunks closest to the input.
+type Document struct {
+	PK interface{}
+	// Chunks are the row's retrieved chunks, in the order of its content
+	Chunks []Chunk
+	// Distance is the distance of the row's closest chunk
+	Distance float64
+}
+
+// chunkCandidates is the number of chunks retrieved per document RetrieveDocuments returns, so documents
+// with several close chunks don't crowd others out.
+const chunkCandidates = 5
+
+// CreateChunkedEmbedding splits the content of rows into chunks with Config.Chunker, storing each chunk
+// with its embedding in the chunk table (Config.ChunkTableName), linked to its row by parent_id. A row's
+// chunks are replaced when it's embedded again. contentSelectQuery selects rows as CreateEmbedding does.
+func (c *Client) CreateChunkedEmbedding(ctx context.Context, contentSelectQuery ...string) error {
+	if err := c.ensureChunkTable(ctx); err != nil {
+		return fmt.Errorf("failed to ensure chunk table: %w", err)
+	}
+	query, err := c.contentQuery(ctx, contentSelectQuery)
+	if err != nil {
+		return err
+	}
+	rows, err := c.queryAndProcessEmbeddingContents(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	chunker := c.Config.Chunker
+	if chunker == nil {
+		chunker = SentenceChunker{}
+	}
+	for _, row := range rows {
+		chunks := chunker.Chunk(row.Content)
+		embeddings, err := c.embedBatches(ctx, chunks)
+		if err != nil {
+			return fmt.Errorf("failed to fetch embeddings: %w", err)
+		}
+		if err := c.replaceChunks(ctx, row.PK, chunks, embeddings); err != nil {
+			return err
+		}
+		c.logger.Debug("chunked", zap.Any("id", row.PK), zap.Int("chunks", len(chunks)))
+	}
+	return nil
+}
+
+// replaceChunks replaces the chunks of the row of pk in a transaction.
+func (c *Client) replaceChunks(ctx context.Context, pk interface{}, chunks []string, embeddings [][]float32) error {
+	table := c.chunkTableIdentifier()
+	tx, err := c.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	batch.Queue("DELETE FROM "+table+" WHERE parent_id = $1", pk)
+	for i, chunk := range chunks {
+		batch.Queue("INSERT INTO "+table+" (parent_id, chunk_index, content, "+c.embeddingColumn()+") VALUES ($1, $2, $3, $4)",
+			pk, i, chunk, c.vectorParam(embeddings[i]))
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to store chunks: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// RetrieveChunks retrieves the chunks most similar to the input.
+func (c *Client) RetrieveChunks(ctx context.Context, input string, limit int) ([]Chunk, error) {
+	embedding, err := c.FetchEmbedding(ctx, []string{input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch embedding for input: %w", err)
+	}
+
+	query := c.nearestSQL("parent_id, chunk_index, content, "+c.embeddingSelect()+", "+c.distanceSQL()+" AS distance",
+		c.chunkTableIdentifier(), "")
+	rows, err := c.conn.Query(ctx, query, c.vectorParam(embedding[0]), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Chunk
+	for rows.Next() {
+		var chunk Chunk
+		if err := rows.Scan(&chunk.ParentPK, &chunk.Index, &chunk.Content, &chunk.Embedding, &chunk.Distance); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, chunk)
+	}
+	return results, rows.Err()
+}
+
+// RetrieveDocuments retrieves the rows, up to limit, whose chunks are most similar to the input, grouping
+// their retrieved chunks back per row.
+func (c *Client) RetrieveDocuments(ctx context.Context, input string, limit int) ([]Document, error) {
+	chunks, err := c.RetrieveChunks(ctx, input, limit*chunkCandidates)
+	if err != nil {
+		return nil, err
+	}
+	return groupChunks(chunks, limit), nil
+}
+
+// groupChunks groups chunks, ordered by distance, per row, returning up to limit rows by their closest chunk.
+func groupChunks(chunks []Chunk, limit int) []Document {
+	var documents []Document
+	index := make(map[string]int) // by fmt.Sprint(pk), as pks may not be comparable
+	for _, chunk := range chunks {
+		key := fmt.Sprint(chunk.ParentPK)
+		i, ok := index[key]
+		if !ok {
+			if len(documents) == limit {
+				continue
+			}
+			i = len(documents)
+			index[key] = i
+			documents = append(documents, Document{PK: chunk.ParentPK, Distance: chunk.Distance})
+		}
+		documents[i].Chunks = append(documents[i].Chunks, chunk)
+	}
+	for _, d := range documents {
+		slices.SortFunc(d.Chunks, func(a, b Chunk) int { return cmp.Compare(a.Index, b.Index) })
+	}
+	return documents
+}
+
+// ensureChunkTable creates the chunk table if it doesn't exist, its parent_id referencing the table's
+// primary key, of its type.
+func (c *Client) ensureChunkTable(ctx context.Context) error {
+	pkType, err := c.primaryKeyType(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+			parent_id %s NOT NULL REFERENCES %s (%s) ON DELETE CASCADE,
+			chunk_index INT NOT NULL,
+			content TEXT NOT NULL,
+			%s %s,
+			UNIQUE (parent_id, chunk_index)
+		)`, c.chunkTableIdentifier(), pkType, c.tableIdentifier(),
+		pgx.Identifier{c.Config.TablePrimaryKeyCol}.Sanitize(), c.embeddingColumn(), c.columnType())
+	if _, err := c.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create chunk table: %w", err)
+	}
+	return nil
+}
+
+// chunkTableIdentifier returns the quoted name of the chunk table.
+func (c *Client) chunkTableIdentifier() string {
+	schema, table := splitSchemaTableName(cmp.Or(c.Config.ChunkTableName, c.Config.TableName+"_chunks"))
+	return pgx.Identifier{schema, table}.Sanitize()
+}
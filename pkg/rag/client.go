@@ -3,9 +3,12 @@ package rag
 import (
 	"context"
 	"fmt"
+	"time"
 
+	pg "github.com/edgeflare/pgo/pkg/pgx"
 	"github.com/edgeflare/pgo/pkg/util"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	pgxvector "github.com/pgvector/pgvector-go/pgx"
 	"go.uber.org/zap"
 )
@@ -21,6 +24,68 @@ type Config struct {
 	EmbeddingsPath     string
 	GeneratePath       string
 	BatchSize          int
+	// Concurrency is the number of batches embedded at once by CreateEmbedding and CreateChunkedEmbedding.
+	// Defaults to 1.
+	Concurrency int
+	// RateLimitTimeout is how long a batch is retried with backoff while the provider rate limits requests.
+	// Defaults to 5 minutes.
+	RateLimitTimeout time.Duration
+	// Provider selects the embedding API (see NewEmbeddingProvider): openai (default, including
+	// OpenAI-compatible APIs), ollama, lmstudio, cohere, vertexai or bedrock.
+	Provider string
+	// Region is the cloud region of the vertexai and bedrock providers, e.g. us-central1.
+	Region string
+	// ProjectId is the Google Cloud project of the vertexai provider.
+	ProjectId string
+	// Embedder, if set, creates the embeddings instead of the provider selected by Provider.
+	Embedder EmbeddingProvider
+	// Chunker splits rows' content into chunks embedded by CreateChunkedEmbedding. Defaults to a
+	// SentenceChunker.
+	Chunker Chunker
+	// ChunkTableName is the table of chunks of TableName's rows. Defaults to TableName_chunks.
+	ChunkTableName string
+	// VectorType is the pgvector type of embedding columns created: vector (default), halfvec or sparsevec.
+	VectorType string
+	// BinaryQuantization retrieves candidates by the Hamming distance of binary quantized embeddings, indexed
+	// by CreateIndex, reranking them by their full embeddings. It speeds up retrieval of large tables, and
+	// indexes embeddings of up to 64000 dimensions.
+	BinaryQuantization bool
+	// QuantizationOversampling is the number of candidates retrieved per row with BinaryQuantization.
+	// Defaults to 4.
+	QuantizationOversampling int
+	// Distance is the metric Retrieve ranks rows by: cosine (default), l2, ip (inner product) or l1. It's
+	// recorded on the embedding column once created; clients configured with another metric fail to start.
+	Distance Distance
+	// EmbeddingColumn is the column embeddings are stored in. Defaults to embedding.
+	EmbeddingColumn string
+	// Spaces declares further embedding columns of the table, each with its own model, selected with
+	// Client.Space.
+	Spaces []EmbeddingSpace
+	// Reranker, if set, reorders the rows Retrieve, and so GenerateWithRetrieval, retrieves by their relevance
+	// to the input, scored by a reranking model, e.g. CohereReranker.
+	Reranker Reranker
+	// RerankCandidates is the number of nearest rows Retrieve reranks. Defaults to 4 times the limit.
+	RerankCandidates int
+	// ConversationTableName and MessageTableName are the tables of GenerateChat's conversations, in the
+	// schema of TableName. Default to rag_conversations and rag_messages.
+	ConversationTableName string
+	MessageTableName      string
+	// ChatTokenBudget is the number of tokens of GenerateChat's prompts, estimated at 4 characters per
+	// token. Defaults to 4096.
+	ChatTokenBudget int
+	// PromptTemplate formats the prompts of GenerateWithRetrieval and GenerateWithRetrievalStream. Defaults
+	// to the zero PromptTemplate.
+	PromptTemplate *PromptTemplate
+	// ChatRetrievalLimit is the number of rows GenerateChat retrieves for a message. Defaults to 5.
+	ChatRetrievalLimit int
+	// Checkpoint stores CreateEmbedding's progress in CheckpointTableName after each wave of rows, so runs
+	// interrupted resume after the last row processed instead of from the first one.
+	Checkpoint bool
+	// CheckpointTableName is the table of checkpoints, in the schema of TableName. Defaults to
+	// rag_checkpoints.
+	CheckpointTableName string
+	// OnProgress, if set, is called with CreateEmbedding's progress after each wave of rows.
+	OnProgress func(Progress)
 }
 
 // DefaultConfig returns a Config with default values
@@ -35,18 +100,49 @@ func DefaultConfig() Config {
 		EmbeddingsPath:     "/v1/embeddings",
 		GeneratePath:       "/api/generate",
 		BatchSize:          100,
+		Concurrency:        4,
 	}
 }
 
-// Client handles the RAG operations
+// Client handles the RAG operations. Clients of NewPoolClient are safe for concurrent use, except for
+// Migrate, which switches the client's model.
 type Client struct {
-	conn   *pgx.Conn
-	Config Config
-	logger *zap.Logger
+	// conn is a *pgx.Conn, serving a query at a time, or a *pgxpool.Pool
+	conn     pg.Conn
+	Config   Config
+	logger   *zap.Logger
+	embedder EmbeddingProvider
+	// columns are the embedding columns of the client a space was selected of
+	columns []string
 }
 
-// NewClient creates a new RAG client
+// NewClient creates a new RAG client using a single connection, which serves one query at a time; use
+// NewPoolClient to serve concurrent requests, e.g. of HTTP handlers.
 func NewClient(conn *pgx.Conn, config Config, loggers ...*zap.Logger) (*Client, error) {
+	return newClient(conn, config, loggers)
+}
+
+// NewPoolClient creates a new RAG client using the connections of pool, safe for concurrent use. The pool's
+// connections must register pgvector's types once connected, with AfterConnect:
+//
+//	poolConfig.AfterConnect = rag.AfterConnect
+func NewPoolClient(pool *pgxpool.Pool, config Config, loggers ...*zap.Logger) (*Client, error) {
+	return newClient(pool, config, loggers)
+}
+
+// AfterConnect creates the vector extension, if it doesn't exist, and registers its types on conn. Set it as
+// the AfterConnect hook of pools of NewPoolClient.
+func AfterConnect(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS vector"); err != nil {
+		return fmt.Errorf("failed to create vector extension: %w", err)
+	}
+	if err := pgxvector.RegisterTypes(ctx, conn); err != nil {
+		return fmt.Errorf("failed to register vector types: %w", err)
+	}
+	return nil
+}
+
+func newClient(conn pg.Conn, config Config, loggers []*zap.Logger) (*Client, error) {
 	var logger *zap.Logger
 	if len(loggers) > 0 && loggers[0] != nil {
 		logger = loggers[0]
@@ -59,10 +155,26 @@ func NewClient(conn *pgx.Conn, config Config, loggers ...*zap.Logger) (*Client,
 		}
 	}
 
+	if err := validateVectorType(config); err != nil {
+		return nil, err
+	}
+	if err := validateSpaces(config); err != nil {
+		return nil, err
+	}
+
+	embedder := config.Embedder
+	if embedder == nil {
+		var err error
+		if embedder, err = NewEmbeddingProvider(config); err != nil {
+			return nil, fmt.Errorf("failed to create embedding provider: %w", err)
+		}
+	}
+
 	client := &Client{
-		conn:   conn,
-		Config: config,
-		logger: logger,
+		conn:     conn,
+		Config:   config,
+		logger:   logger,
+		embedder: embedder,
 	}
 
 	if err := client.initialize(); err != nil {
@@ -75,14 +187,16 @@ func NewClient(conn *pgx.Conn, config Config, loggers ...*zap.Logger) (*Client,
 func (c *Client) initialize() error {
 	ctx := context.Background()
 
-	_, err := c.conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS vector")
-	if err != nil {
+	if conn, ok := c.conn.(*pgx.Conn); ok {
+		if err := AfterConnect(ctx, conn); err != nil {
+			return err
+		}
+	} else if _, err := c.conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS vector"); err != nil {
 		return fmt.Errorf("failed to create vector extension: %w", err)
 	}
 
-	err = pgxvector.RegisterTypes(ctx, c.conn)
-	if err != nil {
-		return fmt.Errorf("failed to register vector types: %w", err)
+	if err := c.checkDistance(ctx); err != nil {
+		return err
 	}
 
 	return nil
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func TestNewClient(t *testing.T) {
@@ -14,14 +15,23 @@ func TestNewClient(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to connect to database: %v", err)
 	}
+	defer conn.Close(ctx)
 
-	client, err := NewClient(conn, Config{
+	_, err = NewClient(conn, Config{
 		TableName:  "test_table",
 		Dimensions: 3072,
 	})
 	if err != nil {
 		t.Fatalf("failed to create client: %v", err)
 	}
+}
 
-	defer client.conn.Close(ctx)
+func TestPoolClientSettings(t *testing.T) {
+	c := &Client{conn: &pgxpool.Pool{}}
+	if err := c.SetEfSearch(context.Background(), 100); err == nil {
+		t.Error("expected SetEfSearch rejected for pools")
+	}
+	if err := c.SetProbes(context.Background(), 10); err == nil {
+		t.Error("expected SetProbes rejected for pools")
+	}
 }
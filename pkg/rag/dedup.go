@@ -0,0 +1,103 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+	"go.uber.org/zap"
+)
+
+// contentHash returns the hash of content embedded by model, stored along embeddings so unchanged content
+// isn't embedded again.
+func contentHash(model, content string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashColumn returns the name of the column of the hashes of the content of the embedding column.
+func (c *Client) hashColumn() string {
+	return c.embeddingColumn() + "_hash"
+}
+
+// embedRows embeds the content of rows and writes the embeddings, skipping rows whose stored hash matches
+// their content, and fetching the embedding of content already embedded, in other rows or in rows, from the
+// table instead of the provider. It returns the number of rows written.
+func (c *Client) embedRows(ctx context.Context, pkType string, rows []Embedding) (int, error) {
+	model := c.embedder.Model()
+	hashes := make([]string, len(rows))
+	for i, row := range rows {
+		hashes[i] = contentHash(model, row.Content)
+	}
+	stored, known, err := c.storedHashes(ctx, hashes)
+	if err != nil {
+		return 0, err
+	}
+
+	// embed each new content once
+	var pending []Embedding
+	var contents []string
+	for i, row := range rows {
+		if stored[fmt.Sprint(row.PK)] == hashes[i] {
+			continue
+		}
+		pending = append(pending, row)
+		if _, ok := known[hashes[i]]; !ok {
+			known[hashes[i]] = nil
+			contents = append(contents, row.Content)
+		}
+	}
+	fetched, err := c.embedBatches(ctx, contents)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch embeddings: %w", err)
+	}
+	for i, content := range contents {
+		known[contentHash(model, content)] = fetched[i]
+	}
+	c.logger.Debug("embeddings", zap.Int("rows", len(rows)), zap.Int("unchanged", len(rows)-len(pending)),
+		zap.Int("fetched", len(fetched)))
+
+	embeddings := make([][]float32, len(pending))
+	for i, row := range pending {
+		embeddings[i] = known[contentHash(model, row.Content)]
+	}
+	batchSize := c.batchSize()
+	for i := 0; i < len(pending); i += batchSize {
+		end := min(i+batchSize, len(pending))
+		if err := c.updateEmbeddings(ctx, pkType, pending[i:end], embeddings[i:end]); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+// storedHashes returns the stored hashes, by fmt.Sprint(pk), of the rows embedded with one of hashes, and
+// an embedding of each of those hashes.
+func (c *Client) storedHashes(ctx context.Context, hashes []string) (map[string]string, map[string][]float32, error) {
+	rows, err := c.conn.Query(ctx, fmt.Sprintf("SELECT %s, %s, %s FROM %s WHERE %s = ANY($1) AND %s IS NOT NULL",
+		pgx.Identifier{c.Config.TablePrimaryKeyCol}.Sanitize(), c.hashColumn(), c.embeddingSelect(), c.tableIdentifier(),
+		c.hashColumn(), c.embeddingColumn()), hashes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query content hashes: %w", err)
+	}
+	defer rows.Close()
+
+	stored, embeddings := make(map[string]string), make(map[string][]float32)
+	for rows.Next() {
+		var pk any
+		var hash string
+		var embedding pgvector.Vector
+		if err := rows.Scan(&pk, &hash, &embedding); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan content hash: %w", err)
+		}
+		stored[fmt.Sprint(pk)] = hash
+		embeddings[hash] = embedding.Slice()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to query content hashes: %w", err)
+	}
+	return stored, embeddings, nil
+}
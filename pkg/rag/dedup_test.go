@@ -0,0 +1,21 @@
+package rag
+
+import "testing"
+
+func TestContentHash(t *testing.T) {
+	hash := contentHash("nomic-embed-text", "hello")
+	if len(hash) != 64 || hash != contentHash("nomic-embed-text", "hello") {
+		t.Errorf("expected a stable sha256 hex digest, got %q", hash)
+	}
+	if hash == contentHash("nomic-embed-text", "hello!") || hash == contentHash("all-minilm", "hello") {
+		t.Error("expected hashes to differ by content and model")
+	}
+	if contentHash("a", "bc") == contentHash("ab", "c") {
+		t.Error("expected model and content separated")
+	}
+
+	c := &Client{Config: Config{EmbeddingColumn: "embedding_minilm"}}
+	if got := c.hashColumn(); got != "embedding_minilm_hash" {
+		t.Errorf("hashColumn() = %s", got)
+	}
+}
@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// distanceOperators are the pgvector operators of the distances, ordering rows nearest first. The inner
+// product operator returns the negative inner product.
+var distanceOperators = map[Distance]string{
+	DistanceCosine:       "<=>",
+	DistanceL2:           "<->",
+	DistanceInnerProduct: "<#>",
+	DistanceL1:           "<+>",
+}
+
+// distance returns the metric of retrieval queries.
+func (c *Client) distance() Distance {
+	return cmp.Or(c.Config.Distance, DistanceCosine)
+}
+
+// columnMetadata is recorded as the comment of embedding columns, so clients configured with another metric
+// than the one the embeddings, and their indexes, were created for fail instead of silently returning
+// worse results.
+type columnMetadata struct {
+	Distance Distance `json:"distance"`
+}
+
+// checkDistance returns an error if the metric recorded on the embedding column isn't Config.Distance. It
+// records the metric if the column exists without a comment.
+func (c *Client) checkDistance(ctx context.Context) error {
+	schema, table := splitSchemaTableName(c.Config.TableName)
+	var comment *string
+	err := c.conn.QueryRow(ctx, `SELECT col_description(a.attrelid, a.attnum) FROM pg_attribute a
+		JOIN pg_class t ON t.oid = a.attrelid JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = $1 AND t.relname = $2 AND a.attname = $3 AND NOT a.attisdropped`,
+		schema, table, c.embeddingColumn()).Scan(&comment)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // recorded once CreateEmbedding creates the column
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query the metric of the embedding column: %w", err)
+	}
+	if comment == nil {
+		return c.recordDistance(ctx)
+	}
+	return checkRecordedDistance(*comment, c.distance())
+}
+
+// checkRecordedDistance returns an error if comment, of an embedding column, records a metric other than
+// distance. Comments not recording a metric, e.g. set by users, are ignored.
+func checkRecordedDistance(comment string, distance Distance) error {
+	var metadata columnMetadata
+	if err := json.Unmarshal([]byte(comment), &metadata); err != nil || metadata.Distance == "" {
+		return nil
+	}
+	if metadata.Distance != distance {
+		return fmt.Errorf("embedding column was created for %s distance, but Config.Distance is %s", metadata.Distance, distance)
+	}
+	return nil
+}
+
+// recordDistance records Config.Distance as the comment of the embedding column.
+func (c *Client) recordDistance(ctx context.Context) error {
+	metadata, err := json.Marshal(columnMetadata{Distance: c.distance()})
+	if err != nil {
+		return err
+	}
+	schema, table := splitSchemaTableName(c.Config.TableName)
+	// COMMENT doesn't take parameters
+	query := fmt.Sprintf("COMMENT ON COLUMN %s IS '%s'", pgx.Identifier{schema, table, c.embeddingColumn()}.Sanitize(), metadata)
+	if _, err := c.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to record the metric of the embedding column: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package rag
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDistanceSQL(t *testing.T) {
+	tests := map[Distance]string{
+		"":                   "embedding <=> $1::vector",
+		DistanceL2:           "embedding <-> $1::vector",
+		DistanceInnerProduct: "embedding <#> $1::vector",
+		DistanceL1:           "embedding <+> $1::vector",
+	}
+	for distance, expected := range tests {
+		c := &Client{Config: Config{Distance: distance}}
+		if got := c.distanceSQL(); got != expected {
+			t.Errorf("distanceSQL() for %q = %s, want %s", distance, got, expected)
+		}
+	}
+	if err := validateVectorType(Config{Distance: "hamming"}); err == nil {
+		t.Error("expected unknown distance rejected")
+	}
+}
+
+func TestCheckRecordedDistance(t *testing.T) {
+	for _, comment := range []string{`{"distance":"l2"}`, "embeddings of the docs", `{"other":1}`} {
+		if err := checkRecordedDistance(comment, DistanceL2); err != nil {
+			t.Errorf("unexpected error for %q: %v", comment, err)
+		}
+	}
+	if err := checkRecordedDistance(`{"distance":"cosine"}`, DistanceInnerProduct); err == nil {
+		t.Error("expected mismatched distance rejected")
+	}
+}
+
+func TestCreateIndexDistanceMismatch(t *testing.T) {
+	c := &Client{Config: Config{Distance: DistanceInnerProduct}}
+	if err := c.CreateIndex(context.Background(), IndexOptions{Distance: DistanceCosine}); err == nil {
+		t.Error("expected index of another distance than Config.Distance rejected")
+	}
+}
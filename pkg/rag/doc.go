@@ -2,6 +2,7 @@
 Package rag provides functions to integrate Retrieval Augmented Generation (RAG)
 capabilities in PostgreSQL tables using the pgvector extension. It facilitates
 operations for adding embeddings on tables from popular language model APIs such
-as OpenAI, Ollama, and LMStudio.
+as OpenAI, Ollama, LMStudio, Cohere, Vertex AI and Amazon Bedrock, selected with
+Config.Provider, or any other implementing EmbeddingProvider.
 */
 package rag
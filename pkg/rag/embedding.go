@@ -2,20 +2,16 @@ package rag
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-
-	"github.com/edgeflare/pgo/pkg/httputil"
 )
 
-// EmbeddingRequest is the request body for the FetchEmbedding function
+// EmbeddingRequest is the request body of OpenAI-compatible embedding APIs (see OpenAIEmbedder)
 type EmbeddingRequest struct {
 	Model string   `json:"model"`
 	Input []string `json:"input"`
 }
 
-// EmbeddingResponse is the response body for the FetchEmbedding function
+// EmbeddingResponse is the response body of OpenAI-compatible embedding APIs
 // https://platform.openai.com/docs/api-reference/embeddings/create
 // https://github.com/ollama/ollama/blob/main/docs/api.md#embeddings
 type EmbeddingResponse struct {
@@ -24,45 +20,21 @@ type EmbeddingResponse struct {
 	} `json:"data"`
 }
 
-// FetchEmbedding fetches embeddings from the LLM API
+// FetchEmbedding fetches embeddings from the client's embedding provider (see Config.Provider)
 func (c *Client) FetchEmbedding(ctx context.Context, input []string) ([][]float32, error) {
 	// check if input is empty
 	if len(input) == 0 {
 		return [][]float32{}, fmt.Errorf("input is empty")
 	}
 
-	data := &EmbeddingRequest{
-		Input: input,
-		Model: c.Config.ModelId,
-	}
-
-	dataBytes, err := json.Marshal(data)
-	if err != nil {
-		return [][]float32{}, fmt.Errorf("failed to marshal request data: %w", err)
-	}
-
-	config := httputil.DefaultRequestConfig(
-		http.MethodPost,
-		fmt.Sprintf("%s%s", c.Config.ApiUrl, c.Config.EmbeddingsPath),
-	)
-	config.Headers = map[string][]string{
-		"Authorization": {fmt.Sprintf("Bearer %s", c.Config.ApiKey)},
-	}
-
-	response, err := httputil.Request(ctx, config, dataBytes)
+	embeddings, err := c.embedder.Embed(ctx, input)
 	if err != nil {
-		return [][]float32{}, fmt.Errorf("failed to fetch embeddings: %w", err)
+		return [][]float32{}, err
 	}
-
-	var embeddingResponse EmbeddingResponse
-	if err := json.Unmarshal(response.Body, &embeddingResponse); err != nil {
-		return [][]float32{}, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	embeddings := make([][]float32, len(embeddingResponse.Data))
-	for i, d := range embeddingResponse.Data {
-		embeddings[i] = d.Embedding
-	}
-
 	return embeddings, nil
 }
+
+// Embedder returns the client's embedding provider.
+func (c *Client) Embedder() EmbeddingProvider {
+	return c.embedder
+}
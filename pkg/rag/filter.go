@@ -0,0 +1,149 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Filter scopes retrieval to rows matching all its conditions, e.g. a tenant's rows of a language.
+//
+// Tags and Metadata filter on the table's tags (text[]) and metadata (jsonb) columns, which must exist to
+// be filtered on.
+type Filter struct {
+	// Tags selects rows whose tags contain all of them.
+	Tags []string
+	// Metadata selects rows whose metadata contains it, e.g. {"tenant": "acme", "lang": "en"}.
+	Metadata map[string]any
+	// MetadataPredicates select rows by comparing values in their metadata.
+	MetadataPredicates []MetadataPredicate
+	// Where are conditions on other columns, see Where.
+	Where []Expr
+}
+
+// MetadataPredicate compares the value at Path in rows' metadata with Value, e.g.
+// MetadataPredicate{Path: []string{"published", "year"}, Op: ">=", Value: 2020}. Values are compared as
+// numbers if Value is one, and as text otherwise.
+type MetadataPredicate struct {
+	Path []string
+	// Op is one of =, <>, <, <=, >, >= or LIKE.
+	Op    string
+	Value any
+}
+
+// Expr is an SQL condition with ? placeholders for its Args.
+type Expr struct {
+	SQL  string
+	Args []any
+}
+
+// Where returns a condition with ? placeholders for args, numbered when the query is built, e.g.
+// Where("created_at > ? AND kind = ANY(?)", since, kinds). Values must be passed as args, never formatted
+// into sql. A literal ? is written ??.
+func Where(sql string, args ...any) Expr {
+	return Expr{SQL: sql, Args: args}
+}
+
+var predicateOps = map[string]bool{"=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true, "LIKE": true}
+
+// build returns f's conditions, each prefixed by AND, and their arguments, numbering placeholders after
+// the query's first n arguments.
+func (f Filter) build(n int) (string, []any, error) {
+	var sql strings.Builder
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", n+len(args))
+	}
+
+	if len(f.Tags) > 0 {
+		sql.WriteString(" AND tags @> " + arg(f.Tags) + "::text[]")
+	}
+	if len(f.Metadata) > 0 {
+		metadata, err := json.Marshal(f.Metadata)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal metadata filter: %w", err)
+		}
+		sql.WriteString(" AND metadata @> " + arg(string(metadata)) + "::jsonb")
+	}
+	for _, p := range f.MetadataPredicates {
+		op := strings.ToUpper(p.Op)
+		if !predicateOps[op] {
+			return "", nil, fmt.Errorf("unsupported metadata predicate operator %q", p.Op)
+		}
+		if len(p.Path) == 0 {
+			return "", nil, fmt.Errorf("metadata predicate without path")
+		}
+		value := "(metadata #>> " + arg(p.Path) + "::text[])"
+		switch p.Value.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			if op == "LIKE" {
+				return "", nil, fmt.Errorf("LIKE compares text, not %T", p.Value)
+			}
+			fmt.Fprintf(&sql, " AND %s::numeric %s %s", value, op, arg(p.Value))
+		default:
+			fmt.Fprintf(&sql, " AND %s %s %s", value, op, arg(fmt.Sprint(p.Value)))
+		}
+	}
+	for _, e := range f.Where {
+		where, err := numberPlaceholders(e, arg)
+		if err != nil {
+			return "", nil, err
+		}
+		sql.WriteString(" AND (" + where + ")")
+	}
+	return sql.String(), args, nil
+}
+
+// numberPlaceholders replaces the ? placeholders of e, outside quoted strings and identifiers, with the
+// numbered ones arg returns for its arguments.
+func numberPlaceholders(e Expr, arg func(any) string) (string, error) {
+	var sql strings.Builder
+	var quote byte
+	used := 0
+	for i := 0; i < len(e.SQL); i++ {
+		ch := e.SQL[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?' && i+1 < len(e.SQL) && e.SQL[i+1] == '?':
+			sql.WriteByte('?')
+			i++
+			continue
+		case ch == '?':
+			if used == len(e.Args) {
+				return "", fmt.Errorf("condition %q has more placeholders than its %d arguments", e.SQL, len(e.Args))
+			}
+			sql.WriteString(arg(e.Args[used]))
+			used++
+			continue
+		}
+		sql.WriteByte(ch)
+	}
+	if quote != 0 {
+		return "", fmt.Errorf("condition %q has an unterminated quote", e.SQL)
+	}
+	if used != len(e.Args) {
+		return "", fmt.Errorf("condition %q has %d placeholders for %d arguments", e.SQL, used, len(e.Args))
+	}
+	return sql.String(), nil
+}
+
+// buildFilters returns the conditions of all filters, as Filter.build does.
+func buildFilters(filters []Filter, n int) (string, []any, error) {
+	var sql strings.Builder
+	var args []any
+	for _, f := range filters {
+		where, fargs, err := f.build(n + len(args))
+		if err != nil {
+			return "", nil, err
+		}
+		sql.WriteString(where)
+		args = append(args, fargs...)
+	}
+	return sql.String(), args, nil
+}
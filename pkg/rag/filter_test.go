@@ -0,0 +1,52 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilterBuild(t *testing.T) {
+	f := Filter{
+		Tags:     []string{"go", "postgres"},
+		Metadata: map[string]any{"tenant": "acme"},
+		MetadataPredicates: []MetadataPredicate{
+			{Path: []string{"published", "year"}, Op: ">=", Value: 2020},
+			{Path: []string{"lang"}, Op: "like", Value: "en%"},
+		},
+		Where: []Expr{Where("kind = ANY(?) AND title <> 'why?' AND data ?? 'key'", []string{"doc"})},
+	}
+	where, args, err := f.build(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := " AND tags @> $3::text[] AND metadata @> $4::jsonb" +
+		" AND (metadata #>> $5::text[])::numeric >= $6 AND (metadata #>> $7::text[]) LIKE $8" +
+		" AND (kind = ANY($9) AND title <> 'why?' AND data ? 'key')"
+	if where != expected {
+		t.Errorf("got %s, want %s", where, expected)
+	}
+	expectedArgs := []any{[]string{"go", "postgres"}, `{"tenant":"acme"}`, []string{"published", "year"}, 2020, []string{"lang"}, "en%", []string{"doc"}}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("got args %v, want %v", args, expectedArgs)
+	}
+
+	where, args, err = buildFilters([]Filter{{Tags: []string{"a"}}, {Where: []Expr{Where("id > ?", 1)}}}, 1)
+	if err != nil || where != " AND tags @> $2::text[] AND (id > $3)" || len(args) != 2 {
+		t.Errorf("unexpected filters %s %v: %v", where, args, err)
+	}
+}
+
+func TestFilterBuildErrors(t *testing.T) {
+	for _, f := range []Filter{
+		{MetadataPredicates: []MetadataPredicate{{Path: []string{"a"}, Op: "; DROP TABLE x"}}},
+		{MetadataPredicates: []MetadataPredicate{{Op: "="}}},
+		{MetadataPredicates: []MetadataPredicate{{Path: []string{"a"}, Op: "LIKE", Value: 1}}},
+		{Where: []Expr{Where("a = ? AND b = ?", 1)}},
+		{Where: []Expr{Where("a = ?", 1, 2)}},
+		{Where: []Expr{Where("a = 'x", 1)}},
+	} {
+		if _, _, err := f.build(0); err == nil {
+			t.Errorf("expected %+v rejected", f)
+		}
+	}
+}
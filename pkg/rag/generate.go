@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/edgeflare/pgo/pkg/httputil"
@@ -129,7 +128,10 @@ func (c *Client) GenerateWithRetrieval(ctx context.Context, prompt string, retri
 	}
 
 	// Step 2: Construct an augmented prompt
-	augmentedPrompt := constructAugmentedPrompt(prompt, relevantInfo)
+	augmentedPrompt, err := c.augmentedPrompt(prompt, relevantInfo)
+	if err != nil {
+		return nil, err
+	}
 
 	// Step 3: Generate response using the augmented prompt
 	response, err := c.Generate(ctx, augmentedPrompt)
@@ -139,17 +141,3 @@ func (c *Client) GenerateWithRetrieval(ctx context.Context, prompt string, retri
 
 	return response, nil
 }
-
-// constructAugmentedPrompt creates a prompt that includes the original query and relevant information
-func constructAugmentedPrompt(prompt string, relevantInfo []Embedding) string {
-	var sb strings.Builder
-	sb.WriteString("Given the following context:\n\n")
-
-	for _, info := range relevantInfo {
-		sb.WriteString(fmt.Sprintf("- %s\n", info.Content))
-	}
-
-	sb.WriteString(fmt.Sprintf("\nAnswer the following question: %s", prompt))
-
-	return sb.String()
-}
@@ -0,0 +1,215 @@
+package rag
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// SearchRequest is the body of POST /rag/search.
+type SearchRequest struct {
+	Query string `json:"query" validate:"required,max=8192"`
+	Limit int    `json:"limit" validate:"min=0,max=100"` // defaults to 5
+	// Hybrid fuses full-text and vector search, see HybridRetrieve.
+	Hybrid bool `json:"hybrid"`
+	// Tags and Metadata filter rows, see Filter.
+	Tags     []string       `json:"tags"`
+	Metadata map[string]any `json:"metadata"`
+	// Space selects the embedding space searched, see Client.Space; the default one if empty.
+	Space string `json:"space"`
+}
+
+// SearchResult is a row of the response of POST /rag/search.
+type SearchResult struct {
+	PK      interface{} `json:"pk"`
+	Content string      `json:"content"`
+	// Score is the fused score of hybrid searches.
+	Score float64 `json:"score,omitempty"`
+}
+
+// EmbedRequest is the body of POST /rag/embed.
+type EmbedRequest struct {
+	Input []string `json:"input" validate:"required,min=1,max=2048"`
+}
+
+// EmbedResponse is the response of POST /rag/embed.
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// GenerateHTTPRequest is the body of POST /rag/generate.
+type GenerateHTTPRequest struct {
+	Prompt string `json:"prompt" validate:"required"`
+	// RetrievalLimit is the number of rows retrieved to augment the prompt; 0 generates without retrieval.
+	RetrievalLimit int `json:"retrieval_limit" validate:"min=0,max=100"`
+	// RetrievalInput is the query of the retrieval, if not the prompt.
+	RetrievalInput string `json:"retrieval_input"`
+	// Stream streams the response as server-sent events, see WriteSSE. Requests accepting
+	// text/event-stream are streamed too.
+	Stream bool `json:"stream"`
+}
+
+// GenerateHTTPResponse is the response of POST /rag/generate, unless streamed.
+type GenerateHTTPResponse struct {
+	Response string `json:"response"`
+}
+
+// RegisterRoutes registers the client's RAG endpoints on r, so non-Go clients can use them:
+//
+//   - POST /rag/search retrieves rows similar to a query (SearchRequest)
+//   - POST /rag/embed returns embeddings of texts (EmbedRequest)
+//   - POST /rag/generate performs retrieval-augmented generation (GenerateHTTPRequest)
+//
+// middleware, e.g. authentication, applies to the endpoints only. Requests using the database are served one
+// at a time for clients of NewClient, as their connection serves one query at a time; use NewPoolClient to
+// serve them concurrently.
+func (c *Client) RegisterRoutes(r *httputil.Router, middleware ...httputil.Middleware) {
+	h := &ragHandlers{client: c}
+	r.Handle("POST /rag/search", http.HandlerFunc(h.search), middleware...)
+	r.Handle("POST /rag/embed", http.HandlerFunc(h.embed), middleware...)
+	r.Handle("POST /rag/generate", http.HandlerFunc(h.generate), middleware...)
+}
+
+// Handler returns a handler serving the endpoints of RegisterRoutes, for servers not using httputil.Router.
+func (c *Client) Handler(middleware ...httputil.Middleware) http.Handler {
+	h := &ragHandlers{client: c}
+	mux := http.NewServeMux()
+	wrap := func(handler http.HandlerFunc) http.Handler {
+		var wrapped http.Handler = handler
+		for i := len(middleware) - 1; i >= 0; i-- {
+			wrapped = middleware[i](wrapped)
+		}
+		return wrapped
+	}
+	mux.Handle("POST /rag/search", wrap(h.search))
+	mux.Handle("POST /rag/embed", wrap(h.embed))
+	mux.Handle("POST /rag/generate", wrap(h.generate))
+	return mux
+}
+
+type ragHandlers struct {
+	client *Client
+	// mu serializes queries on the client's connection, unless it's a pool
+	mu sync.Mutex
+}
+
+// lock serializes requests using the database if the client uses a single connection, returning the unlock
+// function.
+func (h *ragHandlers) lock() func() {
+	if _, ok := h.client.conn.(*pgx.Conn); !ok {
+		return func() {}
+	}
+	h.mu.Lock()
+	return h.mu.Unlock
+}
+
+func (h *ragHandlers) search(w http.ResponseWriter, r *http.Request) {
+	req, err := httputil.Bind[SearchRequest](r)
+	if err != nil {
+		httputil.BindFailed(w, err)
+		return
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = 5
+	}
+	filter := Filter{Tags: req.Tags, Metadata: req.Metadata}
+	client := h.client
+	if req.Space != "" {
+		if client, err = h.client.Space(req.Space); err != nil {
+			httputil.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	defer h.lock()()
+	results := []SearchResult{}
+	if req.Hybrid {
+		rows, err := client.HybridRetrieve(r.Context(), req.Query, limit, HybridOptions{Filter: filter})
+		if err != nil {
+			h.fail(w, "search", err)
+			return
+		}
+		for _, row := range rows {
+			results = append(results, SearchResult{PK: row.PK, Content: row.Content, Score: row.Score})
+		}
+	} else {
+		rows, err := client.Retrieve(r.Context(), req.Query, limit, filter)
+		if err != nil {
+			h.fail(w, "search", err)
+			return
+		}
+		for _, row := range rows {
+			results = append(results, SearchResult{PK: row.PK, Content: row.Content})
+		}
+	}
+	httputil.JSON(w, http.StatusOK, results)
+}
+
+func (h *ragHandlers) embed(w http.ResponseWriter, r *http.Request) {
+	req, err := httputil.Bind[EmbedRequest](r)
+	if err != nil {
+		httputil.BindFailed(w, err)
+		return
+	}
+	embeddings, err := h.client.FetchEmbedding(r.Context(), req.Input)
+	if err != nil {
+		h.fail(w, "embed", err)
+		return
+	}
+	httputil.JSON(w, http.StatusOK, EmbedResponse{Model: h.client.embedder.Model(), Embeddings: embeddings})
+}
+
+func (h *ragHandlers) generate(w http.ResponseWriter, r *http.Request) {
+	req, err := httputil.Bind[GenerateHTTPRequest](r)
+	if err != nil {
+		httputil.BindFailed(w, err)
+		return
+	}
+
+	var tokens <-chan Token
+	if req.RetrievalLimit > 0 {
+		unlock := h.lock()
+		tokens, err = h.client.GenerateWithRetrievalStream(r.Context(), req.Prompt, req.RetrievalLimit, req.RetrievalInput)
+		unlock()
+	} else {
+		tokens, err = h.client.GenerateStream(r.Context(), req.Prompt)
+	}
+	if err != nil {
+		h.fail(w, "generate", err)
+		return
+	}
+
+	if req.Stream || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		if err := WriteSSE(w, tokens); err != nil {
+			h.client.logger.Warn("Streaming generation failed", zap.Error(err))
+		}
+		return
+	}
+	var sb strings.Builder
+	for token := range tokens {
+		if token.Err != nil {
+			h.fail(w, "generate", token.Err)
+			return
+		}
+		sb.WriteString(token.Text)
+	}
+	httputil.JSON(w, http.StatusOK, GenerateHTTPResponse{Response: sb.String()})
+}
+
+// fail logs err of op and sends it, as 429 Too Many Requests if the provider rate limited the request.
+func (h *ragHandlers) fail(w http.ResponseWriter, op string, err error) {
+	h.client.logger.Error("RAG request failed", zap.String("op", op), zap.Error(err))
+	var rateLimited *RateLimitError
+	if errors.As(err, &rateLimited) {
+		httputil.Error(w, http.StatusTooManyRequests, "rate limited by the model provider")
+		return
+	}
+	httputil.Error(w, http.StatusInternalServerError, op+" failed")
+}
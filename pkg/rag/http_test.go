@@ -0,0 +1,84 @@
+package rag
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestHandler(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"response":"4"}` + "\n" + `{"response":"2"}` + "\n"))
+	}))
+	defer llm.Close()
+
+	c := &Client{
+		Config:   Config{ApiUrl: llm.URL, GeneratePath: "/api/generate", BatchSize: 10},
+		logger:   zap.NewNop(),
+		embedder: &fakeEmbedder{},
+	}
+	requireKey := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Api-Key") != "key" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := c.Handler(requireKey)
+
+	do := func(path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", "key")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/rag/embed", `{"input":["a","abc"]}`)
+	var embedded EmbedResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &embedded); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+	if embedded.Model != "fake" || len(embedded.Embeddings) != 2 || embedded.Embeddings[1][0] != 3 {
+		t.Errorf("unexpected embeddings %+v", embedded)
+	}
+
+	rec = do("/rag/generate", `{"prompt":"6*7?"}`)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"response":"42"}` {
+		t.Errorf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+	rec = do("/rag/generate", `{"prompt":"6*7?"}`, "Accept", "text/event-stream")
+	if !strings.Contains(rec.Body.String(), `data: {"text":"4"}`) || !strings.HasSuffix(rec.Body.String(), "event: done\ndata: {}\n\n") {
+		t.Errorf("unexpected stream %s", rec.Body)
+	}
+
+	for path, body := range map[string]string{
+		"/rag/search":   `{"limit":5}`,
+		"/rag/embed":    `{"input":[]}`,
+		"/rag/generate": `{"prompt":"x","retrieval_limit":1000}`,
+	} {
+		if rec := do(path, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: got %d, want 400", path, body, rec.Code)
+		}
+	}
+	if rec := do("/rag/search", `{"query":"x","space":"unknown"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown space: got %d, want 400", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/rag/embed", strings.NewReader(`{"input":["a"]}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected the middleware applied, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,145 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HybridOptions configures HybridRetrieve. Zero values use the defaults.
+type HybridOptions struct {
+	// VectorWeight and TextWeight weigh the ranks of the vector and full-text queries. Both default to 1.
+	VectorWeight float64
+	TextWeight   float64
+	// K dampens the influence of the top ranks in Reciprocal Rank Fusion. Defaults to 60.
+	K int
+	// Candidates is the number of rows each query ranks. Defaults to 4 times the limit.
+	Candidates int
+	// Language is the text search configuration of the content, e.g. simple. Defaults to english.
+	Language string
+	// Filter scopes both queries to the rows matching it.
+	Filter Filter
+}
+
+// HybridResult is a row retrieved by HybridRetrieve.
+type HybridResult struct {
+	Embedding
+	// Score is the row's fused score, higher for more relevant rows
+	Score float64
+	// VectorRank and TextRank are the row's 1-based ranks in the vector and full-text queries, or 0 if it
+	// wasn't ranked by the query.
+	VectorRank int
+	TextRank   int
+}
+
+var languageRegexp = regexp.MustCompile(`^[a-z_]+$`)
+
+// HybridRetrieve retrieves the rows most relevant to the input by both a vector query, matching its meaning,
+// and a full-text query, matching its keywords, e.g. names and codes embeddings miss. Their results are fused
+// with Reciprocal Rank Fusion, scoring a row sum(weight / (K + rank)) over the queries.
+//
+// The full-text query ranks rows with ts_rank_cd; CreateTextIndex creates the index it uses.
+func (c *Client) HybridRetrieve(ctx context.Context, input string, limit int, opts HybridOptions) ([]HybridResult, error) {
+	language := cmp.Or(opts.Language, "english")
+	if !languageRegexp.MatchString(language) {
+		return nil, fmt.Errorf("invalid text search configuration %q", language)
+	}
+	candidates := cmp.Or(opts.Candidates, limit*4)
+	where, args, err := opts.Filter.build(2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
+	embedding, err := c.FetchEmbedding(ctx, []string{input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch embedding for input: %w", err)
+	}
+
+	pk, table := pgx.Identifier{c.Config.TablePrimaryKeyCol}.Sanitize(), c.tableIdentifier()
+	columns := pk + ", content, " + c.embeddingSelect()
+	vectorRows, err := c.queryEmbeddings(ctx, c.nearestSQL(columns, table, where),
+		append([]any{c.vectorParam(embedding[0]), candidates}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	textRows, err := c.queryEmbeddings(ctx, fmt.Sprintf(`SELECT %[1]s FROM %[2]s, websearch_to_tsquery('%[3]s', $1) query
+		WHERE to_tsvector('%[3]s', content) @@ query%[4]s ORDER BY ts_rank_cd(to_tsvector('%[3]s', content), query) DESC LIMIT $2`,
+		columns, table, language, where), append([]any{input, candidates}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return fuseRRF(vectorRows, textRows, limit, opts), nil
+}
+
+// CreateTextIndex creates a GIN index on the content's text search vector of language (english if empty),
+// used by the full-text query of HybridRetrieve. It does nothing if the index exists.
+func (c *Client) CreateTextIndex(ctx context.Context, language string) error {
+	language = cmp.Or(language, "english")
+	if !languageRegexp.MatchString(language) {
+		return fmt.Errorf("invalid text search configuration %q", language)
+	}
+	_, table := splitSchemaTableName(c.Config.TableName)
+	query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING gin (to_tsvector('%s', content))",
+		pgx.Identifier{fmt.Sprintf("%s_content_%s_idx", table, language)}.Sanitize(), c.tableIdentifier(), language)
+	if _, err := c.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create text index: %w", err)
+	}
+	return nil
+}
+
+// queryEmbeddings returns the rows of query, selecting the primary key, content and embedding.
+func (c *Client) queryEmbeddings(ctx context.Context, query string, args ...any) ([]Embedding, error) {
+	rows, err := c.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var results []Embedding
+	for rows.Next() {
+		var embedding Embedding
+		if err := rows.Scan(&embedding.PK, &embedding.Content, &embedding.Embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results = append(results, embedding)
+	}
+	return results, rows.Err()
+}
+
+// fuseRRF fuses the ranked rows of the vector and full-text queries with Reciprocal Rank Fusion, returning
+// the limit best.
+func fuseRRF(vectorRows, textRows []Embedding, limit int, opts HybridOptions) []HybridResult {
+	k := float64(cmp.Or(opts.K, 60))
+	vectorWeight, textWeight := cmp.Or(opts.VectorWeight, 1), cmp.Or(opts.TextWeight, 1)
+
+	var results []*HybridResult
+	index := make(map[string]*HybridResult) // by fmt.Sprint(pk), as pks may not be comparable
+	add := func(rows []Embedding, weight float64, rank func(*HybridResult) *int) {
+		for i, row := range rows {
+			key := fmt.Sprint(row.PK)
+			result, ok := index[key]
+			if !ok {
+				result = &HybridResult{Embedding: row}
+				index[key] = result
+				results = append(results, result)
+			}
+			*rank(result) = i + 1
+			result.Score += weight / (k + float64(i+1))
+		}
+	}
+	add(vectorRows, vectorWeight, func(r *HybridResult) *int { return &r.VectorRank })
+	add(textRows, textWeight, func(r *HybridResult) *int { return &r.TextRank })
+
+	// stable, so ties keep the vector query's order
+	slices.SortStableFunc(results, func(a, b *HybridResult) int { return cmp.Compare(b.Score, a.Score) })
+	fused := make([]HybridResult, 0, min(limit, len(results)))
+	for _, r := range results[:min(limit, len(results))] {
+		fused = append(fused, *r)
+	}
+	return fused
+}
@@ -0,0 +1,31 @@
+package rag
+
+import "testing"
+
+func TestFuseRRF(t *testing.T) {
+	rows := func(pks ...int64) []Embedding {
+		embeddings := make([]Embedding, len(pks))
+		for i, pk := range pks {
+			embeddings[i] = Embedding{PK: pk}
+		}
+		return embeddings
+	}
+	vector, text := rows(1, 2, 3), rows(3, 4, 1)
+
+	results := fuseRRF(vector, text, 3, HybridOptions{})
+	if len(results) != 3 || results[0].PK != int64(1) || results[1].PK != int64(3) || results[2].PK != int64(2) {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if results[0].VectorRank != 1 || results[0].TextRank != 3 || results[2].TextRank != 0 {
+		t.Errorf("unexpected ranks %+v", results)
+	}
+	if expected := 1.0/61 + 1.0/63; results[0].Score != expected {
+		t.Errorf("score = %v, want %v", results[0].Score, expected)
+	}
+
+	// weighing the full-text query ranks its first row first
+	results = fuseRRF(vector, text, 10, HybridOptions{TextWeight: 3, K: 1})
+	if len(results) != 4 || results[0].PK != int64(3) {
+		t.Errorf("unexpected weighted results %+v", results)
+	}
+}
@@ -0,0 +1,257 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Distance is a distance metric between embeddings.
+type Distance string
+
+const (
+	DistanceCosine       Distance = "cosine"
+	DistanceL2           Distance = "l2"
+	DistanceInnerProduct Distance = "ip"
+	DistanceL1           Distance = "l1"
+)
+
+// opClass returns the pgvector operator class indexing columns of vectorType, e.g. halfvec, for d.
+func (d Distance) opClass(vectorType string) (string, error) {
+	switch d = cmp.Or(d, DistanceCosine); d {
+	case DistanceCosine, DistanceL2, DistanceInnerProduct, DistanceL1:
+		return fmt.Sprintf("%s_%s_ops", vectorType, d), nil
+	default:
+		return "", fmt.Errorf("unknown distance %q", d)
+	}
+}
+
+// IndexMethod is a pgvector index access method.
+type IndexMethod string
+
+const (
+	// IndexHNSW builds a multilayer graph, with better speed-recall tradeoff than IVFFlat, but slower builds
+	// and more memory. It can be created on an empty table.
+	IndexHNSW IndexMethod = "hnsw"
+	// IndexIVFFlat divides vectors into lists, searching the closest ones. It should be created once the table
+	// has data, as lists are computed from the rows at build time.
+	IndexIVFFlat IndexMethod = "ivfflat"
+)
+
+// IndexOptions configures CreateIndex. Zero values use pgvector's defaults.
+type IndexOptions struct {
+	// Method defaults to IndexHNSW.
+	Method IndexMethod
+	// Distance is the metric the index serves queries of. Defaults to Config.Distance, as Retrieve uses; other
+	// metrics are rejected, as Retrieve wouldn't use the index.
+	Distance Distance
+	// Name defaults to <table>_<column>_<method>_idx, or <table>_<column>_<method>_bq_idx with
+	// Config.BinaryQuantization.
+	Name string
+	// M is the max number of connections per layer of HNSW indexes (pgvector's default 16).
+	M int
+	// EfConstruction is the size of the candidate list building HNSW indexes (pgvector's default 64).
+	EfConstruction int
+	// Lists is the number of lists of IVFFlat indexes. Defaults to rows/1000 up to 1M rows, and sqrt(rows)
+	// over, as pgvector recommends.
+	Lists int
+	// Concurrently builds the index without locking writes to the table, but slower.
+	Concurrently bool
+}
+
+// CreateIndex creates an index on the embedding column, so Retrieve doesn't scan the whole table. It does
+// nothing if an index of the name exists. With Config.BinaryQuantization, it indexes the binary quantized
+// embeddings by Hamming distance, as retrieval queries them, instead.
+func (c *Client) CreateIndex(ctx context.Context, opts IndexOptions) error {
+	opts.Method = cmp.Or(opts.Method, IndexHNSW)
+	if opts.Distance = cmp.Or(opts.Distance, c.distance()); opts.Distance != c.distance() {
+		return fmt.Errorf("index distance %s doesn't match Config.Distance %s", opts.Distance, c.distance())
+	}
+	if opts.Method == IndexIVFFlat && opts.Lists == 0 {
+		var rows int64
+		if err := c.conn.QueryRow(ctx, "SELECT count(*) FROM "+c.tableIdentifier()).Scan(&rows); err != nil {
+			return fmt.Errorf("failed to count rows: %w", err)
+		}
+		opts.Lists = ivfflatLists(rows)
+	}
+
+	quantizedDims := 0
+	if c.Config.BinaryQuantization {
+		quantizedDims = c.Config.Dimensions
+	}
+	query, err := createIndexSQL(c.Config.TableName, c.embeddingColumn(), c.vectorType(), quantizedDims, opts)
+	if err != nil {
+		return err
+	}
+	c.logger.Info("Creating index", zap.String("table", c.Config.TableName), zap.String("query", query))
+	if _, err := c.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	return nil
+}
+
+// createIndexSQL returns the statement creating an index on the embedding column of table, of vectorType, or
+// on its binary quantization if quantizedDims, the column's dimensions, isn't 0.
+func createIndexSQL(table, column, vectorType string, quantizedDims int, opts IndexOptions) (string, error) {
+	method := cmp.Or(opts.Method, IndexHNSW)
+	indexed, opClass := column, "bit_hamming_ops"
+	if quantizedDims > 0 {
+		indexed = fmt.Sprintf("(binary_quantize(%s)::bit(%d))", column, quantizedDims)
+	} else {
+		var err error
+		if opClass, err = opts.Distance.opClass(vectorType); err != nil {
+			return "", err
+		}
+	}
+
+	var with []string
+	switch method {
+	case IndexHNSW:
+		if opts.M > 0 {
+			with = append(with, fmt.Sprintf("m = %d", opts.M))
+		}
+		if opts.EfConstruction > 0 {
+			with = append(with, fmt.Sprintf("ef_construction = %d", opts.EfConstruction))
+		}
+	case IndexIVFFlat:
+		if opts.Distance == DistanceL1 && quantizedDims == 0 {
+			return "", fmt.Errorf("ivfflat indexes don't support %s distance", DistanceL1)
+		}
+		if vectorType == VectorTypeSparsevec {
+			return "", fmt.Errorf("ivfflat indexes don't support %s columns", VectorTypeSparsevec)
+		}
+		if opts.Lists > 0 {
+			with = append(with, fmt.Sprintf("lists = %d", opts.Lists))
+		}
+	default:
+		return "", fmt.Errorf("unknown index method %q", method)
+	}
+
+	schema, name := splitSchemaTableName(table)
+	query := "CREATE INDEX "
+	if opts.Concurrently {
+		query += "CONCURRENTLY "
+	}
+	query += fmt.Sprintf("IF NOT EXISTS %s ON %s USING %s (%s %s)",
+		pgx.Identifier{cmp.Or(opts.Name, indexName(table, column, method, quantizedDims > 0))}.Sanitize(),
+		pgx.Identifier{schema, name}.Sanitize(), method, indexed, opClass)
+	if len(with) > 0 {
+		query += " WITH (" + strings.Join(with, ", ") + ")"
+	}
+	return query, nil
+}
+
+// indexName returns the default name of an index of method on the embedding column of table, or its binary
+// quantization.
+func indexName(table, column string, method IndexMethod, quantized bool) string {
+	_, name := splitSchemaTableName(table)
+	if quantized {
+		return fmt.Sprintf("%s_%s_%s_bq_idx", name, column, method)
+	}
+	return fmt.Sprintf("%s_%s_%s_idx", name, column, method)
+}
+
+// ivfflatLists returns the number of lists pgvector recommends for an IVFFlat index of rows.
+func ivfflatLists(rows int64) int {
+	lists := int(rows / 1000)
+	if rows > 1_000_000 {
+		lists = int(math.Sqrt(float64(rows)))
+	}
+	return max(lists, 1)
+}
+
+// IndexExists reports whether an index of the name exists in the table's schema.
+func (c *Client) IndexExists(ctx context.Context, name string) (bool, error) {
+	schema, table := splitSchemaTableName(c.Config.TableName)
+	var exists bool
+	err := c.conn.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 AND indexname = $3)",
+		schema, table, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if index exists: %w", err)
+	}
+	return exists, nil
+}
+
+// DropIndex drops the index of the name, if it exists.
+func (c *Client) DropIndex(ctx context.Context, name string) error {
+	if _, err := c.conn.Exec(ctx, "DROP INDEX IF EXISTS "+c.indexIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to drop index: %w", err)
+	}
+	return nil
+}
+
+// Reindex rebuilds the index of the name, e.g. an IVFFlat index after the table's data changed much since
+// it was created, as its lists aren't updated. concurrently rebuilds it without locking writes.
+func (c *Client) Reindex(ctx context.Context, name string, concurrently bool) error {
+	query := "REINDEX INDEX "
+	if concurrently {
+		query += "CONCURRENTLY "
+	}
+	if _, err := c.conn.Exec(ctx, query+c.indexIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to reindex: %w", err)
+	}
+	return nil
+}
+
+// Analyze updates the planner's statistics of the table, so it chooses the vector index once the table
+// has grown.
+func (c *Client) Analyze(ctx context.Context) error {
+	if _, err := c.conn.Exec(ctx, "ANALYZE "+c.tableIdentifier()); err != nil {
+		return fmt.Errorf("failed to analyze table: %w", err)
+	}
+	return nil
+}
+
+// SetEfSearch sets the size of the candidate list searching HNSW indexes for the client's connection
+// (pgvector's default 40). Larger values improve recall at the cost of speed. Clients of NewPoolClient
+// can't set it, as it's set per connection; set it in the pool's AfterConnect, or for the database with
+// ALTER DATABASE ... SET hnsw.ef_search, instead.
+func (c *Client) SetEfSearch(ctx context.Context, efSearch int) error {
+	if err := c.requireConn("hnsw.ef_search"); err != nil {
+		return err
+	}
+	if _, err := c.conn.Exec(ctx, fmt.Sprintf("SET hnsw.ef_search = %d", efSearch)); err != nil {
+		return fmt.Errorf("failed to set hnsw.ef_search: %w", err)
+	}
+	return nil
+}
+
+// SetProbes sets the number of lists searched in IVFFlat indexes for the client's connection (pgvector's
+// default 1). Larger values improve recall at the cost of speed; sqrt(lists) is a good start. Clients of
+// NewPoolClient can't set it, as SetEfSearch describes.
+func (c *Client) SetProbes(ctx context.Context, probes int) error {
+	if err := c.requireConn("ivfflat.probes"); err != nil {
+		return err
+	}
+	if _, err := c.conn.Exec(ctx, fmt.Sprintf("SET ivfflat.probes = %d", probes)); err != nil {
+		return fmt.Errorf("failed to set ivfflat.probes: %w", err)
+	}
+	return nil
+}
+
+// requireConn returns an error unless the client uses a single connection, for setting the parameter of the
+// name on it.
+func (c *Client) requireConn(name string) error {
+	if _, ok := c.conn.(*pgx.Conn); !ok {
+		return fmt.Errorf("%s is set per connection; set it when the pool's connections connect", name)
+	}
+	return nil
+}
+
+// tableIdentifier returns the quoted name of the table.
+func (c *Client) tableIdentifier() string {
+	schema, table := splitSchemaTableName(c.Config.TableName)
+	return pgx.Identifier{schema, table}.Sanitize()
+}
+
+// indexIdentifier returns the quoted name of an index in the table's schema.
+func (c *Client) indexIdentifier(name string) string {
+	schema, _ := splitSchemaTableName(c.Config.TableName)
+	return pgx.Identifier{schema, name}.Sanitize()
+}
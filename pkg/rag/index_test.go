@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"cmp"
+	"testing"
+)
+
+func TestCreateIndexSQL(t *testing.T) {
+	tests := []struct {
+		name          string
+		vectorType    string
+		quantizedDims int
+		opts          IndexOptions
+		expected      string
+	}{
+		{
+			name:     "defaults",
+			expected: `CREATE INDEX IF NOT EXISTS "docs_embedding_hnsw_idx" ON "public"."docs" USING hnsw (embedding vector_cosine_ops)`,
+		},
+		{
+			name:     "hnsw",
+			opts:     IndexOptions{Distance: DistanceInnerProduct, M: 32, EfConstruction: 128, Concurrently: true},
+			expected: `CREATE INDEX CONCURRENTLY IF NOT EXISTS "docs_embedding_hnsw_idx" ON "public"."docs" USING hnsw (embedding vector_ip_ops) WITH (m = 32, ef_construction = 128)`,
+		},
+		{
+			name:     "ivfflat",
+			opts:     IndexOptions{Method: IndexIVFFlat, Distance: DistanceL2, Name: "docs_l2", Lists: 100},
+			expected: `CREATE INDEX IF NOT EXISTS "docs_l2" ON "public"."docs" USING ivfflat (embedding vector_l2_ops) WITH (lists = 100)`,
+		},
+		{
+			name:       "halfvec",
+			vectorType: VectorTypeHalfvec,
+			expected:   `CREATE INDEX IF NOT EXISTS "docs_embedding_hnsw_idx" ON "public"."docs" USING hnsw (embedding halfvec_cosine_ops)`,
+		},
+		{
+			name:          "binary quantization",
+			quantizedDims: 3072,
+			opts:          IndexOptions{Distance: DistanceL2},
+			expected:      `CREATE INDEX IF NOT EXISTS "docs_embedding_hnsw_bq_idx" ON "public"."docs" USING hnsw ((binary_quantize(embedding)::bit(3072)) bit_hamming_ops)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createIndexSQL("docs", "embedding", cmp.Or(tt.vectorType, VectorTypeVector), tt.quantizedDims, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+
+	for _, opts := range []IndexOptions{
+		{Method: IndexIVFFlat, Distance: DistanceL1},
+		{Method: "btree"},
+		{Distance: "hamming"},
+	} {
+		if _, err := createIndexSQL("docs", "embedding", VectorTypeVector, 0, opts); err == nil {
+			t.Errorf("expected %+v rejected", opts)
+		}
+	}
+	if _, err := createIndexSQL("docs", "embedding", VectorTypeSparsevec, 0, IndexOptions{Method: IndexIVFFlat}); err == nil {
+		t.Error("expected an ivfflat index of sparsevec rejected")
+	}
+}
+
+func TestIvfflatLists(t *testing.T) {
+	for rows, expected := range map[int64]int{0: 1, 50_000: 50, 1_000_000: 1000, 4_000_000: 2000} {
+		if got := ivfflatLists(rows); got != expected {
+			t.Errorf("ivfflatLists(%d) = %d, want %d", rows, got, expected)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ErrLowRecall is returned by Migrate when the new model's results agree too little with the current one's.
+var ErrLowRecall = errors.New("recall of the new embeddings is below MinRecall")
+
+// MigrationOptions configures Migrate.
+type MigrationOptions struct {
+	// Embedder is the provider of the new model. Required.
+	Embedder EmbeddingProvider
+	// Dimensions of the new model's embeddings. Required.
+	Dimensions int
+	// SampleQueries validate the new embeddings before they're swapped in, comparing their top K rows with
+	// those of the current embeddings. No validation is done without them.
+	SampleQueries []string
+	// K is the number of rows compared per sample query. Defaults to 10.
+	K int
+	// MinRecall is the minimum fraction of the current top K rows the new embeddings must retrieve, averaged
+	// over the sample queries, for them to be swapped in, e.g. 0.7.
+	MinRecall float64
+	// KeepOld keeps the current embeddings in an <column>_old column, e.g. embedding_old, after the swap, for
+	// rolling back.
+	// They're dropped otherwise.
+	KeepOld bool
+}
+
+// MigrationReport describes a migration.
+type MigrationReport struct {
+	// Backfilled is the number of rows embedded with the new model.
+	Backfilled int
+	// Recall is the average recall of the sample queries, or 0 without them.
+	Recall float64
+	// Swapped reports whether the new embeddings replaced the current ones.
+	Swapped bool
+}
+
+// Migrate switches the table's embeddings to another model without hand-written SQL:
+//
+//  1. the new embeddings are backfilled into an <column>_next column, e.g. embedding_next, resuming a previous
+//     migration's backfill, if any
+//  2. the new embeddings are validated against the current ones with sample queries
+//  3. the _next column replaces the embedding column in a transaction, so retrieval never sees a mix of both
+//
+// Once swapped, the client embeds with the new model. Vector indexes on the embedding column aren't
+// migrated; create them again with CreateIndex. If validation fails, ErrLowRecall is returned with the
+// report, and the _next column is kept for inspection.
+func (c *Client) Migrate(ctx context.Context, opts MigrationOptions) (*MigrationReport, error) {
+	if opts.Embedder == nil || opts.Dimensions <= 0 {
+		return nil, fmt.Errorf("migration requires Embedder and Dimensions")
+	}
+	next := *c
+	next.embedder = opts.Embedder
+	next.Config.Dimensions = opts.Dimensions
+	next.Config.ModelId = opts.Embedder.Model()
+	next.Config.EmbeddingColumn = c.embeddingColumn() + "_next"
+
+	table := c.tableIdentifier()
+	_, err := c.conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s, ADD COLUMN IF NOT EXISTS %s TEXT",
+		table, next.embeddingColumn(), next.columnType(), next.hashColumn()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add %s column: %w", next.embeddingColumn(), err)
+	}
+
+	report := &MigrationReport{}
+	if report.Backfilled, err = next.backfill(ctx); err != nil {
+		return report, err
+	}
+	c.logger.Info("Backfilled embeddings", zap.String("model", opts.Embedder.Model()), zap.Int("rows", report.Backfilled))
+
+	if len(opts.SampleQueries) > 0 {
+		if report.Recall, err = c.sampleRecall(ctx, &next, opts); err != nil {
+			return report, err
+		}
+		c.logger.Info("Validated embeddings", zap.Float64("recall", report.Recall))
+		if report.Recall < opts.MinRecall {
+			return report, fmt.Errorf("%w: %.2f < %.2f", ErrLowRecall, report.Recall, opts.MinRecall)
+		}
+	}
+
+	if err := c.swapEmbeddings(ctx, opts.KeepOld); err != nil {
+		return report, err
+	}
+	report.Swapped = true
+	c.embedder, c.Config.Dimensions, c.Config.ModelId = next.embedder, next.Config.Dimensions, next.Config.ModelId
+	c.Config.Embedder = next.embedder
+	return report, nil
+}
+
+// backfill embeds the content of rows without embeddings into the embedding column, in waves of Concurrency
+// batches, returning the number of rows embedded.
+func (c *Client) backfill(ctx context.Context) (int, error) {
+	pkType, err := c.primaryKeyType(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pk, table := pgx.Identifier{c.Config.TablePrimaryKeyCol}.Sanitize(), c.tableIdentifier()
+	selectQuery := fmt.Sprintf("SELECT %s, content FROM %s WHERE %s IS NULL AND content <> '' LIMIT $1", pk, table, c.embeddingColumn())
+
+	total, batchSize := 0, c.batchSize()
+	for {
+		rows, err := c.conn.Query(ctx, selectQuery, batchSize*c.concurrency())
+		if err != nil {
+			return total, fmt.Errorf("failed to query rows to backfill: %w", err)
+		}
+		var pks []any
+		var contents []string
+		for rows.Next() {
+			var pk any
+			var content string
+			if err := rows.Scan(&pk, &content); err != nil {
+				rows.Close()
+				return total, fmt.Errorf("failed to scan row: %w", err)
+			}
+			pks, contents = append(pks, pk), append(contents, content)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, fmt.Errorf("failed to query rows to backfill: %w", err)
+		}
+		if len(pks) == 0 {
+			return total, nil
+		}
+
+		embeddings, err := c.embedBatches(ctx, contents)
+		if err != nil {
+			return total, fmt.Errorf("failed to fetch embeddings: %w", err)
+		}
+		model := c.embedder.Model()
+		for i := 0; i < len(pks); i += batchSize {
+			end := min(i+batchSize, len(pks))
+			args := make([]any, 0, 3*(end-i))
+			for j := i; j < end; j++ {
+				args = append(args, pks[j], c.vectorParam(embeddings[j]), contentHash(model, contents[j]))
+			}
+			if _, err := c.conn.Exec(ctx, backfillSQL(table, pk, pkType, c.embeddingColumn(), c.vectorType(), end-i), args...); err != nil {
+				return total, fmt.Errorf("failed to backfill embeddings: %w", err)
+			}
+			total += end - i
+		}
+	}
+}
+
+// backfillSQL returns an UPDATE of column and its hash column of n rows of table, by their primary key pk of
+// pkType, from parameters ($pk, $embedding, $hash) per row, embeddings of vectorType.
+func backfillSQL(table, pk, pkType, column, vectorType string, n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("($%d::%s, $%d::%s, $%d::text)", 3*i+1, pkType, 3*i+2, vectorType, 3*i+3)
+	}
+	return fmt.Sprintf("UPDATE %[1]s t SET %[2]s = v.embedding, %[2]s_hash = v.hash FROM (VALUES %[3]s) AS v(pk, embedding, hash) WHERE t.%[4]s = v.pk",
+		table, column, strings.Join(values, ", "), pk)
+}
+
+// sampleRecall returns the average fraction of the top K rows of the current embeddings that next's
+// embeddings retrieve for the sample queries.
+func (c *Client) sampleRecall(ctx context.Context, next *Client, opts MigrationOptions) (float64, error) {
+	k := cmp.Or(opts.K, 10)
+	var sum float64
+	for _, query := range opts.SampleQueries {
+		current, err := c.topK(ctx, query, k)
+		if err != nil {
+			return 0, err
+		}
+		candidate, err := next.topK(ctx, query, k)
+		if err != nil {
+			return 0, err
+		}
+		sum += recall(current, candidate)
+	}
+	return sum / float64(len(opts.SampleQueries)), nil
+}
+
+// topK returns the primary keys, formatted with fmt.Sprint, of the k rows whose embeddings are nearest to
+// query.
+func (c *Client) topK(ctx context.Context, query string, k int) ([]string, error) {
+	embedding, err := c.FetchEmbedding(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch embedding for sample query: %w", err)
+	}
+	rows, err := c.conn.Query(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT $2",
+		pgx.Identifier{c.Config.TablePrimaryKeyCol}.Sanitize(), c.tableIdentifier(), c.distanceSQL()),
+		c.vectorParam(embedding[0]), k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute sample query: %w", err)
+	}
+	defer rows.Close()
+
+	var pks []string
+	for rows.Next() {
+		var pk any
+		if err := rows.Scan(&pk); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		pks = append(pks, fmt.Sprint(pk))
+	}
+	return pks, rows.Err()
+}
+
+// recall returns the fraction of expected found in got, or 1 if nothing is expected.
+func recall(expected, got []string) float64 {
+	if len(expected) == 0 {
+		return 1
+	}
+	found := make(map[string]bool, len(got))
+	for _, pk := range got {
+		found[pk] = true
+	}
+	n := 0
+	for _, pk := range expected {
+		if found[pk] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(expected))
+}
+
+// swapEmbeddings replaces the embedding column and its hash column with their _next columns in a
+// transaction, keeping the former as their _old columns if keepOld.
+func (c *Client) swapEmbeddings(ctx context.Context, keepOld bool) error {
+	table, column := c.tableIdentifier(), c.embeddingColumn()
+	tx, err := c.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS %[2]s_hash TEXT", table, column),
+		fmt.Sprintf("ALTER TABLE %[1]s DROP COLUMN %[2]s, DROP COLUMN %[2]s_hash", table, column),
+	}
+	if keepOld {
+		statements = []string{
+			statements[0],
+			fmt.Sprintf("ALTER TABLE %[1]s DROP COLUMN IF EXISTS %[2]s_old, DROP COLUMN IF EXISTS %[2]s_old_hash", table, column),
+			fmt.Sprintf("ALTER TABLE %[1]s RENAME COLUMN %[2]s TO %[2]s_old", table, column),
+			fmt.Sprintf("ALTER TABLE %[1]s RENAME COLUMN %[2]s_hash TO %[2]s_old_hash", table, column),
+		}
+	}
+	statements = append(statements,
+		fmt.Sprintf("ALTER TABLE %[1]s RENAME COLUMN %[2]s_next TO %[2]s", table, column),
+		fmt.Sprintf("ALTER TABLE %[1]s RENAME COLUMN %[2]s_next_hash TO %[2]s_hash", table, column))
+	for _, stmt := range statements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to swap embeddings: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
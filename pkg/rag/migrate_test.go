@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBackfillSQL(t *testing.T) {
+	got := backfillSQL(`"public"."docs"`, `"id"`, "bigint", "embedding_next", "halfvec", 2)
+	want := `UPDATE "public"."docs" t SET embedding_next = v.embedding, embedding_next_hash = v.hash FROM (VALUES ($1::bigint, $2::halfvec, $3::text), ($4::bigint, $5::halfvec, $6::text)) AS v(pk, embedding, hash) WHERE t."id" = v.pk`
+	if got != want {
+		t.Errorf("backfillSQL() = %q, want %q", got, want)
+	}
+}
+
+func TestRecall(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+		got      []string
+		want     float64
+	}{
+		{"identical", []string{"1", "2", "3", "4"}, []string{"4", "3", "2", "1"}, 1},
+		{"partial", []string{"1", "2", "3", "4"}, []string{"1", "5", "3", "6"}, 0.5},
+		{"disjoint", []string{"1", "2"}, []string{"3", "4"}, 0},
+		{"nothing expected", nil, []string{"1"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recall(tt.expected, tt.got); got != tt.want {
+				t.Errorf("recall() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateRequiresEmbedder(t *testing.T) {
+	c := &Client{}
+	if _, err := c.Migrate(context.Background(), MigrationOptions{Dimensions: 768}); err == nil {
+		t.Error("Migrate() without Embedder succeeded")
+	}
+	if _, err := c.Migrate(context.Background(), MigrationOptions{Embedder: &fakeEmbedder{}}); err == nil || errors.Is(err, ErrLowRecall) {
+		t.Errorf("Migrate() without Dimensions = %v, want error", err)
+	}
+}
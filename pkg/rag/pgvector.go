@@ -29,6 +29,13 @@ type Embedding struct {
 // If an empty(`""`) contentSelectQuery is provided, it queries the table rows and constructs the content column as col1_name:col1_value,col2_name:col2_value,...
 // For a non-empty contentSelectQuery, it expects the query to return two columns: primary key and content.
 //
+// The hash of the content embedded is stored in the <embedding column>_hash column, e.g. embedding_hash. Rows
+// whose content and model are unchanged since embedded are skipped, and content embedded in other rows is
+// copied from them, so re-runs only pay for new content.
+//
+// Rows are embedded in waves ordered by primary key. With Config.Checkpoint, the last primary key of each
+// wave is stored, and runs interrupted resume after it; Config.OnProgress is called after each wave.
+//
 // Exectuting contentSelectQuery returns output in below format:
 // primary_key, content; pk can be named anything and of any type, allowing usage of existing indexes on the primary key
 //
@@ -46,67 +53,86 @@ func (c *Client) CreateEmbedding(ctx context.Context, contentSelectQuery ...stri
 		return fmt.Errorf("failed to ensure table configuration: %w", err)
 	}
 
-	var query string
-
-	// Check the query conditions
-	if len(contentSelectQuery) == 0 {
-		// Case 1: No query supplied, assume content is already populated
-		query = fmt.Sprintf("SELECT %s, content FROM %s", c.Config.TablePrimaryKeyCol, c.Config.TableName)
-	} else if contentSelectQuery[0] == "" {
-		// Case 2: Empty string query, construct content column
-		schema, tableName := splitSchemaTableName(c.Config.TableName)
-		c.logger.Info("Query is empty, using table columns as content", zap.String("table", c.Config.TableName))
-		columns, err := c.queryAndFilterColumnNames(ctx, schema, tableName, []string{"embedding", "content"})
-		if err != nil {
-			return err
-		}
-		query = fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), c.Config.TableName)
-	} else {
-		// Case 3: Non-empty query
-		query = contentSelectQuery[0]
-	}
-
-	// queryAndProcessEmbeddingContents to process contents and ids
-	rows, err := c.queryAndProcessEmbeddingContents(ctx, query)
+	query, err := c.contentQuery(ctx, contentSelectQuery)
 	if err != nil {
 		return err
 	}
-	c.logger.Debug("contents", zap.Any("contents", rows))
 
-	contents := []string{}
-	for _, embedding := range rows {
-		contents = append(contents, embedding.Content)
+	pkType, err := c.primaryKeyType(ctx)
+	if err != nil {
+		return err
 	}
-
-	embeddings, err := c.FetchEmbedding(ctx, contents)
+	pk, err := c.queryPrimaryKey(ctx, query)
 	if err != nil {
-		return fmt.Errorf("failed to fetch embeddings: %w", err)
+		return err
 	}
-	c.logger.Debug("embeddings", zap.Int("embeddings", len(embeddings)))
 
-	// Ensure the lengths match
-	if len(contents) != len(embeddings) {
-		return fmt.Errorf("mismatch between contents and embeddings length: %d vs %d", len(contents), len(embeddings))
+	var cp checkpoint
+	if c.Config.Checkpoint {
+		if err := c.ensureCheckpointTable(ctx); err != nil {
+			return err
+		}
+		if cp, err = c.loadCheckpoint(ctx, query); err != nil {
+			return err
+		}
+		if cp.lastPK != nil {
+			c.logger.Info("Resuming embedding from checkpoint", zap.String("table", c.Config.TableName),
+				zap.String("after", *cp.lastPK), zap.Int("processed", cp.processed))
+		}
+	}
+	progress := Progress{Processed: cp.processed}
+	if c.Config.OnProgress != nil {
+		if progress.Total, err = c.countRows(ctx, query); err != nil {
+			return err
+		}
 	}
 
-	// update the embeddings into the database
-	for i := range contents { // Use index to access both contents and ids
-		embedding := embeddings[i]
-		pk := rows[i].PK
-
-		c.logger.Debug("embedding", zap.Any("id", pk), zap.String("content", contents[i]), zap.Any("embedding[0]", embedding[0]))
+	// embed up to Concurrency batches at once, a wave of rows ordered by primary key at a time, writing each
+	// batch with a single UPDATE. Rows whose content is unchanged since embedded are skipped, and content
+	// embedded already isn't fetched again.
+	page := pageSQL(query, pk, pkType)
+	for {
+		rows, err := c.queryAndProcessEmbeddingContents(ctx, page, cp.lastPK, c.batchSize()*c.concurrency())
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		c.logger.Debug("contents", zap.Any("contents", rows))
 
-		// Call the helper function to update the embedding
-		if err := c.updateEmbedding(ctx, embedding, contents[i], pk); err != nil {
+		embedded, err := c.embedRows(ctx, pkType, rows)
+		if err != nil {
 			return err
 		}
+		lastPK := fmt.Sprint(rows[len(rows)-1].PK)
+		cp = checkpoint{lastPK: &lastPK, processed: cp.processed + len(rows)}
+		if c.Config.Checkpoint {
+			if err := c.saveCheckpoint(ctx, query, cp); err != nil {
+				return err
+			}
+		}
+		if c.Config.OnProgress != nil {
+			progress.Processed, progress.Embedded, progress.LastPK = cp.processed, progress.Embedded+embedded, rows[len(rows)-1].PK
+			c.Config.OnProgress(progress)
+		}
 	}
 
+	if c.Config.Checkpoint {
+		return c.deleteCheckpoint(ctx)
+	}
 	return nil
 }
 
-// Retrieve retrieves the most similar rows to the input
-func (c *Client) Retrieve(ctx context.Context, input string, limit int) ([]Embedding, error) {
+// Retrieve retrieves the most similar rows to the input, of those matching filters, if any.
+// With Config.Reranker, the nearest Config.RerankCandidates rows are retrieved, returning the limit most
+// relevant of them by the reranker's scores.
+func (c *Client) Retrieve(ctx context.Context, input string, limit int, filters ...Filter) ([]Embedding, error) {
+	where, args, err := buildFilters(filters, 2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+
 	// Step 1: Fetch the embedding for the input text
 	embedding, err := c.FetchEmbedding(ctx, []string{input})
 	if err != nil {
@@ -114,13 +140,10 @@ func (c *Client) Retrieve(ctx context.Context, input string, limit int) ([]Embed
 	}
 
 	// Step 2: Query the database using the fetched embedding
-	queryStr := fmt.Sprintf(
-		"SELECT id, content, embedding FROM %s ORDER BY embedding <=> $1 LIMIT $2",
-		c.Config.TableName,
-	)
+	queryStr := c.nearestSQL("id, content, "+c.embeddingSelect(), c.Config.TableName, where)
 
 	// Execute the query with the embedding
-	rows, err := c.conn.Query(ctx, queryStr, pgvector.NewVector(embedding[0]), limit)
+	rows, err := c.conn.Query(ctx, queryStr, append([]any{c.vectorParam(embedding[0]), c.rerankCandidates(limit)}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -135,8 +158,38 @@ func (c *Client) Retrieve(ctx context.Context, input string, limit int) ([]Embed
 		}
 		results = append(results, embedding)
 	}
+	// release the connection while reranking
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
 
-	return results, nil
+	// Step 3: Rerank the candidates, if a reranker is configured
+	return c.rerank(ctx, input, results, limit)
+}
+
+// contentQuery returns the query selecting rows' primary key and content, as CreateEmbedding describes
+func (c *Client) contentQuery(ctx context.Context, contentSelectQuery []string) (string, error) {
+	if len(contentSelectQuery) == 0 {
+		// Case 1: No query supplied, assume content is already populated
+		return fmt.Sprintf("SELECT %s, content FROM %s", c.Config.TablePrimaryKeyCol, c.Config.TableName), nil
+	}
+	if contentSelectQuery[0] == "" {
+		// Case 2: Empty string query, construct content column
+		schema, tableName := splitSchemaTableName(c.Config.TableName)
+		c.logger.Info("Query is empty, using table columns as content", zap.String("table", c.Config.TableName))
+		var excluded []string
+		for _, column := range c.embeddingColumns() {
+			excluded = append(excluded, column, column+"_hash")
+		}
+		columns, err := c.queryAndFilterColumnNames(ctx, schema, tableName, append(excluded, "content"))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), c.Config.TableName), nil
+	}
+	// Case 3: Non-empty query
+	return contentSelectQuery[0], nil
 }
 
 // ensureTableConfig ensures the table exists and has the required columns
@@ -165,6 +218,10 @@ func (c *Client) ensureTableConfig(ctx context.Context) error {
 	}
 	c.logger.Info("Required columns ensured", zap.String("table", c.Config.TableName))
 
+	if err := c.checkDistance(ctx); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -175,8 +232,8 @@ func (c *Client) createTable(ctx context.Context, tableName string) error {
 		CREATE TABLE IF NOT EXISTS %s (
 			%s BIGINT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
 			content TEXT,
-			embedding vector(%d)
-		)`, tableName, c.Config.TablePrimaryKeyCol, c.Config.Dimensions)
+			%s %s
+		)`, tableName, c.Config.TablePrimaryKeyCol, c.embeddingColumn(), c.columnType())
 
 	_, err := c.conn.Exec(ctx, query)
 	if err != nil {
@@ -210,13 +267,13 @@ func (c *Client) ensureRequiredColumnsExist(ctx context.Context, tableName strin
 	}
 	c.logger.Info("Content column check", zap.Bool("exists", contentColumnExists))
 
-	// Check for 'embedding' column
+	// Check for the embedding column
 	var embeddingColumnExists bool
-	err = c.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema=$1 AND table_name=$2 AND column_name='embedding')", schema, table).Scan(&embeddingColumnExists)
+	err = c.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema=$1 AND table_name=$2 AND column_name=$3)", schema, table, c.embeddingColumn()).Scan(&embeddingColumnExists)
 	if err != nil {
 		return fmt.Errorf("failed to check for embedding column: %w", err)
 	}
-	c.logger.Info("Embedding column check", zap.Bool("exists", embeddingColumnExists))
+	c.logger.Info("Embedding column check", zap.String("column", c.embeddingColumn()), zap.Bool("exists", embeddingColumnExists))
 
 	// Add primary key column if it doesn't exist and is configured
 	if !pkColumnExists && c.Config.TablePrimaryKeyCol != "" {
@@ -242,10 +299,10 @@ func (c *Client) ensureRequiredColumnsExist(ctx context.Context, tableName strin
 		c.logger.Info("Successfully added content column", zap.String("table", tableName))
 	}
 
-	// Add 'embedding' column if it doesn't exist
+	// Add the embedding column if it doesn't exist
 	if !embeddingColumnExists {
-		c.logger.Info("Adding embedding column", zap.String("table", tableName))
-		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN embedding VECTOR(%d)", tableName, c.Config.Dimensions)
+		c.logger.Info("Adding embedding column", zap.String("table", tableName), zap.String("column", c.embeddingColumn()))
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", tableName, c.embeddingColumn(), c.columnType())
 		_, err = c.conn.Exec(ctx, query)
 		if err != nil {
 			c.logger.Error("Failed to add embedding column", zap.Error(err))
@@ -254,9 +311,15 @@ func (c *Client) ensureRequiredColumnsExist(ctx context.Context, tableName strin
 		c.logger.Info("Successfully added embedding column", zap.String("table", tableName))
 	}
 
+	// Add the content hash column, to skip unchanged content when embedding again
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s TEXT", tableName, c.hashColumn())
+	if _, err := c.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to add content hash column: %w", err)
+	}
+
 	// Final verification
 	c.logger.Info("Verifying all required columns")
-	err = c.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema=$1 AND table_name=$2 AND column_name='embedding')", schema, table).Scan(&embeddingColumnExists)
+	err = c.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema=$1 AND table_name=$2 AND column_name=$3)", schema, table, c.embeddingColumn()).Scan(&embeddingColumnExists)
 	if err != nil {
 		return fmt.Errorf("failed to verify embedding column: %w", err)
 	}
@@ -303,27 +366,11 @@ func formatRowValues(fields []pgconn.FieldDescription, values []interface{}) str
 	return strings.Join(pairs, ",")
 }
 
-func (c *Client) updateEmbedding(ctx context.Context, embedding []float32, content string, id interface{}) error {
-	// Prepare update query
-	query := fmt.Sprintf(`
-		UPDATE %s 
-		SET embedding = $1, content = $2 
-		WHERE %s = $3
-	`, c.Config.TableName, c.Config.TablePrimaryKeyCol)
-
-	// Execute the query
-	_, err := c.conn.Exec(ctx, query, pgvector.NewVector(embedding), content, id)
-	if err != nil {
-		return fmt.Errorf("failed to update embedding: %w", err)
-	}
-	return nil
-}
-
 // queryAndProcessEmbeddingContents queries the database and processes the rows to populate contents and ids.
-func (c *Client) queryAndProcessEmbeddingContents(ctx context.Context, selectQuery string) ([]Embedding, error) {
+func (c *Client) queryAndProcessEmbeddingContents(ctx context.Context, selectQuery string, args ...any) ([]Embedding, error) {
 	var contents []Embedding
 
-	rows, err := c.conn.Query(ctx, selectQuery)
+	rows, err := c.conn.Query(ctx, selectQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query database: %w", err)
 	}
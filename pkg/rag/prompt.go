@@ -0,0 +1,124 @@
+package rag
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// PromptTemplate formats the prompts of GenerateWithRetrieval and GenerateWithRetrievalStream from the
+// question and the retrieved rows. The zero value formats them as:
+//
+//	Given the following context:
+//
+//	- <row content>
+//	- <row content>
+//
+//	Answer the following question: <question>
+type PromptTemplate struct {
+	// System is prepended to the prompt, e.g. instructions on the answers' tone.
+	System string
+	// Context is a text/template formatting each row, given a PromptRow. Defaults to "- {{.Content}}", or
+	// "[{{.Index}}] {{.Content}}" with Citations.
+	Context string
+	// Citations numbers the rows, asking the model to cite the ones it uses, e.g. [2].
+	Citations bool
+	// Prompt is a text/template formatting the whole prompt, given a PromptData, overriding the default
+	// above.
+	Prompt string
+	// MaxContextTokens truncates the context to the rows, in order of relevance, fitting in it, estimated at
+	// 4 characters per token. 0 doesn't truncate.
+	MaxContextTokens int
+}
+
+// PromptRow is a retrieved row formatted by PromptTemplate.Context.
+type PromptRow struct {
+	// Index is the 1-based position of the row, its citation marker with PromptTemplate.Citations
+	Index   int
+	PK      interface{}
+	Content string
+}
+
+// PromptData is formatted by PromptTemplate.Prompt.
+type PromptData struct {
+	System string
+	// Context is the formatted rows, a line each
+	Context   string
+	Citations bool
+	Question  string
+	// Rows are the rows formatted into Context
+	Rows []PromptRow
+}
+
+const defaultPromptTemplate = `{{if .System}}{{.System}}
+
+{{end}}Given the following context:
+
+{{.Context}}
+{{if .Citations}}Cite the context you use by its number, e.g. [1].
+{{end}}Answer the following question: {{.Question}}`
+
+// WithPromptTemplate returns a client using t to format the prompts of retrieval-augmented generation,
+// sharing c's connection, e.g. to override Config.PromptTemplate for a call:
+//
+//	c.WithPromptTemplate(rag.PromptTemplate{Citations: true}).GenerateWithRetrieval(ctx, prompt, 5)
+func (c *Client) WithPromptTemplate(t PromptTemplate) *Client {
+	client := *c
+	client.Config.PromptTemplate = &t
+	return &client
+}
+
+// augmentedPrompt returns the prompt answering prompt with relevantInfo, formatted by Config.PromptTemplate.
+func (c *Client) augmentedPrompt(prompt string, relevantInfo []Embedding) (string, error) {
+	var t PromptTemplate
+	if c.Config.PromptTemplate != nil {
+		t = *c.Config.PromptTemplate
+	}
+	return t.render(prompt, relevantInfo)
+}
+
+// render formats the prompt answering question with rows.
+func (t PromptTemplate) render(question string, rows []Embedding) (string, error) {
+	contextText := t.Context
+	if contextText == "" {
+		contextText = "- {{.Content}}"
+		if t.Citations {
+			contextText = "[{{.Index}}] {{.Content}}"
+		}
+	}
+	contextTmpl, err := template.New("context").Parse(contextText)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse context template: %w", err)
+	}
+	promptTmpl, err := template.New("prompt").Parse(cmp.Or(t.Prompt, defaultPromptTemplate))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+
+	data := PromptData{System: t.System, Citations: t.Citations, Question: question}
+	var formatted strings.Builder
+	budget := t.MaxContextTokens
+	for i, row := range rows {
+		promptRow := PromptRow{Index: i + 1, PK: row.PK, Content: row.Content}
+		var line strings.Builder
+		if err := contextTmpl.Execute(&line, promptRow); err != nil {
+			return "", fmt.Errorf("failed to format context: %w", err)
+		}
+		if t.MaxContextTokens > 0 {
+			if budget -= estimateTokens(line.String()); budget < 0 {
+				break
+			}
+		}
+		formatted.WriteString(line.String())
+		formatted.WriteString("\n")
+		data.Rows = append(data.Rows, promptRow)
+	}
+	data.Context = formatted.String()
+
+	var sb strings.Builder
+	if err := promptTmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to format prompt: %w", err)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	rows := []Embedding{{PK: 1, Content: "Paris is the capital of France."}, {PK: 2, Content: strings.Repeat("x", 100)}}
+
+	c := &Client{}
+	got, err := c.augmentedPrompt("What's the capital of France?", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Given the following context:\n\n- Paris is the capital of France.\n- " + strings.Repeat("x", 100) +
+		"\n\nAnswer the following question: What's the capital of France?"
+	if got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+
+	cited := c.WithPromptTemplate(PromptTemplate{System: "Be brief.", Citations: true, MaxContextTokens: 20})
+	if c.Config.PromptTemplate != nil {
+		t.Error("WithPromptTemplate changed the client's template")
+	}
+	got, err = cited.augmentedPrompt("What's the capital of France?", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "Be brief.\n\nGiven the following context:\n\n[1] Paris is the capital of France.\n\n" +
+		"Cite the context you use by its number, e.g. [1].\nAnswer the following question: What's the capital of France?"
+	if got != expected {
+		t.Errorf("got %q, want %q", got, expected)
+	}
+
+	custom := PromptTemplate{
+		Context: "<doc id={{.PK}}>{{.Content}}</doc>",
+		Prompt:  "{{.Context}}Q: {{.Question}} ({{len .Rows}} docs)",
+	}
+	if got, err := custom.render("q", rows[:1]); err != nil || got != "<doc id=1>Paris is the capital of France.</doc>\nQ: q (1 docs)" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := (PromptTemplate{Prompt: "{{.Missing"}).render("q", nil); err == nil {
+		t.Error("expected invalid template rejected")
+	}
+}
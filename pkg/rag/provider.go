@@ -0,0 +1,263 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/httputil"
+)
+
+// EmbeddingProvider creates vector embeddings of texts with a model's API.
+type EmbeddingProvider interface {
+	// Embed returns the embeddings of input, in order.
+	Embed(ctx context.Context, input []string) ([][]float32, error)
+	// Dimensions returns the number of dimensions of the embeddings, or 0 if it's the model's default.
+	Dimensions() int
+	// Model returns the name of the model creating the embeddings.
+	Model() string
+}
+
+// Embedding providers selectable by Config.Provider.
+const (
+	ProviderOpenAI   = "openai"
+	ProviderOllama   = "ollama"
+	ProviderLMStudio = "lmstudio"
+	ProviderCohere   = "cohere"
+	ProviderVertexAI = "vertexai"
+	ProviderBedrock  = "bedrock"
+)
+
+// NewEmbeddingProvider returns the embedding provider selected by cfg.Provider, configured with cfg's
+// ModelId, ApiUrl, ApiKey, Dimensions, Region and ProjectId. The default, openai, also serves
+// OpenAI-compatible APIs, such as Ollama's and LMStudio's /v1/embeddings, at ApiUrl and EmbeddingsPath.
+func NewEmbeddingProvider(cfg Config) (EmbeddingProvider, error) {
+	switch cfg.Provider {
+	case "", ProviderOpenAI:
+		return &OpenAIEmbedder{URL: cfg.ApiUrl + cfg.EmbeddingsPath, APIKey: cfg.ApiKey, ModelID: cfg.ModelId, Dims: cfg.Dimensions}, nil
+	case ProviderLMStudio:
+		url := cmp.Or(cfg.ApiUrl, "http://127.0.0.1:1234") + cmp.Or(cfg.EmbeddingsPath, "/v1/embeddings")
+		return &OpenAIEmbedder{URL: url, APIKey: cfg.ApiKey, ModelID: cfg.ModelId, Dims: cfg.Dimensions}, nil
+	case ProviderOllama:
+		return &OllamaEmbedder{URL: cmp.Or(cfg.ApiUrl, "http://127.0.0.1:11434"), ModelID: cfg.ModelId, Dims: cfg.Dimensions}, nil
+	case ProviderCohere:
+		return &CohereEmbedder{URL: cfg.ApiUrl, APIKey: cfg.ApiKey, ModelID: cfg.ModelId, Dims: cfg.Dimensions}, nil
+	case ProviderVertexAI:
+		if cfg.ProjectId == "" || cfg.Region == "" {
+			return nil, fmt.Errorf("vertexai provider requires ProjectId and Region")
+		}
+		return &VertexAIEmbedder{Project: cfg.ProjectId, Region: cfg.Region, AccessToken: cfg.ApiKey, ModelID: cfg.ModelId, Dims: cfg.Dimensions}, nil
+	case ProviderBedrock:
+		if cfg.Region == "" {
+			return nil, fmt.Errorf("bedrock provider requires Region")
+		}
+		return &BedrockEmbedder{
+			Region:          cfg.Region,
+			ModelID:         cfg.ModelId,
+			Dims:            cfg.Dimensions,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+	}
+}
+
+// postJSON posts body as JSON to url with headers, decoding the response into out.
+func postJSON(ctx context.Context, url string, headers map[string][]string, body, out any) error {
+	config := httputil.DefaultRequestConfig(http.MethodPost, url)
+	config.Headers = headers
+	config.Timeout = 30 * time.Second
+
+	response, err := httputil.Request(ctx, config, body)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusTooManyRequests {
+			err = &RateLimitError{RetryAfter: retryAfter(response.Headers.Get("Retry-After")), Err: err}
+		}
+		return fmt.Errorf("API request failed: %w", err)
+	}
+	if err := json.Unmarshal(response.Body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// RateLimitError is returned by embedding providers when the API rate limits requests, with HTTP status 429,
+// once their retries are exhausted.
+type RateLimitError struct {
+	// RetryAfter is the delay the API asked for, or 0 if it didn't.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string { return "rate limited: " + e.Err.Error() }
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date.
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// bearer returns an Authorization header with token, or no header if it's empty.
+func bearer(token string) map[string][]string {
+	if token == "" {
+		return nil
+	}
+	return map[string][]string{"Authorization": {"Bearer " + token}}
+}
+
+// checkCount returns an error unless the API returned an embedding per input.
+func checkCount(embeddings [][]float32, input []string) error {
+	if len(embeddings) != len(input) {
+		return fmt.Errorf("got %d embeddings for %d inputs", len(embeddings), len(input))
+	}
+	return nil
+}
+
+// OpenAIEmbedder creates embeddings with OpenAI's embeddings API, or a compatible one, e.g. Ollama's or
+// LMStudio's /v1/embeddings.
+type OpenAIEmbedder struct {
+	// URL is the embeddings endpoint, e.g. https://api.openai.com/v1/embeddings.
+	URL     string
+	APIKey  string
+	ModelID string
+	Dims    int
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, input []string) ([][]float32, error) {
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := postJSON(ctx, e.URL, bearer(e.APIKey), EmbeddingRequest{Model: e.ModelID, Input: input}, &response); err != nil {
+		return nil, err
+	}
+	// the API may return embeddings in any order
+	embeddings := make([][]float32, len(response.Data))
+	for _, d := range response.Data {
+		if d.Index < 0 || d.Index >= len(embeddings) {
+			return nil, fmt.Errorf("invalid embedding index %d", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return embeddings, checkCount(embeddings, input)
+}
+
+func (e *OpenAIEmbedder) Dimensions() int { return e.Dims }
+func (e *OpenAIEmbedder) Model() string   { return e.ModelID }
+
+// OllamaEmbedder creates embeddings with Ollama's native /api/embed API.
+type OllamaEmbedder struct {
+	// URL is Ollama's base URL, e.g. http://127.0.0.1:11434.
+	URL     string
+	ModelID string
+	Dims    int
+}
+
+func (e *OllamaEmbedder) Embed(ctx context.Context, input []string) ([][]float32, error) {
+	var response struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	body := map[string]any{"model": e.ModelID, "input": input}
+	if err := postJSON(ctx, strings.TrimSuffix(e.URL, "/")+"/api/embed", nil, body, &response); err != nil {
+		return nil, err
+	}
+	return response.Embeddings, checkCount(response.Embeddings, input)
+}
+
+func (e *OllamaEmbedder) Dimensions() int { return e.Dims }
+func (e *OllamaEmbedder) Model() string   { return e.ModelID }
+
+// CohereEmbedder creates embeddings with Cohere's v2 embed API.
+type CohereEmbedder struct {
+	// URL is the embed endpoint. Defaults to https://api.cohere.com/v2/embed.
+	URL     string
+	APIKey  string
+	ModelID string
+	Dims    int
+	// InputType tells the model what the texts are used for. Defaults to search_document.
+	InputType string
+}
+
+func (e *CohereEmbedder) Embed(ctx context.Context, input []string) ([][]float32, error) {
+	var response struct {
+		Embeddings struct {
+			Float [][]float32 `json:"float"`
+		} `json:"embeddings"`
+	}
+	body := map[string]any{
+		"model":           e.ModelID,
+		"texts":           input,
+		"input_type":      cmp.Or(e.InputType, "search_document"),
+		"embedding_types": []string{"float"},
+	}
+	if e.Dims > 0 {
+		body["output_dimension"] = e.Dims
+	}
+	if err := postJSON(ctx, cmp.Or(e.URL, "https://api.cohere.com/v2/embed"), bearer(e.APIKey), body, &response); err != nil {
+		return nil, err
+	}
+	return response.Embeddings.Float, checkCount(response.Embeddings.Float, input)
+}
+
+func (e *CohereEmbedder) Dimensions() int { return e.Dims }
+func (e *CohereEmbedder) Model() string   { return e.ModelID }
+
+// VertexAIEmbedder creates embeddings with a Google model on Vertex AI, e.g. text-embedding-005.
+type VertexAIEmbedder struct {
+	Project string
+	Region  string
+	// AccessToken is an OAuth 2.0 access token, e.g. from gcloud auth print-access-token.
+	AccessToken string
+	ModelID     string
+	Dims        int
+	// URL overrides the predict endpoint of the model.
+	URL string
+}
+
+func (e *VertexAIEmbedder) Embed(ctx context.Context, input []string) ([][]float32, error) {
+	instances := make([]map[string]string, len(input))
+	for i, text := range input {
+		instances[i] = map[string]string{"content": text}
+	}
+	body := map[string]any{"instances": instances}
+	if e.Dims > 0 {
+		body["parameters"] = map[string]any{"outputDimensionality": e.Dims}
+	}
+	url := cmp.Or(e.URL, fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/%s:predict",
+		e.Region, e.Project, e.Region, e.ModelID))
+
+	var response struct {
+		Predictions []struct {
+			Embeddings struct {
+				Values []float32 `json:"values"`
+			} `json:"embeddings"`
+		} `json:"predictions"`
+	}
+	if err := postJSON(ctx, url, bearer(e.AccessToken), body, &response); err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, len(response.Predictions))
+	for i, p := range response.Predictions {
+		embeddings[i] = p.Embeddings.Values
+	}
+	return embeddings, checkCount(embeddings, input)
+}
+
+func (e *VertexAIEmbedder) Dimensions() int { return e.Dims }
+func (e *VertexAIEmbedder) Model() string   { return e.ModelID }
@@ -0,0 +1,160 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// embeddingServer serves response to requests to path, recording the last request's body and headers.
+func embeddingServer(t *testing.T, path, response string) (*httptest.Server, *map[string]any, *http.Header) {
+	t.Helper()
+	body, headers := map[string]any{}, http.Header{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != path {
+			t.Errorf("path = %s, want %s", r.URL.EscapedPath(), path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		headers = r.Header.Clone()
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &body, &headers
+}
+
+func TestEmbeddingProviders(t *testing.T) {
+	ctx := context.Background()
+	input := []string{"hello", "world"}
+	expected := [][]float32{{1, 2}, {3, 4}}
+
+	tests := []struct {
+		name     string
+		path     string
+		response string
+		embedder func(url string) EmbeddingProvider
+		check    func(t *testing.T, body map[string]any, headers http.Header)
+	}{
+		{
+			name:     "openai",
+			path:     "/v1/embeddings",
+			response: `{"data":[{"index":1,"embedding":[3,4]},{"index":0,"embedding":[1,2]}]}`,
+			embedder: func(url string) EmbeddingProvider {
+				return &OpenAIEmbedder{URL: url + "/v1/embeddings", APIKey: "secret", ModelID: "text-embedding-3-small"}
+			},
+			check: func(t *testing.T, body map[string]any, headers http.Header) {
+				if headers.Get("Authorization") != "Bearer secret" || body["model"] != "text-embedding-3-small" {
+					t.Errorf("unexpected request: %v %v", headers, body)
+				}
+			},
+		},
+		{
+			name:     "ollama",
+			path:     "/api/embed",
+			response: `{"embeddings":[[1,2],[3,4]]}`,
+			embedder: func(url string) EmbeddingProvider { return &OllamaEmbedder{URL: url, ModelID: "all-minilm"} },
+		},
+		{
+			name:     "cohere",
+			path:     "/v2/embed",
+			response: `{"embeddings":{"float":[[1,2],[3,4]]}}`,
+			embedder: func(url string) EmbeddingProvider {
+				return &CohereEmbedder{URL: url + "/v2/embed", APIKey: "secret", ModelID: "embed-v4.0", Dims: 256}
+			},
+			check: func(t *testing.T, body map[string]any, headers http.Header) {
+				if body["input_type"] != "search_document" || body["output_dimension"] != float64(256) {
+					t.Errorf("unexpected request: %v", body)
+				}
+			},
+		},
+		{
+			name:     "vertexai",
+			path:     "/predict",
+			response: `{"predictions":[{"embeddings":{"values":[1,2]}},{"embeddings":{"values":[3,4]}}]}`,
+			embedder: func(url string) EmbeddingProvider {
+				return &VertexAIEmbedder{URL: url + "/predict", AccessToken: "token", ModelID: "text-embedding-005"}
+			},
+			check: func(t *testing.T, body map[string]any, headers http.Header) {
+				instances, _ := body["instances"].([]any)
+				if len(instances) != 2 || headers.Get("Authorization") != "Bearer token" {
+					t.Errorf("unexpected request: %v %v", headers, body)
+				}
+			},
+		},
+		{
+			name:     "bedrock cohere",
+			path:     "/model/cohere.embed-english-v3/invoke",
+			response: `{"embeddings":[[1,2],[3,4]]}`,
+			embedder: func(url string) EmbeddingProvider {
+				return &BedrockEmbedder{URL: url, Region: "us-east-1", ModelID: "cohere.embed-english-v3", AccessKeyID: "AKID", SecretAccessKey: "secret"}
+			},
+			check: func(t *testing.T, body map[string]any, headers http.Header) {
+				if !strings.HasPrefix(headers.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || headers.Get("X-Amz-Date") == "" {
+					t.Errorf("unsigned request: %v", headers)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, body, headers := embeddingServer(t, tt.path, tt.response)
+			embeddings, err := tt.embedder(srv.URL).Embed(ctx, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(embeddings) != 2 || embeddings[0][0] != expected[0][0] || embeddings[1][1] != expected[1][1] {
+				t.Errorf("embeddings = %v, want %v", embeddings, expected)
+			}
+			if tt.check != nil {
+				tt.check(t, *body, *headers)
+			}
+		})
+	}
+}
+
+func TestBedrockTitanEscapesModelID(t *testing.T) {
+	srv, body, _ := embeddingServer(t, "/model/amazon.titan-embed-text-v2%3A0/invoke", `{"embedding":[1,2]}`)
+	e := &BedrockEmbedder{URL: srv.URL, Region: "us-east-1", ModelID: "amazon.titan-embed-text-v2:0", Dims: 256}
+	embeddings, err := e.Embed(context.Background(), []string{"hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embeddings) != 1 || (*body)["inputText"] != "hello" || (*body)["dimensions"] != float64(256) {
+		t.Errorf("unexpected embeddings %v of request %v", embeddings, *body)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla of the AWS Signature Version 4 test suite
+	u, _ := url.Parse("https://example.amazonaws.com/")
+	headers := map[string]string{"host": "example.amazonaws.com", "x-amz-date": "20150830T123600Z"}
+	got := signV4("GET", u, headers, nil, "us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got != want {
+		t.Errorf("signV4() = %s, want %s", got, want)
+	}
+}
+
+func TestNewEmbeddingProvider(t *testing.T) {
+	cfg := DefaultConfig()
+	p, err := NewEmbeddingProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := p.(*OpenAIEmbedder); !ok || e.URL != cfg.ApiUrl+cfg.EmbeddingsPath || p.Model() != cfg.ModelId {
+		t.Errorf("expected the default OpenAI-compatible provider, got %#v", p)
+	}
+
+	for _, provider := range []string{ProviderVertexAI, ProviderBedrock, "unknown"} {
+		if _, err := NewEmbeddingProvider(Config{Provider: provider}); err == nil {
+			t.Errorf("expected an error for %s without its settings", provider)
+		}
+	}
+	if p, err := NewEmbeddingProvider(Config{Provider: ProviderBedrock, Region: "eu-west-1", Dimensions: 512}); err != nil || p.Dimensions() != 512 {
+		t.Errorf("unexpected bedrock provider %#v: %v", p, err)
+	}
+}
@@ -0,0 +1,126 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// Reranker scores the relevance of documents to a query with a reranking model, e.g. a cross-encoder. It
+// reads the query and each document together, ranking more accurately than the distance of their
+// embeddings, but too slowly to score the whole table; Retrieve reranks its nearest candidates only.
+type Reranker interface {
+	// Rerank returns the relevance scores of documents to query, in order, higher for more relevant ones.
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// CohereReranker reranks with Cohere's v2 rerank API, or a compatible one, e.g. llama.cpp server's or
+// Jina's /v1/rerank.
+type CohereReranker struct {
+	// URL is the rerank endpoint. Defaults to https://api.cohere.com/v2/rerank.
+	URL     string
+	APIKey  string
+	ModelID string
+}
+
+func (r *CohereReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var response struct {
+		Results []struct {
+			Index          int     `json:"index"`
+			RelevanceScore float64 `json:"relevance_score"`
+		} `json:"results"`
+	}
+	body := map[string]any{"model": r.ModelID, "query": query, "documents": documents, "top_n": len(documents)}
+	if err := postJSON(ctx, cmp.Or(r.URL, "https://api.cohere.com/v2/rerank"), bearer(r.APIKey), body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Results) != len(documents) {
+		return nil, fmt.Errorf("got %d scores for %d documents", len(response.Results), len(documents))
+	}
+	scores := make([]float64, len(documents))
+	for _, result := range response.Results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("invalid document index %d", result.Index)
+		}
+		scores[result.Index] = result.RelevanceScore
+	}
+	return scores, nil
+}
+
+// OllamaReranker reranks with a local model served by Ollama's generate API, asking it to rate the relevance
+// of each document to the query from 0 to 10, e.g. with a cross-encoder reranking model or a small
+// instruction-tuned one.
+type OllamaReranker struct {
+	// URL is Ollama's address. Defaults to http://127.0.0.1:11434.
+	URL     string
+	ModelID string
+}
+
+// scorePattern matches the rating in the response of a model asked by OllamaReranker.
+var scorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+func (r *OllamaReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	scores := make([]float64, len(documents))
+	for i, document := range documents {
+		var response struct {
+			Response string `json:"response"`
+		}
+		body := GenerateRequest{Model: r.ModelID, Prompt: rerankPrompt(query, document)}
+		if err := postJSON(ctx, cmp.Or(r.URL, "http://127.0.0.1:11434")+"/api/generate", nil, body, &response); err != nil {
+			return nil, err
+		}
+		score, err := strconv.ParseFloat(scorePattern.FindString(response.Response), 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected rating %q", response.Response)
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+// rerankPrompt returns the prompt asking a model to rate the relevance of document to query.
+func rerankPrompt(query, document string) string {
+	return fmt.Sprintf("Rate how relevant the document is to the query, from 0 (irrelevant) to 10 (answers it). "+
+		"Reply with the number only.\n\nQuery: %s\n\nDocument: %s\n\nRating:", query, document)
+}
+
+// rerankCandidates returns the number of rows Retrieve ranks by distance for Config.Reranker to rerank.
+func (c *Client) rerankCandidates(limit int) int {
+	if c.Config.Reranker == nil {
+		return limit
+	}
+	return max(cmp.Or(c.Config.RerankCandidates, 4*limit), limit)
+}
+
+// rerank orders rows by the relevance Config.Reranker scores them to query, returning up to limit.
+func (c *Client) rerank(ctx context.Context, query string, rows []Embedding, limit int) ([]Embedding, error) {
+	if c.Config.Reranker == nil || len(rows) == 0 {
+		return rows, nil
+	}
+	documents := make([]string, len(rows))
+	for i, row := range rows {
+		documents[i] = row.Content
+	}
+	scores, err := c.Config.Reranker.Rerank(ctx, query, documents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank: %w", err)
+	}
+	if len(scores) != len(rows) {
+		return nil, fmt.Errorf("failed to rerank: got %d scores for %d rows", len(scores), len(rows))
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	// stable, so rows scored equally stay ordered by distance
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(scores[b], scores[a]) })
+	reranked := make([]Embedding, 0, min(limit, len(rows)))
+	for _, i := range order[:min(limit, len(rows))] {
+		reranked = append(reranked, rows[i])
+	}
+	return reranked, nil
+}
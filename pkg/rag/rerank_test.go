@@ -0,0 +1,72 @@
+package rag
+
+import (
+	"context"
+	"testing"
+)
+
+// lengthReranker scores documents by their length.
+type lengthReranker struct{}
+
+func (lengthReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	scores := make([]float64, len(documents))
+	for i, document := range documents {
+		scores[i] = float64(len(document))
+	}
+	return scores, nil
+}
+
+func TestRerank(t *testing.T) {
+	c := &Client{Config: Config{Reranker: lengthReranker{}}}
+	if got := c.rerankCandidates(5); got != 20 {
+		t.Errorf("rerankCandidates() = %d, want 20", got)
+	}
+
+	rows := []Embedding{{PK: 1, Content: "ab"}, {PK: 2, Content: "abcd"}, {PK: 3, Content: "a"}, {PK: 4, Content: "cd"}}
+	reranked, err := c.rerank(context.Background(), "q", rows, 3)
+	if err != nil {
+		t.Fatalf("rerank() error = %v", err)
+	}
+	var pks []any
+	for _, row := range reranked {
+		pks = append(pks, row.PK)
+	}
+	if len(pks) != 3 || pks[0] != 2 || pks[1] != 1 || pks[2] != 4 {
+		t.Errorf("rerank() = %v, want [2 1 4]", pks)
+	}
+
+	c.Config.Reranker = nil
+	if got := c.rerankCandidates(5); got != 5 {
+		t.Errorf("rerankCandidates() without reranker = %d, want 5", got)
+	}
+}
+
+func TestCohereReranker(t *testing.T) {
+	server, body, headers := embeddingServer(t, "/v2/rerank",
+		`{"results":[{"index":1,"relevance_score":0.9},{"index":0,"relevance_score":0.1}]}`)
+
+	r := &CohereReranker{URL: server.URL + "/v2/rerank", APIKey: "secret", ModelID: "rerank-v3.5"}
+	scores, err := r.Rerank(context.Background(), "q", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Rerank() error = %v", err)
+	}
+	if len(scores) != 2 || scores[0] != 0.1 || scores[1] != 0.9 {
+		t.Errorf("Rerank() = %v, want [0.1 0.9]", scores)
+	}
+	if (*body)["query"] != "q" || headers.Get("Authorization") != "Bearer secret" {
+		t.Errorf("unexpected request %v %v", *body, *headers)
+	}
+}
+
+func TestOllamaReranker(t *testing.T) {
+	server, body, _ := embeddingServer(t, "/api/generate", `{"response":" Rating: 7.5"}`)
+
+	r := &OllamaReranker{URL: server.URL, ModelID: "qwen3-reranker"}
+	scores, err := r.Rerank(context.Background(), "q", []string{"a"})
+	if err != nil {
+		t.Fatalf("Rerank() error = %v", err)
+	}
+	if len(scores) != 1 || scores[0] != 7.5 || (*body)["stream"] != false {
+		t.Errorf("Rerank() = %v, request %v", scores, *body)
+	}
+}
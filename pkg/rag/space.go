@@ -0,0 +1,118 @@
+package rag
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+)
+
+// defaultEmbeddingColumn is the embedding column of tables, unless Config.EmbeddingColumn is set.
+const defaultEmbeddingColumn = "embedding"
+
+// columnNamePattern matches column names usable in queries unquoted.
+var columnNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// EmbeddingSpace is an embedding column of the table, with the model embedding it, besides the default one,
+// e.g. to A/B test providers or to embed the content with a multilingual model too. Fields left zero are
+// inherited from the Config declaring the space.
+type EmbeddingSpace struct {
+	// Name selects the space with Client.Space.
+	Name string
+	// Column defaults to embedding_<Name>.
+	Column     string
+	Provider   string
+	ModelId    string
+	ApiUrl     string
+	ApiKey     string
+	Dimensions int
+	VectorType string
+	Distance   Distance
+	// Embedder, if set, creates the space's embeddings instead of the provider selected by Provider.
+	Embedder EmbeddingProvider
+}
+
+// Space returns a client of the embedding space of the name, sharing c's connection. Its methods, e.g.
+// CreateEmbedding, Retrieve and CreateIndex, use the space's column and model instead of the default ones.
+// Chunks of a space are stored in a chunk table of its own, <ChunkTableName>_<Name>. Spaces are selected of
+// the client declaring them only.
+func (c *Client) Space(name string) (*Client, error) {
+	for _, space := range c.Config.Spaces {
+		if space.Name != name {
+			continue
+		}
+		config := spaceConfig(c.Config, space)
+		embedder := config.Embedder
+		if embedder == nil {
+			var err error
+			if embedder, err = NewEmbeddingProvider(config); err != nil {
+				return nil, fmt.Errorf("failed to create embedding provider of space %q: %w", name, err)
+			}
+		}
+		space := *c
+		space.Config, space.embedder, space.columns = config, embedder, c.embeddingColumns()
+		return &space, nil
+	}
+	return nil, fmt.Errorf("unknown embedding space %q", name)
+}
+
+// spaceConfig returns the Config of space, declared in cfg.
+func spaceConfig(cfg Config, space EmbeddingSpace) Config {
+	cfg.EmbeddingColumn = cmp.Or(space.Column, defaultEmbeddingColumn+"_"+space.Name)
+	cfg.ChunkTableName = cmp.Or(cfg.ChunkTableName, cfg.TableName+"_chunks") + "_" + space.Name
+	cfg.Provider = cmp.Or(space.Provider, cfg.Provider)
+	cfg.ModelId = cmp.Or(space.ModelId, cfg.ModelId)
+	cfg.ApiUrl = cmp.Or(space.ApiUrl, cfg.ApiUrl)
+	cfg.ApiKey = cmp.Or(space.ApiKey, cfg.ApiKey)
+	cfg.Dimensions = cmp.Or(space.Dimensions, cfg.Dimensions)
+	cfg.VectorType = cmp.Or(space.VectorType, cfg.VectorType)
+	cfg.Distance = cmp.Or(space.Distance, cfg.Distance)
+	cfg.Spaces = nil
+	// the declaring Config's Embedder is inherited unless the space selects a model of its own
+	if space.Embedder != nil || space.Provider != "" || space.ModelId != "" || space.ApiUrl != "" {
+		cfg.Embedder = space.Embedder
+	}
+	return cfg
+}
+
+// validateSpaces returns an error if the embedding columns or spaces of cfg are invalid.
+func validateSpaces(cfg Config) error {
+	column := cmp.Or(cfg.EmbeddingColumn, defaultEmbeddingColumn)
+	if !columnNamePattern.MatchString(column) {
+		return fmt.Errorf("invalid embedding column %q", column)
+	}
+	columns := map[string]bool{column: true}
+	for _, space := range cfg.Spaces {
+		if space.Name == "" {
+			return fmt.Errorf("embedding spaces require a Name")
+		}
+		spaceCfg := spaceConfig(cfg, space)
+		if !columnNamePattern.MatchString(spaceCfg.EmbeddingColumn) {
+			return fmt.Errorf("invalid embedding column %q of space %q", spaceCfg.EmbeddingColumn, space.Name)
+		}
+		if columns[spaceCfg.EmbeddingColumn] {
+			return fmt.Errorf("embedding column %q of space %q is used by another space", spaceCfg.EmbeddingColumn, space.Name)
+		}
+		columns[spaceCfg.EmbeddingColumn] = true
+		if err := validateVectorType(spaceCfg); err != nil {
+			return fmt.Errorf("invalid space %q: %w", space.Name, err)
+		}
+	}
+	return nil
+}
+
+// embeddingColumn returns the name of the embedding column, validated as usable unquoted.
+func (c *Client) embeddingColumn() string {
+	return cmp.Or(c.Config.EmbeddingColumn, defaultEmbeddingColumn)
+}
+
+// embeddingColumns returns the names of the embedding columns of all spaces, including the default one.
+func (c *Client) embeddingColumns() []string {
+	if c.columns != nil {
+		return c.columns // of the client the space was selected of
+	}
+	columns := []string{cmp.Or(c.Config.EmbeddingColumn, defaultEmbeddingColumn)}
+	for _, space := range c.Config.Spaces {
+		columns = append(columns, cmp.Or(space.Column, defaultEmbeddingColumn+"_"+space.Name))
+	}
+	return columns
+}
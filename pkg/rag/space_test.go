@@ -0,0 +1,68 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSpace(t *testing.T) {
+	fake := &fakeEmbedder{}
+	c := &Client{Config: Config{
+		TableName:  "docs",
+		Dimensions: 1536,
+		Embedder:   fake,
+		Spaces: []EmbeddingSpace{
+			{Name: "minilm", Provider: ProviderOllama, ModelId: "all-minilm", Dimensions: 384, VectorType: VectorTypeHalfvec},
+			{Name: "b", Column: "embedding_ab"},
+		},
+	}}
+
+	minilm, err := c.Space("minilm")
+	if err != nil {
+		t.Fatalf("Space() error = %v", err)
+	}
+	if minilm.distanceSQL() != "embedding_minilm <=> $1::halfvec" || minilm.columnType() != "halfvec(384)" {
+		t.Errorf("unexpected column %s %s", minilm.distanceSQL(), minilm.columnType())
+	}
+	if minilm.chunkTableIdentifier() != `"public"."docs_chunks_minilm"` {
+		t.Errorf("unexpected chunk table %s", minilm.chunkTableIdentifier())
+	}
+	if e, ok := minilm.embedder.(*OllamaEmbedder); !ok || e.ModelID != "all-minilm" {
+		t.Errorf("unexpected embedder %#v", minilm.embedder)
+	}
+	if want := []string{"embedding", "embedding_minilm", "embedding_ab"}; !slices.Equal(minilm.embeddingColumns(), want) {
+		t.Errorf("embeddingColumns() = %v, want %v", minilm.embeddingColumns(), want)
+	}
+
+	b, err := c.Space("b")
+	if err != nil {
+		t.Fatalf("Space() error = %v", err)
+	}
+	if b.embedder != fake || b.embeddingColumn() != "embedding_ab" || b.Config.Dimensions != 1536 {
+		t.Errorf("expected space b to inherit the embedder and dimensions, got %+v", b.Config)
+	}
+	if c.embeddingColumn() != "embedding" {
+		t.Errorf("selecting a space changed the client's column to %s", c.embeddingColumn())
+	}
+	if _, err := c.Space("unknown"); err == nil {
+		t.Error("expected unknown space rejected")
+	}
+}
+
+func TestValidateSpaces(t *testing.T) {
+	valid := Config{Spaces: []EmbeddingSpace{{Name: "openai"}, {Name: "minilm", Column: "minilm"}}}
+	if err := validateSpaces(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, cfg := range []Config{
+		{EmbeddingColumn: `embedding"; DROP TABLE docs; --`},
+		{Spaces: []EmbeddingSpace{{}}},
+		{Spaces: []EmbeddingSpace{{Name: "a", Column: "embedding"}}},
+		{Spaces: []EmbeddingSpace{{Name: "a", Column: "x"}, {Name: "b", Column: "x"}}},
+		{Spaces: []EmbeddingSpace{{Name: "a", VectorType: "bit"}}},
+	} {
+		if err := validateSpaces(cfg); err == nil {
+			t.Errorf("expected %+v rejected", cfg)
+		}
+	}
+}
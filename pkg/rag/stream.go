@@ -0,0 +1,216 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Token is a piece of a streamed generation. Err is set on the stream's last token if it failed.
+type Token struct {
+	Text string `json:"text"`
+	Err  error  `json:"-"`
+}
+
+// GenerateStream sends a streaming generation request to the API, returning the generated text as it's
+// produced, so chat UIs don't wait for the complete response. The channel is closed when the generation is
+// done, fails, or ctx is done.
+//
+// GeneratePath selects the API shape: OpenAI's /v1/chat/completions and /v1/completions stream server-sent
+// events; other paths, e.g. Ollama's /api/generate and /api/chat, stream newline-delimited JSON.
+func (c *Client) GenerateStream(ctx context.Context, prompt string) (<-chan Token, error) {
+	body, err := json.Marshal(c.streamRequest(prompt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request data: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Config.ApiUrl+c.Config.GeneratePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Config.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Config.ApiKey)
+	}
+
+	// no client timeout, as streams last as long as the generation; ctx bounds it
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		err := fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, msg)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			err = &RateLimitError{RetryAfter: retryAfter(resp.Header.Get("Retry-After")), Err: err}
+		}
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+
+	tokens := make(chan Token)
+	go func() {
+		defer close(tokens)
+		defer resp.Body.Close()
+		err := readStream(resp.Body, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream"), func(text string) bool {
+			select {
+			case tokens <- Token{Text: text}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			select {
+			case tokens <- Token{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return tokens, nil
+}
+
+// GenerateWithRetrievalStream performs retrieval-augmented generation as GenerateWithRetrieval does,
+// streaming the response as GenerateStream does.
+func (c *Client) GenerateWithRetrievalStream(ctx context.Context, prompt string, retrievalLimit int, retrievalInput ...string) (<-chan Token, error) {
+	query := prompt
+	if len(retrievalInput) > 0 && retrievalInput[0] != "" {
+		query = retrievalInput[0]
+	}
+	relevantInfo, err := c.Retrieve(ctx, query, retrievalLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve relevant information: %w", err)
+	}
+	augmentedPrompt, err := c.augmentedPrompt(prompt, relevantInfo)
+	if err != nil {
+		return nil, err
+	}
+	return c.GenerateStream(ctx, augmentedPrompt)
+}
+
+// streamRequest returns the body of a streaming request of prompt for the API shape of GeneratePath.
+func (c *Client) streamRequest(prompt string) any {
+	switch path := c.Config.GeneratePath; {
+	case strings.HasSuffix(path, "/chat/completions"), strings.HasSuffix(path, "/api/chat"):
+		return map[string]any{
+			"model":    c.Config.ModelId,
+			"messages": []map[string]string{{"role": "user", "content": prompt}},
+			"stream":   true,
+		}
+	case strings.HasSuffix(path, "/completions"):
+		return map[string]any{"model": c.Config.ModelId, "prompt": prompt, "stream": true}
+	default:
+		return GenerateRequest{Model: c.Config.ModelId, Prompt: prompt, Stream: true}
+	}
+}
+
+// streamChunk is a chunk of the streaming APIs GenerateStream supports.
+type streamChunk struct {
+	// Ollama's /api/generate and /api/chat
+	Response string `json:"response"`
+	Message  struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Error string `json:"error"`
+	// OpenAI's /v1/chat/completions and /v1/completions
+	Choices []struct {
+		Text  string `json:"text"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+func (s streamChunk) text() string {
+	var sb strings.Builder
+	sb.WriteString(s.Response)
+	sb.WriteString(s.Message.Content)
+	for _, choice := range s.Choices {
+		sb.WriteString(choice.Text)
+		sb.WriteString(choice.Delta.Content)
+	}
+	return sb.String()
+}
+
+// readStream reads the chunks of a streaming response, server-sent events if sse and newline-delimited
+// JSON otherwise, calling emit with their text until it returns false.
+func readStream(r io.Reader, sse bool, emit func(string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if sse {
+			data, ok := bytes.CutPrefix(line, []byte("data:"))
+			if !ok {
+				continue // comments, event names and blank lines between events
+			}
+			line = bytes.TrimSpace(data)
+			if string(line) == "[DONE]" {
+				return nil
+			}
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("generation failed: %s", chunk.Error)
+		}
+		if text := chunk.text(); text != "" && !emit(text) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// WriteSSE writes tokens to w as server-sent events until the channel is closed, e.g. of GenerateStream in
+// a chat UI's handler. Each token is a message event with data {"text": "..."}; a failed stream ends with an
+// error event with data {"error": "..."}, and a complete one with a done event.
+func WriteSSE(w http.ResponseWriter, tokens <-chan Token) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming unsupported by the response writer")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering, e.g. of nginx
+	w.WriteHeader(http.StatusOK)
+
+	for token := range tokens {
+		event, data := "message", any(token)
+		if token.Err != nil {
+			event, data = "error", map[string]string{"error": token.Err.Error()}
+		}
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal token: %w", err)
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return err
+		}
+		flusher.Flush()
+		if token.Err != nil {
+			return token.Err
+		}
+	}
+	if _, err := io.WriteString(w, "event: done\ndata: {}\n\n"); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,120 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func collect(t *testing.T, tokens <-chan Token) (string, error) {
+	t.Helper()
+	var sb strings.Builder
+	for token := range tokens {
+		if token.Err != nil {
+			return sb.String(), token.Err
+		}
+		sb.WriteString(token.Text)
+	}
+	return sb.String(), nil
+}
+
+func TestGenerateStream(t *testing.T) {
+	tests := []struct {
+		name, path, contentType, body string
+		check                         func(t *testing.T, req map[string]any)
+	}{
+		{
+			name:        "ollama",
+			path:        "/api/generate",
+			contentType: "application/x-ndjson",
+			body:        `{"response":"Hello","done":false}` + "\n" + `{"response":", world","done":false}` + "\n" + `{"response":"","done":true}` + "\n",
+			check: func(t *testing.T, req map[string]any) {
+				if req["prompt"] != "hi" || req["stream"] != true {
+					t.Errorf("unexpected request %v", req)
+				}
+			},
+		},
+		{
+			name:        "openai chat",
+			path:        "/v1/chat/completions",
+			contentType: "text/event-stream",
+			body: ": keep-alive\n\n" +
+				`data: {"choices":[{"delta":{"role":"assistant"}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{"content":"Hello"}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{"content":", world"}}]}` + "\n\n" +
+				"data: [DONE]\n\n",
+			check: func(t *testing.T, req map[string]any) {
+				if messages, _ := req["messages"].([]any); len(messages) != 1 || req["stream"] != true {
+					t.Errorf("unexpected request %v", req)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&req)
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := &Client{Config: Config{ApiUrl: srv.URL, GeneratePath: tt.path, ModelId: "m"}}
+			tokens, err := c.GenerateStream(context.Background(), "hi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, err := collect(t, tokens)
+			if err != nil || text != "Hello, world" {
+				t.Errorf("got %q, %v", text, err)
+			}
+			tt.check(t, req)
+		})
+	}
+}
+
+func TestGenerateStreamErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/limited" {
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"response":"Hel"}` + "\n" + `{"error":"model crashed"}` + "\n"))
+	}))
+	defer srv.Close()
+
+	c := &Client{Config: Config{ApiUrl: srv.URL, GeneratePath: "/limited"}}
+	if _, err := c.GenerateStream(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("expected a rate limit error, got %v", err)
+	}
+
+	c.Config.GeneratePath = "/api/generate"
+	tokens, err := c.GenerateStream(context.Background(), "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := collect(t, tokens); text != "Hel" || err == nil || !strings.Contains(err.Error(), "model crashed") {
+		t.Errorf("got %q, %v", text, err)
+	}
+}
+
+func TestWriteSSE(t *testing.T) {
+	tokens := make(chan Token, 2)
+	tokens <- Token{Text: "line\nbreak"}
+	tokens <- Token{Text: "!"}
+	close(tokens)
+
+	rec := httptest.NewRecorder()
+	if err := WriteSSE(rec, tokens); err != nil {
+		t.Fatal(err)
+	}
+	expected := "event: message\ndata: {\"text\":\"line\\nbreak\"}\n\nevent: message\ndata: {\"text\":\"!\"}\n\nevent: done\ndata: {}\n\n"
+	if rec.Body.String() != expected || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package rag
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// pgvector column types of embeddings, selected by Config.VectorType.
+const (
+	// VectorTypeVector stores 4-byte floats, up to 2000 dimensions indexed.
+	VectorTypeVector = "vector"
+	// VectorTypeHalfvec stores 2-byte floats, halving storage, up to 4000 dimensions indexed, with little
+	// loss of recall.
+	VectorTypeHalfvec = "halfvec"
+	// VectorTypeSparsevec stores non-zero elements only, e.g. of sparse embeddings like SPLADE's, up to 1000
+	// of them indexed.
+	VectorTypeSparsevec = "sparsevec"
+)
+
+// defaultOversampling is the number of candidates per row retrieved by Hamming distance of binary quantized
+// embeddings, reranked by their full embeddings.
+const defaultOversampling = 4
+
+// validateVectorType returns an error if the vector type, quantization or distance of cfg is unsupported.
+func validateVectorType(cfg Config) error {
+	if _, ok := distanceOperators[cmp.Or(cfg.Distance, DistanceCosine)]; !ok {
+		return fmt.Errorf("unknown distance %q", cfg.Distance)
+	}
+	switch cmp.Or(cfg.VectorType, VectorTypeVector) {
+	case VectorTypeVector, VectorTypeHalfvec:
+	case VectorTypeSparsevec:
+		if cfg.BinaryQuantization {
+			return fmt.Errorf("binary quantization doesn't support %s columns", VectorTypeSparsevec)
+		}
+	default:
+		return fmt.Errorf("unknown vector type %q", cfg.VectorType)
+	}
+	return nil
+}
+
+// vectorType returns the pgvector type of the embedding column.
+func (c *Client) vectorType() string {
+	return cmp.Or(c.Config.VectorType, VectorTypeVector)
+}
+
+// columnType returns the type of the embedding column, with its dimensions.
+func (c *Client) columnType() string {
+	return fmt.Sprintf("%s(%d)", c.vectorType(), c.Config.Dimensions)
+}
+
+// vectorParam returns e as a query parameter of the embedding column's type.
+func (c *Client) vectorParam(e []float32) any {
+	switch c.vectorType() {
+	case VectorTypeHalfvec:
+		return pgvector.NewHalfVector(e)
+	case VectorTypeSparsevec:
+		return pgvector.NewSparseVector(e)
+	default:
+		return pgvector.NewVector(e)
+	}
+}
+
+// embeddingSelect returns the select list item of the embedding column, cast to vector, as Embedding holds.
+func (c *Client) embeddingSelect() string {
+	if c.vectorType() == VectorTypeVector {
+		return c.embeddingColumn()
+	}
+	return c.embeddingColumn() + "::vector AS " + c.embeddingColumn()
+}
+
+// distanceSQL returns the distance, by Config.Distance, of the embedding column to the embedding of
+// parameter $1.
+func (c *Client) distanceSQL() string {
+	return fmt.Sprintf("%s %s $1::%s", c.embeddingColumn(), distanceOperators[c.distance()], c.vectorType())
+}
+
+// nearestSQL returns a query selecting columns of the rows of table matching where, nearest to the embedding
+// of parameter $1, up to parameter $2.
+//
+// With binary quantization, candidates are retrieved by the Hamming distance of their binary quantized
+// embeddings, using the index CreateIndex creates, and reranked by the distance of their full embeddings.
+func (c *Client) nearestSQL(columns, table, where string) string {
+	if !c.Config.BinaryQuantization {
+		return fmt.Sprintf("SELECT %s FROM %s WHERE true%s ORDER BY %s LIMIT $2", columns, table, where, c.distanceSQL())
+	}
+	return fmt.Sprintf(`SELECT %[1]s FROM (
+		SELECT * FROM %[2]s WHERE true%[3]s ORDER BY %[4]s <~> binary_quantize($1::%[5]s) LIMIT $2 * %[6]d
+	) candidates ORDER BY %[7]s LIMIT $2`,
+		columns, table, where, c.quantizedSQL(), c.vectorType(),
+		cmp.Or(c.Config.QuantizationOversampling, defaultOversampling), c.distanceSQL())
+}
+
+// quantizedSQL returns the binary quantized embedding column, as indexed.
+func (c *Client) quantizedSQL() string {
+	return fmt.Sprintf("(binary_quantize(%s)::bit(%d))", c.embeddingColumn(), c.Config.Dimensions)
+}
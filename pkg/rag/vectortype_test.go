@@ -0,0 +1,40 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+func TestNearestSQL(t *testing.T) {
+	c := &Client{Config: Config{Dimensions: 3}}
+	if got, expected := c.nearestSQL("id", "docs", " AND a = $3"), "SELECT id FROM docs WHERE true AND a = $3 ORDER BY embedding <=> $1::vector LIMIT $2"; got != expected {
+		t.Errorf("got %s, want %s", got, expected)
+	}
+
+	c.Config.VectorType, c.Config.BinaryQuantization = VectorTypeHalfvec, true
+	got := strings.Join(strings.Fields(c.nearestSQL("id, "+c.embeddingSelect(), "docs", "")), " ")
+	expected := "SELECT id, embedding::vector AS embedding FROM ( SELECT * FROM docs WHERE true" +
+		" ORDER BY (binary_quantize(embedding)::bit(3)) <~> binary_quantize($1::halfvec) LIMIT $2 * 4" +
+		" ) candidates ORDER BY embedding <=> $1::halfvec LIMIT $2"
+	if got != expected {
+		t.Errorf("got %s, want %s", got, expected)
+	}
+	if _, ok := c.vectorParam([]float32{1, 2, 3}).(pgvector.HalfVector); !ok || c.columnType() != "halfvec(3)" {
+		t.Errorf("expected halfvec parameters and columns")
+	}
+}
+
+func TestValidateVectorType(t *testing.T) {
+	for _, cfg := range []Config{{}, {VectorType: VectorTypeHalfvec, BinaryQuantization: true}, {VectorType: VectorTypeSparsevec}} {
+		if err := validateVectorType(cfg); err != nil {
+			t.Errorf("unexpected error for %+v: %v", cfg, err)
+		}
+	}
+	for _, cfg := range []Config{{VectorType: "bit"}, {VectorType: VectorTypeSparsevec, BinaryQuantization: true}} {
+		if err := validateVectorType(cfg); err == nil {
+			t.Errorf("expected %+v rejected", cfg)
+		}
+	}
+}
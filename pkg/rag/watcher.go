@@ -0,0 +1,188 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/edgeflare/pgo/pkg/pglogrepl"
+	"go.uber.org/zap"
+)
+
+// WatcherConfig configures a Watcher.
+type WatcherConfig struct {
+	// ContentColumns are the columns embedded, formatted as col1:value1,col2:value2 into the content column.
+	// If empty, the content column itself is embedded.
+	ContentColumns []string
+	// FlushInterval is how long changed rows are collected before they're embedded, unless BatchSize rows
+	// are collected first. Defaults to 1 second.
+	FlushInterval time.Duration
+}
+
+// Watcher re-embeds rows of the client's table when their content changes, from change events of the
+// table, e.g. of pglogrepl.Start, so the embedding column stays consistent without re-embedding the whole
+// table periodically.
+//
+// Rows are re-embedded when they're inserted, and updated if their content changes. Changes are detected
+// comparing the old and new rows of tables with REPLICA IDENTITY FULL, and otherwise the content of updated
+// rows with the one last embedded, so the watcher's own writes, and updates of other columns, are ignored.
+// Content columns of updates that are NULL, as unchanged TOASTed values are, are considered unchanged.
+type Watcher struct {
+	client *Client
+	config WatcherConfig
+	schema string
+	table  string
+	// embedded holds hashes of the content last embedded per primary key, by fmt.Sprint(pk)
+	embedded map[string][sha256.Size]byte
+	// pending holds rows to embed, by fmt.Sprint(pk)
+	pending map[string]Embedding
+}
+
+// NewWatcher returns a Watcher re-embedding rows of client's table.
+func NewWatcher(client *Client, config WatcherConfig) *Watcher {
+	schema, table := splitSchemaTableName(client.Config.TableName)
+	return &Watcher{
+		client:   client,
+		config:   config,
+		schema:   schema,
+		table:    table,
+		embedded: make(map[string][sha256.Size]byte),
+		pending:  make(map[string]Embedding),
+	}
+}
+
+// Run re-embeds rows changed by events until ctx is done or events is closed, embedding the rows collected
+// by then. Failed embeddings are logged and retried at the next flush.
+func (w *Watcher) Run(ctx context.Context, events <-chan pglogrepl.CDC) error {
+	pkType, err := w.client.primaryKeyType(ctx)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(cmp.Or(w.config.FlushInterval, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// embed what's collected, unless ctx is canceled mid-flush
+			w.flush(context.WithoutCancel(ctx), pkType)
+			return ctx.Err()
+		case <-ticker.C:
+			w.flush(ctx, pkType)
+		case event, ok := <-events:
+			if !ok {
+				w.flush(ctx, pkType)
+				return nil
+			}
+			w.handle(event)
+			if len(w.pending) >= w.client.batchSize()*w.client.concurrency() {
+				w.flush(ctx, pkType)
+			}
+		}
+	}
+}
+
+// handle collects the row of event if its content changed.
+func (w *Watcher) handle(event pglogrepl.CDC) {
+	src := event.Payload.Source
+	if src.Table != w.table || src.Schema != w.schema {
+		return
+	}
+	op := event.Payload.Op
+	if op != "c" && op != "r" && op != "u" {
+		return
+	}
+	after, _ := event.Payload.After.(map[string]interface{})
+	pk, ok := after[w.client.Config.TablePrimaryKeyCol]
+	if !ok || pk == nil {
+		return
+	}
+	content, ok := w.content(after)
+	if !ok {
+		return
+	}
+
+	key := fmt.Sprint(pk)
+	if op == "u" {
+		before, _ := event.Payload.Before.(map[string]interface{})
+		if len(before) > 0 && !w.contentChanged(before, after) {
+			return
+		}
+		if w.embedded[key] == sha256.Sum256([]byte(content)) {
+			return
+		}
+		if len(w.config.ContentColumns) > 0 && after["content"] == content {
+			// embedded before the watcher started
+			return
+		}
+	}
+	w.pending[key] = Embedding{PK: pk, Content: content}
+}
+
+// content returns the content embedded of row, or false if a content column is NULL.
+func (w *Watcher) content(row map[string]interface{}) (string, bool) {
+	if len(w.config.ContentColumns) == 0 {
+		content, ok := row["content"].(string)
+		return content, ok
+	}
+	pairs := make([]string, len(w.config.ContentColumns))
+	for i, col := range w.config.ContentColumns {
+		value := row[col]
+		if value == nil {
+			return "", false
+		}
+		pairs[i] = fmt.Sprintf("%s:%v", col, value)
+	}
+	return strings.Join(pairs, ","), true
+}
+
+// contentChanged reports whether content columns differ between the old and new row.
+func (w *Watcher) contentChanged(before, after map[string]interface{}) bool {
+	columns := w.config.ContentColumns
+	if len(columns) == 0 {
+		columns = []string{"content"}
+	}
+	for _, col := range columns {
+		if !reflect.DeepEqual(before[col], after[col]) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush embeds the collected rows.
+func (w *Watcher) flush(ctx context.Context, pkType string) {
+	if len(w.pending) == 0 {
+		return
+	}
+	rows := make([]Embedding, 0, len(w.pending))
+	contents := make([]string, 0, len(w.pending))
+	for _, row := range w.pending {
+		rows = append(rows, row)
+		contents = append(contents, row.Content)
+	}
+
+	embeddings, err := w.client.embedBatches(ctx, contents)
+	if err != nil {
+		w.client.logger.Error("Failed to re-embed changed rows", zap.Int("rows", len(rows)), zap.Error(err))
+		return
+	}
+	batchSize := w.client.batchSize()
+	for i := 0; i < len(rows); i += batchSize {
+		end := min(i+batchSize, len(rows))
+		if err := w.client.updateEmbeddings(ctx, pkType, rows[i:end], embeddings[i:end]); err != nil {
+			w.client.logger.Error("Failed to update re-embedded rows", zap.Int("rows", end-i), zap.Error(err))
+			return
+		}
+		for _, row := range rows[i:end] {
+			key := fmt.Sprint(row.PK)
+			w.embedded[key] = sha256.Sum256([]byte(row.Content))
+			delete(w.pending, key)
+		}
+	}
+	w.client.logger.Debug("Re-embedded changed rows", zap.Int("rows", len(rows)))
+}
@@ -0,0 +1,51 @@
+package rag
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/edgeflare/pgo/pkg/pglogrepl"
+)
+
+func cdcEvent(table, op string, before, after map[string]interface{}) pglogrepl.CDC {
+	var event pglogrepl.CDC
+	event.Payload.Source.Schema, event.Payload.Source.Table = "public", table
+	event.Payload.Op = op
+	event.Payload.Before, event.Payload.After = before, after
+	return event
+}
+
+func TestWatcherHandle(t *testing.T) {
+	c := &Client{Config: Config{TableName: "docs", TablePrimaryKeyCol: "id"}}
+	w := NewWatcher(c, WatcherConfig{ContentColumns: []string{"title", "body"}})
+
+	w.handle(cdcEvent("docs", "c", nil, map[string]interface{}{"id": int64(1), "title": "a", "body": "b"}))
+	if row, ok := w.pending["1"]; !ok || row.Content != "title:a,body:b" {
+		t.Fatalf("expected the inserted row collected, got %+v", w.pending)
+	}
+
+	w.pending = map[string]Embedding{}
+	w.embedded["1"] = sha256.Sum256([]byte("title:a,body:b"))
+	for _, event := range []pglogrepl.CDC{
+		// the watcher's own write, or an update of another column
+		cdcEvent("docs", "u", map[string]interface{}{}, map[string]interface{}{"id": int64(1), "title": "a", "body": "b", "views": 2}),
+		// embedded before the watcher started
+		cdcEvent("docs", "u", map[string]interface{}{}, map[string]interface{}{"id": int64(2), "title": "x", "body": "y", "content": "title:x,body:y"}),
+		// unchanged content columns of REPLICA IDENTITY FULL
+		cdcEvent("docs", "u", map[string]interface{}{"id": int64(3), "title": "t", "body": "b"}, map[string]interface{}{"id": int64(3), "title": "t", "body": "b"}),
+		// an unchanged TOASTed column
+		cdcEvent("docs", "u", map[string]interface{}{}, map[string]interface{}{"id": int64(4), "title": "t", "body": nil}),
+		cdcEvent("other", "c", nil, map[string]interface{}{"id": int64(5), "title": "a", "body": "b"}),
+		cdcEvent("docs", "d", map[string]interface{}{"id": int64(6)}, nil),
+	} {
+		w.handle(event)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("expected no rows collected, got %+v", w.pending)
+	}
+
+	w.handle(cdcEvent("docs", "u", map[string]interface{}{}, map[string]interface{}{"id": int64(1), "title": "new", "body": "b"}))
+	if row, ok := w.pending["1"]; !ok || row.Content != "title:new,body:b" {
+		t.Errorf("expected the updated row collected, got %+v", w.pending)
+	}
+}